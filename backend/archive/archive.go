@@ -0,0 +1,369 @@
+// Package archive writes the race data to a versioned zip archive for use
+// offline, and restores it into an empty database.
+//
+// An archive holds:
+//
+//   - manifest.json: the format version of the archive, the schema migration
+//     version of the database it was written from, and the size and SHA-256
+//     checksum of every other file
+//   - races.csv, stages.csv, riders.csv, teams.csv, team_names.csv and
+//     results.csv: the race data tables, with a header row, enums written as their database labels,
+//     times as Go duration strings, e.g. 4h32m10s, and nulls as empty fields,
+//     e.g. the rank of a rider who did not finish
+//   - tracks/ID.gpx: every track with its points, as a GPX file
+//   - tracks/ID.geojson: every track as a GeoJSON feature, with a line per
+//     segment of the track
+package archive
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// FormatVersion is the version of the archive layout, increased whenever it
+// changes in a way older readers cannot read. Version 2 added the names of
+// the teams by year.
+const FormatVersion = 2
+
+// Names of the files of an archive
+const (
+	manifestFile  = "manifest.json"
+	racesFile     = "races.csv"
+	stagesFile    = "stages.csv"
+	ridersFile    = "riders.csv"
+	teamsFile     = "teams.csv"
+	teamNamesFile = "team_names.csv"
+	resultsFile   = "results.csv"
+	tracksDir     = "tracks/"
+)
+
+// Manifest struct, the contents of an archive
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	SchemaVersion string    `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Files         []File    `json:"files"`
+}
+
+// File struct, a file of an archive
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Dataset struct, the race data tables of an archive. Tracks are kept apart
+// as they are too large to hold in memory at once.
+type Dataset struct {
+	Races     []db.RaceInput
+	Stages    []db.StageInput
+	Riders    []db.RiderInput
+	Teams     []db.TeamInput
+	TeamNames []db.TeamName
+	Results   []db.ResultInput
+}
+
+// table describes how the rows of a data table are written to and read from
+// CSV records.
+type table[T any] struct {
+	file   string
+	header []string
+	encode func(T) ([]string, error)
+	decode func(*recordReader) T
+}
+
+func writeTable[T any](w io.Writer, t table[T], rows []T) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record, err := t.encode(row)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func readTable[T any](r io.Reader, t table[T]) ([]T, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(t.header)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.file, err)
+	}
+	if strings.Join(header, ",") != strings.Join(t.header, ",") {
+		return nil, fmt.Errorf(
+			"%s: expected columns %s", t.file, strings.Join(t.header, ","),
+		)
+	}
+
+	var rows []T
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.file, err)
+		}
+		rr := &recordReader{record: record}
+		row := t.decode(rr)
+		if rr.err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", t.file, line, rr.err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// recordReader reads the fields of a CSV record in order, keeping the first
+// error.
+type recordReader struct {
+	record []string
+	i      int
+	err    error
+}
+
+func (r *recordReader) string() string {
+	value := r.record[r.i]
+	r.i++
+	return value
+}
+
+func (r *recordReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *recordReader) int() int {
+	value, err := strconv.Atoi(r.string())
+	if err != nil {
+		r.fail(err)
+	}
+	return value
+}
+
+func (r *recordReader) optionalInt() *int {
+	if r.record[r.i] == "" {
+		r.i++
+		return nil
+	}
+	value := r.int()
+	return &value
+}
+
+func (r *recordReader) float() float64 {
+	value, err := strconv.ParseFloat(r.string(), 64)
+	if err != nil {
+		r.fail(err)
+	}
+	return value
+}
+
+func (r *recordReader) duration() db.Duration {
+	s := r.string()
+	if s == "" {
+		return db.Duration{}
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		r.fail(err)
+	}
+	return db.Duration{Duration: value, Valid: true}
+}
+
+func formatOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func formatDuration(d db.Duration) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Duration.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+var racesTable = table[db.RaceInput]{
+	file:   racesFile,
+	header: []string{"race_id", "grand_tour", "year"},
+	encode: func(race db.RaceInput) ([]string, error) {
+		grandTour, err := race.GrandTour.Value()
+		if err != nil {
+			return nil, err
+		}
+		return []string{
+			strconv.Itoa(race.RaceID),
+			grandTour.(string),
+			strconv.Itoa(race.Year),
+		}, nil
+	},
+	decode: func(r *recordReader) db.RaceInput {
+		race := db.RaceInput{RaceID: r.int()}
+		grandTour, err := db.ParseGrandTour(r.string())
+		r.fail(err)
+		race.GrandTour = grandTour
+		race.Year = r.int()
+		return race
+	},
+}
+
+var stagesTable = table[db.StageInput]{
+	file: stagesFile,
+	header: []string{
+		"stage_id",
+		"race_id",
+		"stage_no",
+		"stage_type",
+		"stage_length",
+		"stage_start",
+		"stage_end",
+		"gpx_id",
+		"gpx_accuracy",
+	},
+	encode: func(stage db.StageInput) ([]string, error) {
+		stageType, err := stage.StageType.Value()
+		if err != nil {
+			return nil, err
+		}
+		return []string{
+			strconv.Itoa(stage.StageID),
+			strconv.Itoa(stage.RaceID),
+			strconv.Itoa(stage.StageNumber),
+			stageType.(string),
+			formatFloat(stage.StageLength),
+			stage.StageStart,
+			stage.StageEnd,
+			strconv.Itoa(stage.GPXID),
+			stage.GPXAccuracy,
+		}, nil
+	},
+	decode: func(r *recordReader) db.StageInput {
+		stage := db.StageInput{
+			StageID:     r.int(),
+			RaceID:      r.int(),
+			StageNumber: r.int(),
+		}
+		stageType, err := db.ParseStageType(r.string())
+		r.fail(err)
+		stage.StageType = stageType
+		stage.StageLength = r.float()
+		stage.StageStart = r.string()
+		stage.StageEnd = r.string()
+		stage.GPXID = r.int()
+		stage.GPXAccuracy = r.string()
+		return stage
+	},
+}
+
+var ridersTable = table[db.RiderInput]{
+	file:   ridersFile,
+	header: []string{"rider_id", "first_name", "last_name"},
+	encode: func(rider db.RiderInput) ([]string, error) {
+		return []string{
+			strconv.Itoa(rider.RiderID), rider.FirstName, rider.LastName,
+		}, nil
+	},
+	decode: func(r *recordReader) db.RiderInput {
+		return db.RiderInput{
+			RiderID:   r.int(),
+			FirstName: r.string(),
+			LastName:  r.string(),
+		}
+	},
+}
+
+var teamsTable = table[db.TeamInput]{
+	file:   teamsFile,
+	header: []string{"team_id", "name"},
+	encode: func(team db.TeamInput) ([]string, error) {
+		return []string{strconv.Itoa(team.TeamID), team.Name}, nil
+	},
+	decode: func(r *recordReader) db.TeamInput {
+		return db.TeamInput{TeamID: r.int(), Name: r.string()}
+	},
+}
+
+var teamNamesTable = table[db.TeamName]{
+	file:   teamNamesFile,
+	header: []string{"team_id", "year", "name"},
+	encode: func(name db.TeamName) ([]string, error) {
+		return []string{
+			strconv.Itoa(name.TeamID), strconv.Itoa(name.Year), name.Name,
+		}, nil
+	},
+	decode: func(r *recordReader) db.TeamName {
+		return db.TeamName{TeamID: r.int(), Year: r.int(), Name: r.string()}
+	},
+}
+
+var resultsTable = table[db.ResultInput]{
+	file: resultsFile,
+	header: []string{
+		"result_id",
+		"stage_id",
+		"rank",
+		"status",
+		"classification",
+		"team_id",
+		"rider_id",
+		"time",
+		"points",
+	},
+	encode: func(result db.ResultInput) ([]string, error) {
+		// Results read from the database hold the classification value, and
+		// results read from an archive its label
+		classification := string(result.Classification)
+		if !result.Classification.IsValid() {
+			key, err := db.EnumKey(
+				result.Classification, db.ClassificationMapping,
+			)
+			if err != nil {
+				return nil, err
+			}
+			classification = key
+		}
+		return []string{
+			strconv.Itoa(result.ResultID),
+			strconv.Itoa(result.StageID),
+			formatOptionalInt(result.Rank),
+			string(result.RankStatusOrValid()),
+			classification,
+			strconv.Itoa(result.TeamID),
+			formatOptionalInt(result.RiderID),
+			formatDuration(result.Time),
+			formatOptionalInt(result.Points),
+		}, nil
+	},
+	decode: func(r *recordReader) db.ResultInput {
+		return db.ResultInput{
+			ResultID:       r.int(),
+			StageID:        r.int(),
+			Rank:           r.optionalInt(),
+			Status:         db.RankStatus(r.string()),
+			Classification: db.Classification(r.string()),
+			TeamID:         r.int(),
+			RiderID:        r.optionalInt(),
+			Time:           r.duration(),
+			Points:         r.optionalInt(),
+		}
+	},
+}
@@ -0,0 +1,242 @@
+package archive_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/archive"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func intRef(i int) *int {
+	return &i
+}
+
+func floatRef(f float64) *float64 {
+	return &f
+}
+
+func testDataset() archive.Dataset {
+	return archive.Dataset{
+		Races: []db.RaceInput{
+			{RaceID: 1, GrandTour: db.GrandTourTour, Year: 2024},
+		},
+		Stages: []db.StageInput{{
+			StageID:     3,
+			RaceID:      1,
+			StageNumber: 1,
+			StageType:   db.StageTypeRoad,
+			StageLength: 206.5,
+			StageStart:  "Firenze",
+			StageEnd:    "Rimini",
+			GPXID:       7,
+			GPXAccuracy: "exact",
+		}},
+		Riders: []db.RiderInput{
+			{RiderID: 4, FirstName: "Tadej", LastName: "Pogačar"},
+		},
+		Teams: []db.TeamInput{{TeamID: 5, Name: "UAE Team Emirates"}},
+		TeamNames: []db.TeamName{
+			{TeamID: 5, Year: 2024, Name: "UAE Team Emirates"},
+		},
+		Results: []db.ResultInput{
+			{
+				ResultID:       10,
+				StageID:        3,
+				Rank:           intRef(1),
+				Status:         db.RankStatusValid,
+				Classification: "general",
+				TeamID:         5,
+				RiderID:        intRef(4),
+				Time:           db.Duration{Duration: 5 * time.Hour, Valid: true},
+			},
+			{
+				ResultID:       11,
+				StageID:        3,
+				Rank:           intRef(2),
+				Status:         db.RankStatusValid,
+				Classification: "points",
+				TeamID:         5,
+				RiderID:        intRef(4),
+				Points:         intRef(20),
+			},
+			{
+				ResultID:       12,
+				StageID:        3,
+				Status:         db.RankStatusDidNotFinish,
+				Classification: "stage",
+				TeamID:         5,
+				RiderID:        intRef(4),
+			},
+		},
+	}
+}
+
+func testTrack() db.TrackInput {
+	return db.TrackInput{
+		TrackID:  7,
+		Name:     "Stage 1",
+		Source:   "test",
+		LinkHref: "https://example.com",
+		LinkText: "Example",
+		Points: []db.TrackPointInput{
+			{Segment: 0, Longitude: 11.25, Latitude: 43.77, Elevation: floatRef(50)},
+			{Segment: 0, Longitude: 11.3, Latitude: 43.8, Elevation: floatRef(80)},
+			{Segment: 1, Longitude: 12.5, Latitude: 44.05},
+		},
+	}
+}
+
+func writeArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := archive.NewWriter(&buf, "20241129100000")
+	if err := writer.WriteDataset(testDataset()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := writer.WriteTrack(testTrack()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := writeArchive(t)
+	reader, err := archive.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if reader.Manifest.SchemaVersion != "20241129100000" {
+		t.Errorf(
+			"expected schema version 20241129100000, got %s",
+			reader.Manifest.SchemaVersion,
+		)
+	}
+	if len(reader.Manifest.Files) != 8 {
+		t.Errorf("expected 8 files, got %d", len(reader.Manifest.Files))
+	}
+
+	dataset, err := reader.Dataset()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(dataset, testDataset()) {
+		t.Errorf("expected %+v, got %+v", testDataset(), dataset)
+	}
+
+	ids, err := reader.TrackIDs()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{7}) {
+		t.Fatalf("expected track IDs [7], got %v", ids)
+	}
+	if err := dataset.Validate(ids); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	track, err := reader.Track(7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(track, testTrack()) {
+		t.Errorf("expected %+v, got %+v", testTrack(), track)
+	}
+}
+
+func TestExportedClassification(t *testing.T) {
+	// Results read from the database hold the classification value
+	dataset := testDataset()
+	dataset.Results[0].Classification = db.ClassificationGC
+
+	var buf bytes.Buffer
+	writer := archive.NewWriter(&buf, "1")
+	if err := writer.WriteDataset(dataset); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	reader, err := archive.NewReader(
+		bytes.NewReader(buf.Bytes()), int64(buf.Len()),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	read, err := reader.Dataset()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if read.Results[0].Classification != "general" {
+		t.Errorf(
+			"expected classification general, got %s",
+			read.Results[0].Classification,
+		)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data := writeArchive(t)
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Copy the archive, changing a rider's name
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range z.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var contents bytes.Buffer
+		if _, err := contents.ReadFrom(f); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		f.Close()
+		out, err := writer.Create(file.Name)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		changed := strings.ReplaceAll(contents.String(), "Tadej", "Tadeo")
+		if _, err := out.Write([]byte(changed)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reader, err := archive.NewReader(
+		bytes.NewReader(buf.Bytes()), int64(buf.Len()),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := reader.Dataset(); err == nil {
+		t.Error("expected a checksum error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dataset := testDataset()
+	dataset.Results[0].TeamID = 99
+	if err := dataset.Validate([]int{7}); !db.IsValidationError(err) {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+	dataset = testDataset()
+	dataset.TeamNames[0].TeamID = 99
+	if err := dataset.Validate([]int{7}); !db.IsValidationError(err) {
+		t.Errorf("expected a validation error for a team name, got %v", err)
+	}
+	if err := testDataset().Validate(nil); !db.IsValidationError(err) {
+		t.Errorf("expected a validation error for a missing track, got %v", err)
+	}
+}
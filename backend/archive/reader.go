@@ -0,0 +1,257 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+)
+
+// Reader reads an archive from a zip file, checking the size and checksum of
+// every file against the manifest.
+type Reader struct {
+	zip      *zip.Reader
+	Manifest Manifest
+	files    map[string]File
+}
+
+// NewReader opens an archive and reads its manifest. Archives of a newer
+// format version, or with files missing from the manifest or the archive,
+// are rejected.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	reader := &Reader{zip: z, files: make(map[string]File)}
+
+	f, err := z.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&reader.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if reader.Manifest.FormatVersion < 1 ||
+		reader.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf(
+			"unsupported archive format version %d",
+			reader.Manifest.FormatVersion,
+		)
+	}
+
+	for _, file := range reader.Manifest.Files {
+		reader.files[file.Path] = file
+	}
+	for _, file := range z.File {
+		if _, ok := reader.files[file.Name]; !ok && file.Name != manifestFile {
+			return nil, fmt.Errorf("%s is not in the manifest", file.Name)
+		}
+	}
+	required := []string{
+		racesFile, stagesFile, ridersFile, teamsFile, resultsFile,
+	}
+	if reader.Manifest.FormatVersion >= 2 {
+		required = append(required, teamNamesFile)
+	}
+	for _, path := range required {
+		if _, ok := reader.files[path]; !ok {
+			return nil, fmt.Errorf("%s is missing from the manifest", path)
+		}
+	}
+	return reader, nil
+}
+
+// readFile reads a file of the archive, checking it against the manifest.
+func (r *Reader) readFile(path string) ([]byte, error) {
+	file, ok := r.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the manifest", path)
+	}
+	f, err := r.zip.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != file.Size ||
+		hex.EncodeToString(sum[:]) != file.SHA256 {
+		return nil, fmt.Errorf("%s does not match its checksum", path)
+	}
+	return data, nil
+}
+
+func readTableFile[T any](r *Reader, t table[T]) ([]T, error) {
+	data, err := r.readFile(t.file)
+	if err != nil {
+		return nil, err
+	}
+	return readTable(bytes.NewReader(data), t)
+}
+
+// Dataset reads the race data tables.
+func (r *Reader) Dataset() (Dataset, error) {
+	var data Dataset
+	var err error
+	if data.Races, err = readTableFile(r, racesTable); err != nil {
+		return Dataset{}, err
+	}
+	if data.Stages, err = readTableFile(r, stagesTable); err != nil {
+		return Dataset{}, err
+	}
+	if data.Riders, err = readTableFile(r, ridersTable); err != nil {
+		return Dataset{}, err
+	}
+	if data.Teams, err = readTableFile(r, teamsTable); err != nil {
+		return Dataset{}, err
+	}
+	// Archives of format version 1 have no team names
+	if _, ok := r.files[teamNamesFile]; ok {
+		data.TeamNames, err = readTableFile(r, teamNamesTable)
+		if err != nil {
+			return Dataset{}, err
+		}
+	}
+	if data.Results, err = readTableFile(r, resultsTable); err != nil {
+		return Dataset{}, err
+	}
+	return data, nil
+}
+
+// TrackIDs returns the IDs of the tracks of the archive, in order.
+func (r *Reader) TrackIDs() ([]int, error) {
+	var ids []int
+	for path := range r.files {
+		name, ok := strings.CutPrefix(path, tracksDir)
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, ".gpx")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(name)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid track file name %s", path)
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Track reads a track from its GPX file.
+func (r *Reader) Track(trackID int) (db.TrackInput, error) {
+	path := trackPath(trackID, "gpx")
+	data, err := r.readFile(path)
+	if err != nil {
+		return db.TrackInput{}, err
+	}
+	doc, err := gpx.Parse(bytes.NewReader(data))
+	if err != nil {
+		return db.TrackInput{}, fmt.Errorf("%s: %w", path, err)
+	}
+	track, err := importer.NewTrackInput(doc, "")
+	if err != nil {
+		return db.TrackInput{}, fmt.Errorf("%s: %w", path, err)
+	}
+	track.TrackID = trackID
+	return track, nil
+}
+
+// Validate checks every row of the dataset, and that the rows refer to
+// races, stages, riders, teams and tracks that exist.
+func (d Dataset) Validate(trackIDs []int) error {
+	var problems []string
+	add := func(file string, i int, err error) {
+		problems = append(
+			problems, fmt.Sprintf("%s line %d: %s", file, i+2, err),
+		)
+	}
+	missing := func(entity string, id int) error {
+		return fmt.Errorf("%s %d does not exist", entity, id)
+	}
+
+	tracks := make(map[int]bool, len(trackIDs))
+	for _, id := range trackIDs {
+		tracks[id] = true
+	}
+	races := make(map[int]bool, len(d.Races))
+	for i, race := range d.Races {
+		if err := race.Validate(); err != nil {
+			add(racesFile, i, err)
+		}
+		races[race.RaceID] = true
+	}
+	stages := make(map[int]bool, len(d.Stages))
+	for i, stage := range d.Stages {
+		if err := stage.Validate(); err != nil {
+			add(stagesFile, i, err)
+		}
+		if !races[stage.RaceID] {
+			add(stagesFile, i, missing("race", stage.RaceID))
+		}
+		if !tracks[stage.GPXID] {
+			add(stagesFile, i, missing("track", stage.GPXID))
+		}
+		stages[stage.StageID] = true
+	}
+	riders := make(map[int]bool, len(d.Riders))
+	for i, rider := range d.Riders {
+		if err := rider.Validate(); err != nil {
+			add(ridersFile, i, err)
+		}
+		riders[rider.RiderID] = true
+	}
+	teams := make(map[int]bool, len(d.Teams))
+	for i, team := range d.Teams {
+		if err := team.Validate(); err != nil {
+			add(teamsFile, i, err)
+		}
+		teams[team.TeamID] = true
+	}
+	for i, name := range d.TeamNames {
+		if strings.TrimSpace(name.Name) == "" {
+			add(teamNamesFile, i, errors.New("name is required"))
+		}
+		if !teams[name.TeamID] {
+			add(teamNamesFile, i, missing("team", name.TeamID))
+		}
+	}
+	for i, result := range d.Results {
+		if err := result.Validate(); err != nil {
+			add(resultsFile, i, err)
+		}
+		if !stages[result.StageID] {
+			add(resultsFile, i, missing("stage", result.StageID))
+		}
+		if !teams[result.TeamID] {
+			add(resultsFile, i, missing("team", result.TeamID))
+		}
+		if result.RiderID != nil && !riders[*result.RiderID] {
+			add(resultsFile, i, missing("rider", *result.RiderID))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &db.ValidationError{Problems: problems}
+	}
+	return nil
+}
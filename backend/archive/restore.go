@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// Summary struct, the number of rows of each table written to or restored
+// from an archive
+type Summary struct {
+	SchemaVersion string `json:"schema_version"`
+	Races         int    `json:"races"`
+	Stages        int    `json:"stages"`
+	Riders        int    `json:"riders"`
+	Teams         int    `json:"teams"`
+	Results       int    `json:"results"`
+	Tracks        int    `json:"tracks"`
+	// Why the elevation profiles could not be refreshed after a restore, if
+	// they could not. The archive is restored either way.
+	Warning string `json:"warning,omitempty"`
+}
+
+func newSummary(schemaVersion string, data Dataset, tracks int) Summary {
+	return Summary{
+		SchemaVersion: schemaVersion,
+		Races:         len(data.Races),
+		Stages:        len(data.Stages),
+		Riders:        len(data.Riders),
+		Teams:         len(data.Teams),
+		Results:       len(data.Results),
+		Tracks:        tracks,
+	}
+}
+
+// ErrNotEmpty is returned when restoring into a database that has race data.
+var ErrNotEmpty = errors.New(
+	"the database already has race data, archives can only be restored " +
+		"into an empty database",
+)
+
+// ErrSchemaVersion is returned when restoring an archive written from a
+// database at another schema migration version.
+var ErrSchemaVersion = errors.New("schema versions do not match")
+
+// ReadDataset reads every race data table of the database.
+func ReadDataset(ctx context.Context, conn db.Store) (Dataset, error) {
+	var data Dataset
+	var err error
+	if data.Races, err = conn.ExportRaces(ctx); err != nil {
+		return Dataset{}, err
+	}
+	if data.Stages, err = conn.ExportStages(ctx); err != nil {
+		return Dataset{}, err
+	}
+	if data.Riders, err = conn.ExportRiders(ctx); err != nil {
+		return Dataset{}, err
+	}
+	if data.Teams, err = conn.ExportTeams(ctx); err != nil {
+		return Dataset{}, err
+	}
+	if data.TeamNames, err = conn.GetAllTeamNames(ctx); err != nil {
+		return Dataset{}, err
+	}
+	if data.Results, err = conn.ExportResults(ctx); err != nil {
+		return Dataset{}, err
+	}
+	return data, nil
+}
+
+// Export writes an archive of the whole database. Tracks are read and
+// written one at a time, to keep only one track in memory.
+func Export(
+	ctx context.Context, conn db.Store, w io.Writer,
+) (Summary, error) {
+	schemaVersion, err := conn.GetSchemaVersion(ctx)
+	if err != nil {
+		return Summary{}, err
+	}
+	data, err := ReadDataset(ctx, conn)
+	if err != nil {
+		return Summary{}, err
+	}
+	trackIDs, err := conn.GetTrackIDs(ctx)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	writer := NewWriter(w, schemaVersion)
+	if err := writer.WriteDataset(data); err != nil {
+		return Summary{}, err
+	}
+	for _, trackID := range trackIDs {
+		track, err := conn.ExportTrack(ctx, trackID)
+		if err != nil {
+			return Summary{}, fmt.Errorf("track %d: %w", trackID, err)
+		}
+		if err := writer.WriteTrack(track); err != nil {
+			return Summary{}, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return Summary{}, err
+	}
+	return newSummary(schemaVersion, data, len(trackIDs)), nil
+}
+
+// Restore loads an archive into an empty database at the same schema
+// migration version as the archive. Every row keeps its ID. The load runs in
+// a single transaction and is recorded in the audit log, then the elevation
+// profiles are refreshed. Problems with the archive are returned as a
+// db.ValidationError. A failed refresh is reported as a warning of the
+// summary, as the archive has been committed.
+func Restore(
+	ctx context.Context,
+	conn db.Store,
+	r io.ReaderAt,
+	size int64,
+	actor string,
+) (Summary, error) {
+	reader, err := NewReader(r, size)
+	if err != nil {
+		return Summary{}, db.NewValidationError(err)
+	}
+	data, err := reader.Dataset()
+	if err != nil {
+		return Summary{}, db.NewValidationError(err)
+	}
+	trackIDs, err := reader.TrackIDs()
+	if err != nil {
+		return Summary{}, db.NewValidationError(err)
+	}
+	if err := data.Validate(trackIDs); err != nil {
+		return Summary{}, err
+	}
+
+	schemaVersion, err := conn.GetSchemaVersion(ctx)
+	if err != nil {
+		return Summary{}, err
+	}
+	if schemaVersion != reader.Manifest.SchemaVersion {
+		return Summary{}, fmt.Errorf(
+			"%w: the archive is at %q and the database at %q",
+			ErrSchemaVersion, reader.Manifest.SchemaVersion, schemaVersion,
+		)
+	}
+	count, err := conn.CountRaceData(ctx)
+	if err != nil {
+		return Summary{}, err
+	}
+	if count > 0 {
+		return Summary{}, ErrNotEmpty
+	}
+
+	summary := newSummary(schemaVersion, data, len(trackIDs))
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		for _, trackID := range trackIDs {
+			track, err := reader.Track(trackID)
+			if err != nil {
+				return db.NewValidationError(err)
+			}
+			if _, err := tx.CreateTrack(ctx, track); err != nil {
+				return fmt.Errorf("track %d: %w", trackID, err)
+			}
+		}
+		if err := createAll(ctx, data.Races, tx.CreateRace); err != nil {
+			return err
+		}
+		if err := createAll(ctx, data.Teams, tx.CreateTeam); err != nil {
+			return err
+		}
+		for _, name := range data.TeamNames {
+			if err := tx.SetTeamName(ctx, name); err != nil {
+				return fmt.Errorf("team %d name: %w", name.TeamID, err)
+			}
+		}
+		if err := createAll(ctx, data.Riders, tx.CreateRider); err != nil {
+			return err
+		}
+		if err := createAll(ctx, data.Stages, tx.CreateStage); err != nil {
+			return err
+		}
+		if err := createAll(ctx, data.Results, tx.CreateResult); err != nil {
+			return err
+		}
+		if err := tx.ResetIDSequences(ctx); err != nil {
+			return err
+		}
+		return tx.InsertAuditEntry(ctx, db.AuditEntry{
+			Actor:   actor,
+			Action:  db.ActionImport,
+			Entity:  db.EntityArchive,
+			Payload: summary,
+		})
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary.Warning = db.RefreshElevationAfterCommit(ctx, conn)
+	return summary, nil
+}
+
+// createAll creates every row of a table, stopping at the first error.
+func createAll[T any](
+	ctx context.Context,
+	rows []T,
+	create func(context.Context, T) (int, error),
+) error {
+	for i, row := range rows {
+		if _, err := create(ctx, row); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
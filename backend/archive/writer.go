@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+)
+
+// Writer writes an archive to a zip file. The data tables and tracks may be
+// written in any order, and the manifest is written on Close.
+type Writer struct {
+	zip      *zip.Writer
+	manifest Manifest
+}
+
+// NewWriter returns a Writer of an archive of a database at the given schema
+// migration version.
+func NewWriter(w io.Writer, schemaVersion string) *Writer {
+	return &Writer{
+		zip: zip.NewWriter(w),
+		manifest: Manifest{
+			FormatVersion: FormatVersion,
+			SchemaVersion: schemaVersion,
+			CreatedAt:     time.Now().UTC(),
+			Files:         []File{},
+		},
+	}
+}
+
+// countingHash hashes and counts the bytes written to a file.
+type countingHash struct {
+	hash hash.Hash
+	size int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	return c.hash.Write(p)
+}
+
+// writeFile writes a file to the archive and adds it to the manifest.
+func (w *Writer) writeFile(path string, write func(io.Writer) error) error {
+	f, err := w.zip.Create(path)
+	if err != nil {
+		return err
+	}
+	sum := &countingHash{hash: sha256.New()}
+	if err := write(io.MultiWriter(f, sum)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	w.manifest.Files = append(w.manifest.Files, File{
+		Path:   path,
+		Size:   sum.size,
+		SHA256: hex.EncodeToString(sum.hash.Sum(nil)),
+	})
+	return nil
+}
+
+// WriteDataset writes the race data tables.
+func (w *Writer) WriteDataset(data Dataset) error {
+	files := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{racesFile, func(f io.Writer) error {
+			return writeTable(f, racesTable, data.Races)
+		}},
+		{stagesFile, func(f io.Writer) error {
+			return writeTable(f, stagesTable, data.Stages)
+		}},
+		{ridersFile, func(f io.Writer) error {
+			return writeTable(f, ridersTable, data.Riders)
+		}},
+		{teamsFile, func(f io.Writer) error {
+			return writeTable(f, teamsTable, data.Teams)
+		}},
+		{teamNamesFile, func(f io.Writer) error {
+			return writeTable(f, teamNamesTable, data.TeamNames)
+		}},
+		{resultsFile, func(f io.Writer) error {
+			return writeTable(f, resultsTable, data.Results)
+		}},
+	}
+	for _, file := range files {
+		if err := w.writeFile(file.path, file.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trackPath(trackID int, extension string) string {
+	return fmt.Sprintf("%s%d.%s", tracksDir, trackID, extension)
+}
+
+// WriteTrack writes a track as both a GPX file and a GeoJSON feature.
+func (w *Writer) WriteTrack(track db.TrackInput) error {
+	if track.TrackID <= 0 {
+		return errors.New("track ID is required")
+	}
+	err := w.writeFile(trackPath(track.TrackID, "gpx"), func(f io.Writer) error {
+		return NewTrackGPX(track).Write(f)
+	})
+	if err != nil {
+		return err
+	}
+	return w.writeFile(
+		trackPath(track.TrackID, "geojson"),
+		func(f io.Writer) error {
+			return json.NewEncoder(f).Encode(NewTrackFeature(track))
+		},
+	)
+}
+
+// Close writes the manifest and finishes the zip file. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(w.manifest); err != nil {
+		return err
+	}
+	f, err := w.zip.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// NewTrackGPX builds a GPX document of a track, with a GPX segment per
+// segment of the track.
+func NewTrackGPX(track db.TrackInput) *gpx.GPX {
+	doc := gpx.New()
+	doc.Metadata = &gpx.Metadata{Name: track.Name}
+
+	var link *gpx.Link
+	if track.LinkHref != "" {
+		link = &gpx.Link{Href: track.LinkHref, Text: track.LinkText}
+		doc.Metadata.Link = link
+	}
+
+	var segments []gpx.Segment
+	for i, point := range track.Points {
+		if i == 0 || point.Segment != track.Points[i-1].Segment {
+			segments = append(segments, gpx.Segment{})
+		}
+		segment := &segments[len(segments)-1]
+		segment.Points = append(segment.Points, gpx.Waypoint{
+			Latitude:  point.Latitude,
+			Longitude: point.Longitude,
+			Elevation: point.Elevation,
+			Time:      point.Time,
+		})
+	}
+	doc.Tracks = []gpx.Track{{
+		Name:     track.Name,
+		Source:   track.Source,
+		Link:     link,
+		Segments: segments,
+	}}
+	return doc
+}
+
+// TrackFeature struct, a track as a GeoJSON feature
+type TrackFeature struct {
+	Type       string          `json:"type"`
+	Geometry   TrackGeometry   `json:"geometry"`
+	Properties TrackProperties `json:"properties"`
+}
+
+// TrackGeometry struct, the line of each segment of a track, with points of
+// longitude, latitude and, if known, elevation
+type TrackGeometry struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// TrackProperties struct, the properties of a track feature
+type TrackProperties struct {
+	TrackID  int    `json:"track_id"`
+	Name     string `json:"name,omitempty"`
+	Source   string `json:"source,omitempty"`
+	LinkHref string `json:"link,omitempty"`
+	LinkText string `json:"link_text,omitempty"`
+}
+
+// NewTrackFeature builds a GeoJSON MultiLineString feature of a track.
+func NewTrackFeature(track db.TrackInput) TrackFeature {
+	lines := [][][]float64{}
+	for i, point := range track.Points {
+		if i == 0 || point.Segment != track.Points[i-1].Segment {
+			lines = append(lines, [][]float64{})
+		}
+		position := []float64{point.Longitude, point.Latitude}
+		if point.Elevation != nil {
+			position = append(position, *point.Elevation)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], position)
+	}
+	return TrackFeature{
+		Type: "Feature",
+		Geometry: TrackGeometry{
+			Type:        "MultiLineString",
+			Coordinates: lines,
+		},
+		Properties: TrackProperties{
+			TrackID:  track.TrackID,
+			Name:     track.Name,
+			Source:   track.Source,
+			LinkHref: track.LinkHref,
+			LinkText: track.LinkText,
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/michaelbennett99/stagehunter/backend/archive"
+)
+
+func runExportArchive(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	output := fs.String("o", "", "zip file to write")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *output == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	summary, err := archive.Export(ctx, conn, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	return writeJSON(e.out, summary)
+}
+
+func runRestoreArchive(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	actor := fs.String("actor", defaultActor, "actor recorded in the audit log")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	summary, err := archive.Restore(ctx, conn, file, size, *actor)
+	if err != nil {
+		return err
+	}
+	return writeJSON(e.out, summary)
+}
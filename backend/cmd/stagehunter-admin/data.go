@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func runScheduleDaily(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	stageID := fs.Int(
+		"stage", 0,
+		"ID of the stage to make today's daily stage, replacing any stage "+
+			"already chosen. Defaults to keeping today's stage, or choosing "+
+			"one at random if there is none.",
+	)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if *stageID > 0 {
+		if _, err := conn.GetStageInfo(ctx, *stageID); err != nil {
+			return fmt.Errorf("stage %d: %w", *stageID, err)
+		}
+		if err := conn.ScheduleDailyStage(ctx, *stageID); err != nil {
+			return err
+		}
+	} else if _, err := conn.EnsureDailyStage(ctx, lib.Today()); err != nil {
+		return err
+	}
+	daily, err := conn.GetDailyStage(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Daily stage is stage %d\n", daily.StageID)
+	return nil
+}
+
+func runListStages(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	raceID := fs.Int("race", 0, "ID of the race, defaults to every race")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	var races []db.Race
+	if *raceID > 0 {
+		race, err := conn.GetRace(ctx, *raceID)
+		if err != nil {
+			return fmt.Errorf("race %d: %w", *raceID, err)
+		}
+		races = []db.Race{race}
+	} else if races, err = conn.GetRaces(ctx, db.RacesQueryParams{}); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE ID\tRACE ID\tRACE\tSTAGE\tTYPE\tSTART\tEND\tLENGTH")
+	for _, race := range races {
+		stages, err := conn.GetRaceStages(ctx, race.RaceID)
+		if err != nil {
+			return err
+		}
+		for _, stage := range stages {
+			fmt.Fprintf(
+				w, "%d\t%d\t%s %d\t%d\t%s\t%s\t%s\t%.1f\n",
+				stage.StageID, race.RaceID, race.GrandTour, race.Year,
+				stage.StageNumber, stage.StageType, stage.StageStart,
+				stage.StageEnd, stage.StageLength,
+			)
+		}
+	}
+	return w.Flush()
+}
+
+func runValidateData(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	tolerance := fs.Float64(
+		"tolerance", validation.DefaultTrackLengthTolerance,
+		"how far the track length may be from the stage length, as a "+
+			"fraction of the stage length",
+	)
+	dryRun := fs.Bool(
+		"dry-run", false,
+		"only report the problems, without recording them for the daily "+
+			"stage selector",
+	)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	cfg := validation.Config{TrackLengthTolerance: *tolerance}
+	report, err := validation.Run(ctx, conn, cfg, *dryRun)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(e.out, report); err != nil {
+		return err
+	}
+	if report.NumFailed > 0 {
+		return fmt.Errorf(
+			"%d of %d stages failed the checks",
+			report.NumFailed, report.NumStages,
+		)
+	}
+	return nil
+}
+
+func runRefreshElevation(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		return tx.RefreshElevation(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, "Refreshed elevation profiles")
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+)
+
+func runExport(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	raceID := fs.Int("race", 0, "ID of the race to export")
+	format := fs.String("format", "csv", "format of the file, csv or json")
+	output := fs.String("o", "", "file to write, defaults to stdout")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *raceID <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	resultsFormat, err := importer.ParseResultsFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.GetRace(ctx, *raceID); err != nil {
+		return fmt.Errorf("race %d: %w", *raceID, err)
+	}
+	results, err := conn.GetRaceResults(ctx, *raceID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = e.out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	rows := importer.NewResultRows(results)
+	return importer.WriteResults(w, rows, resultsFormat)
+}
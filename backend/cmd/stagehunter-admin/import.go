@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+)
+
+// Actor recorded in the audit log for changes made with the command
+const defaultActor = "stagehunter-admin"
+
+func runImportGPX(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	stageID := fs.Int(
+		"stage", 0, "ID of the stage to link the track to, if any",
+	)
+	accuracy := fs.String(
+		"accuracy", "",
+		"how accurately the track follows the stage route, "+
+			"required with -stage",
+	)
+	name := fs.String("name", "", "name of the track, defaults to the GPX name")
+	actor := fs.String("actor", defaultActor, "actor recorded in the audit log")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := importer.ImportGPX(ctx, conn, file, importer.TrackOptions{
+		StageID:  *stageID,
+		Accuracy: *accuracy,
+		Name:     *name,
+		Actor:    *actor,
+	})
+	if err != nil {
+		return err
+	}
+	if *stageID > 0 {
+		fmt.Fprintf(
+			e.out, "Imported track %d for stage %d\n", result.TrackID, *stageID,
+		)
+	} else {
+		fmt.Fprintf(e.out, "Imported track %d\n", result.TrackID)
+	}
+	if result.Warning != "" {
+		fmt.Fprintf(e.out, "Warning: %s\n", result.Warning)
+	}
+	return nil
+}
+
+func runImportResults(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	raceID := fs.Int("race", 0, "ID of the race the results belong to")
+	format := fs.String(
+		"format", "", "format of the file, csv or json, "+
+			"defaults to the file extension",
+	)
+	dryRun := fs.Bool(
+		"dry-run", false, "only report what the import would do",
+	)
+	replace := fs.Bool(
+		"replace", false,
+		"replace the existing results of the classifications in the file",
+	)
+	actor := fs.String("actor", defaultActor, "actor recorded in the audit log")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	resultsFormat, err := importer.ParseResultsFormat(*format)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	conn, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+	report, err := importer.ImportResults(
+		ctx, conn, file, importer.ResultsOptions{
+			RaceID:  *raceID,
+			Format:  resultsFormat,
+			Replace: *replace,
+			DryRun:  *dryRun,
+			Actor:   *actor,
+		},
+	)
+	if err != nil && !errors.Is(err, importer.ErrResultsConflict) {
+		return err
+	}
+
+	if encodeErr := writeJSON(e.out, report); encodeErr != nil {
+		return encodeErr
+	}
+	// Conflicts are listed in the report, and still fail the command
+	return err
+}
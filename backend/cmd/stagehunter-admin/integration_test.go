@@ -0,0 +1,98 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/db/dbtest"
+)
+
+// Connections to the test database, seeded with the default fixtures. Nil if
+// TEST_DATABASE_URL is not set.
+var testPool *pgxpool.Pool
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	url := os.Getenv(dbtest.URLEnv)
+	if url == "" {
+		return m.Run()
+	}
+
+	ctx := context.Background()
+	pool, cleanup, err := dbtest.Create(ctx, url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating the test database: %v\n", err)
+		return 1
+	}
+	defer cleanup()
+
+	testPool = pool
+	if err := dbtest.Seed(ctx, db.New(pool)); err != nil {
+		fmt.Fprintf(os.Stderr, "seeding the test database: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// databaseEnv returns an env whose commands run against the test database,
+// skipping the test if there is none.
+func databaseEnv(t *testing.T) env {
+	t.Helper()
+	if testPool == nil {
+		t.Skipf("%s is not set", dbtest.URLEnv)
+	}
+	return env{
+		connect: func(ctx context.Context) (db.Store, error) {
+			return db.New(testPool), nil
+		},
+		connectConn: func(ctx context.Context) (db.DBConn, error) {
+			return testPool, nil
+		},
+	}
+}
+
+func TestCommandsIntegration(t *testing.T) {
+	e := databaseEnv(t)
+	path := filepath.Join(t.TempDir(), "results.csv")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"migrate", "status"}, "0 pending migrations"},
+		{[]string{"list-stages", "-race", "2"}, "Novara"},
+		{[]string{"schedule-daily", "-stage", "3"}, "Daily stage is stage 3"},
+		{[]string{"validate-data"}, `"num_failed": 0`},
+		{[]string{"export", "-race", "1", "-o", path}, ""},
+		{[]string{"import-results", "-race", "1", "-dry-run", "-replace", path},
+			`"dry_run": true`},
+		{[]string{"import-results", "-race", "1", "-replace", path},
+			`"replaced": `},
+		{[]string{"refresh-elevation"}, "Refreshed elevation profiles"},
+	}
+	// The commands run in order, as each may depend on the ones before
+	for _, tt := range tests {
+		out, err := runCommand(t, e, tt.args...)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", strings.Join(tt.args, " "), err, out)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf(
+				"%s: got output without %q:\n%s",
+				strings.Join(tt.args, " "), tt.want, out,
+			)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Command stagehunter-admin administers the StageHunter database.
+//
+// Usage:
+//
+//	stagehunter-admin COMMAND [flags] [ARGS]
+//
+// Run stagehunter-admin without arguments for the list of commands, and
+// stagehunter-admin COMMAND -h for the flags of a command. The database is
+// given by the DATABASE_URL environment variable, as for the server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// env is what a command runs with.
+type env struct {
+	out io.Writer
+	// connect opens the database, only once the command's flags are valid
+	connect func(ctx context.Context) (db.Store, error)
+	// connectConn opens the database as a connection, for the migrations
+	connectConn func(ctx context.Context) (db.DBConn, error)
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	// run parses the arguments with the command's flag set and runs it
+	run func(ctx context.Context, e env, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{
+		name:    "import-gpx",
+		args:    "FILE",
+		summary: "import a GPX file as a track, of a stage if given",
+		run:     runImportGPX,
+	},
+	{
+		name:    "import-results",
+		args:    "FILE",
+		summary: "import a CSV or JSON results file into a race",
+		run:     runImportResults,
+	},
+	{
+		name:    "schedule-daily",
+		summary: "choose today's daily stage",
+		run:     runScheduleDaily,
+	},
+	{
+		name:    "list-stages",
+		summary: "list the stages of every race, or of one race",
+		run:     runListStages,
+	},
+	{
+		name:    "validate-data",
+		summary: "check the tracks and results of every stage",
+		run:     runValidateData,
+	},
+	{
+		name:    "refresh-elevation",
+		summary: "refresh the elevation profiles of the tracks",
+		run:     runRefreshElevation,
+	},
+	{
+		name:    "export",
+		summary: "export the results of a race as a CSV or JSON results file",
+		run:     runExport,
+	},
+	{
+		name:    "export-archive",
+		summary: "export the whole dataset as a versioned zip archive",
+		run:     runExportArchive,
+	},
+	{
+		name:    "restore-archive",
+		args:    "FILE",
+		summary: "restore a dataset archive into an empty database",
+		run:     runRestoreArchive,
+	},
+	{
+		name:    "migrate",
+		args:    "up|down|status",
+		summary: "apply, roll back or list the database migrations",
+		run:     runMigrate,
+	},
+}
+
+// errUsage is returned when a command is called with invalid arguments,
+// after its usage has been printed.
+var errUsage = errors.New("invalid arguments")
+
+// newFlagSet creates the flag set of a command, which prints its usage to
+// stderr.
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			fs.Output(), "Usage: stagehunter-admin %s\n\n%s%s.\n\n",
+			strings.TrimSpace(cmd.name+" [flags] "+cmd.args),
+			strings.ToUpper(cmd.summary[:1]), cmd.summary[1:],
+		)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the arguments of a command, which must leave nArgs
+// positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != nArgs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func connect(ctx context.Context) (db.Store, error) {
+	conn, err := db.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	return db.New(conn), nil
+}
+
+func connectConn(ctx context.Context) (db.DBConn, error) {
+	return db.GetConn()
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: stagehunter-admin COMMAND [flags] [ARGS]\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		e := env{out: os.Stdout, connect: connect, connectConn: connectConn}
+		err := cmd.run(context.Background(), e, newFlagSet(cmd), os.Args[2:])
+		switch {
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
+// runCommand runs a command as main does, returning what it wrote.
+func runCommand(t *testing.T, e env, args ...string) (string, error) {
+	t.Helper()
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		var out bytes.Buffer
+		e.out = &out
+		fs := newFlagSet(cmd)
+		fs.SetOutput(io.Discard)
+		err := cmd.run(context.Background(), e, fs, args[1:])
+		return out.String(), err
+	}
+	t.Fatalf("unknown command %s", args[0])
+	return "", nil
+}
+
+// storeEnv returns an env whose commands run against the store.
+func storeEnv(store db.Store) env {
+	return env{
+		connect: func(ctx context.Context) (db.Store, error) {
+			return store, nil
+		},
+		connectConn: func(ctx context.Context) (db.DBConn, error) {
+			return nil, errors.New("no database connection")
+		},
+	}
+}
+
+func TestListStages(t *testing.T) {
+	e := storeEnv(memstore.Default())
+
+	out, err := runCommand(t, e, "list-stages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 6 {
+		t.Errorf("got %d lines, want a header and 5 stages:\n%s", len(lines), out)
+	}
+
+	out, err = runCommand(t, e, "list-stages", "-race", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "Florence") || !strings.Contains(out, "Novara") {
+		t.Errorf("got stages of another race:\n%s", out)
+	}
+
+	if _, err := runCommand(t, e, "list-stages", "-race", "99"); err == nil {
+		t.Error("got no error listing the stages of a missing race")
+	}
+}
+
+func TestScheduleDaily(t *testing.T) {
+	e := storeEnv(memstore.Default())
+
+	out, err := runCommand(t, e, "schedule-daily", "-stage", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Daily stage is stage 3\n" {
+		t.Errorf("got output %q", out)
+	}
+	// Without a stage, today's stage is kept
+	out, err = runCommand(t, e, "schedule-daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Daily stage is stage 3\n" {
+		t.Errorf("got output %q keeping today's stage", out)
+	}
+
+	if _, err := runCommand(t, e, "schedule-daily", "-stage", "99"); err == nil {
+		t.Error("got no error scheduling a missing stage")
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	store := memstore.Default()
+	e := storeEnv(store)
+
+	out, err := runCommand(t, e, "validate-data", "-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report validation.Report
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.NumStages != 5 || report.NumFailed != 0 {
+		t.Errorf("got report of %d stages, %d failed, want 5 and 0",
+			report.NumStages, report.NumFailed)
+	}
+
+	// Without a tolerance, no track is exactly as long as its stage
+	out, err = runCommand(t, e, "validate-data", "-dry-run", "-tolerance", "0")
+	if err == nil {
+		t.Errorf("got no error for failing stages:\n%s", out)
+	}
+}
+
+func TestExportAndImportResults(t *testing.T) {
+	e := storeEnv(memstore.Default())
+	path := filepath.Join(t.TempDir(), "results.csv")
+
+	if _, err := runCommand(t, e, "export", "-race", "1", "-o", path); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCommand(t, e, "export", "-race", "2", "-format", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Evenepoel") {
+		t.Errorf("got export without the race's riders:\n%s", out)
+	}
+
+	// The exported results are imported back, which the race already has
+	out, err = runCommand(t, e, "import-results", "-race", "1", path)
+	if !errors.Is(err, importer.ErrResultsConflict) {
+		t.Errorf("got error %v importing existing results, want a conflict", err)
+	}
+	if !strings.Contains(out, "conflicts") {
+		t.Errorf("got output without the conflicts:\n%s", out)
+	}
+
+	out, err = runCommand(t, e, "import-results", "-race", "1", "-replace", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report importer.ResultsReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Results == 0 || report.DryRun {
+		t.Errorf("got report %+v replacing the results", report)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	gpx := filepath.Join(t.TempDir(), "track.gpx")
+	if err := os.WriteFile(gpx, []byte("<gpx/>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown flag", []string{"list-stages", "-stages", "1"}},
+		{"extra argument", []string{"list-stages", "2"}},
+		{"invalid flag value", []string{"schedule-daily", "-stage", "three"}},
+		{"extra argument", []string{"validate-data", "now"}},
+		{"missing race", []string{"export", "-format", "json"}},
+		{"missing file", []string{"import-results", "-race", "2"}},
+		{"two files", []string{"import-gpx", gpx, gpx}},
+		{"missing file", []string{"restore-archive"}},
+		{"unknown action", []string{"migrate", "sideways"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args[0]+"/"+tt.name, func(t *testing.T) {
+			e := env{
+				connect: func(ctx context.Context) (db.Store, error) {
+					t.Error("connected with invalid arguments")
+					return memstore.Default(), nil
+				},
+				connectConn: func(ctx context.Context) (db.DBConn, error) {
+					t.Error("connected with invalid arguments")
+					return nil, errors.New("no database connection")
+				},
+			}
+			if _, err := runCommand(t, e, tt.args...); !errors.Is(err, errUsage) {
+				t.Errorf("got error %v, want a usage error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/michaelbennett99/stagehunter/backend/migrate"
+)
+
+func runMigrate(
+	ctx context.Context, e env, fs *flag.FlagSet, args []string,
+) error {
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	action := fs.Arg(0)
+	if action != "up" && action != "down" && action != "status" {
+		fs.Usage()
+		return errUsage
+	}
+
+	conn, err := e.connectConn(ctx)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(
+				e.out, "Applied %s_%s\n", migration.Version, migration.Name,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(e.out, "No pending migrations")
+		}
+		return nil
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(
+			e.out, "Rolled back %s_%s\n", migration.Version, migration.Name,
+		)
+		return nil
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		pending := 0
+		for _, status := range statuses {
+			state := "applied"
+			switch {
+			case !status.Applied:
+				state = "pending"
+				pending++
+			case !status.Embedded:
+				state = "applied, unknown to this backend"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", status.Version, status.Name, state)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "\n%d pending migrations\n", pending)
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Package daily chooses the daily stage at the start of every UTC day.
+//
+// Every replica of the backend runs a scheduler. Choosing the stage of a date
+// is idempotent, and takes an advisory lock in the database, so one replica
+// chooses it while the others wait and try again until it has been chosen.
+package daily
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// DefaultRetryInterval is how long the scheduler waits by default before
+// trying again after a failure, or while another replica is choosing.
+const DefaultRetryInterval = time.Minute
+
+const day = 24 * time.Hour
+
+// Scheduler struct, chooses the daily stage of every day
+type Scheduler struct {
+	store db.Store
+	// How long to wait before trying again after a failure, or while another
+	// replica is choosing
+	RetryInterval time.Duration
+	// Current time, replaced in tests
+	Now func() time.Time
+}
+
+func NewScheduler(store db.Store) *Scheduler {
+	return &Scheduler{
+		store:         store,
+		RetryInterval: DefaultRetryInterval,
+		Now:           time.Now,
+	}
+}
+
+// Run chooses the daily stage now, and then at the start of every day, until
+// the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(s.Step(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Step chooses the daily stage of the current day unless it has been chosen,
+// returning how long to wait before the next step: until the start of the
+// next day, or the retry interval if the stage of the day is not known to
+// have been chosen.
+func (s *Scheduler) Step(ctx context.Context) time.Duration {
+	now := s.Now().UTC()
+	today := now.Truncate(day)
+	chosen, err := s.store.EnsureDailyStage(ctx, today)
+	if errors.Is(err, db.ErrDailyLocked) {
+		return s.RetryInterval
+	}
+	if err != nil {
+		log.Printf(
+			"choosing the daily stage of %s: %v",
+			today.Format(time.DateOnly), err,
+		)
+		return s.RetryInterval
+	}
+	if chosen {
+		log.Printf("Chose the daily stage of %s", today.Format(time.DateOnly))
+	}
+	return today.Add(day).Sub(now)
+}
@@ -0,0 +1,73 @@
+package daily_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/daily"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+)
+
+func TestStep(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	scheduler := daily.NewScheduler(store)
+	now := time.Date(2024, 12, 3, 15, 0, 0, 0, time.UTC)
+	scheduler.Now = func() time.Time { return now }
+
+	if wait := scheduler.Step(ctx); wait != 9*time.Hour {
+		t.Errorf("expected to wait until midnight, got %v", wait)
+	}
+	first, err := store.GetDailyStage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Date.Time.Equal(now.Truncate(24 * time.Hour)) {
+		t.Errorf("expected the daily stage of %v, got %v", now, first.Date.Time)
+	}
+
+	// The stage of the day is kept
+	now = now.Add(time.Hour)
+	if wait := scheduler.Step(ctx); wait != 8*time.Hour {
+		t.Errorf("expected to wait until midnight, got %v", wait)
+	}
+	second, err := store.GetDailyStage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("expected the daily stage to be kept, got %+v", second)
+	}
+
+	// A stage is chosen for the next day
+	now = now.Add(9 * time.Hour)
+	scheduler.Step(ctx)
+	third, err := store.GetDailyStage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !third.Date.Time.After(first.Date.Time) {
+		t.Errorf("expected a daily stage after %v, got %v", first.Date, third.Date)
+	}
+}
+
+// lockedStore is a store whose daily stage is being chosen by another replica
+type lockedStore struct {
+	db.Store
+}
+
+func (lockedStore) EnsureDailyStage(
+	ctx context.Context, date time.Time,
+) (bool, error) {
+	return false, db.ErrDailyLocked
+}
+
+func TestStepLocked(t *testing.T) {
+	scheduler := daily.NewScheduler(lockedStore{memstore.Default()})
+	scheduler.RetryInterval = 5 * time.Second
+	if wait := scheduler.Step(context.Background()); wait != 5*time.Second {
+		t.Errorf("expected to retry after 5s, got %v", wait)
+	}
+}
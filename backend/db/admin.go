@@ -0,0 +1,567 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Entities that can be edited through the admin API, as recorded in the audit
+// log
+const (
+	EntityRace   = "race"
+	EntityStage  = "stage"
+	EntityRider  = "rider"
+	EntityTeam   = "team"
+	EntityResult = "result"
+	EntityTrack  = "track"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionImport = "import"
+)
+
+// AuditEntry struct, a change made through the admin API
+type AuditEntry struct {
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID int
+	// The input of the change, marshalled to JSON
+	Payload any
+}
+
+const insertAuditEntryQuery = `
+INSERT INTO racedata.audit_log (actor, action, entity, entity_id, payload)
+VALUES (@actor, @action, @entity, @entity_id, @payload);
+`
+
+// Record a change in the audit log
+func (q *Queries) InsertAuditEntry(ctx context.Context, entry AuditEntry) error {
+	payload, err := json.Marshal(entry.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.conn.Exec(ctx, insertAuditEntryQuery, pgx.NamedArgs{
+		"actor":     entry.Actor,
+		"action":    entry.Action,
+		"entity":    entry.Entity,
+		"entity_id": entry.EntityID,
+		"payload":   payload,
+	})
+	return err
+}
+
+// execOne executes a statement that should affect exactly one row, returning
+// pgx.ErrNoRows if it affected none.
+func (q *Queries) execOne(
+	ctx context.Context, sql string, args pgx.NamedArgs,
+) error {
+	tag, err := q.conn.Exec(ctx, sql, args)
+	if err != nil {
+		return err
+	}
+	return requireRow(tag)
+}
+
+func requireRow(tag pgconn.CommandTag) error {
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// insertReturningID runs an insert returning the ID of the new row.
+func (q *Queries) insertReturningID(
+	ctx context.Context, sql string, args pgx.NamedArgs,
+) (int, error) {
+	var id int
+	if err := q.conn.QueryRow(ctx, sql, args).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+//
+// Races
+//
+
+const createRaceQuery = `
+INSERT INTO racedata.races (race_id, gt, year)
+VALUES (
+	COALESCE(
+		NULLIF(@race_id::int, 0),
+		nextval('racedata.races_race_id_seq')
+	),
+	@grand_tour,
+	@year
+)
+RETURNING race_id;
+`
+
+// Create a race, returning its ID
+func (q *Queries) CreateRace(ctx context.Context, in RaceInput) (int, error) {
+	return q.insertReturningID(ctx, createRaceQuery, pgx.NamedArgs{
+		"race_id":    in.RaceID,
+		"grand_tour": in.GrandTour,
+		"year":       in.Year,
+	})
+}
+
+const updateRaceQuery = `
+UPDATE racedata.races
+SET gt = @grand_tour, year = @year
+WHERE race_id = @race_id;
+`
+
+func (q *Queries) UpdateRace(ctx context.Context, in RaceInput) error {
+	return q.execOne(ctx, updateRaceQuery, pgx.NamedArgs{
+		"race_id":    in.RaceID,
+		"grand_tour": in.GrandTour,
+		"year":       in.Year,
+	})
+}
+
+const deleteRaceQuery = `DELETE FROM racedata.races WHERE race_id = @id;`
+
+func (q *Queries) DeleteRace(ctx context.Context, raceID int) error {
+	return q.execOne(ctx, deleteRaceQuery, pgx.NamedArgs{"id": raceID})
+}
+
+//
+// Stages
+//
+
+const createStageQuery = `
+INSERT INTO racedata.stages (
+	stage_id,
+	race_id,
+	stage_number,
+	stage_type,
+	stage_length,
+	stage_start,
+	stage_end,
+	gpx_id,
+	gpx_accuracy
+)
+VALUES (
+	COALESCE(
+		NULLIF(@stage_id::int, 0),
+		nextval('racedata.stages_stage_id_seq')
+	),
+	@race_id,
+	@stage_number,
+	@stage_type,
+	@stage_length,
+	@stage_start,
+	@stage_end,
+	@gpx_id,
+	@gpx_accuracy
+)
+RETURNING stage_id;
+`
+
+func stageArgs(in StageInput) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"stage_id":     in.StageID,
+		"race_id":      in.RaceID,
+		"stage_number": in.StageNumber,
+		"stage_type":   in.StageType,
+		"stage_length": in.StageLength,
+		"stage_start":  in.StageStart,
+		"stage_end":    in.StageEnd,
+		"gpx_id":       in.GPXID,
+		"gpx_accuracy": in.GPXAccuracy,
+	}
+}
+
+// Create a stage, returning its ID
+func (q *Queries) CreateStage(ctx context.Context, in StageInput) (int, error) {
+	return q.insertReturningID(ctx, createStageQuery, stageArgs(in))
+}
+
+const updateStageQuery = `
+UPDATE racedata.stages
+SET
+	race_id = @race_id,
+	stage_number = @stage_number,
+	stage_type = @stage_type,
+	stage_length = @stage_length,
+	stage_start = @stage_start,
+	stage_end = @stage_end,
+	gpx_id = @gpx_id,
+	gpx_accuracy = @gpx_accuracy
+WHERE stage_id = @stage_id;
+`
+
+func (q *Queries) UpdateStage(ctx context.Context, in StageInput) error {
+	return q.execOne(ctx, updateStageQuery, stageArgs(in))
+}
+
+const deleteStageQuery = `DELETE FROM racedata.stages WHERE stage_id = @id;`
+
+func (q *Queries) DeleteStage(ctx context.Context, stageID int) error {
+	return q.execOne(ctx, deleteStageQuery, pgx.NamedArgs{"id": stageID})
+}
+
+//
+// Riders
+//
+
+const createRiderQuery = `
+INSERT INTO racedata.riders (rider_id, first_name, last_name)
+VALUES (
+	COALESCE(
+		NULLIF(@rider_id::int, 0),
+		nextval('racedata.riders_rider_id_seq')
+	),
+	@first_name,
+	@last_name
+)
+RETURNING rider_id;
+`
+
+// Create a rider, returning their ID
+func (q *Queries) CreateRider(ctx context.Context, in RiderInput) (int, error) {
+	return q.insertReturningID(ctx, createRiderQuery, pgx.NamedArgs{
+		"rider_id":   in.RiderID,
+		"first_name": in.FirstName,
+		"last_name":  in.LastName,
+	})
+}
+
+const updateRiderQuery = `
+UPDATE racedata.riders
+SET first_name = @first_name, last_name = @last_name
+WHERE rider_id = @rider_id;
+`
+
+func (q *Queries) UpdateRider(ctx context.Context, in RiderInput) error {
+	return q.execOne(ctx, updateRiderQuery, pgx.NamedArgs{
+		"rider_id":   in.RiderID,
+		"first_name": in.FirstName,
+		"last_name":  in.LastName,
+	})
+}
+
+const deleteRiderQuery = `DELETE FROM racedata.riders WHERE rider_id = @id;`
+
+func (q *Queries) DeleteRider(ctx context.Context, riderID int) error {
+	return q.execOne(ctx, deleteRiderQuery, pgx.NamedArgs{"id": riderID})
+}
+
+//
+// Teams
+//
+
+const createTeamQuery = `
+INSERT INTO racedata.teams (team_id, name)
+VALUES (
+	COALESCE(
+		NULLIF(@team_id::int, 0),
+		nextval('racedata.teams_team_id_seq')
+	),
+	@name
+)
+RETURNING team_id;
+`
+
+// Create a team, returning its ID
+func (q *Queries) CreateTeam(ctx context.Context, in TeamInput) (int, error) {
+	return q.insertReturningID(ctx, createTeamQuery, pgx.NamedArgs{
+		"team_id": in.TeamID,
+		"name":    in.Name,
+	})
+}
+
+const updateTeamQuery = `
+UPDATE racedata.teams SET name = @name WHERE team_id = @team_id;
+`
+
+func (q *Queries) UpdateTeam(ctx context.Context, in TeamInput) error {
+	return q.execOne(ctx, updateTeamQuery, pgx.NamedArgs{
+		"team_id": in.TeamID,
+		"name":    in.Name,
+	})
+}
+
+const deleteTeamQuery = `DELETE FROM racedata.teams WHERE team_id = @id;`
+
+func (q *Queries) DeleteTeam(ctx context.Context, teamID int) error {
+	return q.execOne(ctx, deleteTeamQuery, pgx.NamedArgs{"id": teamID})
+}
+
+const setTeamNameQuery = `
+INSERT INTO racedata.team_names (team_id, year, name)
+VALUES (@team_id, @year, @name)
+ON CONFLICT (team_id, year) DO UPDATE SET name = EXCLUDED.name;
+`
+
+// Set the name a team raced under in a year
+func (q *Queries) SetTeamName(ctx context.Context, in TeamName) error {
+	_, err := q.conn.Exec(ctx, setTeamNameQuery, pgx.NamedArgs{
+		"team_id": in.TeamID,
+		"year":    in.Year,
+		"name":    in.Name,
+	})
+	return err
+}
+
+//
+// Results
+//
+
+const createResultQuery = `
+INSERT INTO racedata.results (
+	result_id,
+	stage_id,
+	rank,
+	classification,
+	team_id,
+	rider_id,
+	time,
+	points
+)
+VALUES (
+	COALESCE(
+		NULLIF(@result_id::int, 0),
+		nextval('racedata.results_result_id_seq')
+	),
+	@stage_id,
+	ROW(@rank::int, @status::racedata.rank_enum)::racedata.rank_type,
+	@classification,
+	@team_id,
+	@rider_id,
+	@time,
+	@points
+)
+RETURNING result_id;
+`
+
+func resultArgs(in ResultInput) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"result_id":      in.ResultID,
+		"stage_id":       in.StageID,
+		"rank":           optionalArg(in.Rank),
+		"status":         in.RankStatusOrValid(),
+		"classification": in.Classification,
+		"team_id":        in.TeamID,
+		"rider_id":       optionalArg(in.RiderID),
+		"time":           in.Time,
+		"points":         optionalArg(in.Points),
+	}
+}
+
+// Create a result, returning its ID
+func (q *Queries) CreateResult(
+	ctx context.Context, in ResultInput,
+) (int, error) {
+	return q.insertReturningID(ctx, createResultQuery, resultArgs(in))
+}
+
+const updateResultQuery = `
+UPDATE racedata.results
+SET
+	stage_id = @stage_id,
+	rank = ROW(@rank::int, @status::racedata.rank_enum)::racedata.rank_type,
+	classification = @classification,
+	team_id = @team_id,
+	rider_id = @rider_id,
+	time = @time,
+	points = @points
+WHERE result_id = @result_id;
+`
+
+func (q *Queries) UpdateResult(ctx context.Context, in ResultInput) error {
+	return q.execOne(ctx, updateResultQuery, resultArgs(in))
+}
+
+const deleteResultQuery = `
+DELETE FROM racedata.results WHERE result_id = @id;
+`
+
+func (q *Queries) DeleteResult(ctx context.Context, resultID int) error {
+	return q.execOne(ctx, deleteResultQuery, pgx.NamedArgs{"id": resultID})
+}
+
+//
+// Tracks
+//
+
+// TrackInput struct, a GPS track to create. A zero ID means the next value of
+// the track ID sequence.
+type TrackInput struct {
+	TrackID  int
+	Name     string
+	Source   string
+	LinkHref string
+	LinkText string
+	Points   []TrackPointInput
+}
+
+// TrackPointInput struct, a point of a track in WGS 84 coordinates
+type TrackPointInput struct {
+	// Index of the segment of the track the point is in
+	Segment   int
+	Longitude float64
+	Latitude  float64
+	Elevation *float64
+	Time      *time.Time
+}
+
+const createTrackQuery = `
+INSERT INTO geog.tracks (track_id, name, src, link1_href, link1_text)
+VALUES (
+	COALESCE(
+		NULLIF(@track_id::int, 0),
+		nextval('geog.tracks_track_id_seq')
+	),
+	NULLIF(@name, ''),
+	NULLIF(@src, ''),
+	NULLIF(@link_href, ''),
+	NULLIF(@link_text, '')
+)
+RETURNING track_id;
+`
+
+// Points are numbered continuously across segments, as the elevation profile
+// orders the points of a track by track_seg_point_id alone. Points without an
+// elevation are given an elevation of 0 in the geometry.
+const createTrackPointsQuery = `
+INSERT INTO geog.track_points (
+	track_fid, track_seg_id, track_seg_point_id, ele, time, the_geom
+)
+SELECT
+	@track_id,
+	p.segment,
+	p.ordinality - 1,
+	p.elevation,
+	p.time,
+	ST_Transform(
+		ST_SetSRID(
+			ST_MakePoint(p.longitude, p.latitude, COALESCE(p.elevation, 0)),
+			4326
+		),
+		23031
+	)
+FROM unnest(
+	@segments::int[],
+	@longitudes::float8[],
+	@latitudes::float8[],
+	@elevations::float8[],
+	@times::timestamptz[]
+) WITH ORDINALITY AS p(segment, longitude, latitude, elevation, time, ordinality);
+`
+
+const setTrackGeometryQuery = `
+UPDATE geog.tracks
+SET the_geom = (
+	SELECT ST_MakeLine(the_geom ORDER BY track_seg_point_id)
+	FROM geog.track_points
+	WHERE track_fid = @track_id
+)
+WHERE track_id = @track_id;
+`
+
+// Create a track with its points, reprojected to EPSG:23031, and its line
+// geometry, returning its ID. It runs several statements, so should be run in
+// a transaction.
+func (q *Queries) CreateTrack(ctx context.Context, in TrackInput) (int, error) {
+	trackID, err := q.insertReturningID(ctx, createTrackQuery, pgx.NamedArgs{
+		"track_id":  in.TrackID,
+		"name":      in.Name,
+		"src":       in.Source,
+		"link_href": in.LinkHref,
+		"link_text": in.LinkText,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := len(in.Points)
+	segments := make([]int, n)
+	longitudes := make([]float64, n)
+	latitudes := make([]float64, n)
+	elevations := make([]*float64, n)
+	times := make([]*time.Time, n)
+	for i, point := range in.Points {
+		segments[i] = point.Segment
+		longitudes[i] = point.Longitude
+		latitudes[i] = point.Latitude
+		elevations[i] = point.Elevation
+		times[i] = point.Time
+	}
+	_, err = q.conn.Exec(ctx, createTrackPointsQuery, pgx.NamedArgs{
+		"track_id":   trackID,
+		"segments":   segments,
+		"longitudes": longitudes,
+		"latitudes":  latitudes,
+		"elevations": elevations,
+		"times":      times,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = q.execOne(ctx, setTrackGeometryQuery, pgx.NamedArgs{
+		"track_id": trackID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return trackID, nil
+}
+
+const linkStageTrackQuery = `
+UPDATE racedata.stages
+SET gpx_id = @track_id, gpx_accuracy = @accuracy
+WHERE stage_id = @stage_id;
+`
+
+// StageTrackLink struct, the track of a stage and how accurately it follows
+// the route of the stage
+type StageTrackLink struct {
+	StageID  int
+	TrackID  int
+	Accuracy string
+}
+
+// Set the track of a stage
+func (q *Queries) LinkStageTrack(
+	ctx context.Context, link StageTrackLink,
+) error {
+	return q.execOne(ctx, linkStageTrackQuery, pgx.NamedArgs{
+		"stage_id": link.StageID,
+		"track_id": link.TrackID,
+		"accuracy": link.Accuracy,
+	})
+}
+
+const refreshElevationQuery = `SELECT geog.refresh_elevation();`
+
+// Refresh the geog.elevation materialized view after tracks have changed
+func (q *Queries) RefreshElevation(ctx context.Context) error {
+	_, err := q.conn.Exec(ctx, refreshElevationQuery)
+	return err
+}
+
+// RefreshElevationAfterCommit refreshes the elevation profiles under the admin
+// role once new tracks have been committed, as the refresh reads every track.
+// The tracks are kept if it fails, so the failure is returned as a warning to
+// report with them, empty if the refresh succeeded.
+func RefreshElevationAfterCommit(ctx context.Context, conn Store) string {
+	err := conn.WithAdminTx(ctx, func(tx Store) error {
+		return tx.RefreshElevation(ctx)
+	})
+	if err != nil {
+		return "refreshing the elevation profiles: " + err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Entity recorded in the audit log when an archive is restored
+const EntityArchive = "archive"
+
+const getSchemaVersionQuery = `
+SELECT COALESCE(MAX(version), '') FROM migrations.schema_migrations;
+`
+
+// Get the version of the latest migration applied to the database
+func (q *Queries) GetSchemaVersion(ctx context.Context) (string, error) {
+	var version string
+	err := q.conn.QueryRow(ctx, getSchemaVersionQuery).Scan(&version)
+	if err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+const countRaceDataQuery = `
+SELECT
+	(SELECT COUNT(*) FROM racedata.races)
+	+ (SELECT COUNT(*) FROM racedata.stages)
+	+ (SELECT COUNT(*) FROM racedata.riders)
+	+ (SELECT COUNT(*) FROM racedata.teams)
+	+ (SELECT COUNT(*) FROM racedata.team_names)
+	+ (SELECT COUNT(*) FROM racedata.results)
+	+ (SELECT COUNT(*) FROM geog.tracks);
+`
+
+// Get the total number of races, stages, riders, teams, team names, results
+// and tracks
+func (q *Queries) CountRaceData(ctx context.Context) (int, error) {
+	var count int
+	err := q.conn.QueryRow(ctx, countRaceDataQuery).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// collectAll runs a query without arguments and collects its rows by name
+func collectAll[T any](
+	ctx context.Context, q *Queries, sql string,
+) ([]T, error) {
+	rows, err := q.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values, err := pgx.CollectRows(rows, pgx.RowToStructByName[T])
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+const exportRacesQuery = `
+SELECT race_id, gt AS grand_tour, year
+FROM racedata.races
+ORDER BY race_id;
+`
+
+// Get every race as it was created, ordered by ID
+func (q *Queries) ExportRaces(ctx context.Context) ([]RaceInput, error) {
+	return collectAll[RaceInput](ctx, q, exportRacesQuery)
+}
+
+const exportStagesQuery = `
+SELECT
+	stage_id,
+	race_id,
+	stage_number,
+	stage_type,
+	stage_length::float8 AS stage_length,
+	stage_start,
+	stage_end,
+	gpx_id,
+	gpx_accuracy
+FROM racedata.stages
+ORDER BY stage_id;
+`
+
+// Get every stage as it was created, ordered by ID
+func (q *Queries) ExportStages(ctx context.Context) ([]StageInput, error) {
+	return collectAll[StageInput](ctx, q, exportStagesQuery)
+}
+
+const exportRidersQuery = `
+SELECT rider_id, first_name, last_name
+FROM racedata.riders
+ORDER BY rider_id;
+`
+
+// Get every rider as they were created, ordered by ID
+func (q *Queries) ExportRiders(ctx context.Context) ([]RiderInput, error) {
+	return collectAll[RiderInput](ctx, q, exportRidersQuery)
+}
+
+const exportTeamsQuery = `
+SELECT team_id, name
+FROM racedata.teams
+ORDER BY team_id;
+`
+
+// Get every team as it was created, ordered by ID
+func (q *Queries) ExportTeams(ctx context.Context) ([]TeamInput, error) {
+	return collectAll[TeamInput](ctx, q, exportTeamsQuery)
+}
+
+const exportResultsQuery = `
+SELECT
+	result_id,
+	stage_id,
+	(rank).num AS rank,
+	(rank).info AS status,
+	classification,
+	team_id,
+	rider_id,
+	time,
+	points
+FROM racedata.results
+ORDER BY result_id;
+`
+
+// Get every result as it was created, ordered by ID. The classification is
+// scanned to its value, e.g. gc, and must be converted back to its database
+// label before the result is created again.
+func (q *Queries) ExportResults(ctx context.Context) ([]ResultInput, error) {
+	return collectAll[ResultInput](ctx, q, exportResultsQuery)
+}
+
+const getTrackIDsQuery = `SELECT track_id FROM geog.tracks ORDER BY track_id;`
+
+// Get the ID of every track, in order
+func (q *Queries) GetTrackIDs(ctx context.Context) ([]int, error) {
+	rows, err := q.conn.Query(ctx, getTrackIDsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+const exportTrackQuery = `
+SELECT
+	track_id,
+	COALESCE(name, '') AS name,
+	COALESCE(src, '') AS source,
+	COALESCE(link1_href, '') AS link_href,
+	COALESCE(link1_text, '') AS link_text
+FROM geog.tracks
+WHERE track_id = $1;
+`
+
+const exportTrackPointsQuery = `
+SELECT
+	COALESCE(track_seg_id, 0) AS segment,
+	ST_X(ST_Transform(the_geom, 4326)) AS longitude,
+	ST_Y(ST_Transform(the_geom, 4326)) AS latitude,
+	ele AS elevation,
+	time
+FROM geog.track_points
+WHERE track_fid = $1
+ORDER BY track_seg_point_id;
+`
+
+// exportedTrack is a track without its points, which are queried separately
+type exportedTrack struct {
+	TrackID  int
+	Name     string
+	Source   string
+	LinkHref string
+	LinkText string
+}
+
+// Get a track with its points in WGS 84 coordinates, as it was created
+func (q *Queries) ExportTrack(
+	ctx context.Context, trackID int,
+) (TrackInput, error) {
+	rows, err := q.conn.Query(ctx, exportTrackQuery, trackID)
+	if err != nil {
+		return TrackInput{}, err
+	}
+	defer rows.Close()
+
+	track, err := pgx.CollectOneRow(
+		rows, pgx.RowToStructByName[exportedTrack],
+	)
+	if err != nil {
+		return TrackInput{}, err
+	}
+
+	rows, err = q.conn.Query(ctx, exportTrackPointsQuery, trackID)
+	if err != nil {
+		return TrackInput{}, err
+	}
+	defer rows.Close()
+
+	points, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[TrackPointInput],
+	)
+	if err != nil {
+		return TrackInput{}, err
+	}
+	return TrackInput{
+		TrackID:  track.TrackID,
+		Name:     track.Name,
+		Source:   track.Source,
+		LinkHref: track.LinkHref,
+		LinkText: track.LinkText,
+		Points:   points,
+	}, nil
+}
+
+const resetIDSequencesQuery = `
+SELECT
+	setval(
+		'racedata.races_race_id_seq',
+		(SELECT COALESCE(MAX(race_id), 0) + 1 FROM racedata.races),
+		false
+	),
+	setval(
+		'racedata.stages_stage_id_seq',
+		(SELECT COALESCE(MAX(stage_id), 0) + 1 FROM racedata.stages),
+		false
+	),
+	setval(
+		'racedata.riders_rider_id_seq',
+		(SELECT COALESCE(MAX(rider_id), 0) + 1 FROM racedata.riders),
+		false
+	),
+	setval(
+		'racedata.teams_team_id_seq',
+		(SELECT COALESCE(MAX(team_id), 0) + 1 FROM racedata.teams),
+		false
+	),
+	setval(
+		'racedata.results_result_id_seq',
+		(SELECT COALESCE(MAX(result_id), 0) + 1 FROM racedata.results),
+		false
+	),
+	setval(
+		'geog.tracks_track_id_seq',
+		(SELECT COALESCE(MAX(track_id), 0) + 1 FROM geog.tracks),
+		false
+	);
+`
+
+// Make the ID sequences continue after the highest IDs, after rows have been
+// created with their IDs
+func (q *Queries) ResetIDSequences(ctx context.Context) error {
+	_, err := q.conn.Exec(ctx, resetIDSequencesQuery)
+	return err
+}
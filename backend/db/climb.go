@@ -0,0 +1,119 @@
+package db
+
+import "golang.org/x/exp/slices"
+
+// ClimbParams controls which sections of an elevation profile are detected
+// as climbs.
+type ClimbParams struct {
+	// Minimum elevation gain of a climb in meters
+	MinElevationGain float64
+	// Minimum average gradient of a climb as a percentage
+	MinAverageGradient float64
+	// Maximum descent in meters allowed within a climb before it is ended
+	MaxDescent float64
+}
+
+func DefaultClimbParams() ClimbParams {
+	return ClimbParams{
+		MinElevationGain:   100,
+		MinAverageGradient: 3,
+		MaxDescent:         30,
+	}
+}
+
+// Climb struct
+type Climb struct {
+	Start           ElevationPoint `json:"start"`
+	Top             ElevationPoint `json:"top"`
+	Length          float64        `json:"length"`
+	ElevationGain   float64        `json:"elevation_gain"`
+	AverageGradient float64        `json:"average_gradient"`
+	// Indices of the start and top of the climb in the elevation points
+	StartIndex int `json:"-"`
+	TopIndex   int `json:"-"`
+}
+
+func newClimb(elevationPoints []ElevationPoint, start, top int) Climb {
+	startPoint := elevationPoints[start]
+	topPoint := elevationPoints[top]
+	length := topPoint.Distance - startPoint.Distance
+	gain := topPoint.Elevation - startPoint.Elevation
+	return Climb{
+		Start:           startPoint,
+		Top:             topPoint,
+		Length:          length,
+		ElevationGain:   gain,
+		AverageGradient: calculateGradient(gain, length),
+		StartIndex:      start,
+		TopIndex:        top,
+	}
+}
+
+// Move the start of a climb forward past any flat or descending ground, so
+// that a long approach does not dilute the average gradient.
+func trimClimbStart(
+	elevationPoints []ElevationPoint, start, top int, minGradient float64,
+) int {
+	for start < top {
+		next := elevationPoints[start+1]
+		current := elevationPoints[start]
+		changeDist := next.Distance - current.Distance
+		if changeDist > 0 && calculateGradient(
+			next.Elevation-current.Elevation, changeDist,
+		) >= minGradient {
+			break
+		}
+		start++
+	}
+	return start
+}
+
+// DetectClimbs finds the climbs in an elevation profile.
+//
+// A climb runs from a low point to the highest point reached before the road
+// descends by more than MaxDescent. Climbs that do not meet the minimum
+// elevation gain and average gradient are discarded. The elevation points are
+// sorted by distance in place, and the indices of the returned climbs refer to
+// the sorted points.
+func DetectClimbs(
+	elevationPoints []ElevationPoint, params ClimbParams,
+) []Climb {
+	if !isSorted(elevationPoints) {
+		slices.SortFunc(elevationPoints, cmpElevationPoint)
+	}
+
+	climbs := []Climb{}
+	if len(elevationPoints) < 2 {
+		return climbs
+	}
+
+	addClimb := func(start, top int) {
+		start = trimClimbStart(
+			elevationPoints, start, top, params.MinAverageGradient,
+		)
+		if start >= top {
+			return
+		}
+		climb := newClimb(elevationPoints, start, top)
+		if climb.ElevationGain >= params.MinElevationGain &&
+			climb.AverageGradient >= params.MinAverageGradient {
+			climbs = append(climbs, climb)
+		}
+	}
+
+	start, top := 0, 0
+	for i := 1; i < len(elevationPoints); i++ {
+		elevation := elevationPoints[i].Elevation
+		switch {
+		case elevation > elevationPoints[top].Elevation:
+			top = i
+		case elevationPoints[top].Elevation-elevation > params.MaxDescent,
+			elevation < elevationPoints[start].Elevation:
+			addClimb(start, top)
+			start, top = i, i
+		}
+	}
+	addClimb(start, top)
+
+	return climbs
+}
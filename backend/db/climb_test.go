@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func TestDetectClimbs(t *testing.T) {
+	elevationPoints := []db.ElevationPoint{
+		{Distance: 0, Elevation: 100},
+		{Distance: 500, Elevation: 100},
+		{Distance: 1000, Elevation: 101},
+		{Distance: 2000, Elevation: 160},
+		{Distance: 3000, Elevation: 220},
+		{Distance: 3500, Elevation: 200},
+		{Distance: 4000, Elevation: 260},
+		{Distance: 5000, Elevation: 330},
+		{Distance: 6000, Elevation: 200},
+		{Distance: 7000, Elevation: 100},
+		{Distance: 8000, Elevation: 140},
+		{Distance: 9000, Elevation: 100},
+	}
+
+	climbs := db.DetectClimbs(elevationPoints, db.DefaultClimbParams())
+	if len(climbs) != 1 {
+		t.Fatalf("expected 1 climb, got %d", len(climbs))
+	}
+
+	climb := climbs[0]
+	if climb.StartIndex != 2 {
+		t.Errorf("expected climb to start at index 2, got %d", climb.StartIndex)
+	}
+	if climb.TopIndex != 7 {
+		t.Errorf("expected climb top at index 7, got %d", climb.TopIndex)
+	}
+	const epsilon = 0.0001
+	if !approxEqual(climb.Length, 4000, epsilon) {
+		t.Errorf("expected length 4000, got %f", climb.Length)
+	}
+	if !approxEqual(climb.ElevationGain, 229, epsilon) {
+		t.Errorf("expected elevation gain 229, got %f", climb.ElevationGain)
+	}
+	if !approxEqual(climb.AverageGradient, 5.725, epsilon) {
+		t.Errorf(
+			"expected average gradient 5.725, got %f", climb.AverageGradient,
+		)
+	}
+}
+
+func TestDetectClimbsFlat(t *testing.T) {
+	elevationPoints := []db.ElevationPoint{
+		{Distance: 0, Elevation: 10},
+		{Distance: 1000, Elevation: 12},
+		{Distance: 2000, Elevation: 11},
+	}
+
+	climbs := db.DetectClimbs(elevationPoints, db.DefaultClimbParams())
+	if len(climbs) != 0 {
+		t.Fatalf("expected no climbs, got %d", len(climbs))
+	}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// StageCursor marks a position in a sorted list of stages. It holds the sort
+// order and the sort value and ID of the last stage on a page, so that the
+// next page starts after it.
+type StageCursor struct {
+	Sort      StageSort `json:"s"`
+	Desc      bool      `json:"d"`
+	SortValue float64   `json:"v"`
+	StageID   int       `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL safe string.
+func (c StageCursor) Encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeStageCursor parses a cursor returned by StageCursor.Encode.
+func DecodeStageCursor(s string) (StageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return StageCursor{}, errors.New("invalid cursor")
+	}
+	var c StageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return StageCursor{}, errors.New("invalid cursor")
+	}
+	if !c.Sort.IsValid() {
+		return StageCursor{}, errors.New("invalid cursor")
+	}
+	return c, nil
+}
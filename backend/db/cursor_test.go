@@ -0,0 +1,36 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func TestStageCursor(t *testing.T) {
+	cursor := db.StageCursor{
+		Sort:      db.StageSortLength,
+		Desc:      true,
+		SortValue: 185.3,
+		StageID:   42,
+	}
+
+	encoded, err := cursor.Encode()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	decoded, err := db.DecodeStageCursor(encoded)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if decoded != cursor {
+		t.Errorf("expected %+v, got %+v", cursor, decoded)
+	}
+
+	badCursors := []string{"not a cursor", "e30", "eyJzIjoibmFtZSJ9"}
+	for _, bad := range badCursors {
+		if _, err := db.DecodeStageCursor(bad); err == nil {
+			t.Errorf("expected error for cursor %s, got nil", bad)
+		}
+	}
+}
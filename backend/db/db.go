@@ -15,6 +15,7 @@ type DBConn interface {
 	Exec(
 		ctx context.Context, sql string, arguments ...any,
 	) (commandTag pgconn.CommandTag, err error)
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 type Queries struct {
@@ -26,6 +27,40 @@ func (q *Queries) WithConn(conn DBConn) *Queries {
 	return q
 }
 
+// WithTx runs fn with queries in a transaction, which is committed if fn
+// returns nil and rolled back otherwise.
+func (q *Queries) WithTx(
+	ctx context.Context, fn func(tx Store) error,
+) error {
+	tx, err := q.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(New(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// The server's user is granted the admin role without inheriting it, so it
+// can only change the race data in a transaction that sets the role.
+const setAdminRoleQuery = `SET LOCAL ROLE stagehunter_admin;`
+
+// WithAdminTx runs fn with queries in a transaction under the admin role,
+// which is committed if fn returns nil and rolled back otherwise.
+func (q *Queries) WithAdminTx(
+	ctx context.Context, fn func(tx Store) error,
+) error {
+	return q.WithTx(ctx, func(tx Store) error {
+		if _, err := tx.(*Queries).conn.Exec(ctx, setAdminRoleQuery); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
 func New(conn DBConn) *Queries {
 	return &Queries{conn: conn}
 }
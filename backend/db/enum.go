@@ -1,8 +1,11 @@
 package db
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
 type EnumValue interface {
@@ -34,3 +37,41 @@ func IsValidValue[T EnumValue](value T, mapping EnumMap[T]) bool {
 	_, ok := mapping[string(value)]
 	return ok
 }
+
+// EnumKey returns the database label of an enum value.
+func EnumKey[T EnumValue](value T, mapping EnumMap[T]) (string, error) {
+	for key, v := range mapping {
+		if v == value {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported value: %s", value)
+}
+
+// ParseEnum parses an enum value from either its database label or its value,
+// ignoring case and accents.
+func ParseEnum[T EnumValue](s string, mapping EnumMap[T]) (T, error) {
+	for key, v := range mapping {
+		if lib.AreNormEqual(s, key) || lib.AreNormEqual(s, string(v)) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported value: %s", s)
+}
+
+// unmarshalEnumJSON parses an enum value from a JSON string with the given
+// parse function.
+func unmarshalEnumJSON[T EnumValue](
+	dest *T, data []byte, parse func(string) (T, error),
+) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	value, err := parse(s)
+	if err != nil {
+		return err
+	}
+	*dest = value
+	return nil
+}
@@ -0,0 +1,50 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func TestParseGrandTour(t *testing.T) {
+	testPairs := []struct {
+		input    string
+		expected db.GrandTour
+	}{
+		{"TOUR", db.GrandTourTour},
+		{"giro", db.GrandTourGiro},
+		{"Tour de France", db.GrandTourTour},
+		{"vuelta a espana", db.GrandTourVuelta},
+	}
+	for _, pair := range testPairs {
+		actual, err := db.ParseGrandTour(pair.input)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if actual != pair.expected {
+			t.Errorf("expected %s, got %s", pair.expected, actual)
+		}
+	}
+
+	if _, err := db.ParseGrandTour("Tour of Britain"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestEnumValue(t *testing.T) {
+	value, err := db.GrandTourVuelta.Value()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != "VUELTA" {
+		t.Errorf("expected VUELTA, got %v", value)
+	}
+
+	value, err = db.StageTypePrologue.Value()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != "PROLOGUE" {
+		t.Errorf("expected PROLOGUE, got %v", value)
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HeadToHeadStage struct, a stage where two riders, A and B, both have a valid
+// stage result
+type HeadToHeadStage struct {
+	RaceID int
+	RaceStage
+	RankA int
+	RankB int
+	// Stage time of A minus stage time of B, negative when A finished ahead
+	TimeDelta Duration
+	// Ranks in the general classification after the stage
+	GCRankA pgtype.Int8
+	GCRankB pgtype.Int8
+}
+
+// HeadToHeadRace struct, the final general classification ranks of two riders
+// who both finished a race
+type HeadToHeadRace struct {
+	RaceID    int       `json:"race_id"`
+	GrandTour GrandTour `json:"grand_tour"`
+	Year      int       `json:"year"`
+	GCRankA   int       `json:"gc_rank_a"`
+	GCRankB   int       `json:"gc_rank_b"`
+}
+
+// HeadToHeadSummary struct, aggregate statistics of a head to head
+type HeadToHeadSummary struct {
+	Stages int
+	// Number of stages each rider finished ahead of the other
+	WinsA int
+	WinsB int
+	// Mean of the stage time deltas, negative when A was ahead on average
+	AverageGap time.Duration
+	// Races both riders finished, and the number each finished ahead on GC
+	Races   []HeadToHeadRace
+	GCWinsA int
+	GCWinsB int
+}
+
+// HeadToHead struct, the stages two riders both finished and their summary
+type HeadToHead struct {
+	Stages  []HeadToHeadStage
+	Summary HeadToHeadSummary
+}
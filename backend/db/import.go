@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const getAllRidersQuery = `
+SELECT
+	rider_id,
+	first_name,
+	last_name,
+	first_name || ' ' || last_name AS name
+FROM racedata.riders
+ORDER BY rider_id;
+`
+
+// Get every rider, ordered by ID
+func (q *Queries) GetAllRiders(ctx context.Context) ([]Rider, error) {
+	rows, err := q.conn.Query(ctx, getAllRidersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	riders, err := pgx.CollectRows(rows, pgx.RowToStructByName[Rider])
+	if err != nil {
+		return nil, err
+	}
+	return riders, nil
+}
+
+const getAllTeamsQuery = `
+SELECT team_id, name
+FROM racedata.teams
+ORDER BY team_id;
+`
+
+// Get every team, ordered by ID
+func (q *Queries) GetAllTeams(ctx context.Context) ([]Team, error) {
+	rows, err := q.conn.Query(ctx, getAllTeamsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams, err := pgx.CollectRows(rows, pgx.RowToStructByName[Team])
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+const getAllTeamNamesQuery = `
+SELECT team_id, year, name
+FROM racedata.team_names
+ORDER BY team_id, year;
+`
+
+// Get the names of every team by year, ordered by team ID and year
+func (q *Queries) GetAllTeamNames(ctx context.Context) ([]TeamName, error) {
+	rows, err := q.conn.Query(ctx, getAllTeamNamesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := pgx.CollectRows(rows, pgx.RowToStructByName[TeamName])
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// StageResultsCount struct, the number of results of a stage in a
+// classification. The classification is given by its database label.
+type StageResultsCount struct {
+	StageID        int
+	Classification string
+	Count          int
+}
+
+const getRaceResultsCountsQuery = `
+SELECT
+	res.stage_id,
+	res.classification::text AS classification,
+	COUNT(*) AS count
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+WHERE s.race_id = $1
+GROUP BY res.stage_id, res.classification
+ORDER BY res.stage_id, res.classification;
+`
+
+// Get the number of results, valid or not, of each stage of a race in each
+// classification
+func (q *Queries) GetRaceResultsCounts(
+	ctx context.Context, raceID int,
+) ([]StageResultsCount, error) {
+	rows, err := q.conn.Query(ctx, getRaceResultsCountsQuery, raceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[StageResultsCount],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+const deleteStageResultsQuery = `
+DELETE FROM racedata.results
+WHERE stage_id = @stage_id AND classification = @classification;
+`
+
+// Delete every result of a stage in a classification, returning the number
+// of results deleted
+func (q *Queries) DeleteStageResults(
+	ctx context.Context, stageID int, classification Classification,
+) (int64, error) {
+	tag, err := q.conn.Exec(ctx, deleteStageResultsQuery, pgx.NamedArgs{
+		"stage_id":       stageID,
+		"classification": classification,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RaceResult struct, a result of a race with the names of its rider and team,
+// as written in a results file. The classification is given by its database
+// label. The rank is null for results that are not valid.
+type RaceResult struct {
+	StageNumber    int
+	Classification string
+	Rank           pgtype.Int8
+	Status         RankStatus
+	FirstName      pgtype.Text
+	LastName       pgtype.Text
+	Team           string
+	Time           Duration
+	Points         pgtype.Int8
+}
+
+const getRaceResultsQuery = `
+SELECT
+	s.stage_number,
+	res.classification::text AS classification,
+	(res.rank).num AS rank,
+	(res.rank).info AS status,
+	r.first_name,
+	r.last_name,
+	t.name AS team,
+	res.time,
+	res.points
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+LEFT JOIN racedata.riders r ON res.rider_id = r.rider_id
+JOIN racedata.teams t ON res.team_id = t.team_id
+WHERE s.race_id = $1
+ORDER BY
+	s.stage_number,
+	res.classification,
+	(res.rank).info = 'VAL' DESC,
+	(res.rank).num,
+	(res.rank).info,
+	r.last_name,
+	t.name;
+`
+
+// Get every result of a race, ordered by stage, classification and rank with
+// the results that are not valid last
+func (q *Queries) GetRaceResults(
+	ctx context.Context, raceID int,
+) ([]RaceResult, error) {
+	rows, err := q.conn.Query(ctx, getRaceResultsQuery, raceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := pgx.CollectRows(rows, pgx.RowToStructByName[RaceResult])
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Limits mirroring the constraints of the racedata schema
+const (
+	MinStageNumber = 0
+	MaxStageNumber = 21
+	// The first Tour de France was held in 1903
+	MinRaceYear = 1903
+)
+
+// ValidationError lists every problem found when validating an input.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid input: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ValidationError) add(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// NewValidationError marks an error as caused by the input, e.g. an imported
+// file, rather than by the database.
+func NewValidationError(err error) error {
+	return &ValidationError{Problems: []string{err.Error()}}
+}
+
+// IsValidationError reports whether err is or wraps a ValidationError.
+func IsValidationError(err error) bool {
+	var validationErr *ValidationError
+	return errors.As(err, &validationErr)
+}
+
+// RaceInput struct, a race to create or update. A zero ID on creation means
+// the next value of the race ID sequence.
+type RaceInput struct {
+	RaceID    int       `json:"race_id"`
+	GrandTour GrandTour `json:"grand_tour"`
+	Year      int       `json:"year"`
+}
+
+func (in RaceInput) Validate() error {
+	var v ValidationError
+	if in.RaceID < 0 {
+		v.add("race_id must not be negative")
+	}
+	if _, err := EnumKey(in.GrandTour, grandTourMapping); err != nil {
+		v.add("grand_tour must be one of TOUR, GIRO or VUELTA")
+	}
+	if in.Year < MinRaceYear {
+		v.add("year must be %d or later", MinRaceYear)
+	}
+	return v.err()
+}
+
+// StageInput struct, a stage to create or update. A zero ID on creation
+// means the next value of the stage ID sequence.
+type StageInput struct {
+	StageID     int       `json:"stage_id"`
+	RaceID      int       `json:"race_id"`
+	StageNumber int       `json:"stage_no"`
+	StageType   StageType `json:"stage_type"`
+	StageLength float64   `json:"stage_length"`
+	StageStart  string    `json:"stage_start"`
+	StageEnd    string    `json:"stage_end"`
+	GPXID       int       `json:"gpx_id"`
+	GPXAccuracy string    `json:"gpx_accuracy"`
+}
+
+func (in StageInput) Validate() error {
+	var v ValidationError
+	if in.StageID < 0 {
+		v.add("stage_id must not be negative")
+	}
+	if in.RaceID <= 0 {
+		v.add("race_id is required")
+	}
+	if in.StageNumber < MinStageNumber || in.StageNumber > MaxStageNumber {
+		v.add(
+			"stage_no must be between %d and %d",
+			MinStageNumber, MaxStageNumber,
+		)
+	}
+	if _, err := EnumKey(in.StageType, stageTypeMapping); err != nil {
+		v.add("stage_type must be one of ROAD, ITT, TTT or PROLOGUE")
+	}
+	if in.StageLength <= 0 {
+		v.add("stage_length must be positive")
+	}
+	if strings.TrimSpace(in.StageStart) == "" {
+		v.add("stage_start is required")
+	}
+	if strings.TrimSpace(in.StageEnd) == "" {
+		v.add("stage_end is required")
+	}
+	if in.GPXID <= 0 {
+		v.add("gpx_id is required")
+	}
+	if strings.TrimSpace(in.GPXAccuracy) == "" {
+		v.add("gpx_accuracy is required")
+	}
+	return v.err()
+}
+
+// RiderInput struct, a rider to create or update. A zero ID on creation
+// means the next value of the rider ID sequence.
+type RiderInput struct {
+	RiderID   int    `json:"rider_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+func (in RiderInput) Validate() error {
+	var v ValidationError
+	if in.RiderID < 0 {
+		v.add("rider_id must not be negative")
+	}
+	if strings.TrimSpace(in.FirstName) == "" {
+		v.add("first_name is required")
+	}
+	if strings.TrimSpace(in.LastName) == "" {
+		v.add("last_name is required")
+	}
+	return v.err()
+}
+
+// TeamInput struct, a team to create or update. A zero ID on creation means
+// the next value of the team ID sequence.
+type TeamInput struct {
+	TeamID int    `json:"team_id"`
+	Name   string `json:"name"`
+}
+
+func (in TeamInput) Validate() error {
+	var v ValidationError
+	if in.TeamID < 0 {
+		v.add("team_id must not be negative")
+	}
+	if strings.TrimSpace(in.Name) == "" {
+		v.add("name is required")
+	}
+	return v.err()
+}
+
+// ResultInput struct, a result to create or update. The classification is
+// given by its database label, e.g. general. A zero ID on creation means the
+// next value of the result ID sequence. Only valid results have a rank, as
+// the rank of the others is stored as NULL.
+type ResultInput struct {
+	ResultID       int            `json:"result_id"`
+	StageID        int            `json:"stage_id"`
+	Rank           *int           `json:"rank"`
+	Status         RankStatus     `json:"status"`
+	Classification Classification `json:"classification"`
+	TeamID         int            `json:"team_id"`
+	RiderID        *int           `json:"rider_id"`
+	Time           Duration       `json:"time"`
+	Points         *int           `json:"points"`
+}
+
+// Classifications ranked by points rather than time
+var pointsClassifications = map[Classification]bool{
+	ClassificationPoints:    true,
+	ClassificationMountains: true,
+}
+
+// Validate checks the result against the constraints of racedata.results:
+// points classifications have no time and the others no points, a result
+// never has both, and teams classification results have no rider while all
+// others do.
+func (in ResultInput) Validate() error {
+	var v ValidationError
+	if in.ResultID < 0 {
+		v.add("result_id must not be negative")
+	}
+	if in.StageID <= 0 {
+		v.add("stage_id is required")
+	}
+	if in.TeamID <= 0 {
+		v.add("team_id is required")
+	}
+	status := in.Status
+	if status == "" {
+		status = RankStatusValid
+	}
+	if !status.IsValid() {
+		v.add("status must be one of VAL, DNF, DNS, OTL, DF, NR or DSQ")
+	}
+	if status == RankStatusValid && (in.Rank == nil || *in.Rank < 1) {
+		v.add("rank must be positive for a valid result")
+	}
+	if status != RankStatusValid && in.Rank != nil {
+		v.add("rank must not be given for a result with status %s", status)
+	}
+
+	if !in.Classification.IsValid() {
+		v.add(
+			"classification must be one of stage, general, points, " +
+				"mountains, youth or teams",
+		)
+		return v.err()
+	}
+	if in.Time.Valid && in.Points != nil {
+		v.add("a result cannot have both a time and points")
+	}
+	if pointsClassifications[in.Classification] {
+		if in.Time.Valid {
+			v.add("%s results cannot have a time", in.Classification)
+		}
+	} else if in.Points != nil {
+		v.add("%s results cannot have points", in.Classification)
+	}
+	if in.Classification == ClassificationTeams {
+		if in.RiderID != nil {
+			v.add("teams results cannot have a rider")
+		}
+	} else if in.RiderID == nil {
+		v.add("%s results must have a rider", in.Classification)
+	}
+	return v.err()
+}
+
+// RankStatusOrValid returns the status of the result, VAL if not given.
+func (in ResultInput) RankStatusOrValid() RankStatus {
+	if in.Status == "" {
+		return RankStatusValid
+	}
+	return in.Status
+}
+
+// ResultsBatch struct, results to create, update and delete together
+type ResultsBatch struct {
+	Create []ResultInput `json:"create"`
+	Update []ResultInput `json:"update"`
+	Delete []int         `json:"delete"`
+}
+
+// Validate validates every result of the batch, prefixing the problems with
+// the position of the result in the batch.
+func (b ResultsBatch) Validate() error {
+	var v ValidationError
+	addAll := func(kind string, i int, err error) {
+		var resultErr *ValidationError
+		if errors.As(err, &resultErr) {
+			for _, problem := range resultErr.Problems {
+				v.add("%s[%d]: %s", kind, i, problem)
+			}
+		}
+	}
+	for i, result := range b.Create {
+		addAll("create", i, result.Validate())
+	}
+	for i, result := range b.Update {
+		if result.ResultID <= 0 {
+			v.add("update[%d]: result_id is required", i)
+		}
+		addAll("update", i, result.Validate())
+	}
+	for i, resultID := range b.Delete {
+		if resultID <= 0 {
+			v.add("delete[%d]: result_id must be positive", i)
+		}
+	}
+	if len(b.Create)+len(b.Update)+len(b.Delete) == 0 {
+		v.add("batch is empty")
+	}
+	return v.err()
+}
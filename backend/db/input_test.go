@@ -0,0 +1,182 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func TestStageInputValidate(t *testing.T) {
+	valid := db.StageInput{
+		RaceID:      1,
+		StageNumber: 21,
+		StageType:   db.StageTypeRoad,
+		StageLength: 115.5,
+		StageStart:  "Monaco",
+		StageEnd:    "Nice",
+		GPXID:       1,
+		GPXAccuracy: "exact",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	for _, stageNumber := range []int{-1, 22} {
+		invalid := valid
+		invalid.StageNumber = stageNumber
+		err := invalid.Validate()
+		if !db.IsValidationError(err) {
+			t.Errorf("stage %d: expected a validation error", stageNumber)
+		}
+	}
+}
+
+func TestResultInputValidate(t *testing.T) {
+	riderID := 7
+	first := 1
+	points := 50
+	stageTime := db.Duration{Duration: 4 * time.Hour, Valid: true}
+
+	testCases := []struct {
+		name    string
+		input   db.ResultInput
+		problem string
+	}{
+		{
+			name: "valid stage result",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "stage", TeamID: 2,
+				RiderID: &riderID, Time: stageTime,
+			},
+		},
+		{
+			name: "valid teams result",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "teams", TeamID: 2,
+				Time: stageTime,
+			},
+		},
+		{
+			name: "non-finisher without rank",
+			input: db.ResultInput{
+				StageID: 1, Status: db.RankStatusDidNotFinish,
+				Classification: "general", TeamID: 2, RiderID: &riderID,
+			},
+		},
+		{
+			name: "non-finisher with rank",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Status: db.RankStatusDidNotFinish,
+				Classification: "general", TeamID: 2, RiderID: &riderID,
+			},
+			problem: "rank must not be given for a result with status DNF",
+		},
+		{
+			name: "valid result without rank",
+			input: db.ResultInput{
+				StageID: 1, Classification: "general", TeamID: 2,
+				RiderID: &riderID,
+			},
+			problem: "rank must be positive for a valid result",
+		},
+		{
+			name: "points in a time classification",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "general", TeamID: 2,
+				RiderID: &riderID, Points: &points,
+			},
+			problem: "general results cannot have points",
+		},
+		{
+			name: "time in a points classification",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "mountains", TeamID: 2,
+				RiderID: &riderID, Time: stageTime,
+			},
+			problem: "mountains results cannot have a time",
+		},
+		{
+			name: "both time and points",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "points", TeamID: 2,
+				RiderID: &riderID, Time: stageTime, Points: &points,
+			},
+			problem: "cannot have both a time and points",
+		},
+		{
+			name: "rider in teams classification",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "teams", TeamID: 2,
+				RiderID: &riderID,
+			},
+			problem: "teams results cannot have a rider",
+		},
+		{
+			name: "no rider in rider classification",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "youth", TeamID: 2,
+			},
+			problem: "youth results must have a rider",
+		},
+		{
+			name: "unknown classification",
+			input: db.ResultInput{
+				StageID: 1, Rank: &first, Classification: "gc", TeamID: 2,
+				RiderID: &riderID,
+			},
+			problem: "classification must be one of",
+		},
+	}
+
+	for _, tc := range testCases {
+		err := tc.input.Validate()
+		if tc.problem == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.problem) {
+			t.Errorf("%s: expected %q, got %v", tc.name, tc.problem, err)
+		}
+	}
+}
+
+func TestResultsBatchValidate(t *testing.T) {
+	riderID := 7
+	first, second := 1, 2
+	batch := db.ResultsBatch{
+		Create: []db.ResultInput{
+			{
+				StageID: 1, Rank: &first, Classification: "stage", TeamID: 2,
+				RiderID: &riderID,
+			},
+			{StageID: 1, Rank: &second, Classification: "stage", TeamID: 2},
+		},
+		Update: []db.ResultInput{
+			{StageID: 1, Rank: &first, Classification: "teams", TeamID: 2},
+		},
+	}
+
+	err := batch.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, problem := range []string{
+		"create[1]: stage results must have a rider",
+		"update[0]: result_id is required",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %q in %v", problem, err)
+		}
+	}
+	if strings.Contains(err.Error(), "create[0]") {
+		t.Errorf("expected the first result to be valid, got %v", err)
+	}
+
+	if err := (db.ResultsBatch{}).Validate(); err == nil {
+		t.Error("expected an empty batch to be invalid")
+	}
+}
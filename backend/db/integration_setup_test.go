@@ -0,0 +1,63 @@
+//go:build integration
+
+// The integration tests run the queries against a Postgres database with
+// PostGIS. They are built with the integration tag and skipped unless
+// TEST_DATABASE_URL is set to a server on which a database is created for the
+// test run, and dropped afterwards, see package dbtest.
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/db/dbtest"
+)
+
+// Connections to the test database, and its queries, seeded with the default
+// fixtures. Both are nil if TEST_DATABASE_URL is not set.
+var (
+	testPool    *pgxpool.Pool
+	testQueries *db.Queries
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	url := os.Getenv(dbtest.URLEnv)
+	if url == "" {
+		return m.Run()
+	}
+
+	ctx := context.Background()
+	pool, cleanup, err := dbtest.Create(ctx, url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating the test database: %v\n", err)
+		return 1
+	}
+	defer cleanup()
+
+	testPool = pool
+	testQueries = db.New(pool)
+	if err := dbtest.Seed(ctx, testQueries); err != nil {
+		fmt.Fprintf(os.Stderr, "seeding the test database: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// integrationQueries returns the queries of the test database, skipping the
+// test if there is none.
+func integrationQueries(t *testing.T) *db.Queries {
+	t.Helper()
+	if testQueries == nil {
+		t.Skipf("%s is not set", dbtest.URLEnv)
+	}
+	return testQueries
+}
@@ -0,0 +1,1061 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+	"github.com/michaelbennett99/stagehunter/backend/migrate"
+)
+
+// Relative tolerances of floats. Lengths are computed by the database in
+// EPSG:23031 or on the spheroid, and by the memstore on a sphere.
+const (
+	exact     = 1e-9
+	geometric = 1e-2
+)
+
+var errRollback = errors.New("rollback")
+
+// newMemstore returns a memstore with the same data as the test database.
+func newMemstore(t *testing.T) *memstore.Store {
+	t.Helper()
+	store := memstore.Default()
+	if err := store.ScheduleDailyStage(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// query is a read of a store, whose result is compared between the test
+// database and the memstore
+type query struct {
+	name      string
+	run       func(ctx context.Context, store db.Store) (any, error)
+	tolerance float64
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func readQueries() []query {
+	var queries []query
+	add := func(
+		name string,
+		tolerance float64,
+		run func(ctx context.Context, store db.Store) (any, error),
+	) {
+		queries = append(queries, query{name, run, tolerance})
+	}
+	const numStages = 5
+	simplification := db.TrackSimplification{Precision: 5}
+
+	// Daily and random stages
+	add("GetDailyStage", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetDailyStage(ctx)
+	})
+	add("GetAllStages", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetAllStages(ctx)
+	})
+
+	// Races and stages
+	add("GetRaces", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRaces(ctx, db.RacesQueryParams{})
+	})
+	add("GetRaces/Giro", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRaces(ctx, db.RacesQueryParams{
+			GrandTour: ptr(db.GrandTourGiro),
+		})
+	})
+	add("GetRaces/2023", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRaces(ctx, db.RacesQueryParams{Year: ptr(2023)})
+	})
+	add("GetRace/missing", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRace(ctx, 99)
+	})
+	for raceID := 1; raceID <= 2; raceID++ {
+		add(fmt.Sprintf("GetRace/%d", raceID), exact,
+			func(ctx context.Context, s db.Store) (any, error) {
+				return s.GetRace(ctx, raceID)
+			})
+		add(fmt.Sprintf("GetRaceStages/%d", raceID), exact,
+			func(ctx context.Context, s db.Store) (any, error) {
+				return s.GetRaceStages(ctx, raceID)
+			})
+	}
+	add("GetRaceStageByNumber", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRaceStageByNumber(ctx, db.RaceStageQueryParams{
+			RaceID: 2, StageNumber: 1,
+		})
+	})
+	add("GetStagePage", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetStagePage(ctx, db.StagePageQueryParams{
+			Limit: 2, Sort: db.StageSortLength, Desc: true,
+		})
+	})
+	add("GetStagePage/next", exact, func(ctx context.Context, s db.Store) (any, error) {
+		params := db.StagePageQueryParams{Limit: 2, Sort: db.StageSortYear}
+		page, err := s.GetStagePage(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if page.NextCursor == nil {
+			return nil, errors.New("no next page")
+		}
+		cursor, err := db.DecodeStageCursor(*page.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		params.Cursor = &cursor
+		return s.GetStagePage(ctx, params)
+	})
+	add("GetStagePage/filtered", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetStagePage(ctx, db.StagePageQueryParams{
+			Limit:     10,
+			Sort:      db.StageSortID,
+			StageType: ptr(db.StageTypeRoad),
+			MinLength: ptr(100.0),
+			Town:      ptr("bologna"),
+		})
+	})
+	add("GetStageInfo/missing", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetStageInfo(ctx, 99)
+	})
+
+	// Per stage
+	for stageID := 1; stageID <= numStages; stageID++ {
+		stage := func(name string) string {
+			return fmt.Sprintf("%s/%d", name, stageID)
+		}
+		add(stage("GetStageInfo"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetStageInfo(ctx, stageID)
+		})
+		add(stage("GetTrack"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTrack(ctx, db.TrackQueryParams{
+				StageID: stageID, TrackSimplification: simplification,
+			})
+		})
+		add(stage("GetGeometrySummary"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetGeometrySummary(ctx, stageID)
+		})
+		add(stage("GetTrackMetadata"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTrackMetadata(ctx, stageID)
+		})
+		add(stage("GetTrackPoints"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTrackPoints(ctx, stageID)
+		})
+		add(stage("GetElevationProfile"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetElevationProfile(ctx, stageID)
+		})
+		// The resolution is longer than every stage, so that the number of
+		// points does not depend on how the length is computed
+		add(stage("GetGradientProfile"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetGradientProfile(ctx, db.GradientQueryParams{
+				StageID: stageID, Resolution: 1e6,
+			})
+		})
+		add(stage("GetResults"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetResults(ctx, db.ResultsQueryParams{
+				StageID: stageID, TopN: 3,
+			})
+		})
+		add(stage("GetNonFinishers"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetNonFinishers(ctx, db.NonFinishersQueryParams{
+				StageID: stageID,
+			})
+		})
+		add(stage("GetRiders"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRiders(ctx, stageID)
+		})
+		add(stage("GetTeams"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeams(ctx, stageID)
+		})
+		add(stage("GetValidResultsCount"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetValidResultsCount(ctx, stageID)
+		})
+		add(stage("GetSearchCandidates"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetSearchCandidates(ctx, db.SearchCandidatesQueryParams{
+				StageID: ptr(stageID),
+			})
+		})
+		for _, classification := range []db.Classification{
+			"stage", "general", "points", "mountains", "youth", "teams",
+		} {
+			name := stage(string(classification))
+			add("GetResultsForClassification/"+name, exact,
+				func(ctx context.Context, s db.Store) (any, error) {
+					return s.GetResultsForClassification(
+						ctx, db.GetResultsForClassificationParams{
+							StageID:        stageID,
+							TopN:           10,
+							Classification: classification,
+						},
+					)
+				})
+			add("GetResultForRankAndClassification/"+name, exact,
+				func(ctx context.Context, s db.Store) (any, error) {
+					return s.GetResultForRankAndClassification(
+						ctx, db.GetResultForRankAndClassificationParams{
+							StageID:        stageID,
+							Rank:           2,
+							Classification: classification,
+						},
+					)
+				})
+		}
+	}
+	add("GetNonFinishers/classification", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetNonFinishers(ctx, db.NonFinishersQueryParams{
+			StageID:        5,
+			Classification: ptr(db.Classification("stage")),
+		})
+	})
+
+	// Per race
+	for raceID := 1; raceID <= 2; raceID++ {
+		race := func(name string) string {
+			return fmt.Sprintf("%s/%d", name, raceID)
+		}
+		add(race("GetRaceTracks"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceTracks(ctx, db.RaceTracksQueryParams{
+				RaceID: raceID, TrackSimplification: simplification,
+			})
+		})
+		add(race("GetRaceElevationProfiles"), geometric, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceElevationProfiles(ctx, raceID)
+		})
+		add(race("GetStandings"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetStandings(ctx, db.StandingsQueryParams{
+				RaceID: raceID, TopN: 3, Classification: "general",
+			})
+		})
+		add(race("GetRaceResultsCounts"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceResultsCounts(ctx, raceID)
+		})
+		add(race("GetRaceResults"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceResults(ctx, raceID)
+		})
+		add(race("GetRaceCheckedResults"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceCheckedResults(ctx, raceID)
+		})
+	}
+
+	// Riders and teams
+	add("SearchRiders", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.SearchRiders(ctx, db.RiderSearchQueryParams{Query: "og", Limit: 10})
+	})
+	add("SearchRiders/all", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.SearchRiders(ctx, db.RiderSearchQueryParams{Limit: 3})
+	})
+	add("GetRider/missing", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetRider(ctx, 99)
+	})
+	add("GetTeam/missing", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetTeam(ctx, 99)
+	})
+	for id := 1; id <= 5; id++ {
+		entity := func(name string) string {
+			return fmt.Sprintf("%s/%d", name, id)
+		}
+		add(entity("GetRider"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRider(ctx, id)
+		})
+		add(entity("GetRiderStageWins"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRiderStageWins(ctx, id)
+		})
+		add(entity("GetRiderPlacings"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRiderPlacings(ctx, id)
+		})
+		add(entity("GetRiderParticipations"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRiderParticipations(ctx, id)
+		})
+		add(entity("GetRiderTeams"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRiderTeams(ctx, id)
+		})
+		add(entity("GetTeam"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeam(ctx, id)
+		})
+		add(entity("GetTeamNames"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeamNames(ctx, id)
+		})
+		add(entity("GetTeamRosters"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeamRosters(ctx, db.TeamRostersQueryParams{TeamID: id})
+		})
+		add(entity("GetTeamStageWins"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeamStageWins(ctx, id)
+		})
+		add(entity("GetTeamPlacings"), exact, func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetTeamPlacings(ctx, id)
+		})
+	}
+	add("GetTeamRosters/race", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetTeamRosters(ctx, db.TeamRostersQueryParams{
+			TeamID: 4, RaceID: ptr(2),
+		})
+	})
+	add("GetHeadToHead", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetHeadToHead(ctx, db.HeadToHeadQueryParams{RiderA: 1, RiderB: 4})
+	})
+	add("GetHeadToHead/race", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetHeadToHead(ctx, db.HeadToHeadQueryParams{RiderA: 1, RiderB: 2})
+	})
+	add("GetHeadToHead/none", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetHeadToHead(ctx, db.HeadToHeadQueryParams{RiderA: 1, RiderB: 99})
+	})
+	add("GetSearchCandidates", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetSearchCandidates(ctx, db.SearchCandidatesQueryParams{})
+	})
+
+	// Imports and data integrity checks
+	add("GetAllRiders", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetAllRiders(ctx)
+	})
+	add("GetAllTeams", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetAllTeams(ctx)
+	})
+	add("GetStageCheckData", geometric, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetStageCheckData(ctx)
+	})
+
+	// Archives
+	add("GetSchemaVersion", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetSchemaVersion(ctx)
+	})
+	add("CountRaceData", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.CountRaceData(ctx)
+	})
+	add("ExportRaces", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportRaces(ctx)
+	})
+	add("ExportStages", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportStages(ctx)
+	})
+	add("ExportRiders", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportRiders(ctx)
+	})
+	add("ExportTeams", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportTeams(ctx)
+	})
+	add("GetAllTeamNames", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetAllTeamNames(ctx)
+	})
+	add("ExportResults", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportResults(ctx)
+	})
+	add("GetTrackIDs", exact, func(ctx context.Context, s db.Store) (any, error) {
+		return s.GetTrackIDs(ctx)
+	})
+	add("ExportTrack", geometric, func(ctx context.Context, s db.Store) (any, error) {
+		return s.ExportTrack(ctx, 1)
+	})
+	return queries
+}
+
+// TestQueriesMatchMemstore runs the queries on the test database and on the
+// memstore, which is seeded with the same fixtures, and compares the results.
+func TestQueriesMatchMemstore(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+	mem := newMemstore(t)
+
+	for _, tt := range readQueries() {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := tt.run(ctx, mem)
+			got, err := tt.run(ctx, queries)
+			if errorCode(err) != errorCode(wantErr) {
+				t.Fatalf("got error %v, want %v", err, wantErr)
+			}
+			if err == nil && !deepApproxEqual(got, want, tt.tolerance) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// step is a change, or a read after changes, whose result is compared
+// between the test database and the memstore
+type step struct {
+	name string
+	run  func(ctx context.Context, store db.Store) (any, error)
+}
+
+// adminSteps returns the changes made by the admin API, which share the IDs
+// they create.
+func adminSteps() []step {
+	var trackID, raceID, stageID, riderID, teamID, resultID int
+	created := func(id *int) func(int, error) (any, error) {
+		return func(value int, err error) (any, error) {
+			*id = value
+			return value, err
+		}
+	}
+
+	return []step{
+		{"EnsureDailyStage", func(ctx context.Context, s db.Store) (any, error) {
+			return s.EnsureDailyStage(ctx, lib.Today())
+		}},
+		{"ScheduleDailyStage", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.ScheduleDailyStage(ctx, 2)
+		}},
+		{"ScheduleDailyStage/unknown stage", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.ScheduleDailyStage(ctx, 99)
+		}},
+		{"GetDailyStage", func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetDailyStage(ctx)
+		}},
+		{"CreateTrack", func(ctx context.Context, s db.Store) (any, error) {
+			track, err := memstore.DefaultFixtures().Tracks[0].TrackInput()
+			if err != nil {
+				return nil, err
+			}
+			track.TrackID = 0
+			track.Name = "Test track"
+			return created(&trackID)(s.CreateTrack(ctx, track))
+		}},
+		{"RefreshElevation", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.RefreshElevation(ctx)
+		}},
+		{"CreateRace", func(ctx context.Context, s db.Store) (any, error) {
+			return created(&raceID)(s.CreateRace(ctx, db.RaceInput{
+				GrandTour: db.GrandTourVuelta, Year: 2024,
+			}))
+		}},
+		{"CreateRace/duplicate", func(ctx context.Context, s db.Store) (any, error) {
+			return s.CreateRace(ctx, db.RaceInput{
+				RaceID: 1, GrandTour: db.GrandTourTour, Year: 2024,
+			})
+		}},
+		{"UpdateRace", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateRace(ctx, db.RaceInput{
+				RaceID: raceID, GrandTour: db.GrandTourVuelta, Year: 2023,
+			})
+		}},
+		{"UpdateRace/missing", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateRace(ctx, db.RaceInput{
+				RaceID: 99, GrandTour: db.GrandTourVuelta, Year: 2023,
+			})
+		}},
+		{"CreateStage/unknown race", func(ctx context.Context, s db.Store) (any, error) {
+			return s.CreateStage(ctx, db.StageInput{
+				RaceID:      99,
+				StageNumber: 1,
+				StageType:   db.StageTypeRoad,
+				StageLength: 100,
+				StageStart:  "Lisbon",
+				StageEnd:    "Oeiras",
+				GPXID:       trackID,
+				GPXAccuracy: "Exact",
+			})
+		}},
+		{"CreateStage", func(ctx context.Context, s db.Store) (any, error) {
+			return created(&stageID)(s.CreateStage(ctx, db.StageInput{
+				RaceID:      raceID,
+				StageNumber: 1,
+				StageType:   db.StageTypeRoad,
+				StageLength: 100,
+				StageStart:  "Lisbon",
+				StageEnd:    "Oeiras",
+				GPXID:       trackID,
+				GPXAccuracy: "Exact",
+			}))
+		}},
+		{"CreateStage/used track", func(ctx context.Context, s db.Store) (any, error) {
+			return s.CreateStage(ctx, db.StageInput{
+				RaceID:      raceID,
+				StageNumber: 2,
+				StageType:   db.StageTypeITT,
+				StageLength: 20,
+				StageStart:  "Lisbon",
+				StageEnd:    "Lisbon",
+				GPXID:       1,
+				GPXAccuracy: "Exact",
+			})
+		}},
+		{"UpdateStage", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateStage(ctx, db.StageInput{
+				StageID:     stageID,
+				RaceID:      raceID,
+				StageNumber: 1,
+				StageType:   db.StageTypePrologue,
+				StageLength: 12.5,
+				StageStart:  "Lisbon",
+				StageEnd:    "Lisbon",
+				GPXID:       trackID,
+				GPXAccuracy: "Exact",
+			})
+		}},
+		{"LinkStageTrack", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.LinkStageTrack(ctx, db.StageTrackLink{
+				StageID: stageID, TrackID: trackID, Accuracy: "Approximate",
+			})
+		}},
+		{"GetRaceStages", func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceStages(ctx, raceID)
+		}},
+		{"CreateRider", func(ctx context.Context, s db.Store) (any, error) {
+			return created(&riderID)(s.CreateRider(ctx, db.RiderInput{
+				FirstName: "Joao", LastName: "Almeida",
+			}))
+		}},
+		{"UpdateRider", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateRider(ctx, db.RiderInput{
+				RiderID: riderID, FirstName: "João", LastName: "Almeida",
+			})
+		}},
+		{"CreateTeam", func(ctx context.Context, s db.Store) (any, error) {
+			return created(&teamID)(s.CreateTeam(ctx, db.TeamInput{
+				Name: "UAE Team",
+			}))
+		}},
+		{"UpdateTeam", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateTeam(ctx, db.TeamInput{
+				TeamID: teamID, Name: "UAE Team Emirates XRG",
+			})
+		}},
+		{"SetTeamName", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.SetTeamName(ctx, db.TeamName{
+				TeamID: teamID, Year: 2025, Name: "UAE Team Emirates XRG",
+			})
+		}},
+		// The ID of the result comes from a sequence, which is not rolled
+		// back with the transaction, so it is not compared
+		{"CreateResult", func(ctx context.Context, s db.Store) (any, error) {
+			id, err := s.CreateResult(ctx, db.ResultInput{
+				StageID:        stageID,
+				Rank:           ptr(1),
+				Classification: "stage",
+				TeamID:         teamID,
+				RiderID:        &riderID,
+				Time:           db.Duration{Duration: 15 * time.Minute, Valid: true},
+			})
+			resultID = id
+			return nil, err
+		}},
+		{"CreateResult/unknown team", func(ctx context.Context, s db.Store) (any, error) {
+			_, err := s.CreateResult(ctx, db.ResultInput{
+				StageID:        stageID,
+				Rank:           ptr(2),
+				Classification: "stage",
+				TeamID:         99,
+				RiderID:        &riderID,
+			})
+			return nil, err
+		}},
+		{"UpdateResult", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.UpdateResult(ctx, db.ResultInput{
+				ResultID:       resultID,
+				StageID:        stageID,
+				Rank:           ptr(1),
+				Classification: "stage",
+				TeamID:         teamID,
+				RiderID:        &riderID,
+				Time: db.Duration{
+					Duration: 15*time.Minute + 20*time.Second, Valid: true,
+				},
+			})
+		}},
+		{"GetResultsForClassification", func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetResultsForClassification(
+				ctx, db.GetResultsForClassificationParams{
+					StageID: stageID, TopN: 10, Classification: "stage",
+				},
+			)
+		}},
+		{"GetRaceResultsCounts", func(ctx context.Context, s db.Store) (any, error) {
+			return s.GetRaceResultsCounts(ctx, raceID)
+		}},
+		{"DeleteRider/with results", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteRider(ctx, riderID)
+		}},
+		{"DeleteStage/with results", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteStage(ctx, stageID)
+		}},
+		{"DeleteStageResults", func(ctx context.Context, s db.Store) (any, error) {
+			return s.DeleteStageResults(ctx, stageID, "stage")
+		}},
+		{"DeleteResult/missing", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteResult(ctx, resultID)
+		}},
+		{"SaveStageValidations", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.SaveStageValidations(ctx, []db.StageValidation{{
+				StageID:   stageID,
+				Passed:    false,
+				Problems:  []string{"no results"},
+				CheckedAt: time.Now(),
+			}})
+		}},
+		{"InsertAuditEntry", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.InsertAuditEntry(ctx, db.AuditEntry{
+				Actor:    "test",
+				Action:   db.ActionCreate,
+				Entity:   db.EntityRace,
+				EntityID: raceID,
+				Payload:  db.RaceInput{RaceID: raceID},
+			})
+		}},
+		{"CountRaceData", func(ctx context.Context, s db.Store) (any, error) {
+			return s.CountRaceData(ctx)
+		}},
+		{"DeleteRider", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteRider(ctx, riderID)
+		}},
+		{"DeleteTeam", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteTeam(ctx, teamID)
+		}},
+		{"DeleteTeam/missing", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteTeam(ctx, teamID)
+		}},
+		{"DeleteRace/with stages", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteRace(ctx, raceID)
+		}},
+		{"DeleteStage", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteStage(ctx, stageID)
+		}},
+		{"DeleteRace", func(ctx context.Context, s db.Store) (any, error) {
+			return nil, s.DeleteRace(ctx, raceID)
+		}},
+		{"ExportRaces", func(ctx context.Context, s db.Store) (any, error) {
+			return s.ExportRaces(ctx)
+		}},
+	}
+}
+
+// outcome is the result of a step
+type outcome struct {
+	value any
+	err   error
+}
+
+// runSteps runs the steps in a transaction that is rolled back, each in a
+// nested transaction so that a failing step does not abort the others.
+func runSteps(
+	ctx context.Context, store db.Store, steps []step,
+) ([]outcome, error) {
+	outcomes := make([]outcome, len(steps))
+	err := store.WithTx(ctx, func(tx db.Store) error {
+		for i, step := range steps {
+			err := tx.WithTx(ctx, func(tx db.Store) error {
+				value, err := step.run(ctx, tx)
+				outcomes[i] = outcome{value, err}
+				return err
+			})
+			outcomes[i].err = err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		return nil, err
+	}
+	return outcomes, nil
+}
+
+// TestAdminQueriesMatchMemstore makes the same changes to the test database
+// and to the memstore, and compares their results and errors. The changes
+// are rolled back.
+func TestAdminQueriesMatchMemstore(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+	mem := newMemstore(t)
+
+	want, err := runSteps(ctx, mem, adminSteps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := adminSteps()
+	got, err := runSteps(ctx, queries, steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range steps {
+		if errorCode(got[i].err) != errorCode(want[i].err) {
+			t.Errorf("%s: got error %v, want %v", step.name, got[i].err, want[i].err)
+			continue
+		}
+		if !deepApproxEqual(got[i].value, want[i].value, exact) {
+			t.Errorf(
+				"%s: got  %+v\nwant %+v", step.name, got[i].value, want[i].value,
+			)
+		}
+	}
+
+	count, err := queries.CountRaceData(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCount, err := mem.CountRaceData(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != wantCount {
+		t.Errorf("got %d rows after rollback, want %d", count, wantCount)
+	}
+}
+
+// TestScanning checks the enums and intervals scanned from the database.
+func TestScanning(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+
+	race, err := queries.GetRace(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if race.GrandTour != db.GrandTourGiro {
+		t.Errorf("got grand tour %q, want %q", race.GrandTour, db.GrandTourGiro)
+	}
+	stages, err := queries.GetRaceStages(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) == 0 || stages[0].StageType != db.StageTypeITT {
+		t.Errorf("got stages %+v, want a first stage of type %q", stages, db.StageTypeITT)
+	}
+
+	winner, err := queries.GetResultForRankAndClassification(
+		ctx, db.GetResultForRankAndClassificationParams{
+			StageID: 1, Rank: 1, Classification: "stage",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTime := 5*time.Hour + 15*time.Minute
+	if !winner.Time.Valid || winner.Time.Duration != wantTime {
+		t.Errorf("got time %+v, want %v", winner.Time, wantTime)
+	}
+	if winner.Classification != db.ClassificationStage {
+		t.Errorf("got classification %q", winner.Classification)
+	}
+
+	// The general classification is scanned as its value
+	leader, err := queries.GetResultForRankAndClassification(
+		ctx, db.GetResultForRankAndClassificationParams{
+			StageID: 1, Rank: 1, Classification: "general",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader.Classification != db.ClassificationGC {
+		t.Errorf("got classification %q, want %q", leader.Classification, db.ClassificationGC)
+	}
+
+	// Points classifications have no time
+	points, err := queries.GetResultForRankAndClassification(
+		ctx, db.GetResultForRankAndClassificationParams{
+			StageID: 1, Rank: 1, Classification: "points",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points.Time.Valid || !points.Points.Valid {
+		t.Errorf("got time %+v and points %+v", points.Time, points.Points)
+	}
+
+	// Stage 4 records a tie for first place, with ranks 1, 1, 3 and 4
+	results, err := queries.GetResultsForClassification(
+		ctx, db.GetResultsForClassificationParams{
+			StageID: 4, TopN: 10, Classification: "stage",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGaps := []time.Duration{0, 0, 3 * time.Second, 9 * time.Second}
+	if len(results) != len(wantGaps) {
+		t.Fatalf("got %d results, want %d", len(results), len(wantGaps))
+	}
+	for i, result := range results {
+		if result.Rank != i+1 || result.Gap.Duration != wantGaps[i] {
+			t.Errorf(
+				"result %d: got rank %d and gap %v, want %d and %v",
+				i, result.Rank, result.Gap.Duration, i+1, wantGaps[i],
+			)
+		}
+	}
+
+	nonFinishers, err := queries.GetNonFinishers(
+		ctx, db.NonFinishersQueryParams{StageID: 5},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nonFinisher := range nonFinishers {
+		if nonFinisher.Status != db.RankStatusDidNotStart {
+			t.Errorf("got status %q, want %q", nonFinisher.Status, db.RankStatusDidNotStart)
+		}
+	}
+	if len(nonFinishers) == 0 {
+		t.Error("got no non finishers on stage 5")
+	}
+
+	// Results that are not valid are stored without a rank, as by the rank
+	// migration
+	var ranked, unranked int
+	if err := testPool.QueryRow(ctx, `
+		SELECT
+			count(*) FILTER (WHERE (rank).num IS NOT NULL),
+			count(*) FILTER (WHERE (rank).num IS NULL)
+		FROM racedata.results
+		WHERE (rank).info <> 'VAL'
+	`).Scan(&ranked, &unranked); err != nil {
+		t.Fatal(err)
+	}
+	if ranked != 0 || unranked == 0 {
+		t.Errorf(
+			"got %d non finishers with a rank and %d without, want 0 and some",
+			ranked, unranked,
+		)
+	}
+}
+
+// TestGeometry checks the queries which the memstore does not implement as
+// the database does.
+func TestGeometry(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+
+	full, err := queries.GetTrack(ctx, db.TrackQueryParams{
+		StageID: 1, TrackSimplification: db.TrackSimplification{Precision: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	simplified, err := queries.GetTrack(ctx, db.TrackQueryParams{
+		StageID: 1,
+		TrackSimplification: db.TrackSimplification{
+			Tolerance: 1000, Precision: 5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simplified.NumPoints < 2 || simplified.NumPoints >= full.NumPoints {
+		t.Errorf(
+			"got %d points simplified from %d",
+			simplified.NumPoints, full.NumPoints,
+		)
+	}
+	var geometry struct {
+		Type        string      `json:"type"`
+		Coordinates [][]float64 `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(simplified.GeoJSON), &geometry); err != nil {
+		t.Fatal(err)
+	}
+	if geometry.Type != "LineString" ||
+		len(geometry.Coordinates) != simplified.NumPoints {
+		t.Errorf("got GeoJSON %s", simplified.GeoJSON)
+	}
+
+	// Every track is in the tile of the whole world
+	tile, err := queries.GetTile(ctx, db.TileQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tile) == 0 || !strings.Contains(string(tile), "stages") {
+		t.Errorf("got a tile of %d bytes without the stages layer", len(tile))
+	}
+	vuelta, err := queries.GetTile(ctx, db.TileQueryParams{
+		GrandTour: ptr(db.GrandTourVuelta),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vuelta) != 0 {
+		t.Errorf("got a tile of %d bytes without any Vuelta stages", len(vuelta))
+	}
+
+	stageID, err := queries.GetRandomStage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stageID < 1 || stageID > 5 {
+		t.Errorf("got random stage %d", stageID)
+	}
+}
+
+// TestDailyStageLock checks that the daily stage is chosen by one connection
+// at a time.
+func TestDailyStageLock(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+	tx, err := testPool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	tomorrow := lib.Today().AddDate(0, 0, 1)
+	chosen, err := db.New(tx).EnsureDailyStage(ctx, tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chosen {
+		t.Error("expected tomorrow's daily stage to be chosen")
+	}
+	// The lock is held until the outer transaction ends
+	if _, err := queries.EnsureDailyStage(ctx, tomorrow); !errors.Is(err, db.ErrDailyLocked) {
+		t.Errorf("got error %v while locked, want %v", err, db.ErrDailyLocked)
+	}
+}
+
+// TestMigrations rolls back the newest migration and applies it again.
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	queries := integrationQueries(t)
+	migrator, err := migrate.New(testPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := migrate.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	down, err := migrator.Down(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if down.Version != latest {
+		t.Errorf("rolled back %s, want %s", down.Version, latest)
+	}
+	if err := migrator.Check(ctx); !errors.Is(err, migrate.ErrSchemaBehind) {
+		t.Errorf("got error %v after rolling back, want %v", err, migrate.ErrSchemaBehind)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != latest {
+		t.Errorf("applied %+v, want %s", applied, latest)
+	}
+	version, err := queries.GetSchemaVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latest {
+		t.Errorf("got schema version %s, want %s", version, latest)
+	}
+}
+
+// errorCode identifies an error by its Postgres code, so that errors of the
+// database and the memstore can be compared.
+func errorCode(err error) string {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, pgx.ErrNoRows):
+		return "no rows"
+	case errors.As(err, &pgErr):
+		return pgErr.Code
+	default:
+		return err.Error()
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// deepApproxEqual reports whether two values are deeply equal, with floats equal
+// within a relative tolerance. Strings holding JSON, such as GeoJSON, are
+// compared by their decoded values, and nil and empty slices are equal.
+func deepApproxEqual(a, b any, tolerance float64) bool {
+	return valuesEqual(reflect.ValueOf(a), reflect.ValueOf(b), tolerance)
+}
+
+func valuesEqual(a, b reflect.Value, tolerance float64) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if a.Type() == timeType && a.CanInterface() {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		scale := math.Max(1, math.Max(math.Abs(x), math.Abs(y)))
+		return math.Abs(x-y) <= tolerance*scale
+	case reflect.String:
+		x, y := a.String(), b.String()
+		if x == y {
+			return true
+		}
+		if !strings.HasPrefix(x, "{") && !strings.HasPrefix(x, "[") {
+			return false
+		}
+		var u, v any
+		if json.Unmarshal([]byte(x), &u) != nil ||
+			json.Unmarshal([]byte(y), &v) != nil {
+			return false
+		}
+		return valuesEqual(reflect.ValueOf(u), reflect.ValueOf(v), tolerance)
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !valuesEqual(a.Index(i), b.Index(i), tolerance) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			value := b.MapIndex(iter.Key())
+			if !value.IsValid() || !valuesEqual(iter.Value(), value, tolerance) {
+				return false
+			}
+		}
+		return true
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return valuesEqual(a.Elem(), b.Elem(), tolerance)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !valuesEqual(a.Field(i), b.Field(i), tolerance) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import "golang.org/x/exp/slices"
+
+// ProfileSummary struct, describing the shape of an elevation profile.
+// Distances and elevations are in meters.
+type ProfileSummary struct {
+	Distance        float64 `json:"distance"`
+	StartElevation  float64 `json:"start_elevation"`
+	FinishElevation float64 `json:"finish_elevation"`
+	MinElevation    float64 `json:"min_elevation"`
+	MaxElevation    float64 `json:"max_elevation"`
+	TotalAscent     float64 `json:"total_ascent"`
+	TotalDescent    float64 `json:"total_descent"`
+}
+
+// SummariseElevationProfile computes the distance, elevation range and total
+// ascent and descent of an elevation profile. An empty profile has an empty
+// summary.
+func SummariseElevationProfile(elevationPoints []ElevationPoint) ProfileSummary {
+	if len(elevationPoints) == 0 {
+		return ProfileSummary{}
+	}
+
+	// Sort the points if they are not already sorted
+	if !isSorted(elevationPoints) {
+		slices.SortFunc(elevationPoints, cmpElevationPoint)
+	}
+
+	first := elevationPoints[0]
+	last := elevationPoints[len(elevationPoints)-1]
+	summary := ProfileSummary{
+		Distance:        last.Distance - first.Distance,
+		StartElevation:  first.Elevation,
+		FinishElevation: last.Elevation,
+		MinElevation:    first.Elevation,
+		MaxElevation:    first.Elevation,
+	}
+
+	for i := 1; i < len(elevationPoints); i++ {
+		elevation := elevationPoints[i].Elevation
+		change := elevation - elevationPoints[i-1].Elevation
+		if change > 0 {
+			summary.TotalAscent += change
+		} else {
+			summary.TotalDescent -= change
+		}
+		summary.MinElevation = min(summary.MinElevation, elevation)
+		summary.MaxElevation = max(summary.MaxElevation, elevation)
+	}
+
+	return summary
+}
@@ -0,0 +1,37 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func TestSummariseElevationProfile(t *testing.T) {
+	elevationPoints := []db.ElevationPoint{
+		{Distance: 0, Elevation: 100},
+		{Distance: 1000, Elevation: 150},
+		{Distance: 3000, Elevation: 80},
+		{Distance: 2000, Elevation: 200},
+		{Distance: 4000, Elevation: 120},
+	}
+
+	expected := db.ProfileSummary{
+		Distance:        4000,
+		StartElevation:  100,
+		FinishElevation: 120,
+		MinElevation:    80,
+		MaxElevation:    200,
+		TotalAscent:     140,
+		TotalDescent:    120,
+	}
+
+	summary := db.SummariseElevationProfile(elevationPoints)
+	if summary != expected {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+
+	empty := db.SummariseElevationProfile(nil)
+	if empty != (db.ProfileSummary{}) {
+		t.Errorf("expected empty summary, got %+v", empty)
+	}
+}
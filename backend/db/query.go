@@ -2,23 +2,34 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 
 	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
+// optionalArg converts an optional query argument to a value or an untyped
+// nil, so that it is sent to the database as NULL when missing.
+func optionalArg[T any](value *T) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
 const getDailyStageQuery = `
 SELECT stage_id, date FROM racedata.daily
-WHERE daily_id = (SELECT MAX(daily_id) FROM racedata.daily)
+ORDER BY date DESC
 LIMIT 1;
 `
 
-const addDailyStageQuery = `
-INSERT INTO racedata.daily (stage_id)
-SELECT racedata.get_random_stage_id();
-`
-
+// Get the latest daily stage, chosen by EnsureDailyStage at the start of the
+// day
 func (q *Queries) GetDailyStage(ctx context.Context) (DailyStage, error) {
 	rows, err := q.conn.Query(ctx, getDailyStageQuery)
 	if err != nil {
@@ -26,21 +37,70 @@ func (q *Queries) GetDailyStage(ctx context.Context) (DailyStage, error) {
 	}
 	defer rows.Close()
 
-	rowValues, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[DailyStage])
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[DailyStage])
+}
+
+// ErrDailyLocked is returned by EnsureDailyStage when another connection,
+// e.g. of another replica of the backend, is choosing the daily stage.
+var ErrDailyLocked = errors.New("the daily stage is being chosen elsewhere")
+
+// Key of the advisory lock held while choosing the daily stage
+const dailyLockKey = 0x5354414745 // "STAGE"
+
+const lockDailyQuery = `
+SELECT pg_try_advisory_xact_lock($1);
+`
+
+const ensureDailyStageQuery = `
+INSERT INTO racedata.daily (stage_id, date)
+SELECT stage_id, @date::date
+FROM (SELECT racedata.get_random_valid_stage_id() AS stage_id) chosen
+WHERE stage_id IS NOT NULL
+ON CONFLICT (date) DO NOTHING;
+`
+
+// Choose the daily stage of a date at random, unless one has been chosen,
+// returning whether it was chosen. Only one connection chooses at a time, the
+// others get ErrDailyLocked.
+func (q *Queries) EnsureDailyStage(
+	ctx context.Context, date time.Time,
+) (bool, error) {
+	tx, err := q.conn.Begin(ctx)
 	if err != nil {
-		return DailyStage{}, err
+		return false, err
 	}
-	dateValue, err := rowValues.Date.DateValue()
-	if err != nil {
-		return DailyStage{}, err
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, lockDailyQuery, dailyLockKey).Scan(
+		&locked,
+	); err != nil {
+		return false, err
 	}
-	if !lib.IsToday(dateValue.Time) {
-		if _, err := q.conn.Exec(ctx, addDailyStageQuery); err != nil {
-			return DailyStage{}, err
-		}
-		return q.GetDailyStage(ctx)
+	if !locked {
+		return false, ErrDailyLocked
+	}
+	tag, err := tx.Exec(ctx, ensureDailyStageQuery, pgx.NamedArgs{
+		"date": pgtype.Date{Time: date, Valid: true},
+	})
+	if err != nil {
+		return false, err
 	}
-	return rowValues, nil
+	return tag.RowsAffected() > 0, tx.Commit(ctx)
+}
+
+const scheduleDailyStageQuery = `
+INSERT INTO racedata.daily (stage_id, date) VALUES (@stage_id, @date::date)
+ON CONFLICT (date) DO UPDATE SET stage_id = EXCLUDED.stage_id;
+`
+
+// Make a stage today's daily stage, in place of any stage already chosen
+func (q *Queries) ScheduleDailyStage(ctx context.Context, stageID int) error {
+	_, err := q.conn.Exec(ctx, scheduleDailyStageQuery, pgx.NamedArgs{
+		"stage_id": stageID,
+		"date":     pgtype.Date{Time: lib.Today(), Valid: true},
+	})
+	return err
 }
 
 const getRandomStageQuery = `
@@ -79,6 +139,291 @@ func (q *Queries) GetAllStages(ctx context.Context) ([]int, error) {
 	return stages, nil
 }
 
+const getRacesQuery = `
+SELECT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	COUNT(s.stage_id) AS num_stages,
+	COALESCE(SUM(s.stage_length), 0)::float8 AS total_length
+FROM racedata.races r
+LEFT JOIN racedata.stages s ON r.race_id = s.race_id
+WHERE
+	(
+		@grand_tour::racedata.grandtour IS NULL
+		OR r.gt = @grand_tour::racedata.grandtour
+	)
+	AND (@year::int IS NULL OR r.year = @year::int)
+GROUP BY r.race_id
+ORDER BY r.year, r.gt;
+`
+
+type RacesQueryParams struct {
+	GrandTour *GrandTour
+	Year      *int
+}
+
+// Get all the races, optionally filtered by grand tour and year, ordered by
+// year
+func (q *Queries) GetRaces(
+	ctx context.Context, params RacesQueryParams,
+) ([]Race, error) {
+	rows, err := q.conn.Query(ctx, getRacesQuery, pgx.NamedArgs{
+		"grand_tour": optionalArg(params.GrandTour),
+		"year":       optionalArg(params.Year),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	races, err := pgx.CollectRows(rows, pgx.RowToStructByName[Race])
+	if err != nil {
+		return nil, err
+	}
+	return races, nil
+}
+
+const getRaceQuery = `
+SELECT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	COUNT(s.stage_id) AS num_stages,
+	COALESCE(SUM(s.stage_length), 0)::float8 AS total_length
+FROM racedata.races r
+LEFT JOIN racedata.stages s ON r.race_id = s.race_id
+WHERE r.race_id = $1
+GROUP BY r.race_id;
+`
+
+func (q *Queries) GetRace(ctx context.Context, raceID int) (Race, error) {
+	rows, err := q.conn.Query(ctx, getRaceQuery, raceID)
+	if err != nil {
+		return Race{}, err
+	}
+	defer rows.Close()
+
+	race, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Race])
+	if err != nil {
+		return Race{}, err
+	}
+	return race, nil
+}
+
+const getRaceStagesQuery = `
+SELECT
+	stage_id,
+	gt as grand_tour,
+	year,
+	stage_number,
+	stage_type,
+	stage_start,
+	stage_end,
+	stage_length
+FROM racedata.races_stages
+WHERE race_id = $1
+ORDER BY stage_number;
+`
+
+// Get the stages of a race with their info, ordered by stage number
+func (q *Queries) GetRaceStages(
+	ctx context.Context, raceID int,
+) ([]RaceStage, error) {
+	rows, err := q.conn.Query(ctx, getRaceStagesQuery, raceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stages, err := pgx.CollectRows(rows, pgx.RowToStructByName[RaceStage])
+	if err != nil {
+		return nil, err
+	}
+	return stages, nil
+}
+
+const getRaceStageByNumberQuery = `
+SELECT
+	stage_id,
+	gt as grand_tour,
+	year,
+	stage_number,
+	stage_type,
+	stage_start,
+	stage_end,
+	stage_length
+FROM racedata.races_stages
+WHERE race_id = @race_id AND stage_number = @stage_number
+LIMIT 1;
+`
+
+type RaceStageQueryParams struct {
+	RaceID      int
+	StageNumber int
+}
+
+// Get a stage of a race by its stage number
+func (q *Queries) GetRaceStageByNumber(
+	ctx context.Context, params RaceStageQueryParams,
+) (RaceStage, error) {
+	rows, err := q.conn.Query(ctx, getRaceStageByNumberQuery, pgx.NamedArgs{
+		"race_id":      params.RaceID,
+		"stage_number": params.StageNumber,
+	})
+	if err != nil {
+		return RaceStage{}, err
+	}
+	defer rows.Close()
+
+	stage, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[RaceStage])
+	if err != nil {
+		return RaceStage{}, err
+	}
+	return stage, nil
+}
+
+// The sort column and direction are formatted into the query, and must come
+// from stageSortColumns
+const getStagePageQuery = `
+SELECT
+	stage_id,
+	gt as grand_tour,
+	year,
+	stage_number,
+	stage_type,
+	stage_start,
+	stage_end,
+	stage_length,
+	%[1]s::float8 AS sort_value
+FROM racedata.races_stages
+WHERE
+	(
+		@grand_tour::racedata.grandtour IS NULL
+		OR gt = @grand_tour::racedata.grandtour
+	)
+	AND (@min_year::int IS NULL OR year >= @min_year::int)
+	AND (@max_year::int IS NULL OR year <= @max_year::int)
+	AND (
+		@stage_type::racedata.stagetype IS NULL
+		OR stage_type = @stage_type::racedata.stagetype
+	)
+	AND (@min_length::float8 IS NULL OR stage_length >= @min_length::float8)
+	AND (@max_length::float8 IS NULL OR stage_length <= @max_length::float8)
+	AND (
+		@town::text IS NULL
+		OR stage_start ILIKE '%%' || @town::text || '%%'
+		OR stage_end ILIKE '%%' || @town::text || '%%'
+	)
+	AND (
+		@cursor_id::int IS NULL
+		OR (%[1]s::float8, stage_id) %[2]s (@cursor_value::float8, @cursor_id::int)
+	)
+ORDER BY %[1]s::float8 %[3]s, stage_id %[3]s
+LIMIT @limit;
+`
+
+type StagePageQueryParams struct {
+	Limit     int
+	Cursor    *StageCursor
+	Sort      StageSort
+	Desc      bool
+	GrandTour *GrandTour
+	MinYear   *int
+	MaxYear   *int
+	StageType *StageType
+	MinLength *float64
+	MaxLength *float64
+	// Case insensitive search for the start or end town
+	Town *string
+}
+
+// escapeLike escapes the wildcard characters in a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "%", `\%`, "_", `\_`,
+	).Replace(s)
+}
+
+// Get a page of stages with their info, filtered and sorted by the given
+// parameters. The cursor of the returned page is nil when there are no more
+// stages.
+func (q *Queries) GetStagePage(
+	ctx context.Context, params StagePageQueryParams,
+) (StagePage, error) {
+	column, ok := stageSortColumns[params.Sort]
+	if !ok {
+		return StagePage{}, fmt.Errorf("invalid sort: %s", params.Sort)
+	}
+	comparison, direction := ">", "ASC"
+	if params.Desc {
+		comparison, direction = "<", "DESC"
+	}
+
+	var cursorValue, cursorID any
+	if params.Cursor != nil {
+		if params.Cursor.Sort != params.Sort ||
+			params.Cursor.Desc != params.Desc {
+			return StagePage{}, errors.New(
+				"cursor does not match the sort order",
+			)
+		}
+		cursorValue = params.Cursor.SortValue
+		cursorID = params.Cursor.StageID
+	}
+
+	var town any
+	if params.Town != nil {
+		town = escapeLike(*params.Town)
+	}
+
+	query := fmt.Sprintf(getStagePageQuery, column, comparison, direction)
+	rows, err := q.conn.Query(ctx, query, pgx.NamedArgs{
+		"grand_tour":   optionalArg(params.GrandTour),
+		"min_year":     optionalArg(params.MinYear),
+		"max_year":     optionalArg(params.MaxYear),
+		"stage_type":   optionalArg(params.StageType),
+		"min_length":   optionalArg(params.MinLength),
+		"max_length":   optionalArg(params.MaxLength),
+		"town":         town,
+		"cursor_value": cursorValue,
+		"cursor_id":    cursorID,
+		// Fetch an extra row to find out if there is a next page
+		"limit": params.Limit + 1,
+	})
+	if err != nil {
+		return StagePage{}, err
+	}
+	defer rows.Close()
+
+	pageRows, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[stagePageRow],
+	)
+	if err != nil {
+		return StagePage{}, err
+	}
+
+	page := StagePage{Stages: make([]RaceStage, 0, params.Limit)}
+	for i, row := range pageRows {
+		if i == params.Limit {
+			last := pageRows[i-1]
+			cursor, err := StageCursor{
+				Sort:      params.Sort,
+				Desc:      params.Desc,
+				SortValue: last.SortValue,
+				StageID:   last.StageID,
+			}.Encode()
+			if err != nil {
+				return StagePage{}, err
+			}
+			page.NextCursor = &cursor
+			break
+		}
+		page.Stages = append(page.Stages, row.RaceStage)
+	}
+	return page, nil
+}
+
 const getStageInfoQuery = `
 SELECT
 	gt as grand_tour,
@@ -111,28 +456,277 @@ func (q *Queries) GetStageInfo(
 }
 
 const getTrackQuery = `
-SELECT ST_AsGeoJSON(ST_Transform(ST_Force2D(the_geom), 4326))
+SELECT
+	ST_AsGeoJSON(ST_Transform(geom, 4326), @precision) AS geojson,
+	ST_NPoints(geom) AS num_points
+FROM (
+	SELECT ST_SimplifyPreserveTopology(ST_Force2D(t.the_geom), @tolerance) AS geom
+	FROM racedata.stages s
+	JOIN geog.tracks t ON s.gpx_id = t.track_id
+	WHERE s.stage_id = @stage_id
+	LIMIT 1
+) simplified;
+`
+
+type TrackSimplification struct {
+	// Simplification tolerance in metres, 0 returns the full resolution track
+	Tolerance float64
+	// Maximum number of decimal places in the output coordinates
+	Precision int
+}
+
+type TrackQueryParams struct {
+	StageID int
+	TrackSimplification
+}
+
+// Get the stage track as a GeoJSON object, simplified to the given tolerance
+func (q *Queries) GetTrack(
+	ctx context.Context, params TrackQueryParams,
+) (Track, error) {
+	rows, err := q.conn.Query(ctx, getTrackQuery, pgx.NamedArgs{
+		"stage_id":  params.StageID,
+		"tolerance": params.Tolerance,
+		"precision": params.Precision,
+	})
+	if err != nil {
+		return Track{}, err
+	}
+	defer rows.Close()
+
+	track, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Track])
+	if err != nil {
+		return Track{}, err
+	}
+	return track, nil
+}
+
+const getGeometrySummaryQuery = `
+SELECT
+	ST_XMin(geom) AS min_lon,
+	ST_YMin(geom) AS min_lat,
+	ST_XMax(geom) AS max_lon,
+	ST_YMax(geom) AS max_lat,
+	ST_X(ST_StartPoint(geom)) AS start_lon,
+	ST_Y(ST_StartPoint(geom)) AS start_lat,
+	ST_X(ST_EndPoint(geom)) AS finish_lon,
+	ST_Y(ST_EndPoint(geom)) AS finish_lat,
+	ST_X(ST_Centroid(geom)) AS centroid_lon,
+	ST_Y(ST_Centroid(geom)) AS centroid_lat,
+	ST_Distance(
+		ST_StartPoint(geom)::geography, ST_EndPoint(geom)::geography
+	) AS start_finish_distance
+FROM (
+	SELECT ST_Transform(ST_Force2D(t.the_geom), 4326) AS geom
+	FROM racedata.stages s
+	JOIN geog.tracks t ON s.gpx_id = t.track_id
+	WHERE s.stage_id = $1
+	LIMIT 1
+) track;
+`
+
+// Get the bounding box, start, finish and centroid of the stage track in
+// EPSG:4326, and the straight line distance between the start and finish
+func (q *Queries) GetGeometrySummary(
+	ctx context.Context, stageID int,
+) (GeometrySummary, error) {
+	rows, err := q.conn.Query(ctx, getGeometrySummaryQuery, stageID)
+	if err != nil {
+		return GeometrySummary{}, err
+	}
+	defer rows.Close()
+
+	row, err := pgx.CollectOneRow(
+		rows, pgx.RowToStructByName[geometrySummaryRow],
+	)
+	if err != nil {
+		return GeometrySummary{}, err
+	}
+	return row.toGeometrySummary(), nil
+}
+
+const getTileQuery = `
+WITH bounds AS (
+	SELECT ST_TileEnvelope(@z, @x, @y) AS geom
+),
+tile AS (
+	SELECT
+		ST_AsMVTGeom(
+			ST_Transform(ST_Force2D(rst.the_geom), 3857), bounds.geom
+		) AS geom,
+		rst.stage_id,
+		rst.gt::text AS grand_tour,
+		rst.year,
+		rst.stage_number::int AS stage_number
+	FROM racedata.races_stages_tracks rst, bounds
+	WHERE
+		-- The tile is transformed to the projection of the tracks rather
+		-- than every track to the tile's, so the spatial index is used
+		rst.the_geom && ST_Transform(bounds.geom, 23031)
+		AND (
+			@grand_tour::racedata.grandtour IS NULL
+			OR rst.gt = @grand_tour::racedata.grandtour
+		)
+		AND (@year::int IS NULL OR rst.year = @year::int)
+		AND (
+			@stage_type::racedata.stagetype IS NULL
+			OR rst.stage_type = @stage_type::racedata.stagetype
+		)
+)
+SELECT COALESCE(ST_AsMVT(tile.*, 'stages', 4096, 'geom'), ''::bytea)
+FROM tile;
+`
+
+type TileQueryParams struct {
+	Z         int
+	X         int
+	Y         int
+	GrandTour *GrandTour
+	Year      *int
+	StageType *StageType
+}
+
+// Get a Mapbox Vector Tile of all the stage tracks in the given web mercator
+// tile, in a layer named "stages"
+func (q *Queries) GetTile(
+	ctx context.Context, params TileQueryParams,
+) ([]byte, error) {
+	rows, err := q.conn.Query(ctx, getTileQuery, pgx.NamedArgs{
+		"z":          params.Z,
+		"x":          params.X,
+		"y":          params.Y,
+		"grand_tour": optionalArg(params.GrandTour),
+		"year":       optionalArg(params.Year),
+		"stage_type": optionalArg(params.StageType),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tile, err := pgx.CollectOneRow(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
+
+const getTrackMetadataQuery = `
+SELECT
+	t.name,
+	t.src AS source,
+	t.link1_href AS link_href,
+	t.link1_text AS link_text
 FROM racedata.stages s
 JOIN geog.tracks t ON s.gpx_id = t.track_id
 WHERE s.stage_id = $1
 LIMIT 1;
 `
 
-// Get the stage track as a GeoJSON object
-func (q *Queries) GetTrack(
+// Get the name, source and link of the stage track
+func (q *Queries) GetTrackMetadata(
 	ctx context.Context, stageID int,
-) (string, error) {
-	rows, err := q.conn.Query(ctx, getTrackQuery, stageID)
+) (TrackMetadata, error) {
+	rows, err := q.conn.Query(ctx, getTrackMetadataQuery, stageID)
 	if err != nil {
-		return "", err
+		return TrackMetadata{}, err
 	}
 	defer rows.Close()
 
-	track, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	metadata, err := pgx.CollectOneRow(
+		rows, pgx.RowToStructByName[TrackMetadata],
+	)
 	if err != nil {
-		return "", err
+		return TrackMetadata{}, err
 	}
-	return track, nil
+	return metadata, nil
+}
+
+const getTrackPointsQuery = `
+SELECT
+	ST_X(ST_Transform(tp.the_geom, 4326)) AS longitude,
+	ST_Y(ST_Transform(tp.the_geom, 4326)) AS latitude,
+	e.elevation,
+	e.distance
+FROM racedata.stages s
+JOIN geog.track_points tp ON s.gpx_id = tp.track_fid
+JOIN geog.elevation e
+	ON tp.track_fid = e.track_fid
+	AND tp.track_seg_point_id = e.track_seg_point_id
+WHERE s.stage_id = $1
+ORDER BY tp.track_seg_point_id;
+`
+
+// Get the points of the stage track in EPSG:4326 with their elevations and
+// distances along the track
+func (q *Queries) GetTrackPoints(
+	ctx context.Context, stageID int,
+) ([]TrackPoint, error) {
+	rows, err := q.conn.Query(ctx, getTrackPointsQuery, stageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points, err := pgx.CollectRows(rows, pgx.RowToStructByName[TrackPoint])
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+const getRaceTracksQuery = `
+SELECT
+	rs.stage_id,
+	rs.gt AS grand_tour,
+	rs.year,
+	rs.stage_number,
+	rs.stage_type,
+	rs.stage_start,
+	rs.stage_end,
+	rs.stage_length,
+	ST_AsGeoJSON(ST_Transform(simplified.geom, 4326), @precision) AS geojson,
+	ST_NPoints(simplified.geom) AS num_points,
+	t.name,
+	t.src AS source,
+	t.link1_href AS link_href,
+	t.link1_text AS link_text
+FROM racedata.races_stages rs
+JOIN geog.tracks t ON rs.gpx_id = t.track_id
+CROSS JOIN LATERAL (
+	SELECT ST_SimplifyPreserveTopology(ST_Force2D(t.the_geom), @tolerance) AS geom
+) simplified
+WHERE rs.race_id = @race_id
+ORDER BY rs.stage_number;
+`
+
+type RaceTracksQueryParams struct {
+	RaceID int
+	TrackSimplification
+}
+
+// Get the info, track and track metadata of every stage in a race, ordered by
+// stage number
+func (q *Queries) GetRaceTracks(
+	ctx context.Context, params RaceTracksQueryParams,
+) ([]RaceStageTrack, error) {
+	rows, err := q.conn.Query(ctx, getRaceTracksQuery, pgx.NamedArgs{
+		"race_id":   params.RaceID,
+		"tolerance": params.Tolerance,
+		"precision": params.Precision,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[RaceStageTrack],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
 }
 
 const getElevationProfileQuery = `
@@ -160,6 +754,40 @@ func (q *Queries) GetElevationProfile(
 	return points, nil
 }
 
+const getRaceElevationProfilesQuery = `
+SELECT se.stage_id, se.distance, se.elevation
+FROM racedata.stages_elevation se
+JOIN racedata.stages s ON se.stage_id = s.stage_id
+WHERE s.race_id = $1
+ORDER BY se.stage_id, se.distance;
+`
+
+// Get the elevation profile of every stage in a race, keyed by stage ID
+func (q *Queries) GetRaceElevationProfiles(
+	ctx context.Context, raceID int,
+) (map[int][]ElevationPoint, error) {
+	rows, err := q.conn.Query(ctx, getRaceElevationProfilesQuery, raceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[StageElevationPoint],
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[int][]ElevationPoint)
+	for _, point := range points {
+		profiles[point.StageID] = append(
+			profiles[point.StageID], point.ElevationPoint,
+		)
+	}
+	return profiles, nil
+}
+
 type GradientQueryParams struct {
 	StageID    int
 	Resolution float64
@@ -178,13 +806,18 @@ func (q *Queries) GetGradientProfile(
 const getResultsQuery = `
 SELECT
 	rank,
+	rider_id,
 	rider,
+	team_id,
 	team,
 	time,
+	time - FIRST_VALUE(time) OVER w AS gap,
+	COALESCE(time = LAG(time) OVER w, false) AS same_time,
 	points,
 	classification
 FROM racedata.riders_teams_results
 WHERE stage_id = $1 AND rank <= $2
+WINDOW w AS (PARTITION BY classification ORDER BY rank)
 ORDER BY classification, rank ASC;
 `
 
@@ -209,12 +842,72 @@ func (q *Queries) GetResults(
 	return results, nil
 }
 
+const getNonFinishersQuery = `
+SELECT
+	CASE
+		WHEN res.classification <> 'teams' THEN r.first_name || ' ' || r.last_name
+	END AS rider,
+	res.rider_id,
+	t.name AS team,
+	res.team_id,
+	(res.rank).info AS status,
+	res.classification
+FROM racedata.results res
+LEFT JOIN racedata.riders r ON res.rider_id = r.rider_id
+LEFT JOIN racedata.teams t ON res.team_id = t.team_id
+WHERE
+	res.stage_id = @stage_id
+	AND (res.rank).info <> 'VAL'
+	AND (@classification::racedata.classification_type IS NULL
+		OR res.classification = @classification)
+ORDER BY
+	res.classification, (res.rank).info, (res.rank).num, r.last_name, t.name;
+`
+
+type NonFinishersQueryParams struct {
+	StageID int
+	// Optional, all classifications if nil
+	Classification *Classification
+}
+
+// GetNonFinishers returns the riders and teams of a stage whose rank is not
+// valid, e.g. because they abandoned, finished outside the time limit or were
+// disqualified.
+func (q *Queries) GetNonFinishers(
+	ctx context.Context, params NonFinishersQueryParams,
+) ([]NonFinisher, error) {
+	rows, err := q.conn.Query(
+		ctx,
+		getNonFinishersQuery,
+		pgx.NamedArgs{
+			"stage_id":       params.StageID,
+			"classification": optionalArg(params.Classification),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nonFinishers, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[NonFinisher],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return nonFinishers, nil
+}
+
 const getResultsForClassificationQuery = `
 SELECT
 	rank,
+	rider_id,
 	rider,
+	team_id,
 	team,
 	time,
+	time - FIRST_VALUE(time) OVER w AS gap,
+	COALESCE(time = LAG(time) OVER w, false) AS same_time,
 	points,
 	classification
 FROM racedata.riders_teams_results
@@ -222,6 +915,7 @@ WHERE
 	stage_id = @stage_id
 	AND rank <= @top_n
 	AND classification = @classification
+WINDOW w AS (ORDER BY rank)
 ORDER BY rank ASC;
 `
 
@@ -257,17 +951,28 @@ func (q *Queries) GetResultsForClassification(
 
 const getResultForRankAndClassificationQuery = `
 SELECT
-	rank,
-	rider,
-	team,
-	time,
-	points,
+	rank, rider_id, rider, team_id, team, time, gap, same_time, points,
 	classification
-FROM racedata.riders_teams_results
-WHERE
-	stage_id = @stage_id
-	AND rank = @rank
-	AND classification = @classification
+FROM (
+	SELECT
+		rank,
+		rider_id,
+		rider,
+		team_id,
+		team,
+		time,
+		time - FIRST_VALUE(time) OVER w AS gap,
+		COALESCE(time = LAG(time) OVER w, false) AS same_time,
+		points,
+		classification
+	FROM racedata.riders_teams_results
+	WHERE
+		stage_id = @stage_id
+		AND rank <= @rank
+		AND classification = @classification
+	WINDOW w AS (ORDER BY rank)
+) ranked
+WHERE rank = @rank;
 `
 
 type GetResultForRankAndClassificationParams struct {
@@ -300,6 +1005,58 @@ func (q *Queries) GetResultForRankAndClassification(
 	return result, nil
 }
 
+const getStandingsQuery = `
+SELECT
+	rtr.stage_id,
+	s.stage_number,
+	rtr.rank,
+	rtr.rider_id,
+	rtr.rider,
+	rtr.team_id,
+	rtr.team,
+	rtr.time,
+	rtr.time - FIRST_VALUE(rtr.time) OVER w AS gap,
+	COALESCE(rtr.time = LAG(rtr.time) OVER w, false) AS same_time,
+	rtr.points,
+	rtr.classification
+FROM racedata.riders_teams_results rtr
+JOIN racedata.stages s ON rtr.stage_id = s.stage_id
+WHERE
+	s.race_id = @race_id
+	AND rtr.classification = @classification
+	AND rtr.rank <= @top_n
+WINDOW w AS (PARTITION BY rtr.stage_id ORDER BY rtr.rank)
+ORDER BY s.stage_number, rtr.rank;
+`
+
+type StandingsQueryParams struct {
+	RaceID         int
+	TopN           int
+	Classification Classification
+}
+
+// Get the top N of a classification after every stage of a race, ordered by
+// stage number and rank
+func (q *Queries) GetStandings(
+	ctx context.Context, params StandingsQueryParams,
+) ([]Standing, error) {
+	rows, err := q.conn.Query(ctx, getStandingsQuery, pgx.NamedArgs{
+		"race_id":        params.RaceID,
+		"top_n":          params.TopN,
+		"classification": params.Classification,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings, err := pgx.CollectRows(rows, pgx.RowToStructByName[Standing])
+	if err != nil {
+		return nil, err
+	}
+	return standings, nil
+}
+
 const getRidersQuery = `
 SELECT DISTINCT rider
 FROM racedata.riders_teams_results
@@ -399,3 +1156,595 @@ func (q *Queries) GetValidResultsCount(
 	}
 	return validResultsCount, nil
 }
+
+const searchRidersQuery = `
+SELECT
+	rider_id,
+	first_name,
+	last_name,
+	first_name || ' ' || last_name AS name
+FROM racedata.riders
+WHERE
+	@query = ''
+	OR first_name || ' ' || last_name ILIKE '%' || @query || '%'
+	OR last_name || ' ' || first_name ILIKE '%' || @query || '%'
+ORDER BY last_name, first_name, rider_id
+LIMIT @limit;
+`
+
+type RiderSearchQueryParams struct {
+	// Part of the rider's name, all riders if empty
+	Query string
+	Limit int
+}
+
+// Search riders by name, ordered by last name
+func (q *Queries) SearchRiders(
+	ctx context.Context, params RiderSearchQueryParams,
+) ([]Rider, error) {
+	rows, err := q.conn.Query(ctx, searchRidersQuery, pgx.NamedArgs{
+		"query": escapeLike(params.Query),
+		"limit": params.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	riders, err := pgx.CollectRows(rows, pgx.RowToStructByName[Rider])
+	if err != nil {
+		return nil, err
+	}
+	return riders, nil
+}
+
+const getRiderQuery = `
+SELECT
+	rider_id,
+	first_name,
+	last_name,
+	first_name || ' ' || last_name AS name
+FROM racedata.riders
+WHERE rider_id = $1;
+`
+
+func (q *Queries) GetRider(ctx context.Context, riderID int) (Rider, error) {
+	rows, err := q.conn.Query(ctx, getRiderQuery, riderID)
+	if err != nil {
+		return Rider{}, err
+	}
+	defer rows.Close()
+
+	rider, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Rider])
+	if err != nil {
+		return Rider{}, err
+	}
+	return rider, nil
+}
+
+const getRiderStageWinsQuery = `
+SELECT
+	rs.race_id,
+	rs.stage_id,
+	rs.gt AS grand_tour,
+	rs.year,
+	rs.stage_number,
+	rs.stage_type,
+	rs.stage_start,
+	rs.stage_end,
+	rs.stage_length
+FROM racedata.results_valid rv
+JOIN racedata.races_stages rs ON rv.stage_id = rs.stage_id
+WHERE
+	rv.rider_id = $1
+	AND rv.classification = 'stage'
+	AND rv.rank = 1
+ORDER BY rs.year, rs.gt, rs.stage_number;
+`
+
+// Get the stages won by a rider, ordered by year
+func (q *Queries) GetRiderStageWins(
+	ctx context.Context, riderID int,
+) ([]RiderStageWin, error) {
+	rows, err := q.conn.Query(ctx, getRiderStageWinsQuery, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wins, err := pgx.CollectRows(rows, pgx.RowToStructByName[RiderStageWin])
+	if err != nil {
+		return nil, err
+	}
+	return wins, nil
+}
+
+const getRiderPlacingsQuery = `
+WITH final_stages AS (
+	SELECT DISTINCT ON (race_id) race_id, stage_id
+	FROM racedata.stages
+	ORDER BY race_id, stage_number DESC
+)
+SELECT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	rv.classification,
+	rv.rank
+FROM racedata.results_valid rv
+JOIN final_stages fs ON rv.stage_id = fs.stage_id
+JOIN racedata.races r ON fs.race_id = r.race_id
+WHERE
+	rv.rider_id = $1
+	AND rv.classification IN ('general', 'points', 'mountains', 'youth')
+ORDER BY r.year, r.gt, rv.classification;
+`
+
+// Get a rider's final placings in the jersey classifications of the races
+// they finished, ordered by year
+func (q *Queries) GetRiderPlacings(
+	ctx context.Context, riderID int,
+) ([]RiderPlacing, error) {
+	rows, err := q.conn.Query(ctx, getRiderPlacingsQuery, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	placings, err := pgx.CollectRows(rows, pgx.RowToStructByName[RiderPlacing])
+	if err != nil {
+		return nil, err
+	}
+	return placings, nil
+}
+
+const getRiderParticipationsQuery = `
+WITH final_stages AS (
+	SELECT DISTINCT ON (race_id) race_id, stage_id
+	FROM racedata.stages
+	ORDER BY race_id, stage_number DESC
+), rider_results AS (
+	SELECT
+		s.race_id,
+		s.stage_id,
+		s.stage_number,
+		res.rank,
+		res.classification,
+		res.team_id
+	FROM racedata.results res
+	JOIN racedata.stages s ON res.stage_id = s.stage_id
+	WHERE res.rider_id = @rider_id
+)
+SELECT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	(ARRAY_AGG(rr.team_id ORDER BY rr.stage_number DESC))[1] AS team_id,
+	(ARRAY_AGG(t.name ORDER BY rr.stage_number DESC))[1] AS team,
+	COUNT(DISTINCT rr.stage_id) FILTER (
+		WHERE rr.classification = 'stage' AND (rr.rank).info = 'VAL'
+	) AS stages_finished,
+	(
+		SELECT rv.rank
+		FROM racedata.results_valid rv
+		JOIN final_stages fs ON rv.stage_id = fs.stage_id
+		WHERE
+			fs.race_id = r.race_id
+			AND rv.rider_id = @rider_id
+			AND rv.classification = 'general'
+	) AS gc_rank,
+	(ARRAY_AGG((rr.rank).info ORDER BY rr.stage_number) FILTER (
+		WHERE (rr.rank).info <> 'VAL'
+	))[1] AS status
+FROM rider_results rr
+JOIN racedata.races r ON rr.race_id = r.race_id
+JOIN racedata.teams t ON rr.team_id = t.team_id
+GROUP BY r.race_id
+ORDER BY r.year, r.gt;
+`
+
+// Get the grand tours a rider took part in, ordered by year
+func (q *Queries) GetRiderParticipations(
+	ctx context.Context, riderID int,
+) ([]RiderParticipation, error) {
+	rows, err := q.conn.Query(ctx, getRiderParticipationsQuery, pgx.NamedArgs{
+		"rider_id": riderID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participations, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[RiderParticipation],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return participations, nil
+}
+
+const getRiderTeamsQuery = `
+SELECT DISTINCT
+	r.year,
+	t.team_id,
+	t.name AS team
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+JOIN racedata.races r ON s.race_id = r.race_id
+JOIN racedata.teams t ON res.team_id = t.team_id
+WHERE res.rider_id = $1
+ORDER BY r.year, t.name;
+`
+
+// Get the teams a rider rode for in each year
+func (q *Queries) GetRiderTeams(
+	ctx context.Context, riderID int,
+) ([]RiderTeam, error) {
+	rows, err := q.conn.Query(ctx, getRiderTeamsQuery, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams, err := pgx.CollectRows(rows, pgx.RowToStructByName[RiderTeam])
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+const getTeamQuery = `
+SELECT team_id, name
+FROM racedata.teams
+WHERE team_id = $1;
+`
+
+func (q *Queries) GetTeam(ctx context.Context, teamID int) (Team, error) {
+	rows, err := q.conn.Query(ctx, getTeamQuery, teamID)
+	if err != nil {
+		return Team{}, err
+	}
+	defer rows.Close()
+
+	team, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Team])
+	if err != nil {
+		return Team{}, err
+	}
+	return team, nil
+}
+
+const getTeamNamesQuery = `
+SELECT team_id, year, name
+FROM racedata.team_names
+WHERE team_id = $1
+ORDER BY year;
+`
+
+// Get the names a team raced under, by year
+func (q *Queries) GetTeamNames(
+	ctx context.Context, teamID int,
+) ([]TeamName, error) {
+	rows, err := q.conn.Query(ctx, getTeamNamesQuery, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := pgx.CollectRows(rows, pgx.RowToStructByName[TeamName])
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+const getTeamRostersQuery = `
+SELECT DISTINCT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	rd.rider_id,
+	rd.first_name,
+	rd.last_name,
+	rd.first_name || ' ' || rd.last_name AS name
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+JOIN racedata.races r ON s.race_id = r.race_id
+JOIN racedata.riders rd ON res.rider_id = rd.rider_id
+WHERE
+	res.team_id = @team_id
+	AND (@race_id::int IS NULL OR r.race_id = @race_id::int)
+ORDER BY r.year, r.gt, r.race_id, rd.last_name, rd.first_name;
+`
+
+type TeamRostersQueryParams struct {
+	TeamID int
+	// Optional, all races if nil
+	RaceID *int
+}
+
+// Get the riders who rode for a team in each race, derived from the results,
+// ordered by race and then by last name
+func (q *Queries) GetTeamRosters(
+	ctx context.Context, params TeamRostersQueryParams,
+) ([]TeamRosterRider, error) {
+	rows, err := q.conn.Query(ctx, getTeamRostersQuery, pgx.NamedArgs{
+		"team_id": params.TeamID,
+		"race_id": optionalArg(params.RaceID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	riders, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[TeamRosterRider],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return riders, nil
+}
+
+const getTeamStageWinsQuery = `
+SELECT
+	rs.race_id,
+	rv.rider_id,
+	rd.first_name || ' ' || rd.last_name AS rider,
+	rs.stage_id,
+	rs.gt AS grand_tour,
+	rs.year,
+	rs.stage_number,
+	rs.stage_type,
+	rs.stage_start,
+	rs.stage_end,
+	rs.stage_length
+FROM racedata.results_valid rv
+JOIN racedata.races_stages rs ON rv.stage_id = rs.stage_id
+JOIN racedata.riders rd ON rv.rider_id = rd.rider_id
+WHERE
+	rv.team_id = $1
+	AND rv.classification = 'stage'
+	AND rv.rank = 1
+ORDER BY rs.year, rs.gt, rs.stage_number;
+`
+
+// Get the stages won by riders of a team, ordered by year
+func (q *Queries) GetTeamStageWins(
+	ctx context.Context, teamID int,
+) ([]TeamStageWin, error) {
+	rows, err := q.conn.Query(ctx, getTeamStageWinsQuery, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wins, err := pgx.CollectRows(rows, pgx.RowToStructByName[TeamStageWin])
+	if err != nil {
+		return nil, err
+	}
+	return wins, nil
+}
+
+const getTeamPlacingsQuery = `
+WITH final_stages AS (
+	SELECT DISTINCT ON (race_id) race_id, stage_id
+	FROM racedata.stages
+	ORDER BY race_id, stage_number DESC
+)
+SELECT
+	r.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	rv.rank
+FROM racedata.results_valid rv
+JOIN final_stages fs ON rv.stage_id = fs.stage_id
+JOIN racedata.races r ON fs.race_id = r.race_id
+WHERE
+	rv.team_id = $1
+	AND rv.classification = 'teams'
+ORDER BY r.year, r.gt;
+`
+
+// Get a team's final placings in the teams classification, ordered by year
+func (q *Queries) GetTeamPlacings(
+	ctx context.Context, teamID int,
+) ([]TeamPlacing, error) {
+	rows, err := q.conn.Query(ctx, getTeamPlacingsQuery, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	placings, err := pgx.CollectRows(rows, pgx.RowToStructByName[TeamPlacing])
+	if err != nil {
+		return nil, err
+	}
+	return placings, nil
+}
+
+const getHeadToHeadQuery = `
+WITH shared AS (
+	SELECT
+		rs.race_id,
+		rs.stage_id,
+		rs.gt AS grand_tour,
+		rs.year,
+		rs.stage_number,
+		rs.stage_type,
+		rs.stage_start,
+		rs.stage_end,
+		rs.stage_length,
+		a.rank AS rank_a,
+		b.rank AS rank_b,
+		a.time - b.time AS time_delta,
+		gc_a.rank AS gc_rank_a,
+		gc_b.rank AS gc_rank_b
+	FROM racedata.results_valid a
+	JOIN racedata.results_valid b
+		ON a.stage_id = b.stage_id
+		AND b.rider_id = @rider_b
+		AND b.classification = 'stage'
+	JOIN racedata.races_stages rs ON a.stage_id = rs.stage_id
+	LEFT JOIN racedata.results_valid gc_a
+		ON a.stage_id = gc_a.stage_id
+		AND gc_a.rider_id = @rider_a
+		AND gc_a.classification = 'general'
+	LEFT JOIN racedata.results_valid gc_b
+		ON a.stage_id = gc_b.stage_id
+		AND gc_b.rider_id = @rider_b
+		AND gc_b.classification = 'general'
+	WHERE
+		a.rider_id = @rider_a
+		AND a.classification = 'stage'
+),
+final_stages AS (
+	SELECT DISTINCT ON (race_id) race_id, stage_id
+	FROM racedata.stages
+	WHERE race_id IN (SELECT race_id FROM shared)
+	ORDER BY race_id, stage_number DESC, stage_id
+),
+-- The final general classification ranks of the races both riders finished
+compared AS (
+	SELECT
+		shared.*,
+		fs.stage_id IS NOT NULL
+			AND gc_rank_a IS NOT NULL
+			AND gc_rank_b IS NOT NULL AS gc_compared
+	FROM shared
+	LEFT JOIN final_stages fs ON shared.stage_id = fs.stage_id
+)
+SELECT
+	*,
+	count(*) OVER () AS num_stages,
+	count(*) FILTER (WHERE rank_a < rank_b) OVER () AS wins_a,
+	count(*) FILTER (WHERE rank_b < rank_a) OVER () AS wins_b,
+	avg(time_delta) OVER () AS average_gap,
+	count(*) FILTER (WHERE gc_compared AND gc_rank_a < gc_rank_b) OVER ()
+		AS gc_wins_a,
+	count(*) FILTER (WHERE gc_compared AND gc_rank_b < gc_rank_a) OVER ()
+		AS gc_wins_b
+FROM compared
+ORDER BY year, grand_tour, stage_number;
+`
+
+type HeadToHeadQueryParams struct {
+	RiderA int
+	RiderB int
+}
+
+// headToHeadRow is a stage of a head to head, with the statistics of the
+// whole head to head repeated on every row
+type headToHeadRow struct {
+	HeadToHeadStage
+	GCCompared bool
+	NumStages  int
+	WinsA      int
+	WinsB      int
+	AverageGap Duration
+	GCWinsA    int
+	GCWinsB    int
+}
+
+// Get every stage where both riders have a valid stage result, with their
+// ranks, time delta and general classification ranks after the stage,
+// ordered by year, and the number of stages and races each rider finished
+// ahead of the other and their average time gap
+func (q *Queries) GetHeadToHead(
+	ctx context.Context, params HeadToHeadQueryParams,
+) (HeadToHead, error) {
+	rows, err := q.conn.Query(ctx, getHeadToHeadQuery, pgx.NamedArgs{
+		"rider_a": params.RiderA,
+		"rider_b": params.RiderB,
+	})
+	if err != nil {
+		return HeadToHead{}, err
+	}
+	defer rows.Close()
+
+	h2hRows, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[headToHeadRow],
+	)
+	if err != nil {
+		return HeadToHead{}, err
+	}
+
+	h2h := HeadToHead{
+		Stages:  make([]HeadToHeadStage, len(h2hRows)),
+		Summary: HeadToHeadSummary{Races: []HeadToHeadRace{}},
+	}
+	for i, row := range h2hRows {
+		h2h.Stages[i] = row.HeadToHeadStage
+		if row.GCCompared {
+			h2h.Summary.Races = append(h2h.Summary.Races, HeadToHeadRace{
+				RaceID:    row.RaceID,
+				GrandTour: row.GrandTour,
+				Year:      row.Year,
+				GCRankA:   int(row.GCRankA.Int64),
+				GCRankB:   int(row.GCRankB.Int64),
+			})
+		}
+	}
+	if len(h2hRows) > 0 {
+		row := h2hRows[0]
+		h2h.Summary.Stages = row.NumStages
+		h2h.Summary.WinsA = row.WinsA
+		h2h.Summary.WinsB = row.WinsB
+		h2h.Summary.AverageGap = row.AverageGap.Duration
+		h2h.Summary.GCWinsA = row.GCWinsA
+		h2h.Summary.GCWinsB = row.GCWinsB
+	}
+	return h2h, nil
+}
+
+const getSearchCandidatesQuery = `
+SELECT
+	'rider' AS type,
+	rider_id::int8 AS id,
+	first_name || ' ' || last_name AS name
+FROM racedata.riders
+WHERE
+	@stage_id::int IS NULL
+	OR rider_id IN (
+		SELECT rider_id FROM racedata.results WHERE stage_id = @stage_id::int
+	)
+UNION ALL
+SELECT 'team' AS type, team_id::int8 AS id, name
+FROM racedata.teams
+WHERE
+	@stage_id::int IS NULL
+	OR team_id IN (
+		SELECT team_id FROM racedata.results WHERE stage_id = @stage_id::int
+	)
+UNION ALL
+SELECT DISTINCT 'town' AS type, NULL::int8 AS id, town AS name
+FROM racedata.stages,
+	LATERAL (VALUES (stage_start), (stage_end)) AS towns(town)
+WHERE @stage_id::int IS NULL OR stage_id = @stage_id::int;
+`
+
+type SearchCandidatesQueryParams struct {
+	// Optional, only the riders, teams and towns of this stage if not nil
+	StageID *int
+}
+
+// Get every rider, team and stage town that can be searched for
+func (q *Queries) GetSearchCandidates(
+	ctx context.Context, params SearchCandidatesQueryParams,
+) ([]SearchCandidate, error) {
+	rows, err := q.conn.Query(ctx, getSearchCandidatesQuery, pgx.NamedArgs{
+		"stage_id": optionalArg(params.StageID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates, err := pgx.CollectRows(
+		rows, pgx.RowToStructByName[SearchCandidate],
+	)
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
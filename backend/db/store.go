@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the data access layer of the backend. It is implemented by Queries
+// on a Postgres connection, and by the memstore package in memory for tests.
+type Store interface {
+	// WithTx runs fn with a store in a transaction, which is committed if fn
+	// returns nil and rolled back otherwise.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+	// WithAdminTx runs fn like WithTx, with the privileges of the admin role
+	// that may change the race data.
+	WithAdminTx(ctx context.Context, fn func(tx Store) error) error
+
+	// Daily and random stages
+	GetDailyStage(ctx context.Context) (DailyStage, error)
+	EnsureDailyStage(ctx context.Context, date time.Time) (bool, error)
+	ScheduleDailyStage(ctx context.Context, stageID int) error
+	GetRandomStage(ctx context.Context) (int, error)
+	GetAllStages(ctx context.Context) ([]int, error)
+
+	// Races and stages
+	GetRaces(ctx context.Context, params RacesQueryParams) ([]Race, error)
+	GetRace(ctx context.Context, raceID int) (Race, error)
+	GetRaceStages(ctx context.Context, raceID int) ([]RaceStage, error)
+	GetRaceStageByNumber(
+		ctx context.Context, params RaceStageQueryParams,
+	) (RaceStage, error)
+	GetStagePage(
+		ctx context.Context, params StagePageQueryParams,
+	) (StagePage, error)
+	GetStageInfo(ctx context.Context, stageID int) (StageInfo, error)
+
+	// Tracks and profiles
+	GetTrack(ctx context.Context, params TrackQueryParams) (Track, error)
+	GetGeometrySummary(
+		ctx context.Context, stageID int,
+	) (GeometrySummary, error)
+	GetTile(ctx context.Context, params TileQueryParams) ([]byte, error)
+	GetTrackMetadata(ctx context.Context, stageID int) (TrackMetadata, error)
+	GetTrackPoints(ctx context.Context, stageID int) ([]TrackPoint, error)
+	GetRaceTracks(
+		ctx context.Context, params RaceTracksQueryParams,
+	) ([]RaceStageTrack, error)
+	GetElevationProfile(
+		ctx context.Context, stageID int,
+	) ([]ElevationPoint, error)
+	GetRaceElevationProfiles(
+		ctx context.Context, raceID int,
+	) (map[int][]ElevationPoint, error)
+	GetGradientProfile(
+		ctx context.Context, params GradientQueryParams,
+	) ([]GradientPoint, error)
+
+	// Results
+	GetResults(ctx context.Context, params ResultsQueryParams) ([]Result, error)
+	GetNonFinishers(
+		ctx context.Context, params NonFinishersQueryParams,
+	) ([]NonFinisher, error)
+	GetResultsForClassification(
+		ctx context.Context, params GetResultsForClassificationParams,
+	) ([]Result, error)
+	GetResultForRankAndClassification(
+		ctx context.Context, params GetResultForRankAndClassificationParams,
+	) (Result, error)
+	GetStandings(
+		ctx context.Context, params StandingsQueryParams,
+	) ([]Standing, error)
+	GetRiders(ctx context.Context, stageID int) ([]string, error)
+	GetTeams(ctx context.Context, stageID int) ([]string, error)
+	GetValidResultsCount(
+		ctx context.Context, stageID int,
+	) (ValidResultsCount, error)
+
+	// Riders and teams
+	SearchRiders(
+		ctx context.Context, params RiderSearchQueryParams,
+	) ([]Rider, error)
+	GetRider(ctx context.Context, riderID int) (Rider, error)
+	GetRiderStageWins(ctx context.Context, riderID int) ([]RiderStageWin, error)
+	GetRiderPlacings(ctx context.Context, riderID int) ([]RiderPlacing, error)
+	GetRiderParticipations(
+		ctx context.Context, riderID int,
+	) ([]RiderParticipation, error)
+	GetRiderTeams(ctx context.Context, riderID int) ([]RiderTeam, error)
+	GetTeam(ctx context.Context, teamID int) (Team, error)
+	GetTeamNames(ctx context.Context, teamID int) ([]TeamName, error)
+	GetTeamRosters(
+		ctx context.Context, params TeamRostersQueryParams,
+	) ([]TeamRosterRider, error)
+	GetTeamStageWins(ctx context.Context, teamID int) ([]TeamStageWin, error)
+	GetTeamPlacings(ctx context.Context, teamID int) ([]TeamPlacing, error)
+	GetHeadToHead(
+		ctx context.Context, params HeadToHeadQueryParams,
+	) (HeadToHead, error)
+
+	// Search
+	GetSearchCandidates(
+		ctx context.Context, params SearchCandidatesQueryParams,
+	) ([]SearchCandidate, error)
+
+	// Admin
+	InsertAuditEntry(ctx context.Context, entry AuditEntry) error
+	CreateRace(ctx context.Context, in RaceInput) (int, error)
+	UpdateRace(ctx context.Context, in RaceInput) error
+	DeleteRace(ctx context.Context, raceID int) error
+	CreateStage(ctx context.Context, in StageInput) (int, error)
+	UpdateStage(ctx context.Context, in StageInput) error
+	DeleteStage(ctx context.Context, stageID int) error
+	CreateRider(ctx context.Context, in RiderInput) (int, error)
+	UpdateRider(ctx context.Context, in RiderInput) error
+	DeleteRider(ctx context.Context, riderID int) error
+	CreateTeam(ctx context.Context, in TeamInput) (int, error)
+	UpdateTeam(ctx context.Context, in TeamInput) error
+	DeleteTeam(ctx context.Context, teamID int) error
+	SetTeamName(ctx context.Context, in TeamName) error
+	CreateResult(ctx context.Context, in ResultInput) (int, error)
+	UpdateResult(ctx context.Context, in ResultInput) error
+	DeleteResult(ctx context.Context, resultID int) error
+	CreateTrack(ctx context.Context, in TrackInput) (int, error)
+	LinkStageTrack(ctx context.Context, link StageTrackLink) error
+	RefreshElevation(ctx context.Context) error
+
+	// Imports
+	GetAllRiders(ctx context.Context) ([]Rider, error)
+	GetAllTeams(ctx context.Context) ([]Team, error)
+	GetAllTeamNames(ctx context.Context) ([]TeamName, error)
+	GetRaceResultsCounts(
+		ctx context.Context, raceID int,
+	) ([]StageResultsCount, error)
+	DeleteStageResults(
+		ctx context.Context, stageID int, classification Classification,
+	) (int64, error)
+	GetRaceResults(ctx context.Context, raceID int) ([]RaceResult, error)
+
+	// Data integrity checks
+	GetStageCheckData(ctx context.Context) ([]StageCheckData, error)
+	GetRaceCheckedResults(
+		ctx context.Context, raceID int,
+	) ([]CheckedResult, error)
+	SaveStageValidations(
+		ctx context.Context, validations []StageValidation,
+	) error
+
+	// Archives
+	GetSchemaVersion(ctx context.Context) (string, error)
+	CountRaceData(ctx context.Context) (int, error)
+	ExportRaces(ctx context.Context) ([]RaceInput, error)
+	ExportStages(ctx context.Context) ([]StageInput, error)
+	ExportRiders(ctx context.Context) ([]RiderInput, error)
+	ExportTeams(ctx context.Context) ([]TeamInput, error)
+	ExportResults(ctx context.Context) ([]ResultInput, error)
+	GetTrackIDs(ctx context.Context) ([]int, error)
+	ExportTrack(ctx context.Context, trackID int) (TrackInput, error)
+	ResetIDSequences(ctx context.Context) error
+}
+
+var _ Store = (*Queries)(nil)
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -32,6 +34,18 @@ func (gt GrandTour) String() string {
 	return string(gt)
 }
 
+func (gt GrandTour) Value() (driver.Value, error) {
+	return EnumKey(gt, grandTourMapping)
+}
+
+func ParseGrandTour(s string) (GrandTour, error) {
+	return ParseEnum(s, grandTourMapping)
+}
+
+func (gt *GrandTour) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(gt, data, ParseGrandTour)
+}
+
 // StageType enum
 type StageType string
 
@@ -57,6 +71,18 @@ func (st StageType) String() string {
 	return string(st)
 }
 
+func (st StageType) Value() (driver.Value, error) {
+	return EnumKey(st, stageTypeMapping)
+}
+
+func ParseStageType(s string) (StageType, error) {
+	return ParseEnum(s, stageTypeMapping)
+}
+
+func (st *StageType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(st, data, ParseStageType)
+}
+
 // StageInfo struct
 type StageInfo struct {
 	GrandTour   GrandTour `json:"grand_tour"`
@@ -68,6 +94,179 @@ type StageInfo struct {
 	StageLength float64   `json:"stage_length"`
 }
 
+// Name returns a human readable name for the stage, e.g.
+// "Tour de France 2024, Stage 1: Lyon - Clermont-Ferrand".
+func (si StageInfo) Name() string {
+	return fmt.Sprintf(
+		"%s %d, Stage %d: %s - %s",
+		si.GrandTour, si.Year, si.StageNumber, si.StageStart, si.StageEnd,
+	)
+}
+
+// Race struct
+type Race struct {
+	RaceID    int       `json:"race_id"`
+	GrandTour GrandTour `json:"grand_tour"`
+	Year      int       `json:"year"`
+	NumStages int       `json:"num_stages"`
+	// Total length of the stages in kilometers
+	TotalLength float64 `json:"total_length"`
+}
+
+// RaceStage struct, a stage with its info
+type RaceStage struct {
+	StageID int `json:"stage_id"`
+	StageInfo
+}
+
+// Rider struct
+type Rider struct {
+	RiderID   int    `json:"rider_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Name      string `json:"name"`
+}
+
+// RiderStageWin struct, a stage won by a rider
+type RiderStageWin struct {
+	RaceID int `json:"race_id"`
+	RaceStage
+}
+
+// RiderPlacing struct, a rider's final placing in a classification of a race
+type RiderPlacing struct {
+	RaceID         int            `json:"race_id"`
+	GrandTour      GrandTour      `json:"grand_tour"`
+	Year           int            `json:"year"`
+	Classification Classification `json:"classification"`
+	Rank           int            `json:"rank"`
+}
+
+// RiderParticipation struct, a grand tour a rider took part in
+type RiderParticipation struct {
+	RaceID    int       `json:"race_id"`
+	GrandTour GrandTour `json:"grand_tour"`
+	Year      int       `json:"year"`
+	TeamID    int       `json:"team_id"`
+	Team      string    `json:"team"`
+	// Number of stages the rider finished
+	StagesFinished int `json:"stages_finished"`
+	// Final rank in the general classification, null if the rider did not
+	// finish the race
+	GCRank pgtype.Int8 `json:"gc_rank"`
+	// Status of the rider's first result without a valid rank, e.g. DNF, null
+	// if the rider finished the race
+	Status *RankStatus `json:"status"`
+}
+
+// RiderTeam struct, a team a rider rode for in a year
+type RiderTeam struct {
+	Year   int    `json:"year"`
+	TeamID int    `json:"team_id"`
+	Team   string `json:"team"`
+}
+
+// Team struct
+type Team struct {
+	TeamID int    `json:"team_id"`
+	Name   string `json:"name"`
+}
+
+// TeamName struct, the name a team raced under in a year
+type TeamName struct {
+	TeamID int    `json:"team_id"`
+	Year   int    `json:"year"`
+	Name   string `json:"name"`
+}
+
+// TeamRosterRider struct, a rider who rode for a team in a race
+type TeamRosterRider struct {
+	RaceID    int
+	GrandTour GrandTour
+	Year      int
+	Rider
+}
+
+// TeamStageWin struct, a stage won by a rider of a team
+type TeamStageWin struct {
+	RaceID  int    `json:"race_id"`
+	RiderID int    `json:"rider_id"`
+	Rider   string `json:"rider"`
+	RaceStage
+}
+
+// TeamPlacing struct, a team's final placing in the teams classification of
+// a race
+type TeamPlacing struct {
+	RaceID    int       `json:"race_id"`
+	GrandTour GrandTour `json:"grand_tour"`
+	Year      int       `json:"year"`
+	Rank      int       `json:"rank"`
+}
+
+// SearchEntity enum, the kinds of things that can be searched for
+type SearchEntity string
+
+const (
+	SearchEntityRider SearchEntity = "rider"
+	SearchEntityTeam  SearchEntity = "team"
+	SearchEntityTown  SearchEntity = "town"
+)
+
+func (e SearchEntity) IsValid() bool {
+	return e == SearchEntityRider || e == SearchEntityTeam ||
+		e == SearchEntityTown
+}
+
+func ParseSearchEntity(s string) (SearchEntity, error) {
+	entity := SearchEntity(s)
+	if !entity.IsValid() {
+		return "", fmt.Errorf("unsupported search type: %s", s)
+	}
+	return entity, nil
+}
+
+// SearchCandidate struct, a rider, team or stage town that can be searched
+// for. Towns have no ID.
+type SearchCandidate struct {
+	Type SearchEntity
+	ID   pgtype.Int8
+	Name string
+}
+
+// StageSort enum, the fields stages can be sorted by
+type StageSort string
+
+const (
+	StageSortID          StageSort = "stage_id"
+	StageSortYear        StageSort = "year"
+	StageSortStageNumber StageSort = "stage_number"
+	StageSortLength      StageSort = "stage_length"
+)
+
+var stageSortColumns = map[StageSort]string{
+	StageSortID:          "stage_id",
+	StageSortYear:        "year",
+	StageSortStageNumber: "stage_number",
+	StageSortLength:      "stage_length",
+}
+
+func (s StageSort) IsValid() bool {
+	_, ok := stageSortColumns[s]
+	return ok
+}
+
+// StagePage struct, a page of stages and the cursor for the next page
+type StagePage struct {
+	Stages     []RaceStage `json:"stages"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+type stagePageRow struct {
+	RaceStage
+	SortValue float64
+}
+
 // DailyStage struct
 
 type DailyStage struct {
@@ -75,6 +274,79 @@ type DailyStage struct {
 	Date    pgtype.Date `json:"date"`
 }
 
+// Track struct
+type Track struct {
+	GeoJSON   string
+	NumPoints int
+}
+
+// TrackMetadata struct
+type TrackMetadata struct {
+	Name     pgtype.Text
+	Source   pgtype.Text
+	LinkHref pgtype.Text
+	LinkText pgtype.Text
+}
+
+// RaceStageTrack struct, the track of a stage with its info and metadata
+type RaceStageTrack struct {
+	StageID int
+	StageInfo
+	Track
+	TrackMetadata
+}
+
+// TrackPoint struct, a point on a track in EPSG:4326 with its elevation and
+// distance along the track in meters
+type TrackPoint struct {
+	Longitude float64 `json:"lon"`
+	Latitude  float64 `json:"lat"`
+	ElevationPoint
+}
+
+// Coordinate struct, a longitude and latitude in EPSG:4326
+type Coordinate struct {
+	Longitude float64 `json:"lon"`
+	Latitude  float64 `json:"lat"`
+}
+
+// GeometrySummary struct
+type GeometrySummary struct {
+	// Bounding box as [min lon, min lat, max lon, max lat]
+	BoundingBox [4]float64 `json:"bbox"`
+	Start       Coordinate `json:"start"`
+	Finish      Coordinate `json:"finish"`
+	Centroid    Coordinate `json:"centroid"`
+	// Straight line distance between the start and finish in meters
+	StartFinishDistance float64 `json:"start_finish_distance"`
+}
+
+type geometrySummaryRow struct {
+	MinLon              float64
+	MinLat              float64
+	MaxLon              float64
+	MaxLat              float64
+	StartLon            float64
+	StartLat            float64
+	FinishLon           float64
+	FinishLat           float64
+	CentroidLon         float64
+	CentroidLat         float64
+	StartFinishDistance float64
+}
+
+func (r geometrySummaryRow) toGeometrySummary() GeometrySummary {
+	return GeometrySummary{
+		BoundingBox: [4]float64{r.MinLon, r.MinLat, r.MaxLon, r.MaxLat},
+		Start:       Coordinate{Longitude: r.StartLon, Latitude: r.StartLat},
+		Finish:      Coordinate{Longitude: r.FinishLon, Latitude: r.FinishLat},
+		Centroid: Coordinate{
+			Longitude: r.CentroidLon, Latitude: r.CentroidLat,
+		},
+		StartFinishDistance: r.StartFinishDistance,
+	}
+}
+
 // ElevationPoint struct
 type OrderedElevationPoint interface {
 	Less(other OrderedElevationPoint) bool
@@ -89,6 +361,12 @@ func (ep ElevationPoint) Less(other ElevationPoint) bool {
 	return ep.Distance < other.Distance
 }
 
+// StageElevationPoint struct, an elevation point labelled with its stage
+type StageElevationPoint struct {
+	StageID int
+	ElevationPoint
+}
+
 // GradientPoint struct
 type GradientPoint struct {
 	Distance  float64               `json:"distance"`
@@ -129,6 +407,38 @@ func (c Classification) IsValid() bool {
 	return IsValidValue(c, ClassificationMapping)
 }
 
+// RankStatus enum, the status of a result. Only results with status VAL are
+// ranked, the others did not finish the stage or were excluded from it.
+type RankStatus string
+
+const (
+	RankStatusValid        RankStatus = "VAL"
+	RankStatusDidNotFinish RankStatus = "DNF"
+	RankStatusDidNotStart  RankStatus = "DNS"
+	RankStatusOutsideLimit RankStatus = "OTL"
+	RankStatusDF           RankStatus = "DF"
+	RankStatusNotRanked    RankStatus = "NR"
+	RankStatusDisqualified RankStatus = "DSQ"
+)
+
+var RankStatusMapping = EnumMap[RankStatus]{
+	"VAL": RankStatusValid,
+	"DNF": RankStatusDidNotFinish,
+	"DNS": RankStatusDidNotStart,
+	"OTL": RankStatusOutsideLimit,
+	"DF":  RankStatusDF,
+	"NR":  RankStatusNotRanked,
+	"DSQ": RankStatusDisqualified,
+}
+
+func (s *RankStatus) Scan(src any) error {
+	return ScanEnum(s, src, RankStatusMapping)
+}
+
+func (s RankStatus) IsValid() bool {
+	return IsValidValue(s, RankStatusMapping)
+}
+
 // Duration struct
 type Duration struct {
 	Duration time.Duration
@@ -142,6 +452,32 @@ func (d *Duration) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, d.Duration.String())), nil
 }
 
+// UnmarshalJSON parses a Go duration string, e.g. 4h32m10s, or null.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = Duration{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration{Duration: dur, Valid: true}
+	return nil
+}
+
+// IntervalValue encodes the duration as a Postgres interval.
+func (d Duration) IntervalValue() (pgtype.Interval, error) {
+	return pgtype.Interval{
+		Microseconds: d.Duration.Microseconds(),
+		Valid:        d.Valid,
+	}, nil
+}
+
 func (d *Duration) Scan(src any) error {
 	if src == nil {
 		d.Valid = false
@@ -159,10 +495,34 @@ func (d *Duration) Scan(src any) error {
 
 // Result struct
 type Result struct {
-	Rank           int
+	Rank    int
+	RiderID pgtype.Int8
+	Rider   pgtype.Text
+	TeamID  int
+	Team    pgtype.Text
+	Time    Duration
+	// Time behind the leader of the classification
+	Gap Duration
+	// Whether the time is the same as the time of the previous rank
+	SameTime       bool
+	Points         pgtype.Int8
+	Classification Classification
+}
+
+// NonFinisher struct, a rider or team without a valid rank in a
+// classification of a stage
+type NonFinisher struct {
+	RiderID        pgtype.Int8
 	Rider          pgtype.Text
+	TeamID         int
 	Team           pgtype.Text
-	Time           Duration
-	Points         pgtype.Int8
+	Status         RankStatus
 	Classification Classification
 }
+
+// Standing struct, a result in a classification after a stage of a race
+type Standing struct {
+	StageID     int
+	StageNumber int
+	Result
+}
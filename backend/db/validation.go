@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// StageCheckData struct, the data of a stage checked by the data integrity
+// checks
+type StageCheckData struct {
+	StageID     int       `json:"stage_id"`
+	RaceID      int       `json:"race_id"`
+	GrandTour   GrandTour `json:"grand_tour"`
+	Year        int       `json:"year"`
+	StageNumber int       `json:"stage_no"`
+	StageType   StageType `json:"stage_type"`
+	// Lengths in kilometers, the track length is null if it has no geometry
+	StageLength     float64       `json:"stage_length"`
+	TrackLength     pgtype.Float8 `json:"track_length"`
+	ElevationPoints int           `json:"elevation_points"`
+}
+
+const getStageCheckDataQuery = `
+SELECT
+	s.stage_id,
+	s.race_id,
+	r.gt AS grand_tour,
+	r.year,
+	s.stage_number,
+	s.stage_type,
+	s.stage_length::float8 AS stage_length,
+	ST_Length(t.the_geom) / 1000 AS track_length,
+	(
+		SELECT COUNT(*)
+		FROM geog.elevation e
+		WHERE e.track_fid = s.gpx_id
+	) AS elevation_points
+FROM racedata.stages s
+JOIN racedata.races r ON s.race_id = r.race_id
+LEFT JOIN geog.tracks t ON s.gpx_id = t.track_id
+ORDER BY r.year, r.gt, s.stage_number;
+`
+
+// Get the track and elevation data of every stage, ordered by race and stage
+// number
+func (q *Queries) GetStageCheckData(
+	ctx context.Context,
+) ([]StageCheckData, error) {
+	rows, err := q.conn.Query(ctx, getStageCheckDataQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stages, err := pgx.CollectRows(rows, pgx.RowToStructByName[StageCheckData])
+	if err != nil {
+		return nil, err
+	}
+	return stages, nil
+}
+
+// CheckedResult struct, a valid result as checked by the data integrity
+// checks. The rank is the rank as recorded, not renumbered as in
+// racedata.results_valid.
+type CheckedResult struct {
+	StageID        int
+	Classification Classification
+	Rank           int
+	Time           Duration
+}
+
+const getRaceCheckedResultsQuery = `
+SELECT
+	res.stage_id,
+	res.classification,
+	(res.rank).num AS rank,
+	res.time
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+WHERE s.race_id = $1 AND (res.rank).info = 'VAL'
+ORDER BY res.stage_id, res.classification, (res.rank).num;
+`
+
+// Get the valid results of a race, ordered by stage, classification and rank
+func (q *Queries) GetRaceCheckedResults(
+	ctx context.Context, raceID int,
+) ([]CheckedResult, error) {
+	rows, err := q.conn.Query(ctx, getRaceCheckedResultsQuery, raceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := pgx.CollectRows(rows, pgx.RowToStructByName[CheckedResult])
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StageValidation struct, the outcome of the data integrity checks of a
+// stage
+type StageValidation struct {
+	StageID int
+	Passed  bool
+	// The problems found, marshalled to JSON
+	Problems  any
+	CheckedAt time.Time
+}
+
+const saveStageValidationQuery = `
+INSERT INTO racedata.stage_validation (
+	stage_id, passed, problems, checked_at
+)
+VALUES (@stage_id, @passed, @problems, @checked_at)
+ON CONFLICT (stage_id) DO UPDATE
+SET
+	passed = EXCLUDED.passed,
+	problems = EXCLUDED.problems,
+	checked_at = EXCLUDED.checked_at;
+`
+
+// Record the outcome of the data integrity checks of stages, replacing the
+// previous outcomes
+func (q *Queries) SaveStageValidations(
+	ctx context.Context, validations []StageValidation,
+) error {
+	for _, validation := range validations {
+		problems, err := json.Marshal(validation.Problems)
+		if err != nil {
+			return err
+		}
+		_, err = q.conn.Exec(ctx, saveStageValidationQuery, pgx.NamedArgs{
+			"stage_id":   validation.StageID,
+			"passed":     validation.Passed,
+			"problems":   problems,
+			"checked_at": validation.CheckedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
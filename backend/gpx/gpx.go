@@ -0,0 +1,127 @@
+// Package gpx contains types for reading and writing GPX 1.1 documents.
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	Version   = "1.1"
+	Namespace = "http://www.topografix.com/GPX/1/1"
+	Creator   = "StageHunter"
+)
+
+const ContentType = "application/gpx+xml"
+
+type GPX struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr"`
+	Creator   string     `xml:"creator,attr"`
+	Namespace string     `xml:"xmlns,attr,omitempty"`
+	Metadata  *Metadata  `xml:"metadata,omitempty"`
+	Waypoints []Waypoint `xml:"wpt"`
+	Tracks    []Track    `xml:"trk"`
+}
+
+type Metadata struct {
+	Name        string `xml:"name,omitempty"`
+	Description string `xml:"desc,omitempty"`
+	Link        *Link  `xml:"link,omitempty"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+}
+
+// Waypoint is used for both waypoints and track points.
+type Waypoint struct {
+	Latitude    float64    `xml:"lat,attr"`
+	Longitude   float64    `xml:"lon,attr"`
+	Elevation   *float64   `xml:"ele,omitempty"`
+	Time        *time.Time `xml:"time,omitempty"`
+	Name        string     `xml:"name,omitempty"`
+	Description string     `xml:"desc,omitempty"`
+	Type        string     `xml:"type,omitempty"`
+}
+
+type Track struct {
+	Name     string    `xml:"name,omitempty"`
+	Source   string    `xml:"src,omitempty"`
+	Link     *Link     `xml:"link,omitempty"`
+	Segments []Segment `xml:"trkseg"`
+}
+
+type Segment struct {
+	Points []Waypoint `xml:"trkpt"`
+}
+
+// New returns an empty GPX 1.1 document.
+func New() *GPX {
+	return &GPX{
+		Version:   Version,
+		Creator:   Creator,
+		Namespace: Namespace,
+	}
+}
+
+// Write encodes the document as XML, including the XML header.
+func (g *GPX) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Parse decodes a GPX document. Documents of any GPX version are accepted as
+// long as they use the GPX 1.1 element names.
+func Parse(r io.Reader) (*GPX, error) {
+	var g GPX
+	if err := xml.NewDecoder(r).Decode(&g); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %w", err)
+	}
+	return &g, nil
+}
+
+// Validate checks that the document has a track with at least two points and
+// that every track point has a valid latitude and longitude.
+func (g *GPX) Validate() error {
+	numPoints := 0
+	for i, track := range g.Tracks {
+		for j, segment := range track.Segments {
+			for k, point := range segment.Points {
+				if err := point.Validate(); err != nil {
+					return fmt.Errorf(
+						"track %d, segment %d, point %d: %w", i, j, k, err,
+					)
+				}
+			}
+			numPoints += len(segment.Points)
+		}
+	}
+	if numPoints < 2 {
+		return errors.New("GPX must have a track with at least two points")
+	}
+	return nil
+}
+
+// Validate checks that the latitude and longitude are in range.
+func (w Waypoint) Validate() error {
+	if w.Latitude < -90 || w.Latitude > 90 {
+		return fmt.Errorf("latitude %f out of range", w.Latitude)
+	}
+	if w.Longitude < -180 || w.Longitude > 180 {
+		return fmt.Errorf("longitude %f out of range", w.Longitude)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package gpx_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+)
+
+func TestWrite(t *testing.T) {
+	elevation := 120.5
+	doc := gpx.New()
+	doc.Metadata = &gpx.Metadata{Name: "Stage 1"}
+	doc.Waypoints = []gpx.Waypoint{
+		{Latitude: 45.1, Longitude: 5.2, Elevation: &elevation, Name: "Top"},
+	}
+	doc.Tracks = []gpx.Track{{
+		Name: "Stage 1",
+		Segments: []gpx.Segment{{
+			Points: []gpx.Waypoint{
+				{Latitude: 45, Longitude: 5, Elevation: &elevation},
+				{Latitude: 45.1, Longitude: 5.2},
+			},
+		}},
+	}}
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<gpx version="1.1" creator="StageHunter" xmlns="http://www.topografix.com/GPX/1/1">`,
+		`<metadata>`,
+		`<name>Stage 1</name>`,
+		`<wpt lat="45.1" lon="5.2">`,
+		`<ele>120.5</ele>`,
+		`<name>Top</name>`,
+		`<trkpt lat="45" lon="5">`,
+		`<trkpt lat="45.1" lon="5.2"></trkpt>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %s, got %s", e, out)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Stage 1</name>
+    <trkseg>
+      <trkpt lat="45.0" lon="5.0"><ele>120.5</ele></trkpt>
+      <trkpt lat="45.1" lon="5.2"></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	g, err := gpx.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := g.Validate(); err != nil {
+		t.Errorf("expected valid GPX, got %v", err)
+	}
+	if len(g.Tracks) != 1 || g.Tracks[0].Name != "Stage 1" {
+		t.Fatalf("expected one track named Stage 1, got %+v", g.Tracks)
+	}
+	points := g.Tracks[0].Segments[0].Points
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if points[0].Elevation == nil || *points[0].Elevation != 120.5 {
+		t.Errorf("expected elevation 120.5, got %v", points[0].Elevation)
+	}
+	if points[1].Elevation != nil {
+		t.Errorf("expected no elevation, got %v", *points[1].Elevation)
+	}
+
+	if _, err := gpx.Parse(strings.NewReader("not xml")); err == nil {
+		t.Error("expected an error for invalid XML")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tooShort := gpx.New()
+	tooShort.Tracks = []gpx.Track{{
+		Segments: []gpx.Segment{{
+			Points: []gpx.Waypoint{{Latitude: 45, Longitude: 5}},
+		}},
+	}}
+	if err := tooShort.Validate(); err == nil {
+		t.Error("expected an error for a track with one point")
+	}
+
+	outOfRange := gpx.New()
+	outOfRange.Tracks = []gpx.Track{{
+		Segments: []gpx.Segment{{
+			Points: []gpx.Waypoint{
+				{Latitude: 45, Longitude: 5},
+				{Latitude: 95, Longitude: 5},
+			},
+		}},
+	}}
+	if err := outOfRange.Validate(); err == nil {
+		t.Error("expected an error for a latitude out of range")
+	}
+}
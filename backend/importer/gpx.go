@@ -0,0 +1,155 @@
+// Package importer loads race data from files into the database, and writes
+// it back out in the same formats.
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+)
+
+// TrackOptions are the options of a GPX import.
+type TrackOptions struct {
+	// Stage to link the track to, none if zero, e.g. for the track of a stage
+	// that is yet to be created
+	StageID int
+	// How accurately the track follows the route of the stage, recorded as
+	// the stage's gpx_accuracy. Required with a stage.
+	Accuracy string
+	// Name of the track, the name in the GPX file if empty
+	Name string
+	// Who made the import, recorded in the audit log
+	Actor string
+}
+
+func (o TrackOptions) Validate() error {
+	if o.StageID < 0 {
+		return errors.New("stage ID must be positive")
+	}
+	if o.StageID > 0 && strings.TrimSpace(o.Accuracy) == "" {
+		return errors.New("accuracy is required with a stage")
+	}
+	return nil
+}
+
+// NewTrackInput converts the tracks of a GPX document to a track to insert.
+// The segments of every track are concatenated, so a document with several
+// tracks becomes a single track with a segment per GPX segment.
+func NewTrackInput(doc *gpx.GPX, name string) (db.TrackInput, error) {
+	if err := doc.Validate(); err != nil {
+		return db.TrackInput{}, err
+	}
+
+	input := db.TrackInput{Name: name}
+	if doc.Metadata != nil {
+		if input.Name == "" {
+			input.Name = doc.Metadata.Name
+		}
+		if doc.Metadata.Link != nil {
+			input.LinkHref = doc.Metadata.Link.Href
+			input.LinkText = doc.Metadata.Link.Text
+		}
+	}
+
+	segment := 0
+	for _, track := range doc.Tracks {
+		if input.Name == "" {
+			input.Name = track.Name
+		}
+		if input.Source == "" {
+			input.Source = track.Source
+		}
+		if input.LinkHref == "" && track.Link != nil {
+			input.LinkHref = track.Link.Href
+			input.LinkText = track.Link.Text
+		}
+		for _, trackSegment := range track.Segments {
+			if len(trackSegment.Points) == 0 {
+				continue
+			}
+			for _, point := range trackSegment.Points {
+				input.Points = append(input.Points, db.TrackPointInput{
+					Segment:   segment,
+					Longitude: point.Longitude,
+					Latitude:  point.Latitude,
+					Elevation: point.Elevation,
+					Time:      point.Time,
+				})
+			}
+			segment++
+		}
+	}
+	return input, nil
+}
+
+// TrackImport is the outcome of a GPX import.
+type TrackImport struct {
+	// ID of the new track
+	TrackID int
+	// Why the elevation profiles could not be refreshed, if they could not.
+	// The track is imported either way.
+	Warning string
+}
+
+// ImportGPX parses and validates a GPX file, inserts it as a track, links it
+// to the stage if one is given and records the import in the audit log in a
+// single transaction, then refreshes the elevation profiles. Problems with the file
+// or options are returned as a db.ValidationError. A failed refresh is
+// reported as a warning of the import, as the track has been committed.
+func ImportGPX(
+	ctx context.Context, conn db.Store, r io.Reader, opts TrackOptions,
+) (TrackImport, error) {
+	if err := opts.Validate(); err != nil {
+		return TrackImport{}, db.NewValidationError(err)
+	}
+	doc, err := gpx.Parse(r)
+	if err != nil {
+		return TrackImport{}, db.NewValidationError(err)
+	}
+	input, err := NewTrackInput(doc, opts.Name)
+	if err != nil {
+		return TrackImport{}, db.NewValidationError(err)
+	}
+
+	var trackID int
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		if trackID, err = tx.CreateTrack(ctx, input); err != nil {
+			return err
+		}
+		payload := map[string]any{
+			"name":       input.Name,
+			"num_points": len(input.Points),
+		}
+		if opts.StageID > 0 {
+			link := db.StageTrackLink{
+				StageID:  opts.StageID,
+				TrackID:  trackID,
+				Accuracy: opts.Accuracy,
+			}
+			if err := tx.LinkStageTrack(ctx, link); err != nil {
+				return err
+			}
+			payload["stage_id"] = opts.StageID
+			payload["accuracy"] = opts.Accuracy
+		}
+		return tx.InsertAuditEntry(ctx, db.AuditEntry{
+			Actor:    opts.Actor,
+			Action:   db.ActionCreate,
+			Entity:   db.EntityTrack,
+			EntityID: trackID,
+			Payload:  payload,
+		})
+	})
+	if err != nil {
+		return TrackImport{}, err
+	}
+
+	return TrackImport{
+		TrackID: trackID,
+		Warning: db.RefreshElevationAfterCommit(ctx, conn),
+	}, nil
+}
@@ -0,0 +1,155 @@
+package importer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+)
+
+func TestNewTrackInput(t *testing.T) {
+	elevation := 120.5
+	doc := gpx.New()
+	doc.Metadata = &gpx.Metadata{
+		Link: &gpx.Link{Href: "https://example.com", Text: "Example"},
+	}
+	doc.Tracks = []gpx.Track{
+		{
+			Name:   "Stage 1",
+			Source: "Garmin",
+			Segments: []gpx.Segment{
+				{Points: []gpx.Waypoint{
+					{Latitude: 45, Longitude: 5, Elevation: &elevation},
+					{Latitude: 45.1, Longitude: 5.1},
+				}},
+				{},
+				{Points: []gpx.Waypoint{{Latitude: 45.2, Longitude: 5.2}}},
+			},
+		},
+	}
+
+	input, err := importer.NewTrackInput(doc, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if input.Name != "Stage 1" || input.Source != "Garmin" {
+		t.Errorf("expected name and source from the track, got %+v", input)
+	}
+	if input.LinkHref != "https://example.com" {
+		t.Errorf("expected link from the metadata, got %s", input.LinkHref)
+	}
+	if len(input.Points) != 3 {
+		t.Fatalf("expected 3 points, got %d", len(input.Points))
+	}
+	// The empty segment is skipped
+	segments := []int{0, 0, 1}
+	for i, point := range input.Points {
+		if point.Segment != segments[i] {
+			t.Errorf(
+				"point %d: expected segment %d, got %d",
+				i, segments[i], point.Segment,
+			)
+		}
+	}
+	if input.Points[0].Elevation == nil || *input.Points[0].Elevation != 120.5 {
+		t.Errorf("expected the elevation to be kept")
+	}
+
+	named, err := importer.NewTrackInput(doc, "Custom")
+	if err != nil || named.Name != "Custom" {
+		t.Errorf("expected the given name to be used, got %q, %v", named.Name, err)
+	}
+
+	if _, err := importer.NewTrackInput(gpx.New(), ""); err == nil {
+		t.Error("expected an error for a GPX without a track")
+	}
+}
+
+// failingRefresh is a store whose elevation profiles cannot be refreshed.
+type failingRefresh struct {
+	*memstore.Store
+}
+
+func (s failingRefresh) WithAdminTx(
+	ctx context.Context, fn func(tx db.Store) error,
+) error {
+	return s.Store.WithAdminTx(ctx, func(tx db.Store) error {
+		return fn(failingRefresh{tx.(*memstore.Store)})
+	})
+}
+
+func (s failingRefresh) RefreshElevation(ctx context.Context) error {
+	return errors.New("refresh failed")
+}
+
+// gpxFile returns a GPX file with a single track.
+func gpxFile(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	doc := gpx.New()
+	doc.Tracks = []gpx.Track{{
+		Name: "Stage 1",
+		Segments: []gpx.Segment{{Points: []gpx.Waypoint{
+			{Latitude: 45, Longitude: 5},
+			{Latitude: 45.1, Longitude: 5.1},
+		}}},
+	}}
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestImportGPXWithoutStage(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	result, err := importer.ImportGPX(
+		ctx, store, gpxFile(t), importer.TrackOptions{Actor: "test"},
+	)
+	if err != nil {
+		t.Fatalf("expected the import to succeed, got %v", err)
+	}
+	if _, err := store.ExportTrack(ctx, result.TrackID); err != nil {
+		t.Errorf("expected track %d to be imported: %v", result.TrackID, err)
+	}
+	// The track is free, so a new stage can take it
+	if _, err := store.CreateStage(ctx, db.StageInput{
+		RaceID: 1, StageNumber: 9, StageType: db.StageTypeRoad, StageLength: 100,
+		StageStart: "A", StageEnd: "B",
+		GPXID: result.TrackID, GPXAccuracy: "Exact",
+	}); err != nil {
+		t.Errorf("expected a stage to take the new track: %v", err)
+	}
+
+	_, err = importer.ImportGPX(
+		ctx, store, gpxFile(t),
+		importer.TrackOptions{StageID: 1, Actor: "test"},
+	)
+	if !db.IsValidationError(err) {
+		t.Errorf("expected a validation error without accuracy, got %v", err)
+	}
+}
+
+func TestImportGPXReportsFailedRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	result, err := importer.ImportGPX(
+		ctx, failingRefresh{store}, gpxFile(t),
+		importer.TrackOptions{StageID: 1, Accuracy: "exact", Actor: "test"},
+	)
+	if err != nil {
+		t.Fatalf("expected the import to succeed, got %v", err)
+	}
+	if !strings.Contains(result.Warning, "refresh failed") {
+		t.Errorf("expected a warning about the refresh, got %q", result.Warning)
+	}
+	if _, err := store.ExportTrack(ctx, result.TrackID); err != nil {
+		t.Errorf("expected track %d to be imported: %v", result.TrackID, err)
+	}
+}
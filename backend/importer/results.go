@@ -0,0 +1,829 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+// A results file holds the results of a single race, one result per row.
+// Each row has the following fields:
+//
+//   - stage: the stage number, 0 for a prologue
+//   - classification: stage, general, points, mountains, youth or teams
+//   - rank: the rank as a positive integer, or a status code (VAL, DNF, DNS,
+//     OTL, DF, NR or DSQ) for a rider who is not ranked
+//   - rider: the rider's name, empty for teams results. Written as
+//     "First Last", or "Last, First" when the first name has several words.
+//   - team: the team's name
+//   - time: the time as h:mm:ss, m:ss or a Go duration, e.g. 4h32m10s.
+//     Empty for points and mountains results.
+//   - points: the points as an integer, only for points and mountains
+//     results
+//
+// A CSV file starts with a header row naming its columns, in any order. The
+// rider, time and points columns may be left out. A JSON file is an array of
+// objects with the fields above; rank may be a number or a string.
+//
+// Riders and teams are matched to those in the database by their names,
+// ignoring case, accents and punctuation, and created if there is no match.
+// Teams are also matched by the names they raced under in earlier years, and
+// the name a file gives a team is recorded as its name in the year of the
+// race.
+
+// ResultsFormat is the format of a results file.
+type ResultsFormat string
+
+const (
+	ResultsFormatCSV  ResultsFormat = "csv"
+	ResultsFormatJSON ResultsFormat = "json"
+)
+
+// ParseResultsFormat parses a results file format, ignoring case.
+func ParseResultsFormat(s string) (ResultsFormat, error) {
+	switch format := ResultsFormat(strings.ToLower(s)); format {
+	case ResultsFormatCSV, ResultsFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported results format: %s", s)
+	}
+}
+
+// RankOrStatus is the rank of a result, either an integer or a status code.
+type RankOrStatus string
+
+// UnmarshalJSON accepts a rank written as either a number or a string.
+func (r *RankOrStatus) UnmarshalJSON(data []byte) error {
+	var rank int
+	if err := json.Unmarshal(data, &rank); err == nil {
+		*r = RankOrStatus(strconv.Itoa(rank))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("rank must be a number or a string")
+	}
+	*r = RankOrStatus(s)
+	return nil
+}
+
+// Parse returns the rank and status of the result. An integer is a rank with
+// status VAL, anything else must be a status code, without a rank.
+func (r RankOrStatus) Parse() (*int, db.RankStatus, error) {
+	s := strings.TrimSpace(string(r))
+	if s == "" {
+		return nil, "", errors.New("rank is required")
+	}
+	if rank, err := strconv.Atoi(s); err == nil {
+		return &rank, db.RankStatusValid, nil
+	}
+	status, err := db.ParseEnum(s, db.RankStatusMapping)
+	if err != nil {
+		return nil, "", errors.New(
+			"rank must be an integer or one of VAL, DNF, DNS, OTL, DF, NR " +
+				"or DSQ",
+		)
+	}
+	return nil, status, nil
+}
+
+// ResultRow is a result as written in a results file.
+type ResultRow struct {
+	// Position of the row in the file, counting from 1 and not counting the
+	// header of a CSV file
+	Row            int          `json:"-"`
+	Stage          int          `json:"stage"`
+	Classification string       `json:"classification"`
+	Rank           RankOrStatus `json:"rank"`
+	Rider          string       `json:"rider,omitempty"`
+	Team           string       `json:"team"`
+	Time           string       `json:"time,omitempty"`
+	Points         *int         `json:"points,omitempty"`
+}
+
+// Columns of a CSV results file
+const (
+	columnStage          = "stage"
+	columnClassification = "classification"
+	columnRank           = "rank"
+	columnRider          = "rider"
+	columnTeam           = "team"
+	columnTime           = "time"
+	columnPoints         = "points"
+)
+
+var requiredColumns = []string{
+	columnStage, columnClassification, columnRank, columnTeam,
+}
+
+var knownColumns = map[string]bool{
+	columnStage:          true,
+	columnClassification: true,
+	columnRank:           true,
+	columnRider:          true,
+	columnTeam:           true,
+	columnTime:           true,
+	columnPoints:         true,
+}
+
+// ParseResults reads the rows of a results file.
+func ParseResults(r io.Reader, format ResultsFormat) ([]ResultRow, error) {
+	switch format {
+	case ResultsFormatCSV:
+		return ParseResultsCSV(r)
+	case ResultsFormatJSON:
+		return ParseResultsJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported results format: %s", format)
+	}
+}
+
+// ParseResultsCSV reads the rows of a CSV results file.
+func ParseResultsCSV(r io.Reader) ([]ResultRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("results file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("duplicate column: %s", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+	for name := range columns {
+		if !knownColumns[name] {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+	}
+
+	var rows []ResultRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ResultRow{
+			Row:            len(rows) + 1,
+			Classification: field(columnClassification),
+			Rank:           RankOrStatus(field(columnRank)),
+			Rider:          field(columnRider),
+			Team:           field(columnTeam),
+			Time:           field(columnTime),
+		}
+		if row.Stage, err = strconv.Atoi(field(columnStage)); err != nil {
+			return nil, fmt.Errorf(
+				"row %d: stage must be an integer", row.Row,
+			)
+		}
+		if points := field(columnPoints); points != "" {
+			value, err := strconv.Atoi(points)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"row %d: points must be an integer", row.Row,
+				)
+			}
+			row.Points = &value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseResultsJSON reads the rows of a JSON results file.
+func ParseResultsJSON(r io.Reader) ([]ResultRow, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var rows []ResultRow
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Row = i + 1
+	}
+	return rows, nil
+}
+
+// riderName writes a rider's name the way splitRiderName reads it.
+func riderName(firstName, lastName string) string {
+	if strings.Contains(strings.TrimSpace(firstName), " ") {
+		return lastName + ", " + firstName
+	}
+	return firstName + " " + lastName
+}
+
+// NewResultRows converts the results of a race to the rows of a results
+// file.
+func NewResultRows(results []db.RaceResult) []ResultRow {
+	rows := make([]ResultRow, 0, len(results))
+	for i, result := range results {
+		row := ResultRow{
+			Row:            i + 1,
+			Stage:          result.StageNumber,
+			Classification: result.Classification,
+			Rank:           RankOrStatus(result.Status),
+			Team:           result.Team,
+		}
+		if result.Status == db.RankStatusValid {
+			row.Rank = ""
+			if result.Rank.Valid {
+				row.Rank = RankOrStatus(
+					strconv.FormatInt(result.Rank.Int64, 10),
+				)
+			}
+		}
+		if result.FirstName.Valid && result.LastName.Valid {
+			row.Rider = riderName(
+				result.FirstName.String, result.LastName.String,
+			)
+		}
+		if result.Time.Valid {
+			row.Time = lib.FormatClock(result.Time.Duration)
+		}
+		if result.Points.Valid {
+			points := int(result.Points.Int64)
+			row.Points = &points
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteResults writes the rows of a results file.
+func WriteResults(w io.Writer, rows []ResultRow, format ResultsFormat) error {
+	switch format {
+	case ResultsFormatCSV:
+		return WriteResultsCSV(w, rows)
+	case ResultsFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	default:
+		return fmt.Errorf("unsupported results format: %s", format)
+	}
+}
+
+// WriteResultsCSV writes the rows of a CSV results file, with every column.
+func WriteResultsCSV(w io.Writer, rows []ResultRow) error {
+	writer := csv.NewWriter(w)
+	header := []string{
+		columnStage,
+		columnClassification,
+		columnRank,
+		columnRider,
+		columnTeam,
+		columnTime,
+		columnPoints,
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		points := ""
+		if row.Points != nil {
+			points = strconv.Itoa(*row.Points)
+		}
+		record := []string{
+			strconv.Itoa(row.Stage),
+			row.Classification,
+			string(row.Rank),
+			row.Rider,
+			row.Team,
+			row.Time,
+			points,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ResultsLookup holds the existing data results are resolved against.
+type ResultsLookup struct {
+	Stages    []db.RaceStage
+	Riders    []db.Rider
+	Teams     []db.Team
+	TeamNames []db.TeamName
+	Counts    []db.StageResultsCount
+}
+
+// PlannedResult is a result to create. Riders and teams created by the same
+// import have no ID yet and are referred to by their keys instead.
+type PlannedResult struct {
+	db.ResultInput
+	NewRider string
+	NewTeam  string
+}
+
+// StageClassification is a classification of a stage.
+type StageClassification struct {
+	StageID        int
+	Classification db.Classification
+}
+
+// ResultsReport summarises a results import.
+type ResultsReport struct {
+	DryRun    bool     `json:"dry_run"`
+	Results   int      `json:"results"`
+	NewRiders []string `json:"new_riders"`
+	NewTeams  []string `json:"new_teams"`
+	// Existing results deleted because the file replaces them
+	Replaced  int      `json:"replaced"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// ResultsPlan is everything a results import creates and deletes.
+type ResultsPlan struct {
+	Results []PlannedResult
+	// Riders and teams to create, by key
+	NewRiders map[string]db.RiderInput
+	NewTeams  map[string]db.TeamInput
+	// Names the file gives the existing teams, by ID. New teams are created
+	// with the name the file gives them.
+	TeamNames map[int]string
+	// Classifications of stages whose existing results are deleted
+	Replace []StageClassification
+	Report  ResultsReport
+}
+
+// nameIndex maps normalised names to the IDs of the riders or teams with
+// that name.
+type nameIndex map[string][]int
+
+func (idx nameIndex) add(name string, id int) {
+	key := lib.NormaliseSearch(name)
+	for _, existing := range idx[key] {
+		if existing == id {
+			return
+		}
+	}
+	idx[key] = append(idx[key], id)
+}
+
+// splitRiderName splits a rider's name into first and last names. A name
+// with a comma is written last name first.
+func splitRiderName(name string) (db.RiderInput, error) {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		if first == "" || last == "" {
+			return db.RiderInput{}, fmt.Errorf("invalid rider name: %s", name)
+		}
+		return db.RiderInput{FirstName: first, LastName: last}, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(name), " ")
+	last = strings.TrimSpace(last)
+	if !ok || last == "" {
+		return db.RiderInput{}, fmt.Errorf(
+			"rider name must have a first and a last name: %s", name,
+		)
+	}
+	return db.RiderInput{FirstName: first, LastName: last}, nil
+}
+
+// resolver resolves rider and team names to existing IDs or new entities.
+type resolver struct {
+	riders    nameIndex
+	teams     nameIndex
+	newRiders map[string]db.RiderInput
+	newTeams  map[string]db.TeamInput
+}
+
+func newResolver(
+	riders []db.Rider, teams []db.Team, teamNames []db.TeamName,
+) *resolver {
+	res := &resolver{
+		riders:    make(nameIndex),
+		teams:     make(nameIndex),
+		newRiders: make(map[string]db.RiderInput),
+		newTeams:  make(map[string]db.TeamInput),
+	}
+	for _, rider := range riders {
+		res.riders.add(rider.FirstName+" "+rider.LastName, rider.RiderID)
+		res.riders.add(rider.LastName+" "+rider.FirstName, rider.RiderID)
+	}
+	for _, team := range teams {
+		res.teams.add(team.Name, team.TeamID)
+	}
+	for _, name := range teamNames {
+		res.teams.add(name.Name, name.TeamID)
+	}
+	return res
+}
+
+// rider returns the ID of an existing rider, or the key of a new one.
+func (res *resolver) rider(name string) (int, string, error) {
+	input, err := splitRiderName(name)
+	if err != nil {
+		return 0, "", err
+	}
+	key := lib.NormaliseSearch(input.FirstName + " " + input.LastName)
+	switch ids := res.riders[key]; len(ids) {
+	case 0:
+		res.newRiders[key] = input
+		return 0, key, nil
+	case 1:
+		return ids[0], "", nil
+	default:
+		return 0, "", fmt.Errorf("rider name is ambiguous: %s", name)
+	}
+}
+
+// team returns the ID of an existing team, or the key of a new one.
+func (res *resolver) team(name string) (int, string, error) {
+	key := lib.NormaliseSearch(name)
+	if key == "" {
+		return 0, "", errors.New("team is required")
+	}
+	switch ids := res.teams[key]; len(ids) {
+	case 0:
+		if _, ok := res.newTeams[key]; !ok {
+			res.newTeams[key] = db.TeamInput{Name: strings.TrimSpace(name)}
+		}
+		return 0, key, nil
+	case 1:
+		return ids[0], "", nil
+	default:
+		return 0, "", fmt.Errorf("team name is ambiguous: %s", name)
+	}
+}
+
+// parseClassification parses a classification, returning its database label
+func parseClassification(s string) (db.Classification, error) {
+	value, err := db.ParseEnum(s, db.ClassificationMapping)
+	if err != nil {
+		return "", fmt.Errorf("unsupported classification: %s", s)
+	}
+	key, err := db.EnumKey(value, db.ClassificationMapping)
+	if err != nil {
+		return "", err
+	}
+	return db.Classification(key), nil
+}
+
+// PlanResults resolves the rows of a results file against the existing data
+// and checks them for conflicts: invalid rows, unknown stages, ambiguous
+// names, ranks or riders repeated within a classification, and
+// classifications that already have results unless replace is set.
+func PlanResults(
+	rows []ResultRow, lookup ResultsLookup, replace bool,
+) ResultsPlan {
+	stages := make(map[int]int, len(lookup.Stages))
+	stageNumbers := make(map[int]int, len(lookup.Stages))
+	for _, stage := range lookup.Stages {
+		stages[stage.StageNumber] = stage.StageID
+		stageNumbers[stage.StageID] = stage.StageNumber
+	}
+	existing := make(map[StageClassification]int, len(lookup.Counts))
+	for _, count := range lookup.Counts {
+		key := StageClassification{
+			count.StageID, db.Classification(count.Classification),
+		}
+		existing[key] = count.Count
+	}
+
+	res := newResolver(lookup.Riders, lookup.Teams, lookup.TeamNames)
+	plan := ResultsPlan{TeamNames: make(map[int]string)}
+	conflict := func(row int, format string, args ...any) {
+		plan.Report.Conflicts = append(
+			plan.Report.Conflicts,
+			fmt.Sprintf("row %d: ", row)+fmt.Sprintf(format, args...),
+		)
+	}
+
+	ranks := make(map[StageClassification]map[int]int)
+	riders := make(map[StageClassification]map[string]int)
+	var classifications []StageClassification
+	for _, row := range rows {
+		stageID, ok := stages[row.Stage]
+		if !ok {
+			conflict(row.Row, "race has no stage %d", row.Stage)
+			continue
+		}
+		classification, err := parseClassification(row.Classification)
+		if err != nil {
+			conflict(row.Row, "%s", err)
+			continue
+		}
+		rank, status, err := row.Rank.Parse()
+		if err != nil {
+			conflict(row.Row, "%s", err)
+			continue
+		}
+
+		result := PlannedResult{ResultInput: db.ResultInput{
+			StageID:        stageID,
+			Rank:           rank,
+			Status:         status,
+			Classification: classification,
+			Points:         row.Points,
+		}}
+		if row.Time != "" {
+			duration, err := lib.ParseClock(row.Time)
+			if err != nil {
+				conflict(row.Row, "%s", err)
+				continue
+			}
+			result.Time = db.Duration{Duration: duration, Valid: true}
+		}
+		if result.TeamID, result.NewTeam, err = res.team(row.Team); err != nil {
+			conflict(row.Row, "%s", err)
+			continue
+		}
+		if _, ok := plan.TeamNames[result.TeamID]; !ok && result.NewTeam == "" {
+			plan.TeamNames[result.TeamID] = strings.TrimSpace(row.Team)
+		}
+		riderKey := ""
+		if row.Rider != "" {
+			riderID, newRider, err := res.rider(row.Rider)
+			if err != nil {
+				conflict(row.Row, "%s", err)
+				continue
+			}
+			result.NewRider = newRider
+			riderKey = newRider
+			if newRider == "" {
+				riderKey = "#" + strconv.Itoa(riderID)
+			}
+			// Stands in for the new rider's ID until it is created
+			result.RiderID = &riderID
+		}
+
+		// New riders and teams have no ID yet, so validate with a stand in
+		validated := result.ResultInput
+		if validated.TeamID == 0 {
+			validated.TeamID = 1
+		}
+		var validationErr *db.ValidationError
+		if errors.As(validated.Validate(), &validationErr) {
+			for _, problem := range validationErr.Problems {
+				conflict(row.Row, "%s", problem)
+			}
+			continue
+		}
+
+		key := StageClassification{stageID, classification}
+		if ranks[key] == nil {
+			ranks[key] = make(map[int]int)
+			riders[key] = make(map[string]int)
+			classifications = append(classifications, key)
+		}
+		if rank != nil {
+			if other, ok := ranks[key][*rank]; ok {
+				conflict(
+					row.Row, "stage %d %s rank %d is also given in row %d",
+					row.Stage, classification, *rank, other,
+				)
+				continue
+			}
+			ranks[key][*rank] = row.Row
+		}
+		if riderKey != "" {
+			if other, ok := riders[key][riderKey]; ok {
+				conflict(
+					row.Row, "stage %d %s rider %s is also given in row %d",
+					row.Stage, classification, row.Rider, other,
+				)
+				continue
+			}
+			riders[key][riderKey] = row.Row
+		}
+		plan.Results = append(plan.Results, result)
+	}
+
+	for _, key := range classifications {
+		count := existing[key]
+		if count == 0 {
+			continue
+		}
+		if replace {
+			plan.Replace = append(plan.Replace, key)
+			plan.Report.Replaced += count
+			continue
+		}
+		plan.Report.Conflicts = append(plan.Report.Conflicts, fmt.Sprintf(
+			"stage %d %s already has %d results",
+			stageNumbers[key.StageID], key.Classification, count,
+		))
+	}
+
+	plan.NewRiders = res.newRiders
+	plan.NewTeams = res.newTeams
+	plan.Report.Results = len(plan.Results)
+	for _, rider := range res.newRiders {
+		plan.Report.NewRiders = append(
+			plan.Report.NewRiders, rider.FirstName+" "+rider.LastName,
+		)
+	}
+	for _, team := range res.newTeams {
+		plan.Report.NewTeams = append(plan.Report.NewTeams, team.Name)
+	}
+	sort.Strings(plan.Report.NewRiders)
+	sort.Strings(plan.Report.NewTeams)
+	return plan
+}
+
+// ResultsOptions are the options of a results import.
+type ResultsOptions struct {
+	// Race the results belong to
+	RaceID int
+	Format ResultsFormat
+	// Replace the existing results of the classifications in the file
+	// rather than reporting them as conflicts
+	Replace bool
+	// Report what the import would do without changing anything
+	DryRun bool
+	// Who made the import, recorded in the audit log
+	Actor string
+}
+
+func (o ResultsOptions) Validate() error {
+	if o.RaceID <= 0 {
+		return errors.New("race ID is required")
+	}
+	if _, err := ParseResultsFormat(string(o.Format)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ErrResultsConflict is returned when a results import is not loaded
+// because of conflicts, which are listed in the report.
+var ErrResultsConflict = errors.New("results have conflicts")
+
+// ImportResults parses a results file, resolves it against the race's stages
+// and the existing riders and teams, and unless it is a dry run or there are
+// conflicts, creates the new riders and teams, records the teams' names for
+// the race's year, replaces existing results if asked to, creates the results
+// and records the import in the audit log in a single transaction. Problems with the file or options are returned as a
+// db.ValidationError, and conflicts as ErrResultsConflict.
+func ImportResults(
+	ctx context.Context, conn db.Store, r io.Reader, opts ResultsOptions,
+) (ResultsReport, error) {
+	if err := opts.Validate(); err != nil {
+		return ResultsReport{}, db.NewValidationError(err)
+	}
+	rows, err := ParseResults(r, opts.Format)
+	if err != nil {
+		return ResultsReport{}, db.NewValidationError(err)
+	}
+	if len(rows) == 0 {
+		return ResultsReport{}, db.NewValidationError(
+			errors.New("no results to import"),
+		)
+	}
+
+	race, err := conn.GetRace(ctx, opts.RaceID)
+	if err != nil {
+		return ResultsReport{}, err
+	}
+	var lookup ResultsLookup
+	if lookup.Stages, err = conn.GetRaceStages(ctx, opts.RaceID); err != nil {
+		return ResultsReport{}, err
+	}
+	if lookup.Riders, err = conn.GetAllRiders(ctx); err != nil {
+		return ResultsReport{}, err
+	}
+	if lookup.Teams, err = conn.GetAllTeams(ctx); err != nil {
+		return ResultsReport{}, err
+	}
+	if lookup.TeamNames, err = conn.GetAllTeamNames(ctx); err != nil {
+		return ResultsReport{}, err
+	}
+	lookup.Counts, err = conn.GetRaceResultsCounts(ctx, opts.RaceID)
+	if err != nil {
+		return ResultsReport{}, err
+	}
+
+	plan := PlanResults(rows, lookup, opts.Replace)
+	plan.Report.DryRun = opts.DryRun
+	if opts.DryRun {
+		return plan.Report, nil
+	}
+	if len(plan.Report.Conflicts) > 0 {
+		return plan.Report, ErrResultsConflict
+	}
+
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		return loadResults(ctx, tx, plan, race.Year, opts)
+	})
+	if err != nil {
+		return plan.Report, err
+	}
+	return plan.Report, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadResults makes the changes of a results plan, for a race of the given
+// year.
+func loadResults(
+	ctx context.Context,
+	tx db.Store,
+	plan ResultsPlan,
+	year int,
+	opts ResultsOptions,
+) error {
+	// Created in order of key so that new IDs do not depend on map order
+	teamIDs := make(map[string]int, len(plan.NewTeams))
+	for _, key := range sortedKeys(plan.NewTeams) {
+		team := plan.NewTeams[key]
+		teamID, err := tx.CreateTeam(ctx, team)
+		if err != nil {
+			return err
+		}
+		teamIDs[key] = teamID
+		err = tx.SetTeamName(ctx, db.TeamName{
+			TeamID: teamID, Year: year, Name: team.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for teamID, name := range plan.TeamNames {
+		err := tx.SetTeamName(ctx, db.TeamName{
+			TeamID: teamID, Year: year, Name: name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	riderIDs := make(map[string]int, len(plan.NewRiders))
+	for _, key := range sortedKeys(plan.NewRiders) {
+		riderID, err := tx.CreateRider(ctx, plan.NewRiders[key])
+		if err != nil {
+			return err
+		}
+		riderIDs[key] = riderID
+	}
+
+	for _, replaced := range plan.Replace {
+		_, err := tx.DeleteStageResults(
+			ctx, replaced.StageID, replaced.Classification,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, result := range plan.Results {
+		input := result.ResultInput
+		if result.NewTeam != "" {
+			input.TeamID = teamIDs[result.NewTeam]
+		}
+		if result.NewRider != "" {
+			riderID := riderIDs[result.NewRider]
+			input.RiderID = &riderID
+		}
+		if _, err := tx.CreateResult(ctx, input); err != nil {
+			return err
+		}
+	}
+
+	return tx.InsertAuditEntry(ctx, db.AuditEntry{
+		Actor:    opts.Actor,
+		Action:   db.ActionImport,
+		Entity:   db.EntityRace,
+		EntityID: opts.RaceID,
+		Payload:  plan.Report,
+	})
+}
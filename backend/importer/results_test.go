@@ -0,0 +1,275 @@
+package importer_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+)
+
+func TestParseResultsCSV(t *testing.T) {
+	file := `Stage,Classification,Rank,Rider,Team,Time,Points
+1,stage,1,Tadej Pogačar,UAE Team Emirates,4:32:10,
+1,points,1,Tadej Pogačar,UAE Team Emirates,,50
+1,stage,DNF,"van Aert, Wout",Visma,,
+`
+	rows, err := importer.ParseResultsCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	if rows[0].Row != 1 || rows[0].Stage != 1 || rows[0].Time != "4:32:10" {
+		t.Errorf("unexpected first row: %+v", rows[0])
+	}
+	if rows[1].Points == nil || *rows[1].Points != 50 {
+		t.Errorf("expected 50 points, got %v", rows[1].Points)
+	}
+	if rows[2].Rank != "DNF" || rows[2].Rider != "van Aert, Wout" {
+		t.Errorf("unexpected last row: %+v", rows[2])
+	}
+
+	for _, file := range []string{
+		"",
+		"stage,classification,rank\n",
+		"stage,classification,rank,team,colour\n",
+		"stage,classification,rank,team\none,stage,1,Visma\n",
+	} {
+		_, err := importer.ParseResultsCSV(strings.NewReader(file))
+		if err == nil {
+			t.Errorf("expected an error for %q", file)
+		}
+	}
+}
+
+func TestParseResultsJSON(t *testing.T) {
+	file := `[
+		{"stage": 2, "classification": "general", "rank": 3,
+			"rider": "Jonas Vingegaard", "team": "Visma", "time": "9h1m2s"},
+		{"stage": 2, "classification": "general", "rank": "otl",
+			"rider": "Mark Cavendish", "team": "Astana"}
+	]`
+	rows, err := importer.ParseResultsJSON(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rows) != 2 || rows[0].Rank != "3" || rows[1].Rank != "otl" {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	if rows[1].Row != 2 {
+		t.Errorf("expected row 2, got %d", rows[1].Row)
+	}
+}
+
+func TestRankOrStatusParse(t *testing.T) {
+	rank, status, err := importer.RankOrStatus("12").Parse()
+	if err != nil || rank == nil || *rank != 12 ||
+		status != db.RankStatusValid {
+		t.Errorf("expected rank 12 VAL, got %v %s %v", rank, status, err)
+	}
+	rank, status, err = importer.RankOrStatus("dsq").Parse()
+	if err != nil || rank != nil || status != db.RankStatusDisqualified {
+		t.Errorf("expected DSQ without a rank, got %v %s %v", rank, status, err)
+	}
+	for _, input := range []string{"", "crashed"} {
+		if _, _, err := importer.RankOrStatus(input).Parse(); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func testLookup() importer.ResultsLookup {
+	return importer.ResultsLookup{
+		Stages: []db.RaceStage{
+			{StageID: 10, StageInfo: db.StageInfo{StageNumber: 1}},
+			{StageID: 11, StageInfo: db.StageInfo{StageNumber: 2}},
+		},
+		Riders: []db.Rider{
+			{RiderID: 1, FirstName: "Tadej", LastName: "Pogačar"},
+			{RiderID: 2, FirstName: "Wout", LastName: "van Aert"},
+			{RiderID: 3, FirstName: "Adam", LastName: "Yates"},
+			{RiderID: 4, FirstName: "Adam", LastName: "Yates"},
+		},
+		Teams: []db.Team{
+			{TeamID: 1, Name: "UAE Team Emirates"},
+			{TeamID: 2, Name: "Team Visma | Lease a Bike"},
+		},
+		TeamNames: []db.TeamName{
+			{TeamID: 2, Year: 2023, Name: "Jumbo-Visma"},
+		},
+		Counts: []db.StageResultsCount{
+			{StageID: 11, Classification: "stage", Count: 150},
+		},
+	}
+}
+
+func TestPlanResults(t *testing.T) {
+	points := 50
+	rows := []importer.ResultRow{
+		{Row: 1, Stage: 1, Classification: "stage", Rank: "1",
+			Rider: "tadej pogacar", Team: "uae team emirates", Time: "4:32:10"},
+		{Row: 2, Stage: 1, Classification: "Points", Rank: "1",
+			Rider: "van Aert, Wout", Team: "Team Visma - Lease a Bike",
+			Points: &points},
+		{Row: 3, Stage: 1, Classification: "stage", Rank: "DNF",
+			Rider: "Julian Alaphilippe", Team: "Soudal Quick-Step"},
+		{Row: 4, Stage: 1, Classification: "teams", Rank: "1",
+			Team: "Soudal Quick-Step", Time: "13:40:00"},
+	}
+
+	plan := importer.PlanResults(rows, testLookup(), false)
+	if len(plan.Report.Conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", plan.Report.Conflicts)
+	}
+	if len(plan.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(plan.Results))
+	}
+
+	first := plan.Results[0]
+	if first.StageID != 10 || *first.RiderID != 1 || first.TeamID != 1 {
+		t.Errorf("expected existing rider and team, got %+v", first)
+	}
+	if first.Time.Duration != 4*time.Hour+32*time.Minute+10*time.Second {
+		t.Errorf("unexpected time: %s", first.Time.Duration)
+	}
+	second := plan.Results[1]
+	if second.Classification != db.ClassificationPoints ||
+		*second.RiderID != 2 || second.TeamID != 2 {
+		t.Errorf("expected rider 2 of team 2, got %+v", second)
+	}
+	third := plan.Results[2]
+	if third.Status != db.RankStatusDidNotFinish ||
+		third.NewRider != "julian alaphilippe" ||
+		third.NewTeam != "soudal quick step" {
+		t.Errorf("expected new rider and team, got %+v", third)
+	}
+	if plan.Results[3].RiderID != nil {
+		t.Errorf("expected no rider for a teams result")
+	}
+
+	if len(plan.NewRiders) != 1 || len(plan.NewTeams) != 1 {
+		t.Errorf(
+			"expected one new rider and team, got %v and %v",
+			plan.NewRiders, plan.NewTeams,
+		)
+	}
+	rider := plan.NewRiders["julian alaphilippe"]
+	if rider.FirstName != "Julian" || rider.LastName != "Alaphilippe" {
+		t.Errorf("unexpected new rider: %+v", rider)
+	}
+	if plan.Report.Results != 4 ||
+		plan.Report.NewTeams[0] != "Soudal Quick-Step" {
+		t.Errorf("unexpected report: %+v", plan.Report)
+	}
+}
+
+func TestPlanResultsTeamNames(t *testing.T) {
+	rows := []importer.ResultRow{
+		{Row: 1, Stage: 1, Classification: "teams", Rank: "1",
+			Team: " Jumbo-Visma ", Time: "13:40:00"},
+		{Row: 2, Stage: 1, Classification: "teams", Rank: "2",
+			Team: "UAE Team Emirates", Time: "13:41:00"},
+		{Row: 3, Stage: 1, Classification: "teams", Rank: "3",
+			Team: "Soudal Quick-Step", Time: "13:42:00"},
+	}
+
+	plan := importer.PlanResults(rows, testLookup(), false)
+	if len(plan.Report.Conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", plan.Report.Conflicts)
+	}
+	if plan.Results[0].TeamID != 2 {
+		t.Errorf("expected team 2 by its past name, got %+v", plan.Results[0])
+	}
+	want := map[int]string{1: "UAE Team Emirates", 2: "Jumbo-Visma"}
+	if !reflect.DeepEqual(plan.TeamNames, want) {
+		t.Errorf("expected team names %v, got %v", want, plan.TeamNames)
+	}
+}
+
+func TestPlanResultsConflicts(t *testing.T) {
+	rows := []importer.ResultRow{
+		{Row: 1, Stage: 5, Classification: "stage", Rank: "1",
+			Rider: "Tadej Pogačar", Team: "UAE Team Emirates"},
+		{Row: 2, Stage: 1, Classification: "stage", Rank: "1",
+			Rider: "Adam Yates", Team: "UAE Team Emirates"},
+		{Row: 3, Stage: 1, Classification: "stage", Rank: "1",
+			Rider: "Tadej Pogačar", Team: "UAE Team Emirates"},
+		{Row: 4, Stage: 1, Classification: "stage", Rank: "2",
+			Rider: "Tadej Pogacar", Team: "UAE Team Emirates"},
+		{Row: 5, Stage: 1, Classification: "points", Rank: "1",
+			Rider: "Tadej Pogačar", Team: "UAE Team Emirates", Time: "1:00"},
+		{Row: 6, Stage: 1, Classification: "stage", Rank: "3",
+			Rider: "Pogačar", Team: "UAE Team Emirates"},
+		{Row: 7, Stage: 2, Classification: "stage", Rank: "1",
+			Rider: "Tadej Pogačar", Team: "UAE Team Emirates"},
+	}
+
+	plan := importer.PlanResults(rows, testLookup(), false)
+	expected := []string{
+		"row 1: race has no stage 5",
+		"row 2: rider name is ambiguous: Adam Yates",
+		"row 4: stage 1 stage rider Tadej Pogacar is also given in row 3",
+		"row 5: points results cannot have a time",
+		"row 6: rider name must have a first and a last name: Pogačar",
+		"stage 2 stage already has 150 results",
+	}
+	if len(plan.Report.Conflicts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, plan.Report.Conflicts)
+	}
+	for i, conflict := range expected {
+		if plan.Report.Conflicts[i] != conflict {
+			t.Errorf("expected %q, got %q", conflict, plan.Report.Conflicts[i])
+		}
+	}
+
+	plan = importer.PlanResults(rows[6:], testLookup(), true)
+	if len(plan.Report.Conflicts) != 0 || plan.Report.Replaced != 150 {
+		t.Errorf("expected stage 2 to be replaced, got %+v", plan.Report)
+	}
+}
+
+func TestWriteResultsRoundTrip(t *testing.T) {
+	text := func(s string) pgtype.Text {
+		return pgtype.Text{String: s, Valid: true}
+	}
+	first := pgtype.Int8{Int64: 1, Valid: true}
+	results := []db.RaceResult{
+		{StageNumber: 1, Classification: "stage", Rank: first,
+			Status: db.RankStatusValid, FirstName: text("Tadej"),
+			LastName: text("Pogačar"), Team: "UAE Team Emirates",
+			Time: db.Duration{Duration: 4 * time.Hour, Valid: true}},
+		{StageNumber: 1, Classification: "points", Rank: first,
+			Status: db.RankStatusValid, FirstName: text("Jan Willem"),
+			LastName: text("van Schip"), Team: "Astana",
+			Points: pgtype.Int8{Int64: 20, Valid: true}},
+		// Results that are not valid are stored with a null rank
+		{StageNumber: 1, Classification: "teams",
+			Status: db.RankStatusDidNotStart, Team: "Astana"},
+	}
+	rows := importer.NewResultRows(results)
+	if rows[1].Rider != "van Schip, Jan Willem" || rows[2].Rank != "DNS" {
+		t.Errorf("unexpected rows: %+v", rows)
+	}
+
+	for _, format := range []importer.ResultsFormat{
+		importer.ResultsFormatCSV, importer.ResultsFormatJSON,
+	} {
+		var buf bytes.Buffer
+		if err := importer.WriteResults(&buf, rows, format); err != nil {
+			t.Fatalf("%s: expected no error, got %v", format, err)
+		}
+		parsed, err := importer.ParseResults(&buf, format)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", format, err)
+		}
+		if !reflect.DeepEqual(parsed, rows) {
+			t.Errorf("%s: expected %+v, got %+v", format, rows, parsed)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package kml contains types for writing KML 2.2 documents.
+package kml
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const Namespace = "http://www.opengis.net/kml/2.2"
+
+const ContentType = "application/vnd.google-earth.kml+xml"
+
+type KML struct {
+	XMLName  xml.Name `xml:"kml"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Document Document `xml:"Document"`
+}
+
+type Document struct {
+	Name        string      `xml:"name,omitempty"`
+	Description string      `xml:"description,omitempty"`
+	Placemarks  []Placemark `xml:"Placemark"`
+}
+
+type Placemark struct {
+	Name        string      `xml:"name,omitempty"`
+	Description string      `xml:"description,omitempty"`
+	LineString  *LineString `xml:"LineString,omitempty"`
+	Point       *Point      `xml:"Point,omitempty"`
+}
+
+type LineString struct {
+	Tessellate   int         `xml:"tessellate,omitempty"`
+	AltitudeMode string      `xml:"altitudeMode,omitempty"`
+	Coordinates  Coordinates `xml:"coordinates"`
+}
+
+type Point struct {
+	AltitudeMode string      `xml:"altitudeMode,omitempty"`
+	Coordinates  Coordinates `xml:"coordinates"`
+}
+
+type Coordinate struct {
+	Longitude float64
+	Latitude  float64
+	Altitude  float64
+}
+
+// Coordinates are encoded as space separated lon,lat,alt tuples.
+type Coordinates []Coordinate
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (c Coordinates) MarshalText() ([]byte, error) {
+	var b strings.Builder
+	for i, coord := range c {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(formatFloat(coord.Longitude))
+		b.WriteByte(',')
+		b.WriteString(formatFloat(coord.Latitude))
+		b.WriteByte(',')
+		b.WriteString(formatFloat(coord.Altitude))
+	}
+	return []byte(b.String()), nil
+}
+
+// New returns a KML document with the given name.
+func New(name string) *KML {
+	return &KML{
+		XMLNS:    Namespace,
+		Document: Document{Name: name},
+	}
+}
+
+// Write encodes the document as XML, including the XML header.
+func (k *KML) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(k); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
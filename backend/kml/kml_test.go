@@ -0,0 +1,56 @@
+package kml_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/kml"
+)
+
+func TestCoordinatesMarshalText(t *testing.T) {
+	coords := kml.Coordinates{
+		{Longitude: 5, Latitude: 45.25, Altitude: 100},
+		{Longitude: 5.125, Latitude: 45, Altitude: 0},
+	}
+	b, err := coords.MarshalText()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := "5,45.25,100 5.125,45,0"
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, string(b))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	doc := kml.New("Stage 1")
+	doc.Document.Placemarks = []kml.Placemark{{
+		Name: "Route",
+		LineString: &kml.LineString{
+			Tessellate: 1,
+			Coordinates: kml.Coordinates{
+				{Longitude: 5, Latitude: 45, Altitude: 100},
+				{Longitude: 5.1, Latitude: 45.1, Altitude: 110},
+			},
+		},
+	}}
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		`<kml xmlns="http://www.opengis.net/kml/2.2">`,
+		`<name>Stage 1</name>`,
+		`<tessellate>1</tessellate>`,
+		`<coordinates>5,45,100 5.1,45.1,110</coordinates>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %s, got %s", e, out)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache is a fixed size least recently used cache, safe for concurrent use.
+// Entries expire after the time to live has passed, a time to live of zero
+// means entries never expire.
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[K]*list.Element
+	order    *list.List
+}
+
+func NewCache[K comparable, V any](
+	capacity int, ttl time.Duration,
+) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[K]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (c *Cache[K, V]) expired(entry *cacheEntry[K, V]) bool {
+	return c.ttl > 0 && time.Now().After(entry.expires)
+}
+
+func (c *Cache[K, V]) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry[K, V])
+	delete(c.entries, entry.key)
+	c.order.Remove(element)
+}
+
+// Get returns the value for the key and whether it was found.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return *new(V), false
+	}
+	entry := element.Value.(*cacheEntry[K, V])
+	if c.expired(entry) {
+		c.remove(element)
+		return *new(V), false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set adds or replaces the value for the key, evicting the least recently
+// used entry if the cache is full.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	entry := &cacheEntry[K, V]{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(entry)
+}
+
+// Len returns the number of entries in the cache, including expired entries
+// that have not yet been removed.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Clear removes every entry from the cache.
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
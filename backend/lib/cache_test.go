@@ -0,0 +1,58 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+func TestCache(t *testing.T) {
+	c := lib.NewCache[string, int](2, 0)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	if !ok || v != 1 {
+		t.Errorf("expected value 1, got %d, %t", v, ok)
+	}
+
+	// "b" is now the least recently used entry, so it is evicted
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected length 2, got %d", c.Len())
+	}
+
+	c.Set("a", 4)
+	v, ok = c.Get("a")
+	if !ok || v != 4 {
+		t.Errorf("expected value 4, got %d, %t", v, ok)
+	}
+	v, ok = c.Get("c")
+	if !ok || v != 3 {
+		t.Errorf("expected value 3, got %d, %t", v, ok)
+	}
+
+	c.Clear()
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Errorf("expected an empty cache, got length %d", c.Len())
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := lib.NewCache[string, int](2, time.Millisecond)
+
+	c.Set("a", 1)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a to have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected length 0, got %d", c.Len())
+	}
+}
@@ -2,10 +2,8 @@ package lib
 
 import "time"
 
-func IsToday(t time.Time) bool {
-	now := time.Now()
-	sameYear := t.Year() == now.Year()
-	sameMonth := t.Month() == now.Month()
-	sameDay := t.Day() == now.Day()
-	return sameYear && sameMonth && sameDay
+// Today returns the current date in UTC, at midnight. Daily stages are chosen
+// for UTC dates.
+func Today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
 }
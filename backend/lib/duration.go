@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameTime is shown in place of a gap when a rider finishes in the same time
+// as the rider ahead.
+const SameTime = "s.t."
+
+func splitDuration(d time.Duration) (hours, minutes, seconds int64) {
+	total := int64(d.Truncate(time.Second) / time.Second)
+	return total / 3600, (total % 3600) / 60, total % 60
+}
+
+// FormatClock formats a duration as h:mm:ss, the way race times are shown in
+// cycling results.
+func FormatClock(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	hours, minutes, seconds := splitDuration(d)
+	return fmt.Sprintf("%s%d:%02d:%02d", sign, hours, minutes, seconds)
+}
+
+// FormatGap formats a time gap as +m:ss, or +h:mm:ss when it is an hour or
+// more, the way gaps are shown in cycling results.
+func FormatGap(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	hours, minutes, seconds := splitDuration(d)
+	if hours > 0 {
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%s%d:%02d", sign, minutes, seconds)
+}
+
+// ParseClock parses a race time written as h:mm:ss or m:ss, the way
+// FormatClock writes it, or as a Go duration string, e.g. 4h32m10s.
+func ParseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ":") {
+		return time.ParseDuration(s)
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock time: %s", s)
+	}
+	var total time.Duration
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid clock time: %s", s)
+		}
+		// Minutes and seconds after the leading part are at most 59
+		if i > 0 && (len(part) != 2 || value > 59) {
+			return 0, fmt.Errorf("invalid clock time: %s", s)
+		}
+		total = total*60 + time.Duration(value)
+	}
+	return total * time.Second, nil
+}
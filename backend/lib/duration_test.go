@@ -0,0 +1,71 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+func TestFormatClock(t *testing.T) {
+	testPairs := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{4*time.Hour + 32*time.Minute + 10*time.Second, "4:32:10"},
+		{45*time.Minute + 3*time.Second, "0:45:03"},
+		{8*time.Second + 900*time.Millisecond, "0:00:08"},
+		{83 * time.Hour, "83:00:00"},
+	}
+	for _, pair := range testPairs {
+		actual := lib.FormatClock(pair.input)
+		if actual != pair.expected {
+			t.Errorf("expected %s, got %s", pair.expected, actual)
+		}
+	}
+}
+
+func TestFormatGap(t *testing.T) {
+	testPairs := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{0, "+0:00"},
+		{83 * time.Second, "+1:23"},
+		{12*time.Minute + 5*time.Second, "+12:05"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "+1:02:03"},
+	}
+	for _, pair := range testPairs {
+		actual := lib.FormatGap(pair.input)
+		if actual != pair.expected {
+			t.Errorf("expected %s, got %s", pair.expected, actual)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	testPairs := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"4:32:10", 4*time.Hour + 32*time.Minute + 10*time.Second},
+		{"45:03", 45*time.Minute + 3*time.Second},
+		{"83:00:00", 83 * time.Hour},
+		{" 0:00:08 ", 8 * time.Second},
+		{"4h32m10s", 4*time.Hour + 32*time.Minute + 10*time.Second},
+	}
+	for _, pair := range testPairs {
+		actual, err := lib.ParseClock(pair.input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", pair.input, err)
+		} else if actual != pair.expected {
+			t.Errorf("expected %s, got %s", pair.expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "4:5:10", "1:60", "1:2:3:4", "a:00"} {
+		if _, err := lib.ParseClock(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package lib
+
+import "math"
+
+// Ground resolution of a 256 pixel web mercator tile at zoom level 0, in
+// metres per pixel at the equator.
+const equatorialResolution = 156543.03392804097
+
+// ZoomTolerance returns the width of a single pixel in metres at the given web
+// mercator zoom level. The equatorial resolution is used, so the tolerance is
+// an upper bound for every latitude.
+func ZoomTolerance(zoom int) float64 {
+	return equatorialResolution / math.Pow(2, float64(zoom))
+}
@@ -0,0 +1,28 @@
+package lib_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+func TestZoomTolerance(t *testing.T) {
+	testPairs := []struct {
+		zoom     int
+		expected float64
+	}{
+		{0, 156543.03392804097},
+		{1, 78271.51696402048},
+		{10, 152.87405657035249},
+		{20, 0.14929107086948487},
+	}
+	for _, pair := range testPairs {
+		actual := lib.ZoomTolerance(pair.zoom)
+		if math.Abs(actual-pair.expected) > 1e-9 {
+			t.Errorf(
+				"zoom %d: expected %f, got %f", pair.zoom, pair.expected, actual,
+			)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormaliseSearch converts a string to a lowercase, accent free form with
+// single spaces between words, for accent and case insensitive matching.
+func NormaliseSearch(s string) string {
+	unAccented, err := StripAccents(s)
+	if err != nil {
+		unAccented = s
+	}
+	words := strings.FieldsFunc(strings.ToLower(unAccented), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// Trigrams returns the set of trigrams of a normalised string, the way
+// pg_trgm computes them: each word is padded with two spaces in front and
+// one behind.
+func Trigrams(s string) map[string]struct{} {
+	trigrams := make(map[string]struct{})
+	for _, word := range strings.Fields(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			trigrams[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return trigrams
+}
+
+// TrigramSimilarity returns the number of trigrams two normalised strings
+// share divided by the number of distinct trigrams in either, from 0 for no
+// shared trigrams to 1 for the same trigrams.
+func TrigramSimilarity(a, b string) float64 {
+	trigramsA, trigramsB := Trigrams(a), Trigrams(b)
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range trigramsA {
+		if _, ok := trigramsB[trigram]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(trigramsA)+len(trigramsB)-shared)
+}
+
+// Scores given to exact, prefix and substring matches, trigram similarities
+// can only rank below them
+const (
+	exactMatchScore     = 1.0
+	prefixMatchScore    = 0.9
+	substringMatchScore = 0.75
+)
+
+// MatchScore scores how well a candidate matches a search query, from 0 for no
+// match to 1 for an exact match, ignoring case and accents. Candidates that
+// start with the query, or have a word that does, score above candidates that
+// only contain it, which score above fuzzy trigram matches.
+func MatchScore(query, candidate string) float64 {
+	query, candidate = NormaliseSearch(query), NormaliseSearch(candidate)
+	if query == "" || candidate == "" {
+		return 0
+	}
+	if query == candidate {
+		return exactMatchScore
+	}
+
+	similarity := TrigramSimilarity(query, candidate)
+	if strings.HasPrefix(candidate, query) ||
+		strings.Contains(candidate, " "+query) {
+		return max(prefixMatchScore, similarity*prefixMatchScore)
+	}
+	if strings.Contains(candidate, query) {
+		return max(substringMatchScore, similarity*prefixMatchScore)
+	}
+	return similarity * substringMatchScore
+}
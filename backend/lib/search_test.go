@@ -0,0 +1,77 @@
+package lib_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+func TestNormaliseSearch(t *testing.T) {
+	testPairs := []struct {
+		input    string
+		expected string
+	}{
+		{"Tadej Pogačar", "tadej pogacar"},
+		{"  Primož   ROGLIČ ", "primoz roglic"},
+		{"Ben O'Connor", "ben o connor"},
+		{"Clermont-Ferrand", "clermont ferrand"},
+		{"", ""},
+	}
+	for _, pair := range testPairs {
+		actual := lib.NormaliseSearch(pair.input)
+		if actual != pair.expected {
+			t.Errorf("expected %q, got %q", pair.expected, actual)
+		}
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"word", "word", 1},
+		{"word", "", 0},
+		{"abc", "xyz", 0},
+		// {"  a", " ab", "abc", "bc "} and {"  a", " ab", "abd", "bd "}
+		{"abc", "abd", 2.0 / 6.0},
+	}
+	for _, tc := range testCases {
+		actual := lib.TrigramSimilarity(tc.a, tc.b)
+		if math.Abs(actual-tc.expected) > 1e-9 {
+			t.Errorf(
+				"similarity(%q, %q): expected %f, got %f",
+				tc.a, tc.b, tc.expected, actual,
+			)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	exact := lib.MatchScore("pogacar", "Pogačar")
+	if exact != 1 {
+		t.Errorf("expected exact match to score 1, got %f", exact)
+	}
+
+	prefix := lib.MatchScore("poga", "Tadej Pogačar")
+	substring := lib.MatchScore("gaca", "Tadej Pogačar")
+	fuzzy := lib.MatchScore("pogacer", "Tadej Pogačar")
+	unrelated := lib.MatchScore("pogacar", "Jonas Vingegaard")
+
+	if !(exact > prefix && prefix > substring && substring > fuzzy) {
+		t.Errorf(
+			"expected exact > prefix > substring > fuzzy, got %f, %f, %f, %f",
+			exact, prefix, substring, fuzzy,
+		)
+	}
+	if fuzzy <= unrelated {
+		t.Errorf(
+			"expected fuzzy match to score above unrelated, got %f <= %f",
+			fuzzy, unrelated,
+		)
+	}
+	if lib.MatchScore("", "Tadej Pogačar") != 0 {
+		t.Error("expected empty query to score 0")
+	}
+}
@@ -70,6 +70,19 @@ func AreNormEqual(a, b string) bool {
 	return strings.EqualFold(unAccentedA, unAccentedB)
 }
 
+// Slugify converts a string to a lowercase, accent free, hyphen separated
+// form suitable for file names and URLs.
+func Slugify(s string) (string, error) {
+	unAccented, err := StripAccents(s)
+	if err != nil {
+		return "", err
+	}
+	words := strings.FieldsFunc(strings.ToLower(unAccented), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-"), nil
+}
+
 func ValueToString(v any) (string, error) {
 	if v == nil {
 		return "", fmt.Errorf("value is nil")
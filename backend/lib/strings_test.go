@@ -32,3 +32,24 @@ func TestStripAccents(t *testing.T) {
 		}
 	}
 }
+
+func TestSlugify(t *testing.T) {
+	testPairs := []struct {
+		input    string
+		expected string
+	}{
+		{"Tour de France", "tour-de-france"},
+		{"Giro d'Italia 2024, Stage 1", "giro-d-italia-2024-stage-1"},
+		{"Vuelta a España", "vuelta-a-espana"},
+		{"  Lyon - Clermont-Ferrand  ", "lyon-clermont-ferrand"},
+	}
+	for _, pair := range testPairs {
+		actual, err := lib.Slugify(pair.input)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if actual != pair.expected {
+			t.Errorf("expected %s, got %s", pair.expected, actual)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 
+	"github.com/michaelbennett99/stagehunter/backend/daily"
 	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/migrate"
 	"github.com/michaelbennett99/stagehunter/backend/server"
 )
 
@@ -14,7 +17,19 @@ func main() {
 	}
 	defer pool.Close()
 
-	server := server.NewServer(pool, server.DefaultServerConfig())
+	// Refuse to serve a database without the schema the queries expect
+	migrator, err := migrate.New(pool)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatalf("checking the database schema: %v", err)
+	}
+
+	store := db.New(pool)
+	go daily.NewScheduler(store).Run(context.Background())
+
+	server := server.NewServer(store, server.DefaultServerConfig())
 
 	log.Printf("Listening on %s", server.Addr)
 	log.Fatal(server.ListenAndServe())
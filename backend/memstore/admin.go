@@ -0,0 +1,324 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+func (s *Store) InsertAuditEntry(ctx context.Context, entry db.AuditEntry) error {
+	payload, err := json.Marshal(entry.Payload)
+	if err != nil {
+		return err
+	}
+	defer s.lock()()
+	entry.Payload = json.RawMessage(payload)
+	s.t.audit = append(s.t.audit, entry)
+	return nil
+}
+
+//
+// Races
+//
+
+func (s *Store) CreateRace(ctx context.Context, in db.RaceInput) (int, error) {
+	defer s.lock()()
+	in.RaceID = s.t.nextID("races", in.RaceID)
+	if _, ok := s.t.races[in.RaceID]; ok {
+		return 0, uniqueViolation("races_pkey")
+	}
+	s.t.races[in.RaceID] = in
+	return in.RaceID, nil
+}
+
+func (s *Store) UpdateRace(ctx context.Context, in db.RaceInput) error {
+	defer s.lock()()
+	if _, ok := s.t.races[in.RaceID]; !ok {
+		return pgx.ErrNoRows
+	}
+	s.t.races[in.RaceID] = in
+	return nil
+}
+
+func (s *Store) DeleteRace(ctx context.Context, raceID int) error {
+	defer s.lock()()
+	if _, ok := s.t.races[raceID]; !ok {
+		return pgx.ErrNoRows
+	}
+	for _, stage := range s.t.stages {
+		if stage.RaceID == raceID {
+			return referencedViolation(
+				"races", "stages_race_id_fkey", "stages",
+			)
+		}
+	}
+	delete(s.t.races, raceID)
+	return nil
+}
+
+//
+// Stages
+//
+
+// checkStage checks the foreign keys and unique track of a stage.
+func (t *tables) checkStage(in db.StageInput) error {
+	if _, ok := t.races[in.RaceID]; !ok {
+		return foreignKeyViolation("stages", "stages_race_id_fkey")
+	}
+	if _, ok := t.tracks[in.GPXID]; !ok {
+		return foreignKeyViolation("stages", "stages_gpx_id_fkey")
+	}
+	for _, stage := range t.stages {
+		if stage.GPXID == in.GPXID && stage.StageID != in.StageID {
+			return uniqueViolation("stages_gpx_id_key")
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateStage(ctx context.Context, in db.StageInput) (int, error) {
+	defer s.lock()()
+	in.StageID = s.t.nextID("stages", in.StageID)
+	if _, ok := s.t.stages[in.StageID]; ok {
+		return 0, uniqueViolation("stages_pkey")
+	}
+	if err := s.t.checkStage(in); err != nil {
+		return 0, err
+	}
+	s.t.stages[in.StageID] = in
+	return in.StageID, nil
+}
+
+func (s *Store) UpdateStage(ctx context.Context, in db.StageInput) error {
+	defer s.lock()()
+	if _, ok := s.t.stages[in.StageID]; !ok {
+		return pgx.ErrNoRows
+	}
+	if err := s.t.checkStage(in); err != nil {
+		return err
+	}
+	s.t.stages[in.StageID] = in
+	return nil
+}
+
+// DeleteStage deletes a stage with its validation, unless it has results or
+// has been a daily stage.
+func (s *Store) DeleteStage(ctx context.Context, stageID int) error {
+	defer s.lock()()
+	if _, ok := s.t.stages[stageID]; !ok {
+		return pgx.ErrNoRows
+	}
+	for _, result := range s.t.results {
+		if result.StageID == stageID {
+			return referencedViolation(
+				"stages", "results_stage_id_fkey", "results",
+			)
+		}
+	}
+	for _, daily := range s.t.daily {
+		if daily.StageID == stageID {
+			return referencedViolation(
+				"stages", "daily_stage_id_fkey", "daily",
+			)
+		}
+	}
+	delete(s.t.stages, stageID)
+	delete(s.t.validations, stageID)
+	return nil
+}
+
+//
+// Riders
+//
+
+func (s *Store) CreateRider(ctx context.Context, in db.RiderInput) (int, error) {
+	defer s.lock()()
+	in.RiderID = s.t.nextID("riders", in.RiderID)
+	if _, ok := s.t.riders[in.RiderID]; ok {
+		return 0, uniqueViolation("riders_pkey")
+	}
+	s.t.riders[in.RiderID] = in
+	return in.RiderID, nil
+}
+
+func (s *Store) UpdateRider(ctx context.Context, in db.RiderInput) error {
+	defer s.lock()()
+	if _, ok := s.t.riders[in.RiderID]; !ok {
+		return pgx.ErrNoRows
+	}
+	s.t.riders[in.RiderID] = in
+	return nil
+}
+
+func (s *Store) DeleteRider(ctx context.Context, riderID int) error {
+	defer s.lock()()
+	if _, ok := s.t.riders[riderID]; !ok {
+		return pgx.ErrNoRows
+	}
+	for _, result := range s.t.results {
+		if result.RiderID != nil && *result.RiderID == riderID {
+			return referencedViolation(
+				"riders", "results_rider_id_fkey", "results",
+			)
+		}
+	}
+	delete(s.t.riders, riderID)
+	return nil
+}
+
+//
+// Teams
+//
+
+func (s *Store) CreateTeam(ctx context.Context, in db.TeamInput) (int, error) {
+	defer s.lock()()
+	in.TeamID = s.t.nextID("teams", in.TeamID)
+	if _, ok := s.t.teams[in.TeamID]; ok {
+		return 0, uniqueViolation("teams_pkey")
+	}
+	s.t.teams[in.TeamID] = in
+	return in.TeamID, nil
+}
+
+func (s *Store) UpdateTeam(ctx context.Context, in db.TeamInput) error {
+	defer s.lock()()
+	if _, ok := s.t.teams[in.TeamID]; !ok {
+		return pgx.ErrNoRows
+	}
+	s.t.teams[in.TeamID] = in
+	return nil
+}
+
+func (s *Store) DeleteTeam(ctx context.Context, teamID int) error {
+	defer s.lock()()
+	if _, ok := s.t.teams[teamID]; !ok {
+		return pgx.ErrNoRows
+	}
+	for _, result := range s.t.results {
+		if result.TeamID == teamID {
+			return referencedViolation(
+				"teams", "results_team_id_fkey", "results",
+			)
+		}
+	}
+	delete(s.t.teams, teamID)
+	for key := range s.t.teamNames {
+		if key.teamID == teamID {
+			delete(s.t.teamNames, key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetTeamName(ctx context.Context, in db.TeamName) error {
+	defer s.lock()()
+	if _, ok := s.t.teams[in.TeamID]; !ok {
+		return foreignKeyViolation("team_names", "team_names_team_id_fkey")
+	}
+	s.t.teamNames[teamYear{in.TeamID, in.Year}] = in.Name
+	return nil
+}
+
+//
+// Results
+//
+
+// checkResult checks the foreign keys of a result, and stores it with the
+// database label of its classification and an explicit status.
+func (t *tables) checkResult(in db.ResultInput) (db.ResultInput, error) {
+	if _, ok := t.stages[in.StageID]; !ok {
+		return in, foreignKeyViolation("results", "results_stage_id_fkey")
+	}
+	if _, ok := t.teams[in.TeamID]; !ok {
+		return in, foreignKeyViolation("results", "results_team_id_fkey")
+	}
+	if in.RiderID != nil {
+		if _, ok := t.riders[*in.RiderID]; !ok {
+			return in, foreignKeyViolation("results", "results_rider_id_fkey")
+		}
+	}
+	in.Classification = classificationKey(in.Classification)
+	in.Status = in.RankStatusOrValid()
+	return in, nil
+}
+
+// CreateResult creates a result, with the next value of the result ID
+// sequence if its ID is zero. An explicit ID does not advance the sequence.
+func (s *Store) CreateResult(
+	ctx context.Context, in db.ResultInput,
+) (int, error) {
+	defer s.lock()()
+	in, err := s.t.checkResult(in)
+	if err != nil {
+		return 0, err
+	}
+	in.ResultID = s.t.nextID("results", in.ResultID)
+	if _, ok := s.t.results[in.ResultID]; ok {
+		return 0, uniqueViolation("results_pkey")
+	}
+	s.t.results[in.ResultID] = in
+	return in.ResultID, nil
+}
+
+func (s *Store) UpdateResult(ctx context.Context, in db.ResultInput) error {
+	defer s.lock()()
+	if _, ok := s.t.results[in.ResultID]; !ok {
+		return pgx.ErrNoRows
+	}
+	in, err := s.t.checkResult(in)
+	if err != nil {
+		return err
+	}
+	s.t.results[in.ResultID] = in
+	return nil
+}
+
+func (s *Store) DeleteResult(ctx context.Context, resultID int) error {
+	defer s.lock()()
+	if _, ok := s.t.results[resultID]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(s.t.results, resultID)
+	return nil
+}
+
+//
+// Tracks
+//
+
+func (s *Store) CreateTrack(ctx context.Context, in db.TrackInput) (int, error) {
+	defer s.lock()()
+	in.TrackID = s.t.nextID("tracks", in.TrackID)
+	if _, ok := s.t.tracks[in.TrackID]; ok {
+		return 0, uniqueViolation("tracks_pkey")
+	}
+	in.Points = append([]db.TrackPointInput(nil), in.Points...)
+	s.t.tracks[in.TrackID] = in
+	return in.TrackID, nil
+}
+
+func (s *Store) LinkStageTrack(
+	ctx context.Context, link db.StageTrackLink,
+) error {
+	defer s.lock()()
+	stage, ok := s.t.stages[link.StageID]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	stage.GPXID = link.TrackID
+	stage.GPXAccuracy = link.Accuracy
+	if err := s.t.checkStage(stage); err != nil {
+		return err
+	}
+	s.t.stages[link.StageID] = stage
+	return nil
+}
+
+// RefreshElevation does nothing, as elevation profiles are derived from the
+// track points when they are queried.
+func (s *Store) RefreshElevation(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,332 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+//
+// Imports
+//
+
+func (s *Store) GetAllRiders(ctx context.Context) ([]db.Rider, error) {
+	defer s.lock()()
+	riders := make([]db.Rider, 0, len(s.t.riders))
+	for _, riderID := range sortedKeys(s.t.riders) {
+		riders = append(riders, rider(s.t.riders[riderID]))
+	}
+	return riders, nil
+}
+
+func (s *Store) GetAllTeams(ctx context.Context) ([]db.Team, error) {
+	defer s.lock()()
+	teams := make([]db.Team, 0, len(s.t.teams))
+	for _, teamID := range sortedKeys(s.t.teams) {
+		team := s.t.teams[teamID]
+		teams = append(teams, db.Team{TeamID: team.TeamID, Name: team.Name})
+	}
+	return teams, nil
+}
+
+func (s *Store) GetAllTeamNames(ctx context.Context) ([]db.TeamName, error) {
+	defer s.lock()()
+	return s.t.sortedTeamNames(0), nil
+}
+
+// raceResults returns the results of the stages of a race.
+func (t *tables) raceResults(raceID int) []db.ResultInput {
+	var results []db.ResultInput
+	for _, resultID := range sortedKeys(t.results) {
+		result := t.results[resultID]
+		if t.stages[result.StageID].RaceID == raceID {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (s *Store) GetRaceResultsCounts(
+	ctx context.Context, raceID int,
+) ([]db.StageResultsCount, error) {
+	defer s.lock()()
+	type stageClassification struct {
+		stageID        int
+		classification db.Classification
+	}
+	counts := make(map[stageClassification]int)
+	for _, result := range s.t.raceResults(raceID) {
+		counts[stageClassification{result.StageID, result.Classification}]++
+	}
+
+	results := make([]db.StageResultsCount, 0, len(counts))
+	for key, count := range counts {
+		results = append(results, db.StageResultsCount{
+			StageID:        key.stageID,
+			Classification: string(key.classification),
+			Count:          count,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.StageID != b.StageID {
+			return a.StageID < b.StageID
+		}
+		return classificationOrder[db.Classification(a.Classification)] <
+			classificationOrder[db.Classification(b.Classification)]
+	})
+	return results, nil
+}
+
+func (s *Store) DeleteStageResults(
+	ctx context.Context, stageID int, classification db.Classification,
+) (int64, error) {
+	defer s.lock()()
+	classification = classificationKey(classification)
+	var deleted int64
+	for resultID, result := range s.t.results {
+		if result.StageID == stageID &&
+			result.Classification == classification {
+			delete(s.t.results, resultID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) GetRaceResults(
+	ctx context.Context, raceID int,
+) ([]db.RaceResult, error) {
+	defer s.lock()()
+	results := []db.RaceResult{}
+	for _, in := range s.t.raceResults(raceID) {
+		result := db.RaceResult{
+			StageNumber:    s.t.stages[in.StageID].StageNumber,
+			Classification: string(in.Classification),
+			Status:         in.Status,
+			Team:           s.t.teams[in.TeamID].Name,
+			Time:           in.Time,
+			Rank:           optionalInt(in.Rank),
+			Points:         optionalInt(in.Points),
+		}
+		if in.RiderID != nil {
+			if rider, ok := s.t.riders[*in.RiderID]; ok {
+				result.FirstName = pgtype.Text{
+					String: rider.FirstName, Valid: true,
+				}
+				result.LastName = pgtype.Text{
+					String: rider.LastName, Valid: true,
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.StageNumber != b.StageNumber {
+			return a.StageNumber < b.StageNumber
+		}
+		if a.Classification != b.Classification {
+			return classificationOrder[db.Classification(a.Classification)] <
+				classificationOrder[db.Classification(b.Classification)]
+		}
+		aValid := a.Status == db.RankStatusValid
+		if aValid != (b.Status == db.RankStatusValid) {
+			return aValid
+		}
+		if a.Rank != b.Rank {
+			// Null ranks come last
+			return a.Rank.Valid &&
+				(!b.Rank.Valid || a.Rank.Int64 < b.Rank.Int64)
+		}
+		if a.Status != b.Status {
+			return rankStatusOrder[a.Status] < rankStatusOrder[b.Status]
+		}
+		// Teams, without a last name, come last
+		if a.LastName.Valid != b.LastName.Valid {
+			return a.LastName.Valid
+		}
+		if a.LastName.String != b.LastName.String {
+			return a.LastName.String < b.LastName.String
+		}
+		return a.Team < b.Team
+	})
+	return results, nil
+}
+
+//
+// Data integrity checks
+//
+
+func (s *Store) GetStageCheckData(
+	ctx context.Context,
+) ([]db.StageCheckData, error) {
+	defer s.lock()()
+	stages := []db.StageCheckData{}
+	for _, stage := range s.t.stagesByRace() {
+		race := s.t.races[stage.RaceID]
+		data := db.StageCheckData{
+			StageID:     stage.StageID,
+			RaceID:      stage.RaceID,
+			GrandTour:   race.GrandTour,
+			Year:        race.Year,
+			StageNumber: stage.StageNumber,
+			StageType:   stage.StageType,
+			StageLength: stage.StageLength,
+		}
+		if track, ok := s.t.tracks[stage.GPXID]; ok && len(track.Points) > 0 {
+			data.TrackLength = pgtype.Float8{
+				Float64: trackLength(track) / 1000, Valid: true,
+			}
+			data.ElevationPoints = len(track.Points)
+		}
+		stages = append(stages, data)
+	}
+	return stages, nil
+}
+
+func (s *Store) GetRaceCheckedResults(
+	ctx context.Context, raceID int,
+) ([]db.CheckedResult, error) {
+	defer s.lock()()
+	results := []db.CheckedResult{}
+	for _, in := range s.t.raceResults(raceID) {
+		if in.Status != db.RankStatusValid || in.Rank == nil {
+			continue
+		}
+		results = append(results, db.CheckedResult{
+			StageID:        in.StageID,
+			Classification: in.Classification,
+			Rank:           *in.Rank,
+			Time:           in.Time,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.StageID != b.StageID {
+			return a.StageID < b.StageID
+		}
+		if a.Classification != b.Classification {
+			return classificationOrder[a.Classification] <
+				classificationOrder[b.Classification]
+		}
+		return a.Rank < b.Rank
+	})
+	for i := range results {
+		results[i].Classification = classificationValue(
+			results[i].Classification,
+		)
+	}
+	return results, nil
+}
+
+func (s *Store) SaveStageValidations(
+	ctx context.Context, validations []db.StageValidation,
+) error {
+	defer s.lock()()
+	for _, validation := range validations {
+		if _, ok := s.t.stages[validation.StageID]; !ok {
+			return foreignKeyViolation(
+				"stage_validation", "stage_validation_stage_id_fkey",
+			)
+		}
+		problems, err := json.Marshal(validation.Problems)
+		if err != nil {
+			return err
+		}
+		validation.Problems = json.RawMessage(problems)
+		s.t.validations[validation.StageID] = validation
+	}
+	return nil
+}
+
+//
+// Archives
+//
+
+func (s *Store) GetSchemaVersion(ctx context.Context) (string, error) {
+	defer s.lock()()
+	return s.t.schemaVersion, nil
+}
+
+func (s *Store) CountRaceData(ctx context.Context) (int, error) {
+	defer s.lock()()
+	return len(s.t.races) + len(s.t.stages) + len(s.t.riders) +
+		len(s.t.teams) + len(s.t.teamNames) + len(s.t.results) +
+		len(s.t.tracks), nil
+}
+
+// rows returns the rows of a table, ordered by ID.
+func rows[V any](m map[int]V) []V {
+	values := make([]V, 0, len(m))
+	for _, id := range sortedKeys(m) {
+		values = append(values, m[id])
+	}
+	return values
+}
+
+func (s *Store) ExportRaces(ctx context.Context) ([]db.RaceInput, error) {
+	defer s.lock()()
+	return rows(s.t.races), nil
+}
+
+func (s *Store) ExportStages(ctx context.Context) ([]db.StageInput, error) {
+	defer s.lock()()
+	return rows(s.t.stages), nil
+}
+
+func (s *Store) ExportRiders(ctx context.Context) ([]db.RiderInput, error) {
+	defer s.lock()()
+	return rows(s.t.riders), nil
+}
+
+func (s *Store) ExportTeams(ctx context.Context) ([]db.TeamInput, error) {
+	defer s.lock()()
+	return rows(s.t.teams), nil
+}
+
+// ExportResults returns every result, ordered by ID, with the value of its
+// classification as scanned from the database.
+func (s *Store) ExportResults(ctx context.Context) ([]db.ResultInput, error) {
+	defer s.lock()()
+	results := rows(s.t.results)
+	for i := range results {
+		results[i].Classification = classificationValue(
+			results[i].Classification,
+		)
+	}
+	return results, nil
+}
+
+func (s *Store) GetTrackIDs(ctx context.Context) ([]int, error) {
+	defer s.lock()()
+	return sortedKeys(s.t.tracks), nil
+}
+
+func (s *Store) ExportTrack(
+	ctx context.Context, trackID int,
+) (db.TrackInput, error) {
+	defer s.lock()()
+	track, ok := s.t.tracks[trackID]
+	if !ok {
+		return db.TrackInput{}, pgx.ErrNoRows
+	}
+	track.Points = append([]db.TrackPointInput{}, track.Points...)
+	return track, nil
+}
+
+func (s *Store) ResetIDSequences(ctx context.Context) error {
+	defer s.lock()()
+	resetSeq(s.t, "races", s.t.races)
+	resetSeq(s.t, "stages", s.t.stages)
+	resetSeq(s.t, "riders", s.t.riders)
+	resetSeq(s.t, "teams", s.t.teams)
+	resetSeq(s.t, "results", s.t.results)
+	resetSeq(s.t, "tracks", s.t.tracks)
+	return nil
+}
@@ -0,0 +1,160 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+//go:embed fixtures.json
+var defaultFixtures []byte
+
+// Fixtures struct, the rows a store is seeded with
+type Fixtures struct {
+	SchemaVersion string          `json:"schema_version"`
+	Races         []db.RaceInput  `json:"races"`
+	Stages        []db.StageInput `json:"stages"`
+	Riders        []db.RiderInput `json:"riders"`
+	Teams         []db.TeamInput  `json:"teams"`
+	TeamNames     []db.TeamName   `json:"team_names"`
+	Tracks        []TrackFixture  `json:"tracks"`
+	// Results give their classification by its database label
+	Results []db.ResultInput `json:"results"`
+}
+
+// TrackFixture struct, a track with its points as [lon, lat] or
+// [lon, lat, ele] in WGS 84 coordinates
+type TrackFixture struct {
+	TrackID  int         `json:"track_id"`
+	Name     string      `json:"name"`
+	Source   string      `json:"source"`
+	LinkHref string      `json:"link_href"`
+	LinkText string      `json:"link_text"`
+	Points   [][]float64 `json:"points"`
+}
+
+// TrackInput converts the fixture to a track to create.
+func (f TrackFixture) TrackInput() (db.TrackInput, error) {
+	points := make([]db.TrackPointInput, len(f.Points))
+	for i, point := range f.Points {
+		if len(point) != 2 && len(point) != 3 {
+			return db.TrackInput{}, fmt.Errorf(
+				"track %d: point %d has %d coordinates",
+				f.TrackID, i, len(point),
+			)
+		}
+		points[i] = db.TrackPointInput{
+			Longitude: point[0],
+			Latitude:  point[1],
+		}
+		if len(point) == 3 {
+			points[i].Elevation = &point[2]
+		}
+	}
+	return db.TrackInput{
+		TrackID:  f.TrackID,
+		Name:     f.Name,
+		Source:   f.Source,
+		LinkHref: f.LinkHref,
+		LinkText: f.LinkText,
+		Points:   points,
+	}, nil
+}
+
+// LoadFixtures reads fixtures from JSON.
+func LoadFixtures(r io.Reader) (Fixtures, error) {
+	var fixtures Fixtures
+	if err := json.NewDecoder(r).Decode(&fixtures); err != nil {
+		return Fixtures{}, err
+	}
+	return fixtures, nil
+}
+
+// DefaultFixtures returns the fixtures embedded in the package: two races of
+// 2024 with five stages and their tracks, five riders with their teams,
+// including a team renamed from 2023, and results in every classification,
+// including riders who did not finish and tied ranks.
+func DefaultFixtures() Fixtures {
+	fixtures, err := LoadFixtures(bytes.NewReader(defaultFixtures))
+	if err != nil {
+		panic(fmt.Sprintf("memstore: invalid default fixtures: %v", err))
+	}
+	return fixtures
+}
+
+// Seed creates the rows of the fixtures in a store in a transaction, with
+// their IDs, and moves the ID sequences past them. It works on any
+// store, so the same fixtures can seed a test database.
+func (f Fixtures) Seed(ctx context.Context, store db.Store) error {
+	return store.WithTx(ctx, func(tx db.Store) error {
+		for _, fixture := range f.Tracks {
+			track, err := fixture.TrackInput()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.CreateTrack(ctx, track); err != nil {
+				return fmt.Errorf("track %d: %w", track.TrackID, err)
+			}
+		}
+		if err := tx.RefreshElevation(ctx); err != nil {
+			return err
+		}
+		for _, race := range f.Races {
+			if _, err := tx.CreateRace(ctx, race); err != nil {
+				return fmt.Errorf("race %d: %w", race.RaceID, err)
+			}
+		}
+		for _, stage := range f.Stages {
+			if _, err := tx.CreateStage(ctx, stage); err != nil {
+				return fmt.Errorf("stage %d: %w", stage.StageID, err)
+			}
+		}
+		for _, rider := range f.Riders {
+			if _, err := tx.CreateRider(ctx, rider); err != nil {
+				return fmt.Errorf("rider %d: %w", rider.RiderID, err)
+			}
+		}
+		for _, team := range f.Teams {
+			if _, err := tx.CreateTeam(ctx, team); err != nil {
+				return fmt.Errorf("team %d: %w", team.TeamID, err)
+			}
+		}
+		for _, name := range f.TeamNames {
+			if err := tx.SetTeamName(ctx, name); err != nil {
+				return fmt.Errorf(
+					"team %d name in %d: %w", name.TeamID, name.Year, err,
+				)
+			}
+		}
+		for _, result := range f.Results {
+			if _, err := tx.CreateResult(ctx, result); err != nil {
+				return fmt.Errorf("result %d: %w", result.ResultID, err)
+			}
+		}
+		return tx.ResetIDSequences(ctx)
+	})
+}
+
+// NewSeeded returns a store seeded with the fixtures, at their schema
+// version.
+func NewSeeded(fixtures Fixtures) (*Store, error) {
+	store := New(fixtures.SchemaVersion)
+	if err := fixtures.Seed(context.Background(), store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Default returns a store seeded with the default fixtures.
+func Default() *Store {
+	store, err := NewSeeded(DefaultFixtures())
+	if err != nil {
+		panic(fmt.Sprintf("memstore: seeding default fixtures: %v", err))
+	}
+	return store
+}
@@ -0,0 +1,354 @@
+// Package memstore is an in-memory implementation of db.Store, for testing
+// the code that uses the database without Postgres. It is seeded from
+// fixtures, and reproduces the views and constraints of the racedata schema
+// that the queries rely on: valid ranks are renumbered as in
+// racedata.results_valid, foreign keys and primary keys are enforced with the
+// error codes of Postgres, and elevation profiles are derived from the track
+// points.
+//
+// Track geometry is computed on the sphere rather than in the projection of
+// the database, so distances differ slightly from those of Postgres, tracks
+// are not simplified and vector tiles are always empty.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+// dailyRow struct, a row of racedata.daily
+type dailyRow struct {
+	DailyID int
+	StageID int
+	Date    time.Time
+}
+
+// tables struct, the rows of the store. Results hold the database label of
+// their classification, e.g. general.
+type tables struct {
+	schemaVersion string
+	races         map[int]db.RaceInput
+	stages        map[int]db.StageInput
+	riders        map[int]db.RiderInput
+	teams         map[int]db.TeamInput
+	teamNames     map[teamYear]string
+	results       map[int]db.ResultInput
+	tracks        map[int]db.TrackInput
+	daily         []dailyRow
+	validations   map[int]db.StageValidation
+	audit         []db.AuditEntry
+	// Last values of the ID sequences, by table
+	seqs map[string]int
+}
+
+// teamYear is the key of the name of a team in a year.
+type teamYear struct {
+	teamID int
+	year   int
+}
+
+func newTables() *tables {
+	return &tables{
+		races:       make(map[int]db.RaceInput),
+		stages:      make(map[int]db.StageInput),
+		riders:      make(map[int]db.RiderInput),
+		teams:       make(map[int]db.TeamInput),
+		teamNames:   make(map[teamYear]string),
+		results:     make(map[int]db.ResultInput),
+		tracks:      make(map[int]db.TrackInput),
+		validations: make(map[int]db.StageValidation),
+		seqs:        make(map[string]int),
+	}
+}
+
+func cloneMap[V any](m map[int]V) map[int]V {
+	clone := make(map[int]V, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+// clone copies the tables. Rows are replaced rather than modified in place,
+// so they are not copied.
+func (t *tables) clone() *tables {
+	return &tables{
+		schemaVersion: t.schemaVersion,
+		races:         cloneMap(t.races),
+		stages:        cloneMap(t.stages),
+		riders:        cloneMap(t.riders),
+		teams:         cloneMap(t.teams),
+		teamNames:     maps.Clone(t.teamNames),
+		results:       cloneMap(t.results),
+		tracks:        cloneMap(t.tracks),
+		daily:         append([]dailyRow(nil), t.daily...),
+		validations:   cloneMap(t.validations),
+		audit:         append([]db.AuditEntry(nil), t.audit...),
+		seqs:          maps.Clone(t.seqs),
+	}
+}
+
+// Store is an in-memory db.Store. It is safe for concurrent use, and its
+// transactions are serialized.
+type Store struct {
+	mu *sync.Mutex
+	t  *tables
+	// Whether the store is a transaction, which holds the lock of its parent
+	tx bool
+}
+
+var _ db.Store = (*Store)(nil)
+
+// New returns an empty store at the given schema migration version.
+func New(schemaVersion string) *Store {
+	t := newTables()
+	t.schemaVersion = schemaVersion
+	return &Store{mu: &sync.Mutex{}, t: t}
+}
+
+// lock locks the store, unless it is a transaction, and returns the function
+// that unlocks it.
+func (s *Store) lock() func() {
+	if s.tx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// WithTx runs fn with a copy of the store, which replaces the store if fn
+// returns nil and is discarded otherwise. Transactions in a transaction run
+// in the outer transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(tx db.Store) error) error {
+	if s.tx {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Store{mu: s.mu, t: s.t.clone(), tx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.t = tx.t
+	return nil
+}
+
+// WithAdminTx runs fn like WithTx, as the store has no roles.
+func (s *Store) WithAdminTx(
+	ctx context.Context, fn func(tx db.Store) error,
+) error {
+	return s.WithTx(ctx, fn)
+}
+
+// AuditLog returns the entries of the audit log, oldest first. Payloads are
+// held as marshalled JSON.
+func (s *Store) AuditLog() []db.AuditEntry {
+	defer s.lock()()
+	return append([]db.AuditEntry(nil), s.t.audit...)
+}
+
+// Errors with the codes and messages of the errors of Postgres
+
+func uniqueViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     "23505",
+		Message: fmt.Sprintf(
+			"duplicate key value violates unique constraint %q", constraint,
+		),
+		ConstraintName: constraint,
+	}
+}
+
+// foreignKeyViolation is the error of a row referring to a row that does not
+// exist.
+func foreignKeyViolation(table, constraint string) error {
+	return &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     "23503",
+		Message: fmt.Sprintf(
+			"insert or update on table %q violates foreign key constraint %q",
+			table, constraint,
+		),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+// referencedViolation is the error of deleting a row that other rows refer
+// to.
+func referencedViolation(table, constraint, referencing string) error {
+	return &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     "23503",
+		Message: fmt.Sprintf(
+			"update or delete on table %q violates foreign key constraint "+
+				"%q on table %q",
+			table, constraint, referencing,
+		),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+// sortedKeys returns the keys of a table in order.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// nextID returns the ID of a new row: the given ID, or the next value of the
+// ID sequence of the table if it is zero. An explicit ID does not advance the
+// sequence.
+func (t *tables) nextID(table string, id int) int {
+	if id != 0 {
+		return id
+	}
+	t.seqs[table]++
+	return t.seqs[table]
+}
+
+// sortedTeamNames returns the names of a team by year, or of every team if
+// the team ID is zero, ordered by team ID and year.
+func (t *tables) sortedTeamNames(teamID int) []db.TeamName {
+	names := []db.TeamName{}
+	for key, name := range t.teamNames {
+		if teamID == 0 || key.teamID == teamID {
+			names = append(names, db.TeamName{
+				TeamID: key.teamID, Year: key.year, Name: name,
+			})
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].TeamID != names[j].TeamID {
+			return names[i].TeamID < names[j].TeamID
+		}
+		return names[i].Year < names[j].Year
+	})
+	return names
+}
+
+// resetSeq makes the ID sequence of a table continue after its highest ID.
+func resetSeq[V any](t *tables, table string, m map[int]V) {
+	t.seqs[table] = 0
+	for id := range m {
+		if id > t.seqs[table] {
+			t.seqs[table] = id
+		}
+	}
+}
+
+//
+// Daily and random stages
+//
+
+// randomValidStage returns a random stage that did not fail the data
+// integrity checks, as racedata.get_random_valid_stage_id.
+func (t *tables) randomValidStage() (int, bool) {
+	var stageIDs []int
+	for _, stageID := range sortedKeys(t.stages) {
+		if validation, ok := t.validations[stageID]; ok && !validation.Passed {
+			continue
+		}
+		stageIDs = append(stageIDs, stageID)
+	}
+	if len(stageIDs) == 0 {
+		return 0, false
+	}
+	return stageIDs[rand.Intn(len(stageIDs))], true
+}
+
+// setDaily makes a stage the daily stage of a date, replacing the stage of
+// the date if there is one, as daily_date_key is unique.
+func (t *tables) setDaily(stageID int, date time.Time) {
+	for i := range t.daily {
+		if t.daily[i].Date.Equal(date) {
+			t.daily[i].StageID = stageID
+			return
+		}
+	}
+	dailyID := 1
+	for _, row := range t.daily {
+		if row.DailyID >= dailyID {
+			dailyID = row.DailyID + 1
+		}
+	}
+	t.daily = append(t.daily, dailyRow{
+		DailyID: dailyID, StageID: stageID, Date: date,
+	})
+}
+
+func (s *Store) GetDailyStage(ctx context.Context) (db.DailyStage, error) {
+	defer s.lock()()
+	if len(s.t.daily) == 0 {
+		return db.DailyStage{}, pgx.ErrNoRows
+	}
+	latest := s.t.daily[0]
+	for _, row := range s.t.daily[1:] {
+		if row.Date.After(latest.Date) {
+			latest = row
+		}
+	}
+	return db.DailyStage{
+		StageID: latest.StageID,
+		Date:    pgtype.Date{Time: latest.Date, Valid: true},
+	}, nil
+}
+
+func (s *Store) EnsureDailyStage(
+	ctx context.Context, date time.Time,
+) (bool, error) {
+	defer s.lock()()
+	for _, row := range s.t.daily {
+		if row.Date.Equal(date) {
+			return false, nil
+		}
+	}
+	stageID, ok := s.t.randomValidStage()
+	if !ok {
+		return false, nil
+	}
+	s.t.setDaily(stageID, date)
+	return true, nil
+}
+
+func (s *Store) ScheduleDailyStage(ctx context.Context, stageID int) error {
+	defer s.lock()()
+	if _, ok := s.t.stages[stageID]; !ok {
+		return foreignKeyViolation("daily", "daily_stage_id_fkey")
+	}
+	s.t.setDaily(stageID, lib.Today())
+	return nil
+}
+
+func (s *Store) GetRandomStage(ctx context.Context) (int, error) {
+	defer s.lock()()
+	stageIDs := sortedKeys(s.t.stages)
+	if len(stageIDs) == 0 {
+		return 0, errors.New("no stages")
+	}
+	return stageIDs[rand.Intn(len(stageIDs))], nil
+}
+
+func (s *Store) GetAllStages(ctx context.Context) ([]int, error) {
+	defer s.lock()()
+	return sortedKeys(s.t.stages), nil
+}
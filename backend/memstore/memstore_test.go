@@ -0,0 +1,311 @@
+package memstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/michaelbennett99/stagehunter/backend/archive"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
+func TestDefaultFixturesPassValidation(t *testing.T) {
+	store := memstore.Default()
+	report, err := validation.Run(
+		context.Background(), store, validation.DefaultConfig(), true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NumStages != 5 {
+		t.Errorf("got %d stages, want 5", report.NumStages)
+	}
+	for _, stage := range report.Stages {
+		if !stage.Passed {
+			t.Errorf("stage %d failed: %v", stage.StageID, stage.Problems)
+		}
+	}
+}
+
+func TestValidRanksAreRenumbered(t *testing.T) {
+	store := memstore.Default()
+	// Stage 4 records a tie for first place, with ranks 1, 1, 3 and 4
+	results, err := store.GetResultsForClassification(
+		context.Background(),
+		db.GetResultsForClassificationParams{
+			StageID: 4, TopN: 10, Classification: "stage",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRanks := []int{1, 2, 3, 4}
+	wantGaps := []time.Duration{0, 0, 3 * time.Second, 9 * time.Second}
+	wantSameTime := []bool{false, true, false, false}
+	if len(results) != len(wantRanks) {
+		t.Fatalf("got %d results, want %d", len(results), len(wantRanks))
+	}
+	for i, result := range results {
+		if result.Rank != wantRanks[i] {
+			t.Errorf("result %d: got rank %d, want %d", i, result.Rank, wantRanks[i])
+		}
+		if result.Gap.Duration != wantGaps[i] {
+			t.Errorf("result %d: got gap %v, want %v", i, result.Gap.Duration, wantGaps[i])
+		}
+		if result.SameTime != wantSameTime[i] {
+			t.Errorf("result %d: got same time %v, want %v", i, result.SameTime, wantSameTime[i])
+		}
+		if result.Classification != db.ClassificationStage {
+			t.Errorf("result %d: got classification %q", i, result.Classification)
+		}
+	}
+
+	// Riders who did not finish are not ranked
+	nonFinishers, err := store.GetNonFinishers(
+		context.Background(), db.NonFinishersQueryParams{StageID: 3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonFinishers) != 1 || nonFinishers[0].Status != db.RankStatusDidNotFinish ||
+		nonFinishers[0].Rider.String != "Primož Roglič" {
+		t.Errorf("got non finishers %+v", nonFinishers)
+	}
+}
+
+func TestWithTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	errAbort := errors.New("abort")
+	err := store.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.DeleteResult(ctx, 1); err != nil {
+			return err
+		}
+		if _, err := tx.CreateRace(ctx, db.RaceInput{
+			GrandTour: db.GrandTourVuelta, Year: 2024,
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("got error %v, want %v", err, errAbort)
+	}
+
+	races, err := store.GetRaces(ctx, db.RacesQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(races) != 2 {
+		t.Errorf("got %d races after rollback, want 2", len(races))
+	}
+	if _, err := store.GetResultForRankAndClassification(
+		ctx, db.GetResultForRankAndClassificationParams{
+			StageID: 1, Rank: 1, Classification: "stage",
+		},
+	); err != nil {
+		t.Errorf("result deleted in the rolled back transaction: %v", err)
+	}
+}
+
+func TestIDsAreNotReused(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	first, err := store.CreateTeam(ctx, db.TeamInput{Name: "Team A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteTeam(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.CreateTeam(ctx, db.TeamInput{Name: "Team B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first+1 {
+		t.Errorf("got team ID %d after deleting %d, want %d", second, first, first+1)
+	}
+}
+
+func TestDailyStage(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	if _, err := store.GetDailyStage(ctx); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("got error %v without a daily stage, want %v", err, pgx.ErrNoRows)
+	}
+	// Reading does not choose a stage
+	if _, err := store.GetDailyStage(ctx); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("got error %v after reading, want %v", err, pgx.ErrNoRows)
+	}
+
+	today := lib.Today()
+	for i, want := range []bool{true, false} {
+		chosen, err := store.EnsureDailyStage(ctx, today)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chosen != want {
+			t.Errorf("call %d: got chosen %t, want %t", i+1, chosen, want)
+		}
+	}
+
+	// Scheduling a stage replaces the stage of the day
+	for _, stageID := range []int{2, 3} {
+		if err := store.ScheduleDailyStage(ctx, stageID); err != nil {
+			t.Fatal(err)
+		}
+		daily, err := store.GetDailyStage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if daily.StageID != stageID || !daily.Date.Time.Equal(today) {
+			t.Errorf(
+				"got stage %d on %v, want stage %d on %v",
+				daily.StageID, daily.Date.Time, stageID, today,
+			)
+		}
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+	riderID, rank := 1, 1
+
+	tests := []struct {
+		name string
+		run  func() error
+		code string
+	}{
+		{"unknown stage", func() error {
+			_, err := store.CreateResult(ctx, db.ResultInput{
+				StageID:        99,
+				Rank:           &rank,
+				Classification: "stage",
+				TeamID:         1,
+				RiderID:        &riderID,
+			})
+			return err
+		}, "23503"},
+		{"duplicate race", func() error {
+			_, err := store.CreateRace(ctx, db.RaceInput{
+				RaceID: 1, GrandTour: db.GrandTourTour, Year: 2024,
+			})
+			return err
+		}, "23505"},
+		{"rider with results", func() error {
+			return store.DeleteRider(ctx, riderID)
+		}, "23503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pgErr *pgconn.PgError
+			if err := tt.run(); !errors.As(err, &pgErr) || pgErr.Code != tt.code {
+				t.Errorf("got error %v, want code %s", err, tt.code)
+			}
+		})
+	}
+
+	if err := store.DeleteTeam(ctx, 99); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("got error %v deleting a missing team, want no rows", err)
+	}
+}
+
+func TestGetHeadToHead(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.Default()
+
+	h2h, err := store.GetHeadToHead(
+		ctx, db.HeadToHeadQueryParams{RiderA: 1, RiderB: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h2h.Stages) != 3 {
+		t.Fatalf("got %d stages, want 3", len(h2h.Stages))
+	}
+	want := db.HeadToHeadSummary{
+		Stages:     3,
+		WinsA:      2,
+		WinsB:      1,
+		AverageGap: 2666667 * time.Microsecond,
+		Races: []db.HeadToHeadRace{{
+			RaceID:    1,
+			GrandTour: db.GrandTourTour,
+			Year:      2024,
+			GCRankA:   2,
+			GCRankB:   1,
+		}},
+		GCWinsB: 1,
+	}
+	if !reflect.DeepEqual(h2h.Summary, want) {
+		t.Errorf("got summary %+v, want %+v", h2h.Summary, want)
+	}
+
+	// Riders who never raced each other have an empty summary
+	h2h, err = store.GetHeadToHead(
+		ctx, db.HeadToHeadQueryParams{RiderA: 1, RiderB: 99},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h2h.Stages) != 0 || h2h.Summary.Stages != 0 ||
+		h2h.Summary.AverageGap != 0 || len(h2h.Summary.Races) != 0 {
+		t.Errorf("got head to head %+v, want an empty one", h2h)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := memstore.Default()
+	var buf bytes.Buffer
+	exported, err := archive.Export(ctx, source, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := memstore.New(memstore.DefaultFixtures().SchemaVersion)
+	restored, err := archive.Restore(
+		ctx, target, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "test",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != exported {
+		t.Errorf("got summary %+v, want %+v", restored, exported)
+	}
+
+	want, err := archive.ReadDataset(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := archive.ReadDataset(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != len(want.Results) {
+		t.Fatalf("got %d results, want %d", len(got.Results), len(want.Results))
+	}
+	for i := range want.Results {
+		if got.Results[i].ResultID != want.Results[i].ResultID ||
+			got.Results[i].Classification != want.Results[i].Classification {
+			t.Errorf("result %d: got %+v, want %+v", i, got.Results[i], want.Results[i])
+		}
+	}
+	if !reflect.DeepEqual(got.TeamNames, want.TeamNames) {
+		t.Errorf("got team names %+v, want %+v", got.TeamNames, want.TeamNames)
+	}
+	if entries := target.AuditLog(); len(entries) != 1 ||
+		entries[0].Entity != db.EntityArchive {
+		t.Errorf("got audit log %+v", entries)
+	}
+}
@@ -0,0 +1,285 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// Positions of the enum labels in the enum types of the database, which
+// order by them
+var grandTourOrder = map[db.GrandTour]int{
+	db.GrandTourTour:   0,
+	db.GrandTourGiro:   1,
+	db.GrandTourVuelta: 2,
+}
+
+// compareRaces orders races by year and grand tour.
+func compareRaces(a, b db.RaceInput) int {
+	if a.Year != b.Year {
+		return a.Year - b.Year
+	}
+	return grandTourOrder[a.GrandTour] - grandTourOrder[b.GrandTour]
+}
+
+// raceStage returns a stage with the info of its race, as a row of
+// racedata.races_stages.
+func (t *tables) raceStage(stage db.StageInput) db.RaceStage {
+	race := t.races[stage.RaceID]
+	return db.RaceStage{
+		StageID: stage.StageID,
+		StageInfo: db.StageInfo{
+			GrandTour:   race.GrandTour,
+			Year:        race.Year,
+			StageNumber: stage.StageNumber,
+			StageType:   stage.StageType,
+			StageStart:  stage.StageStart,
+			StageEnd:    stage.StageEnd,
+			StageLength: stage.StageLength,
+		},
+	}
+}
+
+// raceStages returns the stages of a race, ordered by stage number.
+func (t *tables) raceStages(raceID int) []db.StageInput {
+	var stages []db.StageInput
+	for _, stageID := range sortedKeys(t.stages) {
+		if stage := t.stages[stageID]; stage.RaceID == raceID {
+			stages = append(stages, stage)
+		}
+	}
+	sort.SliceStable(stages, func(i, j int) bool {
+		return stages[i].StageNumber < stages[j].StageNumber
+	})
+	return stages
+}
+
+// sortStagesByRace orders stages by the year and grand tour of their race,
+// then by stage number.
+func (t *tables) sortStagesByRace(stages []db.StageInput) {
+	sort.SliceStable(stages, func(i, j int) bool {
+		a, b := t.races[stages[i].RaceID], t.races[stages[j].RaceID]
+		if c := compareRaces(a, b); c != 0 {
+			return c < 0
+		}
+		return stages[i].StageNumber < stages[j].StageNumber
+	})
+}
+
+// isFinalStage reports whether a stage has the highest stage number of its
+// race.
+func (t *tables) isFinalStage(stage db.StageInput) bool {
+	for _, other := range t.stages {
+		if other.RaceID == stage.RaceID &&
+			(other.StageNumber > stage.StageNumber ||
+				other.StageNumber == stage.StageNumber &&
+					other.StageID < stage.StageID) {
+			return false
+		}
+	}
+	return true
+}
+
+// finalStages returns the final stage of every race, keyed by race ID.
+func (t *tables) finalStages() map[int]db.StageInput {
+	final := make(map[int]db.StageInput)
+	for _, stage := range t.stages {
+		if t.isFinalStage(stage) {
+			final[stage.RaceID] = stage
+		}
+	}
+	return final
+}
+
+func (t *tables) race(race db.RaceInput) db.Race {
+	stages := t.raceStages(race.RaceID)
+	totalLength := 0.0
+	for _, stage := range stages {
+		totalLength += stage.StageLength
+	}
+	return db.Race{
+		RaceID:      race.RaceID,
+		GrandTour:   race.GrandTour,
+		Year:        race.Year,
+		NumStages:   len(stages),
+		TotalLength: totalLength,
+	}
+}
+
+func (s *Store) GetRaces(
+	ctx context.Context, params db.RacesQueryParams,
+) ([]db.Race, error) {
+	defer s.lock()()
+	var races []db.RaceInput
+	for _, raceID := range sortedKeys(s.t.races) {
+		race := s.t.races[raceID]
+		if params.GrandTour != nil && race.GrandTour != *params.GrandTour {
+			continue
+		}
+		if params.Year != nil && race.Year != *params.Year {
+			continue
+		}
+		races = append(races, race)
+	}
+	sort.SliceStable(races, func(i, j int) bool {
+		return compareRaces(races[i], races[j]) < 0
+	})
+
+	result := make([]db.Race, len(races))
+	for i, race := range races {
+		result[i] = s.t.race(race)
+	}
+	return result, nil
+}
+
+func (s *Store) GetRace(ctx context.Context, raceID int) (db.Race, error) {
+	defer s.lock()()
+	race, ok := s.t.races[raceID]
+	if !ok {
+		return db.Race{}, pgx.ErrNoRows
+	}
+	return s.t.race(race), nil
+}
+
+func (s *Store) GetRaceStages(
+	ctx context.Context, raceID int,
+) ([]db.RaceStage, error) {
+	defer s.lock()()
+	stages := s.t.raceStages(raceID)
+	result := make([]db.RaceStage, len(stages))
+	for i, stage := range stages {
+		result[i] = s.t.raceStage(stage)
+	}
+	return result, nil
+}
+
+func (s *Store) GetRaceStageByNumber(
+	ctx context.Context, params db.RaceStageQueryParams,
+) (db.RaceStage, error) {
+	defer s.lock()()
+	for _, stage := range s.t.raceStages(params.RaceID) {
+		if stage.StageNumber == params.StageNumber {
+			return s.t.raceStage(stage), nil
+		}
+	}
+	return db.RaceStage{}, pgx.ErrNoRows
+}
+
+// sortValue returns the value of the column a page of stages is sorted by.
+func sortValue(stage db.RaceStage, sort db.StageSort) float64 {
+	switch sort {
+	case db.StageSortYear:
+		return float64(stage.Year)
+	case db.StageSortStageNumber:
+		return float64(stage.StageNumber)
+	case db.StageSortLength:
+		return stage.StageLength
+	default:
+		return float64(stage.StageID)
+	}
+}
+
+// containsFold reports whether s contains substr, ignoring case as ILIKE.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// matchesStagePage reports whether a stage passes the filters of a page.
+func matchesStagePage(
+	stage db.RaceStage, params db.StagePageQueryParams,
+) bool {
+	switch {
+	case params.GrandTour != nil && stage.GrandTour != *params.GrandTour,
+		params.MinYear != nil && stage.Year < *params.MinYear,
+		params.MaxYear != nil && stage.Year > *params.MaxYear,
+		params.StageType != nil && stage.StageType != *params.StageType,
+		params.MinLength != nil && stage.StageLength < *params.MinLength,
+		params.MaxLength != nil && stage.StageLength > *params.MaxLength:
+		return false
+	case params.Town != nil:
+		return containsFold(stage.StageStart, *params.Town) ||
+			containsFold(stage.StageEnd, *params.Town)
+	}
+	return true
+}
+
+func (s *Store) GetStagePage(
+	ctx context.Context, params db.StagePageQueryParams,
+) (db.StagePage, error) {
+	if !params.Sort.IsValid() {
+		return db.StagePage{}, fmt.Errorf("invalid sort: %s", params.Sort)
+	}
+	if params.Cursor != nil && (params.Cursor.Sort != params.Sort ||
+		params.Cursor.Desc != params.Desc) {
+		return db.StagePage{}, errors.New(
+			"cursor does not match the sort order",
+		)
+	}
+
+	defer s.lock()()
+	// less orders stages by the sort value and ID in the page's direction
+	less := func(aValue float64, aID int, bValue float64, bID int) bool {
+		if aValue != bValue {
+			return aValue < bValue != params.Desc
+		}
+		return aID < bID != params.Desc
+	}
+
+	var stages []db.RaceStage
+	for _, stageID := range sortedKeys(s.t.stages) {
+		stage := s.t.raceStage(s.t.stages[stageID])
+		if !matchesStagePage(stage, params) {
+			continue
+		}
+		if params.Cursor != nil && !less(
+			params.Cursor.SortValue, params.Cursor.StageID,
+			sortValue(stage, params.Sort), stage.StageID,
+		) {
+			continue
+		}
+		stages = append(stages, stage)
+	}
+	sort.SliceStable(stages, func(i, j int) bool {
+		return less(
+			sortValue(stages[i], params.Sort), stages[i].StageID,
+			sortValue(stages[j], params.Sort), stages[j].StageID,
+		)
+	})
+
+	page := db.StagePage{Stages: make([]db.RaceStage, 0, params.Limit)}
+	for i, stage := range stages {
+		if i == params.Limit {
+			last := stages[i-1]
+			cursor, err := db.StageCursor{
+				Sort:      params.Sort,
+				Desc:      params.Desc,
+				SortValue: sortValue(last, params.Sort),
+				StageID:   last.StageID,
+			}.Encode()
+			if err != nil {
+				return db.StagePage{}, err
+			}
+			page.NextCursor = &cursor
+			break
+		}
+		page.Stages = append(page.Stages, stage)
+	}
+	return page, nil
+}
+
+func (s *Store) GetStageInfo(
+	ctx context.Context, stageID int,
+) (db.StageInfo, error) {
+	defer s.lock()()
+	stage, ok := s.t.stages[stageID]
+	if !ok {
+		return db.StageInfo{}, pgx.ErrNoRows
+	}
+	return s.t.raceStage(stage).StageInfo, nil
+}
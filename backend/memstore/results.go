@@ -0,0 +1,398 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// Positions of the labels of the classification_type and rank_enum types
+var (
+	classificationOrder = map[db.Classification]int{
+		"stage":     0,
+		"general":   1,
+		"points":    2,
+		"mountains": 3,
+		"youth":     4,
+		"teams":     5,
+	}
+	rankStatusOrder = map[db.RankStatus]int{
+		db.RankStatusValid:        0,
+		db.RankStatusDidNotFinish: 1,
+		db.RankStatusDidNotStart:  2,
+		db.RankStatusOutsideLimit: 3,
+		db.RankStatusDF:           4,
+		db.RankStatusNotRanked:    5,
+		db.RankStatusDisqualified: 6,
+	}
+)
+
+// classificationKey returns the database label of a classification given by
+// its label or its value.
+func classificationKey(c db.Classification) db.Classification {
+	if c.IsValid() {
+		return c
+	}
+	key, err := db.EnumKey(c, db.ClassificationMapping)
+	if err != nil {
+		return c
+	}
+	return db.Classification(key)
+}
+
+// classificationValue returns the value of a classification given by its
+// database label, as scanned from the database.
+func classificationValue(key db.Classification) db.Classification {
+	return db.ClassificationMapping[string(key)]
+}
+
+// compareRanks compares recorded ranks in the order of Postgres, with the null
+// ranks of the results that are not valid last.
+func compareRanks(a, b *int) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return cmp.Compare(*a, *b)
+}
+
+// validResult struct, a row of racedata.results_valid
+type validResult struct {
+	db.ResultInput
+	// Rank among the valid results of the classification of the stage
+	ValidRank int
+}
+
+// validResults returns the valid results of a stage, renumbered as in
+// racedata.results_valid and ordered by classification and rank. Ties on the
+// recorded rank are broken by result ID.
+func (t *tables) validResults(stageID int) []validResult {
+	var results []validResult
+	for _, resultID := range sortedKeys(t.results) {
+		result := t.results[resultID]
+		if result.StageID == stageID &&
+			result.RankStatusOrValid() == db.RankStatusValid {
+			results = append(results, validResult{ResultInput: result})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Classification != b.Classification {
+			return classificationOrder[a.Classification] <
+				classificationOrder[b.Classification]
+		}
+		return compareRanks(a.Rank, b.Rank) < 0
+	})
+	for i := range results {
+		results[i].ValidRank = 1
+		if i > 0 && results[i-1].Classification == results[i].Classification {
+			results[i].ValidRank = results[i-1].ValidRank + 1
+		}
+	}
+	return results
+}
+
+// validClassification returns the valid results of a classification of a
+// stage, ordered by rank.
+func (t *tables) validClassification(
+	stageID int, classification db.Classification,
+) []validResult {
+	classification = classificationKey(classification)
+	var results []validResult
+	for _, result := range t.validResults(stageID) {
+		if result.Classification == classification {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// validRank returns the valid rank of a rider in a classification of a
+// stage, if they have one.
+func (t *tables) validRank(
+	stageID, riderID int, classification db.Classification,
+) (validResult, bool) {
+	for _, result := range t.validClassification(stageID, classification) {
+		if result.RiderID != nil && *result.RiderID == riderID {
+			return result, true
+		}
+	}
+	return validResult{}, false
+}
+
+func (t *tables) riderName(riderID int) string {
+	rider := t.riders[riderID]
+	return rider.FirstName + " " + rider.LastName
+}
+
+func optionalInt(i *int) pgtype.Int8 {
+	if i == nil {
+		return pgtype.Int8{}
+	}
+	return pgtype.Int8{Int64: int64(*i), Valid: true}
+}
+
+// riderText returns the name of the rider of a result as
+// racedata.riders_teams_results, null for the teams classification.
+func (t *tables) riderText(result db.ResultInput) pgtype.Text {
+	if result.Classification == db.ClassificationTeams ||
+		result.RiderID == nil {
+		return pgtype.Text{}
+	}
+	if _, ok := t.riders[*result.RiderID]; !ok {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: t.riderName(*result.RiderID), Valid: true}
+}
+
+func (t *tables) teamText(teamID int) pgtype.Text {
+	team, ok := t.teams[teamID]
+	if !ok {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: team.Name, Valid: true}
+}
+
+// rankedResults returns the results of a classification window with their
+// gaps to the first result and whether their time is the same as the time of
+// the previous result.
+func (t *tables) rankedResults(window []validResult) []db.Result {
+	results := make([]db.Result, len(window))
+	for i, result := range window {
+		gap := db.Duration{}
+		if result.Time.Valid && window[0].Time.Valid {
+			gap = db.Duration{
+				Duration: result.Time.Duration - window[0].Time.Duration,
+				Valid:    true,
+			}
+		}
+		sameTime := i > 0 && result.Time.Valid && window[i-1].Time.Valid &&
+			result.Time.Duration == window[i-1].Time.Duration
+		results[i] = db.Result{
+			Rank:           result.ValidRank,
+			RiderID:        optionalInt(result.RiderID),
+			Rider:          t.riderText(result.ResultInput),
+			TeamID:         result.TeamID,
+			Team:           t.teamText(result.TeamID),
+			Time:           result.Time,
+			Gap:            gap,
+			SameTime:       sameTime,
+			Points:         optionalInt(result.Points),
+			Classification: classificationValue(result.Classification),
+		}
+	}
+	return results
+}
+
+// topN returns the results with a rank of at most n.
+func topN(results []validResult, n int) []validResult {
+	var top []validResult
+	for _, result := range results {
+		if result.ValidRank <= n {
+			top = append(top, result)
+		}
+	}
+	return top
+}
+
+func (s *Store) GetResults(
+	ctx context.Context, params db.ResultsQueryParams,
+) ([]db.Result, error) {
+	defer s.lock()()
+	results := []db.Result{}
+	valid := s.t.validResults(params.StageID)
+	for start := 0; start < len(valid); {
+		end := start
+		for end < len(valid) &&
+			valid[end].Classification == valid[start].Classification {
+			end++
+		}
+		results = append(
+			results, s.t.rankedResults(topN(valid[start:end], params.TopN))...,
+		)
+		start = end
+	}
+	return results, nil
+}
+
+func (s *Store) GetNonFinishers(
+	ctx context.Context, params db.NonFinishersQueryParams,
+) ([]db.NonFinisher, error) {
+	defer s.lock()()
+	var classification db.Classification
+	if params.Classification != nil {
+		classification = classificationKey(*params.Classification)
+	}
+
+	var results []db.ResultInput
+	for _, resultID := range sortedKeys(s.t.results) {
+		result := s.t.results[resultID]
+		if result.StageID != params.StageID ||
+			result.RankStatusOrValid() == db.RankStatusValid ||
+			classification != "" && result.Classification != classification {
+			continue
+		}
+		results = append(results, result)
+	}
+	lastName := func(result db.ResultInput) (string, bool) {
+		if result.RiderID == nil {
+			return "", false
+		}
+		rider, ok := s.t.riders[*result.RiderID]
+		return rider.LastName, ok
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Classification != b.Classification {
+			return classificationOrder[a.Classification] <
+				classificationOrder[b.Classification]
+		}
+		if a.Status != b.Status {
+			return rankStatusOrder[a.Status] < rankStatusOrder[b.Status]
+		}
+		if c := compareRanks(a.Rank, b.Rank); c != 0 {
+			return c < 0
+		}
+		// Riders without a last name, i.e. teams, come last
+		aName, aOK := lastName(a)
+		bName, bOK := lastName(b)
+		if aOK != bOK {
+			return aOK
+		}
+		if aName != bName {
+			return aName < bName
+		}
+		return s.t.teams[a.TeamID].Name < s.t.teams[b.TeamID].Name
+	})
+
+	nonFinishers := make([]db.NonFinisher, len(results))
+	for i, result := range results {
+		nonFinishers[i] = db.NonFinisher{
+			RiderID:        optionalInt(result.RiderID),
+			Rider:          s.t.riderText(result),
+			TeamID:         result.TeamID,
+			Team:           s.t.teamText(result.TeamID),
+			Status:         result.Status,
+			Classification: classificationValue(result.Classification),
+		}
+	}
+	return nonFinishers, nil
+}
+
+func (s *Store) GetResultsForClassification(
+	ctx context.Context, params db.GetResultsForClassificationParams,
+) ([]db.Result, error) {
+	defer s.lock()()
+	return s.t.rankedResults(topN(
+		s.t.validClassification(params.StageID, params.Classification),
+		params.TopN,
+	)), nil
+}
+
+func (s *Store) GetResultForRankAndClassification(
+	ctx context.Context, params db.GetResultForRankAndClassificationParams,
+) (db.Result, error) {
+	defer s.lock()()
+	results := s.t.rankedResults(topN(
+		s.t.validClassification(params.StageID, params.Classification),
+		params.Rank,
+	))
+	for _, result := range results {
+		if result.Rank == params.Rank {
+			return result, nil
+		}
+	}
+	return db.Result{}, pgx.ErrNoRows
+}
+
+func (s *Store) GetStandings(
+	ctx context.Context, params db.StandingsQueryParams,
+) ([]db.Standing, error) {
+	defer s.lock()()
+	standings := []db.Standing{}
+	for _, stage := range s.t.raceStages(params.RaceID) {
+		results := s.t.rankedResults(topN(
+			s.t.validClassification(stage.StageID, params.Classification),
+			params.TopN,
+		))
+		for _, result := range results {
+			standings = append(standings, db.Standing{
+				StageID:     stage.StageID,
+				StageNumber: stage.StageNumber,
+				Result:      result,
+			})
+		}
+	}
+	return standings, nil
+}
+
+// distinctSorted returns the distinct strings in order.
+func distinctSorted(values []string) []string {
+	seen := make(map[string]bool)
+	distinct := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			distinct = append(distinct, value)
+		}
+	}
+	sort.Strings(distinct)
+	return distinct
+}
+
+func (s *Store) GetRiders(
+	ctx context.Context, stageID int,
+) ([]string, error) {
+	defer s.lock()()
+	var riders []string
+	for _, result := range s.t.validResults(stageID) {
+		if rider := s.t.riderText(result.ResultInput); rider.Valid {
+			riders = append(riders, rider.String)
+		}
+	}
+	return distinctSorted(riders), nil
+}
+
+func (s *Store) GetTeams(ctx context.Context, stageID int) ([]string, error) {
+	defer s.lock()()
+	var teams []string
+	for _, result := range s.t.validResults(stageID) {
+		if team := s.t.teamText(result.TeamID); team.Valid {
+			teams = append(teams, team.String)
+		}
+	}
+	return distinctSorted(teams), nil
+}
+
+func (s *Store) GetValidResultsCount(
+	ctx context.Context, stageID int,
+) (db.ValidResultsCount, error) {
+	defer s.lock()()
+	counts := db.ValidResultsCount{}
+	for _, result := range s.t.validResults(stageID) {
+		switch classificationValue(result.Classification) {
+		case db.ClassificationStage:
+			counts.Stage++
+		case db.ClassificationGC:
+			counts.General++
+		case db.ClassificationPoints:
+			counts.Points++
+		case db.ClassificationMountains:
+			counts.Mountains++
+		case db.ClassificationYouth:
+			counts.Youth++
+		case db.ClassificationTeams:
+			counts.Teams++
+		}
+	}
+	return counts, nil
+}
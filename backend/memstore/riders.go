@@ -0,0 +1,471 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// Classifications with a jersey, whose final placings are reported
+var jerseyClassifications = []db.Classification{
+	"general", "points", "mountains", "youth",
+}
+
+func rider(in db.RiderInput) db.Rider {
+	return db.Rider{
+		RiderID:   in.RiderID,
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+		Name:      in.FirstName + " " + in.LastName,
+	}
+}
+
+// stagesByRace returns every stage, ordered by the year and grand tour of its
+// race and by stage number.
+func (t *tables) stagesByRace() []db.StageInput {
+	stages := make([]db.StageInput, 0, len(t.stages))
+	for _, stageID := range sortedKeys(t.stages) {
+		stages = append(stages, t.stages[stageID])
+	}
+	t.sortStagesByRace(stages)
+	return stages
+}
+
+// racesByYear returns every race, ordered by year and grand tour.
+func (t *tables) racesByYear() []db.RaceInput {
+	races := make([]db.RaceInput, 0, len(t.races))
+	for _, raceID := range sortedKeys(t.races) {
+		races = append(races, t.races[raceID])
+	}
+	sort.SliceStable(races, func(i, j int) bool {
+		return compareRaces(races[i], races[j]) < 0
+	})
+	return races
+}
+
+func (s *Store) SearchRiders(
+	ctx context.Context, params db.RiderSearchQueryParams,
+) ([]db.Rider, error) {
+	defer s.lock()()
+	riders := []db.Rider{}
+	for _, riderID := range sortedKeys(s.t.riders) {
+		in := s.t.riders[riderID]
+		if params.Query == "" ||
+			containsFold(in.FirstName+" "+in.LastName, params.Query) ||
+			containsFold(in.LastName+" "+in.FirstName, params.Query) {
+			riders = append(riders, rider(in))
+		}
+	}
+	sort.SliceStable(riders, func(i, j int) bool {
+		a, b := riders[i], riders[j]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		return a.FirstName < b.FirstName
+	})
+	if len(riders) > params.Limit {
+		riders = riders[:params.Limit]
+	}
+	return riders, nil
+}
+
+func (s *Store) GetRider(ctx context.Context, riderID int) (db.Rider, error) {
+	defer s.lock()()
+	in, ok := s.t.riders[riderID]
+	if !ok {
+		return db.Rider{}, pgx.ErrNoRows
+	}
+	return rider(in), nil
+}
+
+func (s *Store) GetRiderStageWins(
+	ctx context.Context, riderID int,
+) ([]db.RiderStageWin, error) {
+	defer s.lock()()
+	wins := []db.RiderStageWin{}
+	for _, stage := range s.t.stagesByRace() {
+		result, ok := s.t.validRank(stage.StageID, riderID, "stage")
+		if ok && result.ValidRank == 1 {
+			wins = append(wins, db.RiderStageWin{
+				RaceID:    stage.RaceID,
+				RaceStage: s.t.raceStage(stage),
+			})
+		}
+	}
+	return wins, nil
+}
+
+func (s *Store) GetRiderPlacings(
+	ctx context.Context, riderID int,
+) ([]db.RiderPlacing, error) {
+	defer s.lock()()
+	placings := []db.RiderPlacing{}
+	final := s.t.finalStages()
+	for _, race := range s.t.racesByYear() {
+		stage, ok := final[race.RaceID]
+		if !ok {
+			continue
+		}
+		for _, classification := range jerseyClassifications {
+			result, ok := s.t.validRank(stage.StageID, riderID, classification)
+			if !ok {
+				continue
+			}
+			placings = append(placings, db.RiderPlacing{
+				RaceID:         race.RaceID,
+				GrandTour:      race.GrandTour,
+				Year:           race.Year,
+				Classification: classificationValue(classification),
+				Rank:           result.ValidRank,
+			})
+		}
+	}
+	return placings, nil
+}
+
+func (s *Store) GetRiderParticipations(
+	ctx context.Context, riderID int,
+) ([]db.RiderParticipation, error) {
+	defer s.lock()()
+	// Results of the rider by race, ordered by stage number
+	raceResults := make(map[int][]db.ResultInput)
+	for _, resultID := range sortedKeys(s.t.results) {
+		result := s.t.results[resultID]
+		if result.RiderID == nil || *result.RiderID != riderID {
+			continue
+		}
+		stage := s.t.stages[result.StageID]
+		raceResults[stage.RaceID] = append(raceResults[stage.RaceID], result)
+	}
+	final := s.t.finalStages()
+
+	participations := []db.RiderParticipation{}
+	for _, race := range s.t.racesByYear() {
+		results := raceResults[race.RaceID]
+		if len(results) == 0 {
+			continue
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return s.t.stages[results[i].StageID].StageNumber <
+				s.t.stages[results[j].StageID].StageNumber
+		})
+
+		participation := db.RiderParticipation{
+			RaceID:    race.RaceID,
+			GrandTour: race.GrandTour,
+			Year:      race.Year,
+		}
+		lastStage := -1
+		finished := make(map[int]bool)
+		for _, result := range results {
+			if number := s.t.stages[result.StageID].StageNumber; number > lastStage {
+				lastStage = number
+				participation.TeamID = result.TeamID
+				participation.Team = s.t.teams[result.TeamID].Name
+			}
+			status := result.RankStatusOrValid()
+			if status == db.RankStatusValid {
+				if result.Classification == db.ClassificationStage {
+					finished[result.StageID] = true
+				}
+			} else if participation.Status == nil {
+				participation.Status = &status
+			}
+		}
+		participation.StagesFinished = len(finished)
+		if stage, ok := final[race.RaceID]; ok {
+			if result, ok := s.t.validRank(
+				stage.StageID, riderID, "general",
+			); ok {
+				participation.GCRank = pgtype.Int8{
+					Int64: int64(result.ValidRank), Valid: true,
+				}
+			}
+		}
+		participations = append(participations, participation)
+	}
+	return participations, nil
+}
+
+func (s *Store) GetRiderTeams(
+	ctx context.Context, riderID int,
+) ([]db.RiderTeam, error) {
+	defer s.lock()()
+	seen := make(map[db.RiderTeam]bool)
+	teams := []db.RiderTeam{}
+	for _, result := range s.t.results {
+		if result.RiderID == nil || *result.RiderID != riderID {
+			continue
+		}
+		team := db.RiderTeam{
+			Year:   s.t.races[s.t.stages[result.StageID].RaceID].Year,
+			TeamID: result.TeamID,
+			Team:   s.t.teams[result.TeamID].Name,
+		}
+		if !seen[team] {
+			seen[team] = true
+			teams = append(teams, team)
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		a, b := teams[i], teams[j]
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Team != b.Team {
+			return a.Team < b.Team
+		}
+		return a.TeamID < b.TeamID
+	})
+	return teams, nil
+}
+
+func (s *Store) GetTeam(ctx context.Context, teamID int) (db.Team, error) {
+	defer s.lock()()
+	team, ok := s.t.teams[teamID]
+	if !ok {
+		return db.Team{}, pgx.ErrNoRows
+	}
+	return db.Team{TeamID: team.TeamID, Name: team.Name}, nil
+}
+
+func (s *Store) GetTeamNames(
+	ctx context.Context, teamID int,
+) ([]db.TeamName, error) {
+	defer s.lock()()
+	return s.t.sortedTeamNames(teamID), nil
+}
+
+func (s *Store) GetTeamRosters(
+	ctx context.Context, params db.TeamRostersQueryParams,
+) ([]db.TeamRosterRider, error) {
+	defer s.lock()()
+	type raceRider struct{ raceID, riderID int }
+	seen := make(map[raceRider]bool)
+	riders := []db.TeamRosterRider{}
+	for _, result := range s.t.results {
+		if result.TeamID != params.TeamID || result.RiderID == nil {
+			continue
+		}
+		in, ok := s.t.riders[*result.RiderID]
+		if !ok {
+			continue
+		}
+		race := s.t.races[s.t.stages[result.StageID].RaceID]
+		if params.RaceID != nil && race.RaceID != *params.RaceID {
+			continue
+		}
+		key := raceRider{race.RaceID, in.RiderID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		riders = append(riders, db.TeamRosterRider{
+			RaceID:    race.RaceID,
+			GrandTour: race.GrandTour,
+			Year:      race.Year,
+			Rider:     rider(in),
+		})
+	}
+	sort.Slice(riders, func(i, j int) bool {
+		a, b := riders[i], riders[j]
+		if c := compareRaces(
+			s.t.races[a.RaceID], s.t.races[b.RaceID],
+		); c != 0 {
+			return c < 0
+		}
+		if a.RaceID != b.RaceID {
+			return a.RaceID < b.RaceID
+		}
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		return a.RiderID < b.RiderID
+	})
+	return riders, nil
+}
+
+func (s *Store) GetTeamStageWins(
+	ctx context.Context, teamID int,
+) ([]db.TeamStageWin, error) {
+	defer s.lock()()
+	wins := []db.TeamStageWin{}
+	for _, stage := range s.t.stagesByRace() {
+		results := s.t.validClassification(stage.StageID, "stage")
+		if len(results) == 0 || results[0].TeamID != teamID ||
+			results[0].RiderID == nil {
+			continue
+		}
+		riderID := *results[0].RiderID
+		if _, ok := s.t.riders[riderID]; !ok {
+			continue
+		}
+		wins = append(wins, db.TeamStageWin{
+			RaceID:    stage.RaceID,
+			RiderID:   riderID,
+			Rider:     s.t.riderName(riderID),
+			RaceStage: s.t.raceStage(stage),
+		})
+	}
+	return wins, nil
+}
+
+func (s *Store) GetTeamPlacings(
+	ctx context.Context, teamID int,
+) ([]db.TeamPlacing, error) {
+	defer s.lock()()
+	placings := []db.TeamPlacing{}
+	final := s.t.finalStages()
+	for _, race := range s.t.racesByYear() {
+		stage, ok := final[race.RaceID]
+		if !ok {
+			continue
+		}
+		for _, result := range s.t.validClassification(stage.StageID, "teams") {
+			if result.TeamID == teamID {
+				placings = append(placings, db.TeamPlacing{
+					RaceID:    race.RaceID,
+					GrandTour: race.GrandTour,
+					Year:      race.Year,
+					Rank:      result.ValidRank,
+				})
+			}
+		}
+	}
+	return placings, nil
+}
+
+func (s *Store) GetHeadToHead(
+	ctx context.Context, params db.HeadToHeadQueryParams,
+) (db.HeadToHead, error) {
+	defer s.lock()()
+	gcRank := func(stageID, riderID int) pgtype.Int8 {
+		result, ok := s.t.validRank(stageID, riderID, "general")
+		if !ok {
+			return pgtype.Int8{}
+		}
+		return pgtype.Int8{Int64: int64(result.ValidRank), Valid: true}
+	}
+
+	h2h := db.HeadToHead{
+		Stages:  []db.HeadToHeadStage{},
+		Summary: db.HeadToHeadSummary{Races: []db.HeadToHeadRace{}},
+	}
+	summary := &h2h.Summary
+	var totalGap time.Duration
+	var numGaps int
+	for _, stage := range s.t.stagesByRace() {
+		a, okA := s.t.validRank(stage.StageID, params.RiderA, "stage")
+		b, okB := s.t.validRank(stage.StageID, params.RiderB, "stage")
+		if !okA || !okB {
+			continue
+		}
+		h2hStage := db.HeadToHeadStage{
+			RaceID:    stage.RaceID,
+			RaceStage: s.t.raceStage(stage),
+			RankA:     a.ValidRank,
+			RankB:     b.ValidRank,
+			GCRankA:   gcRank(stage.StageID, params.RiderA),
+			GCRankB:   gcRank(stage.StageID, params.RiderB),
+		}
+		if a.Time.Valid && b.Time.Valid {
+			h2hStage.TimeDelta = db.Duration{
+				Duration: a.Time.Duration - b.Time.Duration, Valid: true,
+			}
+			totalGap += h2hStage.TimeDelta.Duration
+			numGaps++
+		}
+		h2h.Stages = append(h2h.Stages, h2hStage)
+
+		summary.Stages++
+		if a.ValidRank < b.ValidRank {
+			summary.WinsA++
+		} else if b.ValidRank < a.ValidRank {
+			summary.WinsB++
+		}
+		if !s.t.isFinalStage(stage) ||
+			!h2hStage.GCRankA.Valid || !h2hStage.GCRankB.Valid {
+			continue
+		}
+		race := db.HeadToHeadRace{
+			RaceID:    stage.RaceID,
+			GrandTour: h2hStage.GrandTour,
+			Year:      h2hStage.Year,
+			GCRankA:   int(h2hStage.GCRankA.Int64),
+			GCRankB:   int(h2hStage.GCRankB.Int64),
+		}
+		summary.Races = append(summary.Races, race)
+		if race.GCRankA < race.GCRankB {
+			summary.GCWinsA++
+		} else if race.GCRankB < race.GCRankA {
+			summary.GCWinsB++
+		}
+	}
+	// The database averages intervals to the microsecond
+	if numGaps > 0 {
+		average := totalGap / time.Duration(numGaps)
+		summary.AverageGap = average.Round(time.Microsecond)
+	}
+	return h2h, nil
+}
+
+func (s *Store) GetSearchCandidates(
+	ctx context.Context, params db.SearchCandidatesQueryParams,
+) ([]db.SearchCandidate, error) {
+	defer s.lock()()
+	inStage := func(match func(db.ResultInput) bool) bool {
+		if params.StageID == nil {
+			return true
+		}
+		for _, result := range s.t.results {
+			if result.StageID == *params.StageID && match(result) {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidates := []db.SearchCandidate{}
+	for _, riderID := range sortedKeys(s.t.riders) {
+		if inStage(func(result db.ResultInput) bool {
+			return result.RiderID != nil && *result.RiderID == riderID
+		}) {
+			candidates = append(candidates, db.SearchCandidate{
+				Type: db.SearchEntityRider,
+				ID:   pgtype.Int8{Int64: int64(riderID), Valid: true},
+				Name: s.t.riderName(riderID),
+			})
+		}
+	}
+	for _, teamID := range sortedKeys(s.t.teams) {
+		if inStage(func(result db.ResultInput) bool {
+			return result.TeamID == teamID
+		}) {
+			candidates = append(candidates, db.SearchCandidate{
+				Type: db.SearchEntityTeam,
+				ID:   pgtype.Int8{Int64: int64(teamID), Valid: true},
+				Name: s.t.teams[teamID].Name,
+			})
+		}
+	}
+	var towns []string
+	for _, stage := range s.t.stages {
+		if params.StageID == nil || stage.StageID == *params.StageID {
+			towns = append(towns, stage.StageStart, stage.StageEnd)
+		}
+	}
+	for _, town := range distinctSorted(towns) {
+		candidates = append(candidates, db.SearchCandidate{
+			Type: db.SearchEntityTown, Name: town,
+		})
+	}
+	return candidates, nil
+}
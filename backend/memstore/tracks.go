@@ -0,0 +1,277 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+// Mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+var errNoGeometry = errors.New("track has no geometry")
+
+// distance returns the great circle distance between two points in meters.
+func distance(a, b db.TrackPointInput) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// trackLength returns the length of a track in meters.
+func trackLength(track db.TrackInput) float64 {
+	length := 0.0
+	for i := 1; i < len(track.Points); i++ {
+		length += distance(track.Points[i-1], track.Points[i])
+	}
+	return length
+}
+
+// stageTrack returns the track of a stage, if the stage exists.
+func (t *tables) stageTrack(stageID int) (db.TrackInput, bool) {
+	stage, ok := t.stages[stageID]
+	if !ok {
+		return db.TrackInput{}, false
+	}
+	track, ok := t.tracks[stage.GPXID]
+	return track, ok
+}
+
+// trackPoints returns the points of a track with their elevations and
+// distances along the track, as geog.elevation. Points without an elevation
+// have an elevation of 0, as in the track geometry.
+func trackPoints(track db.TrackInput) []db.TrackPoint {
+	points := make([]db.TrackPoint, len(track.Points))
+	total := 0.0
+	for i, point := range track.Points {
+		if i > 0 {
+			total += distance(track.Points[i-1], point)
+		}
+		elevation := 0.0
+		if point.Elevation != nil {
+			elevation = *point.Elevation
+		}
+		points[i] = db.TrackPoint{
+			Longitude: point.Longitude,
+			Latitude:  point.Latitude,
+			ElevationPoint: db.ElevationPoint{
+				Distance:  total,
+				Elevation: elevation,
+			},
+		}
+	}
+	return points
+}
+
+func elevationProfile(track db.TrackInput) []db.ElevationPoint {
+	points := trackPoints(track)
+	profile := make([]db.ElevationPoint, len(points))
+	for i, point := range points {
+		profile[i] = point.ElevationPoint
+	}
+	return profile
+}
+
+// formatCoordinate formats a coordinate with at most precision decimal
+// places, as ST_AsGeoJSON.
+func formatCoordinate(value float64, precision int) string {
+	scale := math.Pow(10, float64(precision))
+	return strconv.FormatFloat(math.Round(value*scale)/scale, 'f', -1, 64)
+}
+
+// trackGeoJSON returns the track as a GeoJSON LineString. Tracks are not
+// simplified.
+func trackGeoJSON(
+	track db.TrackInput, simplification db.TrackSimplification,
+) (db.Track, error) {
+	if len(track.Points) == 0 {
+		return db.Track{}, errNoGeometry
+	}
+	coordinates := make([]string, len(track.Points))
+	for i, point := range track.Points {
+		coordinates[i] = "[" +
+			formatCoordinate(point.Longitude, simplification.Precision) + "," +
+			formatCoordinate(point.Latitude, simplification.Precision) + "]"
+	}
+	return db.Track{
+		GeoJSON: `{"type":"LineString","coordinates":[` +
+			strings.Join(coordinates, ",") + "]}",
+		NumPoints: len(track.Points),
+	}, nil
+}
+
+func trackMetadata(track db.TrackInput) db.TrackMetadata {
+	text := func(s string) pgtype.Text {
+		return pgtype.Text{String: s, Valid: s != ""}
+	}
+	return db.TrackMetadata{
+		Name:     text(track.Name),
+		Source:   text(track.Source),
+		LinkHref: text(track.LinkHref),
+		LinkText: text(track.LinkText),
+	}
+}
+
+func (s *Store) GetTrack(
+	ctx context.Context, params db.TrackQueryParams,
+) (db.Track, error) {
+	defer s.lock()()
+	track, ok := s.t.stageTrack(params.StageID)
+	if !ok {
+		return db.Track{}, pgx.ErrNoRows
+	}
+	return trackGeoJSON(track, params.TrackSimplification)
+}
+
+// centroid returns the centroid of a line as ST_Centroid: the mean of the
+// midpoints of its segments weighted by their lengths, or the mean of its
+// points if it has no length.
+func centroid(points []db.TrackPointInput) db.Coordinate {
+	var lon, lat, total float64
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length := math.Hypot(b.Longitude-a.Longitude, b.Latitude-a.Latitude)
+		lon += length * (a.Longitude + b.Longitude) / 2
+		lat += length * (a.Latitude + b.Latitude) / 2
+		total += length
+	}
+	if total > 0 {
+		return db.Coordinate{Longitude: lon / total, Latitude: lat / total}
+	}
+	for _, point := range points {
+		lon += point.Longitude
+		lat += point.Latitude
+	}
+	n := float64(len(points))
+	return db.Coordinate{Longitude: lon / n, Latitude: lat / n}
+}
+
+func (s *Store) GetGeometrySummary(
+	ctx context.Context, stageID int,
+) (db.GeometrySummary, error) {
+	defer s.lock()()
+	track, ok := s.t.stageTrack(stageID)
+	if !ok {
+		return db.GeometrySummary{}, pgx.ErrNoRows
+	}
+	points := track.Points
+	if len(points) == 0 {
+		return db.GeometrySummary{}, errNoGeometry
+	}
+
+	start, finish := points[0], points[len(points)-1]
+	bbox := [4]float64{
+		start.Longitude, start.Latitude, start.Longitude, start.Latitude,
+	}
+	for _, point := range points {
+		bbox[0] = math.Min(bbox[0], point.Longitude)
+		bbox[1] = math.Min(bbox[1], point.Latitude)
+		bbox[2] = math.Max(bbox[2], point.Longitude)
+		bbox[3] = math.Max(bbox[3], point.Latitude)
+	}
+	return db.GeometrySummary{
+		BoundingBox: bbox,
+		Start: db.Coordinate{
+			Longitude: start.Longitude, Latitude: start.Latitude,
+		},
+		Finish: db.Coordinate{
+			Longitude: finish.Longitude, Latitude: finish.Latitude,
+		},
+		Centroid:            centroid(points),
+		StartFinishDistance: distance(start, finish),
+	}, nil
+}
+
+// GetTile returns an empty tile, whatever the tile and filters.
+func (s *Store) GetTile(
+	ctx context.Context, params db.TileQueryParams,
+) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (s *Store) GetTrackMetadata(
+	ctx context.Context, stageID int,
+) (db.TrackMetadata, error) {
+	defer s.lock()()
+	track, ok := s.t.stageTrack(stageID)
+	if !ok {
+		return db.TrackMetadata{}, pgx.ErrNoRows
+	}
+	return trackMetadata(track), nil
+}
+
+func (s *Store) GetTrackPoints(
+	ctx context.Context, stageID int,
+) ([]db.TrackPoint, error) {
+	defer s.lock()()
+	track, _ := s.t.stageTrack(stageID)
+	return trackPoints(track), nil
+}
+
+func (s *Store) GetRaceTracks(
+	ctx context.Context, params db.RaceTracksQueryParams,
+) ([]db.RaceStageTrack, error) {
+	defer s.lock()()
+	tracks := []db.RaceStageTrack{}
+	for _, stage := range s.t.raceStages(params.RaceID) {
+		track, ok := s.t.tracks[stage.GPXID]
+		if !ok {
+			continue
+		}
+		geoJSON, err := trackGeoJSON(track, params.TrackSimplification)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, db.RaceStageTrack{
+			StageID:       stage.StageID,
+			StageInfo:     s.t.raceStage(stage).StageInfo,
+			Track:         geoJSON,
+			TrackMetadata: trackMetadata(track),
+		})
+	}
+	return tracks, nil
+}
+
+func (s *Store) GetElevationProfile(
+	ctx context.Context, stageID int,
+) ([]db.ElevationPoint, error) {
+	defer s.lock()()
+	track, _ := s.t.stageTrack(stageID)
+	return elevationProfile(track), nil
+}
+
+func (s *Store) GetRaceElevationProfiles(
+	ctx context.Context, raceID int,
+) (map[int][]db.ElevationPoint, error) {
+	defer s.lock()()
+	profiles := make(map[int][]db.ElevationPoint)
+	for _, stage := range s.t.raceStages(raceID) {
+		if track, ok := s.t.tracks[stage.GPXID]; ok && len(track.Points) > 0 {
+			profiles[stage.StageID] = elevationProfile(track)
+		}
+	}
+	return profiles, nil
+}
+
+func (s *Store) GetGradientProfile(
+	ctx context.Context, params db.GradientQueryParams,
+) ([]db.GradientPoint, error) {
+	elevationPoints, err := s.GetElevationProfile(ctx, params.StageID)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetInterpolatedGradientPoints(
+		elevationPoints, params.Resolution,
+	)
+}
@@ -0,0 +1,390 @@
+// Package migrate applies the database migrations, which are embedded in the
+// backend so that it knows the schema version it was built for.
+//
+// Migrations are SQL files in migrations/ named VERSION_NAME.sql, where the
+// version is a timestamp, in the format of dbmate: an up section after a
+// "-- migrate:up" line and a down section after a "-- migrate:down" line.
+// Either line can be followed by "transaction:false" to run the section
+// outside of a transaction. The versions that have been applied are recorded
+// in migrations.schema_migrations, as by dbmate, which can still apply them
+// when run from the db directory of the repository, as configured by its
+// .env file.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaBehind is returned by Check when migrations the backend was built
+// with have not been applied to the database.
+var ErrSchemaBehind = errors.New("database schema is behind the backend")
+
+// ErrNoApplied is returned by Down when no migration has been applied.
+var ErrNoApplied = errors.New("no migration has been applied")
+
+// Migration struct, a migration file
+type Migration struct {
+	Version string
+	Name    string
+	Up      Section
+	Down    Section
+}
+
+// Section struct, the SQL of one direction of a migration
+type Section struct {
+	SQL string
+	// Whether the SQL is run in a transaction, the default
+	Transaction bool
+}
+
+const (
+	upMarker   = "-- migrate:up"
+	downMarker = "-- migrate:down"
+	// Option of a section to run outside of a transaction
+	noTransaction = "transaction:false"
+)
+
+// Parse parses a migration file in the format of dbmate.
+func Parse(filename, contents string) (Migration, error) {
+	base := strings.TrimSuffix(path.Base(filename), ".sql")
+	version, name, _ := strings.Cut(base, "_")
+	if version == "" || strings.Trim(version, "0123456789") != "" {
+		return Migration{}, fmt.Errorf(
+			"%s: file name must start with a numeric version", filename,
+		)
+	}
+
+	migration := Migration{Version: version, Name: name}
+	var current *Section
+	var seenUp, seenDown bool
+	var sql strings.Builder
+	flush := func() {
+		if current != nil {
+			current.SQL = strings.TrimSpace(sql.String())
+		}
+		sql.Reset()
+	}
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		var marker string
+		switch {
+		case strings.HasPrefix(trimmed, upMarker):
+			marker = upMarker
+		case strings.HasPrefix(trimmed, downMarker):
+			marker = downMarker
+		default:
+			sql.WriteString(line)
+			continue
+		}
+
+		flush()
+		options := strings.Fields(strings.TrimPrefix(trimmed, marker))
+		section := Section{Transaction: true}
+		for _, option := range options {
+			if option != noTransaction {
+				return Migration{}, fmt.Errorf(
+					"%s: unknown option %q", filename, option,
+				)
+			}
+			section.Transaction = false
+		}
+		if marker == upMarker {
+			if seenUp || seenDown {
+				return Migration{}, fmt.Errorf(
+					"%s: the up section must come once, first", filename,
+				)
+			}
+			seenUp = true
+			migration.Up = section
+			current = &migration.Up
+		} else {
+			if !seenUp || seenDown {
+				return Migration{}, fmt.Errorf(
+					"%s: the down section must come once, after the up section",
+					filename,
+				)
+			}
+			seenDown = true
+			migration.Down = section
+			current = &migration.Down
+		}
+	}
+	flush()
+
+	if !seenUp {
+		return Migration{}, fmt.Errorf("%s: no %s section", filename, upMarker)
+	}
+	return migration, nil
+}
+
+// Migrations returns the embedded migrations, ordered by version.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(names))
+	versions := make(map[string]string, len(names))
+	for _, name := range names {
+		contents, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := Parse(name, string(contents))
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := versions[migration.Version]; ok {
+			return nil, fmt.Errorf(
+				"%s and %s have the same version", other, name,
+			)
+		}
+		versions[migration.Version] = name
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration, the
+// schema version the backend was built for.
+func LatestVersion() (string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return "", err
+	}
+	if len(migrations) == 0 {
+		return "", errors.New("no migrations are embedded")
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Status struct, a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied bool
+	// Whether the migration is embedded in the backend. Migrations that have
+	// been applied by a newer backend are not.
+	Embedded bool
+}
+
+// Migrator struct, applies the embedded migrations to a database
+type Migrator struct {
+	conn       db.DBConn
+	migrations []Migration
+}
+
+func New(conn db.DBConn) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+const createVersionsTableQuery = `
+CREATE SCHEMA IF NOT EXISTS migrations;
+CREATE TABLE IF NOT EXISTS migrations.schema_migrations (
+	version character varying(128) PRIMARY KEY
+);
+`
+
+const getAppliedVersionsQuery = `
+SELECT version FROM migrations.schema_migrations ORDER BY version;
+`
+
+const insertVersionQuery = `
+INSERT INTO migrations.schema_migrations (version) VALUES ($1);
+`
+
+const deleteVersionQuery = `
+DELETE FROM migrations.schema_migrations WHERE version = $1;
+`
+
+// applied returns the versions that have been applied, none if the versions
+// table does not exist yet.
+func (m *Migrator) applied(ctx context.Context) (map[string]bool, error) {
+	var versions []string
+	rows, err := m.conn.Query(ctx, getAppliedVersionsQuery)
+	if err == nil {
+		versions, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	}
+	var pgErr *pgconn.PgError
+	// undefined_table and invalid_schema_name
+	if errors.As(err, &pgErr) && (pgErr.Code == "42P01" || pgErr.Code == "3F000") {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+// Status returns every embedded migration and every applied migration,
+// ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   applied[migration.Version],
+			Embedded:  true,
+		})
+		delete(applied, migration.Version)
+	}
+	for version := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: version},
+			Applied:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Pending returns the embedded migrations that have not been applied, ordered
+// by version.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, status := range statuses {
+		if status.Embedded && !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Check returns an error wrapping ErrSchemaBehind if any embedded migration
+// has not been applied.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf(
+			"%w: %d pending migrations, from %s_%s",
+			ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name,
+		)
+	}
+	return nil
+}
+
+// run runs a section of a migration and records the change of version, in a
+// transaction unless the section opts out of it.
+func (m *Migrator) run(
+	ctx context.Context, section Section, versionQuery, version string,
+) error {
+	if !section.Transaction {
+		if _, err := m.conn.Exec(ctx, section.SQL); err != nil {
+			return err
+		}
+		_, err := m.conn.Exec(ctx, versionQuery, version)
+		return err
+	}
+
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, section.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, versionQuery, version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Up applies the pending migrations in order, returning those it applied. It
+// stops at the first migration that fails.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if _, err := m.conn.Exec(ctx, createVersionsTableQuery); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, migration := range pending {
+		if err := m.run(
+			ctx, migration.Up, insertVersionQuery, migration.Version,
+		); err != nil {
+			return applied, fmt.Errorf(
+				"%s_%s: %w", migration.Version, migration.Name, err,
+			)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the newest applied migration, returning it. It must be
+// embedded in the backend.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	var latest *Status
+	for i := range statuses {
+		if statuses[i].Applied {
+			latest = &statuses[i]
+		}
+	}
+	if latest == nil {
+		return Migration{}, ErrNoApplied
+	}
+	if !latest.Embedded {
+		return Migration{}, fmt.Errorf(
+			"migration %s is not embedded in this backend", latest.Version,
+		)
+	}
+
+	migration := latest.Migration
+	if err := m.run(
+		ctx, migration.Down, deleteVersionQuery, migration.Version,
+	); err != nil {
+		return Migration{}, fmt.Errorf(
+			"%s_%s: %w", migration.Version, migration.Name, err,
+		)
+	}
+	return migration, nil
+}
@@ -0,0 +1,80 @@
+package migrate_test
+
+import (
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+	"github.com/michaelbennett99/stagehunter/backend/migrate"
+)
+
+func TestParse(t *testing.T) {
+	contents := `-- Comment before the sections
+--
+-- migrate:up
+
+CREATE TABLE a (id int);
+
+-- migrate:down transaction:false
+
+DROP TABLE a;
+`
+	migration, err := migrate.Parse("migrations/20241201120000_add_a.sql", contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := migrate.Migration{
+		Version: "20241201120000",
+		Name:    "add_a",
+		Up:      migrate.Section{SQL: "CREATE TABLE a (id int);", Transaction: true},
+		Down:    migrate.Section{SQL: "DROP TABLE a;", Transaction: false},
+	}
+	if migration != want {
+		t.Errorf("got %+v, want %+v", migration, want)
+	}
+
+	invalid := []struct {
+		name     string
+		filename string
+		contents string
+	}{
+		{"no version", "add_a.sql", "-- migrate:up\nSELECT 1;"},
+		{"no up section", "1_a.sql", "SELECT 1;\n-- migrate:down\nSELECT 2;"},
+		{"down before up", "1_a.sql", "-- migrate:down\nSELECT 2;\n-- migrate:up\nSELECT 1;"},
+		{"two up sections", "1_a.sql", "-- migrate:up\nSELECT 1;\n-- migrate:up\nSELECT 1;"},
+		{"unknown option", "1_a.sql", "-- migrate:up transaction:maybe\nSELECT 1;"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := migrate.Parse(tt.filename, tt.contents); err == nil {
+				t.Errorf("parsed %q without an error", tt.contents)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := migrate.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Up.SQL == "" {
+			t.Errorf("%s has an empty up section", migration.Version)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			t.Errorf("%s is not after %s", migration.Version, migrations[i-1].Version)
+		}
+	}
+
+	// The memstore stands in for a database with every migration applied
+	latest, err := migrate.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := memstore.DefaultFixtures().SchemaVersion; version != latest {
+		t.Errorf("fixtures are at schema version %s, want %s", version, latest)
+	}
+}
@@ -0,0 +1,39 @@
+-- migrate:up
+
+CREATE OR REPLACE VIEW racedata.riders_teams_results AS
+SELECT
+    rv.stage_id,
+    rv."rank",
+    CASE WHEN rv.classification != 'teams'
+        THEN r.first_name || ' ' || r.last_name
+        ELSE NULL
+    END AS rider,
+    t.name AS team,
+    rv.time AS time,
+    rv.points AS points,
+    rv.classification AS classification,
+    rv.rider_id,
+    rv.team_id
+FROM racedata.results_valid rv
+LEFT JOIN racedata.riders r ON rv.rider_id = r.rider_id
+LEFT JOIN racedata.teams t ON rv.team_id = t.team_id;
+
+-- migrate:down
+
+DROP VIEW racedata.riders_teams_results;
+
+CREATE VIEW racedata.riders_teams_results AS
+SELECT
+    rv.stage_id,
+    rv."rank",
+    CASE WHEN rv.classification != 'teams'
+        THEN r.first_name || ' ' || r.last_name
+        ELSE NULL
+    END AS rider,
+    t.name AS team,
+    rv.time AS time,
+    rv.points AS points,
+    rv.classification AS classification
+FROM racedata.results_valid rv
+LEFT JOIN racedata.riders r ON rv.rider_id = r.rider_id
+LEFT JOIN racedata.teams t ON rv.team_id = t.team_id;
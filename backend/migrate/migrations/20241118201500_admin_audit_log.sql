@@ -0,0 +1,45 @@
+-- migrate:up
+
+-- Log of every change made through the admin API
+CREATE TABLE racedata.audit_log (
+    audit_id serial PRIMARY KEY,
+    changed_at timestamp with time zone DEFAULT now() NOT NULL,
+    actor text NOT NULL,
+    action text NOT NULL,
+    entity text NOT NULL,
+    entity_id integer NOT NULL,
+    payload jsonb
+);
+
+CREATE INDEX audit_log_entity_idx
+ON racedata.audit_log (entity, entity_id);
+
+-- Create nologin role to allow the admin API to edit the race data
+CREATE ROLE stagehunter_admin;
+GRANT INSERT, UPDATE, DELETE
+ON racedata.races, racedata.stages, racedata.riders, racedata.teams,
+    racedata.results
+TO stagehunter_admin;
+GRANT USAGE ON SEQUENCE racedata.results_result_id_seq TO stagehunter_admin;
+GRANT SELECT, INSERT ON racedata.audit_log TO stagehunter_admin;
+GRANT USAGE ON SEQUENCE racedata.audit_log_audit_id_seq TO stagehunter_admin;
+
+-- Grant stagehunter_admin role to go_prog
+GRANT stagehunter_admin TO go_prog_user;
+
+-- migrate:down
+
+REVOKE stagehunter_admin FROM go_prog_user;
+
+REVOKE USAGE ON SEQUENCE racedata.audit_log_audit_id_seq
+FROM stagehunter_admin;
+REVOKE SELECT, INSERT ON racedata.audit_log FROM stagehunter_admin;
+REVOKE USAGE ON SEQUENCE racedata.results_result_id_seq
+FROM stagehunter_admin;
+REVOKE INSERT, UPDATE, DELETE
+ON racedata.races, racedata.stages, racedata.riders, racedata.teams,
+    racedata.results
+FROM stagehunter_admin;
+DROP ROLE stagehunter_admin;
+
+DROP TABLE racedata.audit_log;
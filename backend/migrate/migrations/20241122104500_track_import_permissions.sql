@@ -0,0 +1,29 @@
+-- migrate:up
+
+-- Refreshing a materialized view requires owning it, so the admin role
+-- refreshes the elevation profiles through a function owned by its owner
+CREATE FUNCTION geog.refresh_elevation()
+RETURNS void
+LANGUAGE sql
+SECURITY DEFINER
+SET search_path = geog, pg_temp
+AS $$
+    REFRESH MATERIALIZED VIEW CONCURRENTLY geog.elevation;
+$$;
+
+REVOKE ALL ON FUNCTION geog.refresh_elevation() FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION geog.refresh_elevation() TO stagehunter_admin;
+
+-- Allow the admin role to import tracks
+GRANT INSERT, UPDATE ON geog.tracks TO stagehunter_admin;
+GRANT INSERT ON geog.track_points TO stagehunter_admin;
+GRANT USAGE ON SEQUENCE geog.track_points_ogc_fid_seq TO stagehunter_admin;
+
+-- migrate:down
+
+REVOKE USAGE ON SEQUENCE geog.track_points_ogc_fid_seq
+FROM stagehunter_admin;
+REVOKE INSERT ON geog.track_points FROM stagehunter_admin;
+REVOKE INSERT, UPDATE ON geog.tracks FROM stagehunter_admin;
+
+DROP FUNCTION geog.refresh_elevation();
@@ -0,0 +1,54 @@
+-- migrate:up
+
+-- Latest outcome of the data integrity checks of each stage
+CREATE TABLE racedata.stage_validation (
+    stage_id integer PRIMARY KEY
+        REFERENCES racedata.stages (stage_id) ON DELETE CASCADE,
+    passed boolean NOT NULL,
+    problems jsonb DEFAULT '[]'::jsonb NOT NULL,
+    checked_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+-- Random stage that has not failed the data integrity checks. Stages that
+-- have not been checked yet can still be chosen.
+CREATE FUNCTION racedata.get_random_valid_stage_id() RETURNS bigint
+    LANGUAGE sql VOLATILE
+    AS $$
+    SELECT s.stage_id
+    FROM racedata.stages s
+    WHERE NOT EXISTS (
+        SELECT 1
+        FROM racedata.stage_validation v
+        WHERE v.stage_id = s.stage_id AND NOT v.passed
+    )
+    ORDER BY random()
+    LIMIT 1;
+$$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON racedata.stage_validation
+TO stagehunter_admin;
+GRANT SELECT ON racedata.stage_validation TO stagehunter_daily_insert;
+
+-- Choose the daily stage among the stages that pass the checks
+SELECT cron.unschedule('daily_insert');
+SELECT cron.schedule(
+    'daily_insert', '0 0 * * *',
+    'INSERT INTO racedata.daily (stage_id)
+    SELECT racedata.get_random_valid_stage_id()'
+);
+
+-- migrate:down
+
+SELECT cron.unschedule('daily_insert');
+SELECT cron.schedule(
+    'daily_insert', '0 0 * * *',
+    'INSERT INTO racedata.daily (stage_id)
+    SELECT racedata.get_random_stage_id()'
+);
+
+REVOKE SELECT ON racedata.stage_validation FROM stagehunter_daily_insert;
+REVOKE SELECT, INSERT, UPDATE, DELETE ON racedata.stage_validation
+FROM stagehunter_admin;
+
+DROP FUNCTION racedata.get_random_valid_stage_id();
+DROP TABLE racedata.stage_validation;
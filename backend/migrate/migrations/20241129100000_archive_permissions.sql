@@ -0,0 +1,14 @@
+-- migrate:up
+
+-- Allow the admin role to record the schema version in dataset archives,
+-- and to continue the result IDs after restoring an archive
+GRANT USAGE ON SCHEMA migrations TO stagehunter_admin;
+GRANT SELECT ON migrations.schema_migrations TO stagehunter_admin;
+GRANT UPDATE ON SEQUENCE racedata.results_result_id_seq TO stagehunter_admin;
+
+-- migrate:down
+
+REVOKE UPDATE ON SEQUENCE racedata.results_result_id_seq
+FROM stagehunter_admin;
+REVOKE SELECT ON migrations.schema_migrations FROM stagehunter_admin;
+REVOKE USAGE ON SCHEMA migrations FROM stagehunter_admin;
@@ -0,0 +1,31 @@
+-- migrate:up
+
+-- One daily stage per date, so that choosing it is idempotent. Dates that
+-- were chosen several times keep the last stage chosen.
+DELETE FROM racedata.daily d
+WHERE EXISTS (
+    SELECT 1
+    FROM racedata.daily newer
+    WHERE newer.date = d.date AND newer.daily_id > d.daily_id
+);
+ALTER TABLE racedata.daily ADD CONSTRAINT daily_date_key UNIQUE (date);
+DROP INDEX racedata.daily_date_idx;
+
+-- Allow a stage scheduled by the admin to replace the stage of the date
+GRANT SELECT, UPDATE ON racedata.daily TO stagehunter_daily_insert;
+
+-- The daily stage is chosen by the backend's scheduler
+SELECT cron.unschedule('daily_insert');
+
+-- migrate:down
+
+SELECT cron.schedule(
+    'daily_insert', '0 0 * * *',
+    'INSERT INTO racedata.daily (stage_id)
+    SELECT racedata.get_random_valid_stage_id()'
+);
+
+REVOKE SELECT, UPDATE ON racedata.daily FROM stagehunter_daily_insert;
+
+CREATE INDEX daily_date_idx ON racedata.daily (date);
+ALTER TABLE racedata.daily DROP CONSTRAINT daily_date_key;
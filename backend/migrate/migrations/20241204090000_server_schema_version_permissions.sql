@@ -0,0 +1,11 @@
+-- migrate:up
+
+-- Allow the server to check on startup that every migration it was built
+-- with has been applied
+GRANT USAGE ON SCHEMA migrations TO go_prog_user;
+GRANT SELECT ON migrations.schema_migrations TO go_prog_user;
+
+-- migrate:down
+
+REVOKE SELECT ON migrations.schema_migrations FROM go_prog_user;
+REVOKE USAGE ON SCHEMA migrations FROM go_prog_user;
@@ -0,0 +1,87 @@
+-- migrate:up
+
+-- The server's user only has the privileges of the admin role in the
+-- transactions that set it, so the admin role reads the race data itself
+GRANT stagehunter_admin TO go_prog_user WITH INHERIT FALSE, SET TRUE;
+GRANT USAGE ON SCHEMA racedata, geog TO stagehunter_admin;
+GRANT SELECT ON ALL TABLES IN SCHEMA racedata, geog TO stagehunter_admin;
+
+-- The random valid stage reads the outcome of the checks, which the server
+-- could only read through the admin role
+GRANT SELECT ON racedata.stage_validation TO go_prog_user;
+
+-- Allocate the IDs of new rows from sequences, so concurrent creates do not
+-- take the same ID
+CREATE SEQUENCE racedata.races_race_id_seq
+AS integer OWNED BY racedata.races.race_id;
+SELECT setval(
+    'racedata.races_race_id_seq', COALESCE(MAX(race_id), 0) + 1, false
+)
+FROM racedata.races;
+ALTER TABLE racedata.races
+ALTER COLUMN race_id SET DEFAULT nextval('racedata.races_race_id_seq');
+
+CREATE SEQUENCE racedata.stages_stage_id_seq
+AS integer OWNED BY racedata.stages.stage_id;
+SELECT setval(
+    'racedata.stages_stage_id_seq', COALESCE(MAX(stage_id), 0) + 1, false
+)
+FROM racedata.stages;
+ALTER TABLE racedata.stages
+ALTER COLUMN stage_id SET DEFAULT nextval('racedata.stages_stage_id_seq');
+
+CREATE SEQUENCE racedata.riders_rider_id_seq
+AS integer OWNED BY racedata.riders.rider_id;
+SELECT setval(
+    'racedata.riders_rider_id_seq', COALESCE(MAX(rider_id), 0) + 1, false
+)
+FROM racedata.riders;
+ALTER TABLE racedata.riders
+ALTER COLUMN rider_id SET DEFAULT nextval('racedata.riders_rider_id_seq');
+
+CREATE SEQUENCE racedata.teams_team_id_seq
+AS integer OWNED BY racedata.teams.team_id;
+SELECT setval(
+    'racedata.teams_team_id_seq', COALESCE(MAX(team_id), 0) + 1, false
+)
+FROM racedata.teams;
+ALTER TABLE racedata.teams
+ALTER COLUMN team_id SET DEFAULT nextval('racedata.teams_team_id_seq');
+
+CREATE SEQUENCE geog.tracks_track_id_seq
+AS integer OWNED BY geog.tracks.track_id;
+SELECT setval(
+    'geog.tracks_track_id_seq', COALESCE(MAX(track_id), 0) + 1, false
+)
+FROM geog.tracks;
+ALTER TABLE geog.tracks
+ALTER COLUMN track_id SET DEFAULT nextval('geog.tracks_track_id_seq');
+
+-- Allow the admin role to take IDs, and to continue them after restoring an
+-- archive
+GRANT USAGE, UPDATE
+ON SEQUENCE racedata.races_race_id_seq, racedata.stages_stage_id_seq,
+    racedata.riders_rider_id_seq, racedata.teams_team_id_seq,
+    geog.tracks_track_id_seq
+TO stagehunter_admin;
+
+-- migrate:down
+
+ALTER TABLE geog.tracks ALTER COLUMN track_id DROP DEFAULT;
+ALTER TABLE racedata.teams ALTER COLUMN team_id DROP DEFAULT;
+ALTER TABLE racedata.riders ALTER COLUMN rider_id DROP DEFAULT;
+ALTER TABLE racedata.stages ALTER COLUMN stage_id DROP DEFAULT;
+ALTER TABLE racedata.races ALTER COLUMN race_id DROP DEFAULT;
+DROP SEQUENCE geog.tracks_track_id_seq;
+DROP SEQUENCE racedata.teams_team_id_seq;
+DROP SEQUENCE racedata.riders_rider_id_seq;
+DROP SEQUENCE racedata.stages_stage_id_seq;
+DROP SEQUENCE racedata.races_race_id_seq;
+
+REVOKE SELECT ON racedata.stage_validation FROM go_prog_user;
+
+REVOKE SELECT ON ALL TABLES IN SCHEMA racedata, geog FROM stagehunter_admin;
+GRANT SELECT ON racedata.audit_log, racedata.stage_validation
+TO stagehunter_admin;
+REVOKE USAGE ON SCHEMA racedata, geog FROM stagehunter_admin;
+GRANT stagehunter_admin TO go_prog_user WITH INHERIT TRUE;
@@ -0,0 +1,32 @@
+-- migrate:up
+
+-- Name a team raced under in each year, as teams are renamed with their
+-- sponsors. The results importer records the name a file gives a team.
+CREATE TABLE racedata.team_names (
+    team_id integer NOT NULL
+        REFERENCES racedata.teams (team_id) ON DELETE CASCADE,
+    year integer NOT NULL,
+    name text NOT NULL,
+    PRIMARY KEY (team_id, year)
+);
+
+-- Until now teams had a single name, which is the name of every year they
+-- have results
+INSERT INTO racedata.team_names (team_id, year, name)
+SELECT DISTINCT res.team_id, r.year, t.name
+FROM racedata.results res
+JOIN racedata.stages s ON res.stage_id = s.stage_id
+JOIN racedata.races r ON s.race_id = r.race_id
+JOIN racedata.teams t ON res.team_id = t.team_id;
+
+GRANT SELECT ON racedata.team_names TO go_prog_user;
+GRANT SELECT, INSERT, UPDATE, DELETE ON racedata.team_names
+TO stagehunter_admin;
+
+-- migrate:down
+
+REVOKE SELECT, INSERT, UPDATE, DELETE ON racedata.team_names
+FROM stagehunter_admin;
+REVOKE SELECT ON racedata.team_names FROM go_prog_user;
+
+DROP TABLE racedata.team_names;
@@ -0,0 +1,627 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/michaelbennett99/stagehunter/backend/archive"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
+// adminRoutes returns the routes of the admin API, which creates, updates and
+// deletes races, stages, riders, teams and results. Every change is recorded
+// in the audit log in the same transaction.
+func adminRoutes() []Route {
+	return []Route{
+		NewAdminRoute(
+			http.MethodPost, "/admin/races",
+			MakeCreateHandler(db.EntityRace, db.Store.CreateRace),
+		),
+		NewAdminRoute(
+			http.MethodPut, fmt.Sprintf("/admin/races/{%s}", RaceID),
+			MakeUpdateHandler(
+				db.EntityRace, RaceID,
+				func(in *db.RaceInput, id int) { in.RaceID = id },
+				db.Store.UpdateRace,
+			),
+		),
+		NewAdminRoute(
+			http.MethodDelete, fmt.Sprintf("/admin/races/{%s}", RaceID),
+			MakeDeleteHandler(db.EntityRace, RaceID, db.Store.DeleteRace),
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/stages",
+			MakeCreateHandler(db.EntityStage, db.Store.CreateStage),
+		),
+		NewAdminRoute(
+			http.MethodPut, fmt.Sprintf("/admin/stages/{%s}", StageID),
+			MakeUpdateHandler(
+				db.EntityStage, StageID,
+				func(in *db.StageInput, id int) { in.StageID = id },
+				db.Store.UpdateStage,
+			),
+		),
+		NewAdminRoute(
+			http.MethodDelete, fmt.Sprintf("/admin/stages/{%s}", StageID),
+			MakeDeleteHandler(
+				db.EntityStage, StageID, db.Store.DeleteStage,
+			),
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/tracks", AdminImportTrackHandler,
+		),
+		NewAdminRoute(
+			http.MethodPost, fmt.Sprintf("/admin/stages/{%s}/track", StageID),
+			AdminImportTrackHandler,
+		),
+		NewAdminRoute(
+			http.MethodPost,
+			fmt.Sprintf("/admin/races/{%s}/results/import", RaceID),
+			AdminImportResultsHandler,
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/validation", AdminValidateDataHandler,
+		),
+		NewAdminRoute(http.MethodGet, "/admin/export", AdminExportHandler),
+		NewAdminRoute(
+			http.MethodPost, "/admin/riders",
+			MakeCreateHandler(db.EntityRider, db.Store.CreateRider),
+		),
+		NewAdminRoute(
+			http.MethodPut, fmt.Sprintf("/admin/riders/{%s}", RiderID),
+			MakeUpdateHandler(
+				db.EntityRider, RiderID,
+				func(in *db.RiderInput, id int) { in.RiderID = id },
+				db.Store.UpdateRider,
+			),
+		),
+		NewAdminRoute(
+			http.MethodDelete, fmt.Sprintf("/admin/riders/{%s}", RiderID),
+			MakeDeleteHandler(
+				db.EntityRider, RiderID, db.Store.DeleteRider,
+			),
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/teams",
+			MakeCreateHandler(db.EntityTeam, db.Store.CreateTeam),
+		),
+		NewAdminRoute(
+			http.MethodPut, fmt.Sprintf("/admin/teams/{%s}", TeamID),
+			MakeUpdateHandler(
+				db.EntityTeam, TeamID,
+				func(in *db.TeamInput, id int) { in.TeamID = id },
+				db.Store.UpdateTeam,
+			),
+		),
+		NewAdminRoute(
+			http.MethodDelete, fmt.Sprintf("/admin/teams/{%s}", TeamID),
+			MakeDeleteHandler(db.EntityTeam, TeamID, db.Store.DeleteTeam),
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/results",
+			MakeCreateHandler(db.EntityResult, db.Store.CreateResult),
+		),
+		NewAdminRoute(
+			http.MethodPost, "/admin/results/batch",
+			AdminResultsBatchHandler,
+		),
+		NewAdminRoute(
+			http.MethodPut, fmt.Sprintf("/admin/results/{%s}", ResultID),
+			MakeUpdateHandler(
+				db.EntityResult, ResultID,
+				func(in *db.ResultInput, id int) { in.ResultID = id },
+				db.Store.UpdateResult,
+			),
+		),
+		NewAdminRoute(
+			http.MethodDelete, fmt.Sprintf("/admin/results/{%s}", ResultID),
+			MakeDeleteHandler(
+				db.EntityResult, ResultID, db.Store.DeleteResult,
+			),
+		),
+	}
+}
+
+// AdminInput is an input of the admin API that can validate itself.
+type AdminInput interface {
+	Validate() error
+}
+
+// AdminResponse is the response to a create or update through the admin API.
+type AdminResponse struct {
+	ID int `json:"id"`
+	// Set if the change was made but a follow-up step failed
+	Warning string `json:"warning,omitempty"`
+}
+
+// DecodeAdminInput decodes and validates the JSON body of an admin request.
+// Unknown fields are rejected so that typos are not silently ignored.
+func DecodeAdminInput[T AdminInput](
+	w http.ResponseWriter, r *http.Request,
+) (T, error) {
+	var input T
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminMaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		return input, db.NewValidationError(err)
+	}
+	return input, input.Validate()
+}
+
+// GetAdminActor returns who made an admin request, from the X-Admin-Actor
+// header.
+func GetAdminActor(r *http.Request) string {
+	if actor := r.Header.Get(adminActorHeader); actor != "" {
+		return actor
+	}
+	return adminActorDefault
+}
+
+// WriteAdminError writes the error of an admin request with a status code
+// matching its cause: invalid input, a missing row or a violated constraint.
+func WriteAdminError(w http.ResponseWriter, err error) {
+	var pgErr *pgconn.PgError
+	switch {
+	case db.IsValidationError(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.As(err, &pgErr) && pgErr.Code[:2] == "23":
+		// Class 23 is integrity constraint violations
+		http.Error(w, pgErr.Message, http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeAdminResponse(w http.ResponseWriter, status int, id int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AdminResponse{ID: id})
+}
+
+func getPathID(r *http.Request, segment string) (int, error) {
+	value := r.PathValue(segment)
+	if value == "" {
+		return 0, fmt.Errorf("%s is required", segment)
+	}
+	return strconv.Atoi(value)
+}
+
+// MakeCreateHandler creates a handler that creates an entity from the JSON
+// body of the request and responds with its ID.
+func MakeCreateHandler[T AdminInput](
+	entity string,
+	create func(db.Store, context.Context, T) (int, error),
+) func(http.ResponseWriter, *http.Request, db.Store) {
+	return func(w http.ResponseWriter, r *http.Request, conn db.Store) {
+		input, err := DecodeAdminInput[T](w, r)
+		if err != nil {
+			WriteAdminError(w, err)
+			return
+		}
+
+		ctx := context.Background()
+		var id int
+		err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+			if id, err = create(tx, ctx, input); err != nil {
+				return err
+			}
+			return tx.InsertAuditEntry(ctx, db.AuditEntry{
+				Actor:    GetAdminActor(r),
+				Action:   db.ActionCreate,
+				Entity:   entity,
+				EntityID: id,
+				Payload:  input,
+			})
+		})
+		if err != nil {
+			WriteAdminError(w, err)
+			return
+		}
+
+		writeAdminResponse(w, http.StatusCreated, id)
+	}
+}
+
+// MakeUpdateHandler creates a handler that replaces the entity with the ID in
+// the given path segment by the JSON body of the request.
+func MakeUpdateHandler[T AdminInput](
+	entity string,
+	segment string,
+	setID func(*T, int),
+	update func(db.Store, context.Context, T) error,
+) func(http.ResponseWriter, *http.Request, db.Store) {
+	return func(w http.ResponseWriter, r *http.Request, conn db.Store) {
+		id, err := getPathID(r, segment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		input, err := DecodeAdminInput[T](w, r)
+		if err != nil {
+			WriteAdminError(w, err)
+			return
+		}
+		setID(&input, id)
+
+		ctx := context.Background()
+		err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+			if err := update(tx, ctx, input); err != nil {
+				return err
+			}
+			return tx.InsertAuditEntry(ctx, db.AuditEntry{
+				Actor:    GetAdminActor(r),
+				Action:   db.ActionUpdate,
+				Entity:   entity,
+				EntityID: id,
+				Payload:  input,
+			})
+		})
+		if err != nil {
+			WriteAdminError(w, err)
+			return
+		}
+
+		writeAdminResponse(w, http.StatusOK, id)
+	}
+}
+
+// MakeDeleteHandler creates a handler that deletes the entity with the ID in
+// the given path segment.
+func MakeDeleteHandler(
+	entity string,
+	segment string,
+	remove func(db.Store, context.Context, int) error,
+) func(http.ResponseWriter, *http.Request, db.Store) {
+	return func(w http.ResponseWriter, r *http.Request, conn db.Store) {
+		id, err := getPathID(r, segment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+			if err := remove(tx, ctx, id); err != nil {
+				return err
+			}
+			return tx.InsertAuditEntry(ctx, db.AuditEntry{
+				Actor:    GetAdminActor(r),
+				Action:   db.ActionDelete,
+				Entity:   entity,
+				EntityID: id,
+			})
+		})
+		if err != nil {
+			WriteAdminError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AdminResultsBatchResponse is the IDs of the results created, updated and
+// deleted by a batch.
+type AdminResultsBatchResponse struct {
+	Created []int `json:"created"`
+	Updated []int `json:"updated"`
+	Deleted []int `json:"deleted"`
+}
+
+// AdminResultsBatchHandler creates, updates and deletes results in a single
+// transaction, so either every change of the batch is made or none is.
+//
+// Request Body: {"create": [result, ...], "update": [result, ...],
+// "delete": [result_id, ...]}
+func AdminResultsBatchHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	batch, err := DecodeAdminInput[db.ResultsBatch](w, r)
+	if err != nil {
+		WriteAdminError(w, err)
+		return
+	}
+
+	actor := GetAdminActor(r)
+	response := AdminResultsBatchResponse{
+		Created: []int{},
+		Updated: []int{},
+		Deleted: []int{},
+	}
+	ctx := context.Background()
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		audit := func(action string, id int, payload any) error {
+			return tx.InsertAuditEntry(ctx, db.AuditEntry{
+				Actor:    actor,
+				Action:   action,
+				Entity:   db.EntityResult,
+				EntityID: id,
+				Payload:  payload,
+			})
+		}
+		for _, result := range batch.Create {
+			id, err := tx.CreateResult(ctx, result)
+			if err != nil {
+				return err
+			}
+			if err := audit(db.ActionCreate, id, result); err != nil {
+				return err
+			}
+			response.Created = append(response.Created, id)
+		}
+		for _, result := range batch.Update {
+			if err := tx.UpdateResult(ctx, result); err != nil {
+				return err
+			}
+			err := audit(db.ActionUpdate, result.ResultID, result)
+			if err != nil {
+				return err
+			}
+			response.Updated = append(response.Updated, result.ResultID)
+		}
+		for _, resultID := range batch.Delete {
+			if err := tx.DeleteResult(ctx, resultID); err != nil {
+				return err
+			}
+			if err := audit(db.ActionDelete, resultID, nil); err != nil {
+				return err
+			}
+			response.Deleted = append(response.Deleted, resultID)
+		}
+		return nil
+	})
+	if err != nil {
+		WriteAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminImportTrackHandler imports the GPX file in the request body as a
+// track, linked to the stage of the path if there is one, and responds with
+// the ID of the new track. A track imported without a stage can be given to
+// a new stage. If the elevation profiles could not be refreshed after the
+// import, the response has a warning.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer, on the route of a stage
+//
+// Optional Query Parameters:
+// - accuracy: how accurately the track follows the route of the stage.
+// Required with a stage.
+// - name: the name of the track. Defaults to the name in the GPX file.
+func AdminImportTrackHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id := 0
+	if r.PathValue(StageID) != "" {
+		var err error
+		if stage_id, err = GetStageIDFromRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accuracyParam := NewStringQueryParamWithDefault(accuracyName, "")
+	nameParam := NewStringQueryParamWithDefault(nameName, "")
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		[]QueryParamInterface{},
+		[]QueryParamInterface{accuracyParam, nameParam},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	accuracy, err := GetParamValue[string](queryParams[accuracyName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := GetParamValue[string](queryParams[nameName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := importer.ImportGPX(
+		context.Background(),
+		conn,
+		http.MaxBytesReader(w, r.Body, adminMaxBodySize),
+		importer.TrackOptions{
+			StageID:  stage_id,
+			Accuracy: accuracy,
+			Name:     name,
+			Actor:    GetAdminActor(r),
+		},
+	)
+	if err != nil {
+		WriteAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(AdminResponse{
+		ID: result.TrackID, Warning: result.Warning,
+	})
+}
+
+// AdminImportResultsHandler imports the results file in the request body into
+// a race, in the format documented in the importer package, and responds
+// with a report of the import. The report lists any conflicts, in which case
+// nothing is imported and the status is 409.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+//
+// Optional Query Parameters:
+// - format: the format of the file, csv or json. Defaults to csv.
+// - dry_run: whether to only report what the import would do. Defaults to
+// false.
+// - replace: whether to replace the existing results of the classifications
+// in the file rather than report them as conflicts. Defaults to false.
+func AdminImportResultsHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	formatParam := NewStringQueryParamWithDefault(
+		formatName, resultsFormatDefault,
+	)
+	dryRunParam := NewBoolQueryParamWithDefault(dryRunName, dryRunDefault)
+	replaceParam := NewBoolQueryParamWithDefault(replaceName, replaceDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		[]QueryParamInterface{},
+		[]QueryParamInterface{formatParam, dryRunParam, replaceParam},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	formatValue, err := GetParamValue[string](queryParams[formatName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := importer.ParseResultsFormat(formatValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun, err := GetParamValue[bool](queryParams[dryRunName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	replace, err := GetParamValue[bool](queryParams[replaceName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := importer.ImportResults(
+		context.Background(),
+		conn,
+		http.MaxBytesReader(w, r.Body, adminMaxBodySize),
+		importer.ResultsOptions{
+			RaceID:  race_id,
+			Format:  format,
+			Replace: replace,
+			DryRun:  dryRun,
+			Actor:   GetAdminActor(r),
+		},
+	)
+	status := http.StatusCreated
+	switch {
+	case errors.Is(err, importer.ErrResultsConflict):
+		status = http.StatusConflict
+	case err != nil:
+		WriteAdminError(w, err)
+		return
+	case dryRun:
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// AdminValidateDataHandler checks the tracks and results of every stage,
+// records the outcomes for the daily stage selector, which skips the stages
+// that failed, and responds with the report of the checks.
+//
+// Optional Query Parameters:
+// - tolerance: how far the track length may be from the stage length, as a
+// fraction of the stage length. Defaults to 0.1.
+// - dry_run: whether to only report the problems, without recording them.
+// Defaults to false.
+func AdminValidateDataHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	toleranceParam := NewFloatQueryParamWithDefault(
+		toleranceName, trackToleranceDefault,
+	)
+	dryRunParam := NewBoolQueryParamWithDefault(dryRunName, dryRunDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r, nil, []QueryParamInterface{toleranceParam, dryRunParam},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tolerance, err := GetParamValue[float64](queryParams[toleranceName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun, err := GetParamValue[bool](queryParams[dryRunName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := validation.Run(
+		context.Background(),
+		conn,
+		validation.Config{TrackLengthTolerance: tolerance},
+		dryRun,
+	)
+	if err != nil {
+		WriteAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// AdminExportHandler responds with a versioned archive of the whole dataset,
+// in the format documented in the archive package. The archive is written to
+// a temporary file first, so that an error while exporting is not sent as a
+// truncated archive.
+func AdminExportHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	file, err := os.CreateTemp("", "stagehunter-export-*.zip")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	summary, err := archive.Export(context.Background(), conn, file)
+	if err != nil {
+		WriteAdminError(w, err)
+		return
+	}
+
+	SetAttachmentHeaders(
+		w, archiveContentType,
+		fmt.Sprintf("stagehunter-%s.zip", summary.SchemaVersion),
+	)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", time.Time{}, file)
+}
@@ -1,22 +1,141 @@
 package server
 
+import (
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/importer"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
 // Route segment names
 const (
 	StageID              = "stageID"
+	RaceID               = "raceID"
+	RiderID              = "riderID"
+	OtherRiderID         = "otherRiderID"
+	TeamID               = "teamID"
+	ResultID             = "resultID"
+	StageNumber          = "stageNumber"
 	InfoField            = "infoField"
 	ResultClassification = "classification"
 	Rank                 = "rank"
 	ResultField          = "field"
+	TileZ                = "z"
+	TileX                = "x"
+	TileY                = "y"
 )
 
 // Query parameter names
 const (
-	topNName = "topN"
+	topNName           = "topN"
+	toleranceName      = "tolerance"
+	zoomName           = "zoom"
+	precisionName      = "precision"
+	climbsName         = "climbs"
+	grandTourName      = "grand_tour"
+	yearName           = "year"
+	stageTypeName      = "stage_type"
+	formatName         = "format"
+	limitName          = "limit"
+	cursorName         = "cursor"
+	sortName           = "sort"
+	orderName          = "order"
+	minYearName        = "min_year"
+	maxYearName        = "max_year"
+	minLengthName      = "min_length"
+	maxLengthName      = "max_length"
+	townName           = "town"
+	timeFormatName     = "time_format"
+	includeStatusName  = "include_status"
+	classificationName = "classification"
+	searchQueryName    = "q"
+	searchTypeName     = "type"
+	stageName          = "stage"
+	accuracyName       = "accuracy"
+	nameName           = "name"
+	dryRunName         = "dry_run"
+	replaceName        = "replace"
 )
 
 // Query parameter defaults
 const (
-	topNDefault = 1000
+	topNDefault          = 1000
+	standingsTopN        = 10
+	toleranceDefault     = 0.0
+	zoomDefault          = 0
+	precisionDefault     = 9
+	climbsDefault        = false
+	limitDefault         = 50
+	sortDefault          = string(db.StageSortID)
+	orderDefault         = orderAsc
+	timeFormatDefault    = string(TimeFormatDuration)
+	includeStatusDefault = false
+	searchLimitDefault   = 10
+	resultsFormatDefault = string(importer.ResultsFormatCSV)
+	dryRunDefault        = false
+	replaceDefault       = false
+	// The track length tolerance of the data integrity checks
+	trackToleranceDefault = validation.DefaultTrackLengthTolerance
+)
+
+// Sort orders
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// Search settings
+const (
+	// Hits scoring below this are not returned
+	searchMinScore = 0.3
+	// Search candidates are cached per stage, and for all stages
+	searchCacheSize = 256
+	searchCacheTTL  = time.Hour
+)
+
+// Track formats
+const (
+	formatGeometry = "geometry"
+	formatFeature  = "feature"
+)
+
+// Query parameter limits
+const (
+	zoomMax      = 22
+	precisionMax = 15
+	limitMax     = 500
+	// Autocompletes return few matches of guesses of a few letters at
+	// least, so they do not list the riders of a stage
+	autocompleteLimitMax       = 10
+	autocompleteQueryMinLength = 3
+)
+
+// Tile settings
+const (
+	tileExtension   = ".mvt"
+	tileContentType = "application/vnd.mapbox-vector-tile"
+	tileCacheSize   = 4096
+	tileCacheTTL    = time.Hour
+)
+
+// Response header names
+const (
+	trackPointsHeader = "X-Track-Points"
+)
+
+// Admin API settings
+const (
+	// Environment variable holding the bearer token of the admin API, which
+	// is disabled if it is empty
+	adminTokenEnv = "ADMIN_TOKEN"
+	// Request header naming who made a change, recorded in the audit log
+	adminActorHeader  = "X-Admin-Actor"
+	adminActorDefault = "admin"
+	// Maximum size of an admin request body
+	adminMaxBodySize = 32 << 20
+	// Content type of a dataset archive
+	archiveContentType = "application/zip"
 )
 
 const (
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+)
+
+type Feature[P any] struct {
+	Type       string          `json:"type"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties P               `json:"properties"`
+}
+
+func NewFeature[P any](geometry string, properties P) Feature[P] {
+	return Feature[P]{
+		Type:       "Feature",
+		Geometry:   json.RawMessage(geometry),
+		Properties: properties,
+	}
+}
+
+type FeatureCollection[P any] struct {
+	Type     string       `json:"type"`
+	Features []Feature[P] `json:"features"`
+}
+
+func NewFeatureCollection[P any](features []Feature[P]) FeatureCollection[P] {
+	return FeatureCollection[P]{
+		Type:     "FeatureCollection",
+		Features: features,
+	}
+}
+
+// StageTrackProperties are the properties of a stage track feature.
+type StageTrackProperties struct {
+	StageID int `json:"stage_id"`
+	db.StageInfo
+	Profile db.ProfileSummary `json:"profile"`
+	Source  *string           `json:"source,omitempty"`
+	Link    *string           `json:"link,omitempty"`
+}
+
+func NewStageTrackFeature(
+	stageID int,
+	info db.StageInfo,
+	track db.Track,
+	metadata db.TrackMetadata,
+	profile []db.ElevationPoint,
+) Feature[StageTrackProperties] {
+	return NewFeature(track.GeoJSON, StageTrackProperties{
+		StageID:   stageID,
+		StageInfo: info,
+		Profile:   db.SummariseElevationProfile(profile),
+		Source:    StringRefFromPGText(metadata.Source),
+		Link:      StringRefFromPGText(metadata.LinkHref),
+	})
+}
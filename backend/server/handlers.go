@@ -1,40 +1,26 @@
 package server
 
 import (
-	"compress/gzip"
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+	"github.com/michaelbennett99/stagehunter/backend/kml"
 	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
-// MakeHandler creates a new HTTP handler function that acquires a database
-// connection from the provided pool and calls the provided function with the
-// Queries object.
+// MakeHandler creates a new HTTP handler function that calls the provided
+// function with the store. A store on a connection pool acquires a connection
+// for each query.
 func MakeHandler(
-	pool *pgxpool.Pool,
-	fn func(http.ResponseWriter, *http.Request, *db.Queries),
+	store db.Store,
+	fn func(http.ResponseWriter, *http.Request, db.Store),
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Acquire a connection from the pool
-		conn, err := pool.Acquire(context.Background())
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer conn.Release()
-
-		// Create a new Queries object with the acquired connection
-		queries := db.New(conn.Conn())
-
-		// Call the provided handler function with the Queries object
-		fn(w, r, queries)
+		fn(w, r, store)
 	}
 }
 
@@ -43,41 +29,535 @@ func DefaultHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Request OK"))
 }
 
-// GetDailyHandler returns the ID of the daily stage from the database.
-func GetDailyHandler(w http.ResponseWriter, r *http.Request, conn *db.Queries) {
-	dailyStage, err := conn.GetDailyStage(context.Background())
+// GetDailyHandler returns the ID of the daily stage from the database.
+func GetDailyHandler(w http.ResponseWriter, r *http.Request, conn db.Store) {
+	dailyStage, err := conn.GetDailyStage(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dailyStage)
+}
+
+// GetRandomHandler returns a random stage ID from the database.
+func GetRandomHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id, err := conn.GetRandomStage(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stage_id)
+}
+
+// GetAllStagesHandler returns a page of stages with their info.
+//
+// Optional Query Parameters:
+// - limit: the maximum number of stages to return as an integer. Defaults to
+// 50, and cannot be more than 500.
+// - cursor: the next_cursor of the previous page, to get the next page.
+// - sort: the field to sort by, one of stage_id, year, stage_number or
+// stage_length. Defaults to stage_id.
+// - order: asc or desc. Defaults to asc.
+// - grand_tour: only include stages from this grand tour
+// - min_year, max_year: only include stages from this range of years
+// - stage_type: only include stages of this type
+// - min_length, max_length: only include stages with a length in this range
+// in kilometers
+// - town: only include stages whose start or end town contains this text,
+// ignoring case
+func GetAllStagesHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	params, err := GetStagePageQueryParamsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := conn.GetStagePage(context.Background(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetRacesHandler returns all the races in the database.
+//
+// Optional Query Parameters:
+// - grand_tour: only include races of this grand tour
+// - year: only include races from this year as an integer
+func GetRacesHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	params, err := GetRacesQueryParamsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	races, err := conn.GetRaces(context.Background(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(races)
+}
+
+// GetRaceHandler returns a race with its stages ordered by stage number.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+func GetRaceHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	race, err := conn.GetRace(context.Background(), race_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stages, err := conn.GetRaceStages(context.Background(), race_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RaceDetail{Race: race, Stages: stages})
+}
+
+// GetRaceStageHandler returns a stage of a race by its stage number.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+// - stage_number: the stage number as an integer
+func GetRaceStageHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stage_number, err := GetStageNumberFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stage, err := conn.GetRaceStageByNumber(
+		context.Background(), db.RaceStageQueryParams{
+			RaceID:      race_id,
+			StageNumber: stage_number,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stage)
+}
+
+// GetStandingsHandler returns the top N of a classification after every stage
+// of a race, with the time gap to the leader for time based classifications.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+// - classification: the classification
+//
+// Optional Query Parameters:
+// - topN: the number of results to return per stage as an integer. Defaults
+// to 10.
+// - time_format: duration (default) or cycling, e.g. 4:32:10, +1:23, s.t.
+func GetStandingsHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	classification, err := GetResultClassificationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	topNParam := NewIntQueryParamWithDefault(topNName, standingsTopN)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{topNParam},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topN, err := GetParamValue[int](queryParams[topNName])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbStandings, err := conn.GetStandings(
+		context.Background(), db.StandingsQueryParams{
+			RaceID:         race_id,
+			TopN:           topN,
+			Classification: classification,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewStageStandings(dbStandings, format))
+}
+
+// SearchRidersHandler returns the riders whose name contains a search term,
+// ordered by last name.
+//
+// Optional Query Parameters:
+// - q: part of the rider's name. Defaults to all riders.
+// - limit: the maximum number of riders to return. Defaults to 50.
+func SearchRidersHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	params, err := GetRiderSearchQueryParamsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	riders, err := conn.SearchRiders(context.Background(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(riders)
+}
+
+// GetRiderHandler returns a rider's profile: their stage wins, final placings
+// in the jersey classifications, grand tour participations and teams by year.
+//
+// Dynamic Query Segments:
+// - rider_id: the rider ID as an integer
+func GetRiderHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	rider_id, err := GetRiderIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rider, err := conn.GetRider(context.Background(), rider_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stageWins, err := conn.GetRiderStageWins(context.Background(), rider_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	placings, err := conn.GetRiderPlacings(context.Background(), rider_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	participations, err := conn.GetRiderParticipations(
+		context.Background(), rider_id,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	teams, err := conn.GetRiderTeams(context.Background(), rider_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RiderProfile{
+		Rider:          rider,
+		StageWins:      stageWins,
+		Placings:       placings,
+		Participations: participations,
+		Teams:          teams,
+	})
+}
+
+// GetHeadToHeadHandler compares two riders over every stage where both have a
+// valid result, with the number of stages and races each finished ahead of
+// the other and their average time gap.
+//
+// Dynamic Query Segments:
+// - rider_id: the ID of rider A as an integer
+// - other_rider_id: the ID of rider B as an integer
+//
+// Optional Query Parameters:
+// - time_format: duration (default) or cycling, e.g. +1:23
+func GetHeadToHeadHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	rider_a, err := GetRiderIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rider_b, err := GetOtherRiderIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	riderA, err := conn.GetRider(context.Background(), rider_a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	riderB, err := conn.GetRider(context.Background(), rider_b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h2h, err := conn.GetHeadToHead(
+		context.Background(), db.HeadToHeadQueryParams{
+			RiderA: rider_a,
+			RiderB: rider_b,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewHeadToHead(riderA, riderB, h2h, format))
+}
+
+// GetTeamHandler returns a team's profile: its names by year, its roster for
+// each race, its stage wins and its final placings in the teams
+// classification.
+//
+// Dynamic Query Segments:
+// - team_id: the team ID as an integer
+func GetTeamHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	team_id, err := GetTeamIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	team, err := conn.GetTeam(context.Background(), team_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	names, err := conn.GetTeamNames(context.Background(), team_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rosters, err := conn.GetTeamRosters(
+		context.Background(), db.TeamRostersQueryParams{TeamID: team_id},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stageWins, err := conn.GetTeamStageWins(context.Background(), team_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	placings, err := conn.GetTeamPlacings(context.Background(), team_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TeamProfile{
+		Team:      team,
+		Names:     names,
+		Rosters:   NewTeamRosters(rosters),
+		StageWins: stageWins,
+		Placings:  placings,
+	})
+}
+
+// GetRaceTeamRosterHandler returns the riders who rode for a team in a race,
+// ordered by last name.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+// - team_id: the team ID as an integer
+func GetRaceTeamRosterHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	team_id, err := GetTeamIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbRiders, err := conn.GetTeamRosters(
+		context.Background(), db.TeamRostersQueryParams{
+			TeamID: team_id,
+			RaceID: &race_id,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	riders := make([]db.Rider, len(dbRiders))
+	for i, dbRider := range dbRiders {
+		riders[i] = dbRider.Rider
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(riders)
+}
+
+// SearchHandler returns the riders, teams and stage towns best matching a
+// search, ignoring case and accents and tolerating typos.
+//
+// Required Query Parameters:
+// - q: the search
+//
+// Optional Query Parameters:
+// - type: only return hits of this type, rider, team or town
+// - stage: only search the riders, teams and towns of this stage
+// - limit: the maximum number of hits to return. Defaults to 10.
+func SearchHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	params, err := GetSearchQueryParamsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := GetSearchCandidates(conn, params.StageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hits := RankSearchHits(params.Query, candidates, params.Type, params.Limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
+
+// GetAutocompleteHandler returns the riders, or teams for the teams
+// classification, best matching a partial guess for a classification of a
+// stage. The guess is matched against every rider or team in the database,
+// and only the best few matches of a guess of a few letters are returned, so
+// the matches do not disclose who was in the stage.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+// - classification: the classification
+//
+// Required Query Parameters:
+// - q: the partial guess, of at least 3 characters
+//
+// Optional Query Parameters:
+// - limit: the maximum number of matches to return, at most 10. Defaults to
+// 10.
+func GetAutocompleteHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	if _, err := GetStageIDFromRequest(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	classification, err := GetResultClassificationFromRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dailyStage)
-}
 
-// GetRandomHandler returns a random stage ID from the database.
-func GetRandomHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
-) {
-	stage_id, err := conn.GetRandomStage(context.Background())
+	params, err := GetAutocompleteQueryParamsFromRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stage_id)
-}
 
-// GetAllStagesHandler returns the IDs of all the stages in the database.
-func GetAllStagesHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
-) {
-	stages, err := conn.GetAllStages(context.Background())
+	entity := db.SearchEntityRider
+	if classification == db.ClassificationTeams {
+		entity = db.SearchEntityTeam
+	}
+
+	candidates, err := GetSearchCandidates(conn, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	hits := RankSearchHits(params.Query, candidates, &entity, params.Limit)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stages)
+	json.NewEncoder(w).Encode(hits)
 }
 
 // GetStageInfoHandler returns the stage info for a given stage.
@@ -85,7 +565,7 @@ func GetAllStagesHandler(
 // Dynamic Query Segments:
 // - stage_id: the stage ID as an integer
 func GetStageInfoHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -113,7 +593,7 @@ func GetStageInfoHandler(
 // Required Query Parameters:
 // - f: the field to get as a string
 func GetStageInfoFieldHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	// Get the stage info
 	stage_id, err := GetStageIDFromRequest(r)
@@ -139,8 +619,23 @@ func GetStageInfoFieldHandler(
 //
 // Dynamic Query Segments:
 // - stage_id: the stage ID as an integer
+//
+// Optional Query Parameters:
+// - tolerance: the simplification tolerance in meters as a float. Defaults to
+// 0, which returns the track at full resolution.
+// - zoom: the web mercator zoom level the track will be displayed at as an
+// integer. Sets the tolerance to one pixel at that zoom level. Cannot be
+// combined with tolerance.
+// - precision: the maximum number of decimal places in the coordinates as an
+// integer. Defaults to 9.
+// - format: geometry to return a GeoJSON LineString, or feature to return a
+// GeoJSON Feature with the stage info, profile summary and track source as
+// properties. Defaults to geometry.
+//
+// The number of points in the returned track is set in the X-Track-Points
+// header.
 func GetStageTrackHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -148,7 +643,110 @@ func GetStageTrackHandler(
 		return
 	}
 
-	track, err := conn.GetTrack(context.Background(), stage_id)
+	simplification, err := GetTrackSimplificationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := GetTrackFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	track, err := conn.GetTrack(
+		context.Background(), db.TrackQueryParams{
+			StageID:             stage_id,
+			TrackSimplification: simplification,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := []byte(track.GeoJSON)
+	if format == formatFeature {
+		feature, err := GetStageTrackFeature(conn, stage_id, track)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body, err = json.Marshal(feature)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(trackPointsHeader, strconv.Itoa(track.NumPoints))
+
+	WriteCompressed(w, r, body)
+}
+
+// GetRaceTracksHandler returns the tracks of every stage in a race as a GeoJSON
+// FeatureCollection, with the stage info, profile summary and track source of
+// each stage as properties.
+//
+// Dynamic Query Segments:
+// - race_id: the race ID as an integer
+//
+// Optional Query Parameters:
+// - tolerance, zoom, precision: as for GetStageTrackHandler
+//
+// The total number of points in the returned tracks is set in the
+// X-Track-Points header.
+func GetRaceTracksHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	race_id, err := GetRaceIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	simplification, err := GetTrackSimplificationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tracks, err := conn.GetRaceTracks(
+		context.Background(), db.RaceTracksQueryParams{
+			RaceID:              race_id,
+			TrackSimplification: simplification,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	profiles, err := conn.GetRaceElevationProfiles(
+		context.Background(), race_id,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	numPoints := 0
+	features := make([]Feature[StageTrackProperties], len(tracks))
+	for i, track := range tracks {
+		features[i] = NewStageTrackFeature(
+			track.StageID,
+			track.StageInfo,
+			track.Track,
+			track.TrackMetadata,
+			profiles[track.StageID],
+		)
+		numPoints += track.NumPoints
+	}
+
+	body, err := json.Marshal(NewFeatureCollection(features))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -156,17 +754,146 @@ func GetStageTrackHandler(
 
 	w.Header().Set("Cache-Control", "public, max-age=3600")
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(trackPointsHeader, strconv.Itoa(numPoints))
+
+	WriteCompressed(w, r, body)
+}
+
+// GetStageTrackGPXHandler returns the track for a given stage as a GPX file.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+//
+// Optional Query Parameters:
+// - climbs: whether to add a waypoint at the top of each detected climb as a
+// boolean. Defaults to false.
+func GetStageTrackGPXHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id, err := GetStageIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withClimbs, err := GetClimbsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	track, err := GetStageTrack(conn, stage_id, withClimbs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fileName, err := track.FileName("gpx")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	SetAttachmentHeaders(w, gpx.ContentType, fileName)
+	NewStageGPX(track).Write(w)
+}
+
+// GetStageTrackKMLHandler returns the track for a given stage as a KML file.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+//
+// Optional Query Parameters:
+// - climbs: whether to add a point at the top of each detected climb as a
+// boolean. Defaults to false.
+func GetStageTrackKMLHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id, err := GetStageIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withClimbs, err := GetClimbsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	track, err := GetStageTrack(conn, stage_id, withClimbs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fileName, err := track.FileName("kml")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	SetAttachmentHeaders(w, kml.ContentType, fileName)
+	NewStageKML(track).Write(w)
+}
+
+// GetStageGeometrySummaryHandler returns the bounding box, start, finish and
+// centroid of the track for a given stage.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+func GetStageGeometrySummaryHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id, err := GetStageIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := conn.GetGeometrySummary(context.Background(), stage_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(summary)
+}
 
-	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
+// GetTileHandler returns a Mapbox Vector Tile of all the stage tracks in a web
+// mercator tile. Each feature has stage_id, grand_tour, year and stage_number
+// attributes.
+//
+// Dynamic Query Segments:
+// - z: the zoom level as an integer
+// - x: the tile column as an integer
+// - y: the tile row as an integer, with a .mvt extension
+//
+// Optional Query Parameters:
+// - grand_tour: only include stages from this grand tour
+// - year: only include stages from this year as an integer
+// - stage_type: only include stages of this type
+func GetTileHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	params, err := GetTileFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		gz.Write([]byte(track))
+	tile, err := GetTile(conn, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Write([]byte(track))
+	w.Header().Set("Content-Type", tileContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	WriteCompressed(w, r, tile)
 }
 
 // GetStageElevationHandler returns the raw elevation profile for a given stage.
@@ -174,7 +901,7 @@ func GetStageTrackHandler(
 // Dynamic Query Segments:
 // - stage_id: the stage ID as an integer
 func GetStageElevationHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -204,7 +931,7 @@ func GetStageElevationHandler(
 // - resolution: the resolution of the gradient profile as a float in meters.
 // Defaults to 10.
 func GetStageGradientHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -241,8 +968,11 @@ func GetStageGradientHandler(
 //
 // Optional Query Parameters:
 // - topN: the number of results to return as an integer. Defaults to 1000.
+// - time_format: duration (default) or cycling, e.g. 4:32:10, +1:23, s.t.
+// - include_status: if true, riders and teams without a valid rank (DNF, DNS,
+// OTL, DSQ, ...) are appended unranked with their status. Defaults to false.
 func GetResultsHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -267,6 +997,18 @@ func GetResultsHandler(
 		return
 	}
 
+	includeStatus, err := GetIncludeStatusFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	dbResults, err := conn.GetResults(
 		context.Background(), db.ResultsQueryParams{
 			StageID: stage_id,
@@ -278,14 +1020,40 @@ func GetResultsHandler(
 		return
 	}
 
-	results := NewResults(dbResults)
+	results := NewResults(dbResults, format)
+
+	if includeStatus {
+		nonFinishers, err := conn.GetNonFinishers(
+			context.Background(), db.NonFinishersQueryParams{
+				StageID:        stage_id,
+				Classification: nil,
+			},
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, NewNonFinisherResults(nonFinishers)...)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
 
+// GetResultsForClassificationHandler returns the top N results for a given
+// stage and classification.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+// - classification: the classification
+//
+// Optional Query Parameters:
+// - topN: the number of results to return as an integer. Defaults to 1000.
+// - time_format: duration (default) or cycling, e.g. 4:32:10, +1:23, s.t.
+// - include_status: if true, riders and teams without a valid rank (DNF, DNS,
+// OTL, DSQ, ...) are appended unranked with their status. Defaults to false.
 func GetResultsForClassificationHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -315,6 +1083,18 @@ func GetResultsForClassificationHandler(
 		return
 	}
 
+	includeStatus, err := GetIncludeStatusFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	dbResults, err := conn.GetResultsForClassification(
 		context.Background(), db.GetResultsForClassificationParams{
 			StageID:        stage_id,
@@ -327,18 +1107,68 @@ func GetResultsForClassificationHandler(
 		return
 	}
 
-	results := NewResults(dbResults)
+	results := NewResults(dbResults, format)
 
-	fmt.Println(results)
+	if includeStatus {
+		nonFinishers, err := conn.GetNonFinishers(
+			context.Background(), db.NonFinishersQueryParams{
+				StageID:        stage_id,
+				Classification: &classification,
+			},
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, NewNonFinisherResults(nonFinishers)...)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
 
+// GetNonFinishersHandler returns the riders and teams without a valid rank in
+// a given stage, with their status.
+//
+// Dynamic Query Segments:
+// - stage_id: the stage ID as an integer
+//
+// Optional Query Parameters:
+// - classification: only return non-finishers in this classification
+func GetNonFinishersHandler(
+	w http.ResponseWriter, r *http.Request, conn db.Store,
+) {
+	stage_id, err := GetStageIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	classification, err := GetOptionalClassificationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nonFinishers, err := conn.GetNonFinishers(
+		context.Background(), db.NonFinishersQueryParams{
+			StageID:        stage_id,
+			Classification: classification,
+		},
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewNonFinisherResults(nonFinishers))
+}
+
 // GetCorrectResultHandler returns the correct rider/team for a given stage,
 // rank and classification.
 func GetResultForRankAndClassificationHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -358,6 +1188,12 @@ func GetResultForRankAndClassificationHandler(
 		return
 	}
 
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	dbResult, err := conn.GetResultForRankAndClassification(
 		context.Background(), db.GetResultForRankAndClassificationParams{
 			StageID:        stage_id,
@@ -370,14 +1206,14 @@ func GetResultForRankAndClassificationHandler(
 		return
 	}
 
-	result := NewResult(dbResult)
+	result := NewResult(dbResult, format)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
 func GetResultFieldForRankAndClassificationHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -403,6 +1239,12 @@ func GetResultFieldForRankAndClassificationHandler(
 		return
 	}
 
+	format, err := GetTimeFormatFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	dbResult, err := conn.GetResultForRankAndClassification(
 		context.Background(), db.GetResultForRankAndClassificationParams{
 			StageID:        stage_id,
@@ -415,7 +1257,7 @@ func GetResultFieldForRankAndClassificationHandler(
 		return
 	}
 
-	result := NewResult(dbResult)
+	result := NewResult(dbResult, format)
 
 	fieldValue, err := lib.GetFieldByTag(result, "json", field)
 	if err != nil {
@@ -428,7 +1270,7 @@ func GetResultFieldForRankAndClassificationHandler(
 }
 
 func GetResultNameForRankAndClassificationHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -475,7 +1317,7 @@ func GetResultNameForRankAndClassificationHandler(
 // Dynamic Query Segments:
 // - stage_id: the stage ID as an integer
 func GetRidersHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -498,7 +1340,7 @@ func GetRidersHandler(
 // Dynamic Query Segments:
 // - stage_id: the stage ID as an integer
 func GetTeamsHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
@@ -519,7 +1361,7 @@ func GetTeamsHandler(
 // VerifyInfoHandler verifies a guess for a given stage info field against the
 // database.
 func VerifyInfoHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	// Get the stage info
 	stage_id, err := GetStageIDFromRequest(r)
@@ -575,7 +1417,7 @@ func VerifyInfoHandler(
 // VerifyResultHandler verifies a rider/team answer for a given stage, rank and
 // classification against the database.
 func VerifyResultHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	// Get Stage ID
 	stage_id, err := GetStageIDFromRequest(r)
@@ -642,7 +1484,7 @@ func VerifyResultHandler(
 }
 
 func GetValidResultsCountHandler(
-	w http.ResponseWriter, r *http.Request, conn *db.Queries,
+	w http.ResponseWriter, r *http.Request, conn db.Store,
 ) {
 	stage_id, err := GetStageIDFromRequest(r)
 	if err != nil {
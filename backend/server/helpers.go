@@ -1,14 +1,19 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/michaelbennett99/stagehunter/backend/db"
 	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
 func GetInfoField(
-	conn *db.Queries, stage_id int, field string,
+	conn db.Store, stage_id int, field string,
 ) (any, error) {
 	stage_info, err := conn.GetStageInfo(context.Background(), stage_id)
 	if err != nil {
@@ -22,3 +27,148 @@ func GetInfoField(
 
 	return v.Interface(), nil
 }
+
+// WriteCompressed writes the body to the response, gzip compressed if the
+// client accepts it.
+func WriteCompressed(w http.ResponseWriter, r *http.Request, body []byte) {
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+
+		gz.Write(body)
+		return
+	}
+
+	w.Write(body)
+}
+
+var tileCache = lib.NewCache[string, []byte](
+	tileCacheSize, tileCacheTTL,
+)
+
+// tileCacheKey returns the cache key for the tile query parameters, with the
+// filters dereferenced so that equal requests share a cache entry.
+func tileCacheKey(params db.TileQueryParams) string {
+	return fmt.Sprintf(
+		"%d/%d/%d?%s&%s&%s",
+		params.Z, params.X, params.Y,
+		optionalString(params.GrandTour),
+		optionalString(params.Year),
+		optionalString(params.StageType),
+	)
+}
+
+func optionalString[T any](value *T) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(*value)
+}
+
+// GetTile returns the vector tile for the given parameters, from the tile
+// cache if possible.
+func GetTile(conn db.Store, params db.TileQueryParams) ([]byte, error) {
+	key := tileCacheKey(params)
+	if tile, ok := tileCache.Get(key); ok {
+		return tile, nil
+	}
+	tile, err := conn.GetTile(context.Background(), params)
+	if err != nil {
+		return nil, err
+	}
+	tileCache.Set(key, tile)
+	return tile, nil
+}
+
+// ClearCaches empties the tile and search caches, after the race data has
+// changed.
+func ClearCaches() {
+	tileCache.Clear()
+	searchCache.Clear()
+}
+
+// GetStageTrackFeature loads the info, track metadata and elevation profile of
+// a stage and returns its track as a GeoJSON Feature.
+func GetStageTrackFeature(
+	conn db.Store, stageID int, track db.Track,
+) (Feature[StageTrackProperties], error) {
+	info, err := conn.GetStageInfo(context.Background(), stageID)
+	if err != nil {
+		return Feature[StageTrackProperties]{}, err
+	}
+	metadata, err := conn.GetTrackMetadata(context.Background(), stageID)
+	if err != nil {
+		return Feature[StageTrackProperties]{}, err
+	}
+	profile, err := conn.GetElevationProfile(context.Background(), stageID)
+	if err != nil {
+		return Feature[StageTrackProperties]{}, err
+	}
+	return NewStageTrackFeature(stageID, info, track, metadata, profile), nil
+}
+
+var searchCache = lib.NewCache[string, []db.SearchCandidate](
+	searchCacheSize, searchCacheTTL,
+)
+
+// GetSearchCandidates returns the riders, teams and towns of a stage, or of
+// all stages if the stage ID is nil, from the search cache if possible.
+func GetSearchCandidates(
+	conn db.Store, stageID *int,
+) ([]db.SearchCandidate, error) {
+	key := optionalString(stageID)
+	if candidates, ok := searchCache.Get(key); ok {
+		return candidates, nil
+	}
+	candidates, err := conn.GetSearchCandidates(
+		context.Background(), db.SearchCandidatesQueryParams{StageID: stageID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	searchCache.Set(key, candidates)
+	return candidates, nil
+}
+
+// RankSearchHits scores the candidates of the given type, or of any type if
+// nil, against the query and returns the best matching, at most limit, best
+// first.
+func RankSearchHits(
+	query string,
+	candidates []db.SearchCandidate,
+	entity *db.SearchEntity,
+	limit int,
+) []SearchHit {
+	hits := []SearchHit{}
+	for _, candidate := range candidates {
+		if entity != nil && candidate.Type != *entity {
+			continue
+		}
+		score := lib.MatchScore(query, candidate.Name)
+		if score < searchMinScore {
+			continue
+		}
+		hit := SearchHit{
+			Type:  candidate.Type,
+			Name:  candidate.Name,
+			Score: score,
+		}
+		if candidate.ID.Valid {
+			id := candidate.ID.Int64
+			hit.ID = &id
+		}
+		hits = append(hits, hit)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Name < hits[j].Name
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -48,6 +51,7 @@ func SetCORSHeaders(next http.HandlerFunc) http.HandlerFunc {
 			"Access-Control-Allow-Headers",
 			"Accept, Content-Type, Content-Length, Accept-Encoding",
 		)
+		w.Header().Set("Access-Control-Expose-Headers", trackPointsHeader)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight requests
@@ -59,3 +63,44 @@ func SetCORSHeaders(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// RequireAdminToken only lets requests through that carry the admin token,
+// read from the ADMIN_TOKEN environment variable, as a bearer token. The
+// admin API is disabled when no token is set.
+func RequireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv(adminTokenEnv)
+		if token == "" {
+			http.Error(w, "admin API is disabled", http.StatusNotFound)
+			return
+		}
+
+		given, ok := strings.CutPrefix(
+			r.Header.Get("Authorization"), "Bearer ",
+		)
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ClearCachesOnChange clears the caches of the race data after an admin
+// request that changed it, i.e. a successful request other than GET, so that
+// the change is seen at once rather than when the entries expire.
+func ClearCachesOnChange(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			next(w, r)
+			return
+		}
+		responseWriter := newResponseWriter(w)
+		next(responseWriter, r)
+		if responseWriter.statusCode < 300 {
+			ClearCaches()
+		}
+	}
+}
@@ -154,6 +154,22 @@ func NewFloatQueryParam(name string) *URLQueryParam[float64] {
 	return NewQueryParam(name, coerceFloat64)
 }
 
+// NewOptionalQueryParam returns a parameter whose value is nil when it is not
+// present in the request.
+func NewOptionalQueryParam[T any](
+	name string, coerce func(string) (T, error),
+) *URLQueryParam[*T] {
+	var defaultValue *T
+	coerceOptional := func(value string) (*T, error) {
+		v, err := coerce(value)
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}
+	return NewQueryParamWithDefault(name, coerceOptional, &defaultValue)
+}
+
 //
 // Helpers
 //
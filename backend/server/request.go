@@ -2,10 +2,16 @@ package server
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
 // GetStageIDFromRequest returns the stage ID from the last segment of the URL.
@@ -54,3 +60,555 @@ func GetResultFieldFromRequest(r *http.Request) (string, error) {
 	}
 	return value, nil
 }
+
+// GetTrackSimplificationFromRequest returns the track simplification from the
+// tolerance, zoom and precision query parameters of the request.
+func GetTrackSimplificationFromRequest(
+	r *http.Request,
+) (db.TrackSimplification, error) {
+	toleranceParam := NewFloatQueryParamWithDefault(
+		toleranceName, toleranceDefault,
+	)
+	zoomParam := NewIntQueryParamWithDefault(zoomName, zoomDefault)
+	precisionParam := NewIntQueryParamWithDefault(
+		precisionName, precisionDefault,
+	)
+	queryParams, found, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{toleranceParam, zoomParam, precisionParam},
+	)
+	if err != nil {
+		return db.TrackSimplification{}, err
+	}
+
+	tolerance, err := GetParamValue[float64](queryParams[toleranceName])
+	if err != nil {
+		return db.TrackSimplification{}, err
+	}
+	if tolerance < 0 {
+		return db.TrackSimplification{}, errors.New(
+			"tolerance cannot be negative",
+		)
+	}
+
+	if slices.Contains(found, zoomName) {
+		if slices.Contains(found, toleranceName) {
+			return db.TrackSimplification{}, errors.New(
+				"only one of tolerance and zoom can be specified",
+			)
+		}
+		zoom, err := GetParamValue[int](queryParams[zoomName])
+		if err != nil {
+			return db.TrackSimplification{}, err
+		}
+		if zoom < 0 || zoom > zoomMax {
+			return db.TrackSimplification{}, fmt.Errorf(
+				"zoom must be between 0 and %d", zoomMax,
+			)
+		}
+		tolerance = lib.ZoomTolerance(zoom)
+	}
+
+	precision, err := GetParamValue[int](queryParams[precisionName])
+	if err != nil {
+		return db.TrackSimplification{}, err
+	}
+	if precision < 0 || precision > precisionMax {
+		return db.TrackSimplification{}, fmt.Errorf(
+			"precision must be between 0 and %d", precisionMax,
+		)
+	}
+
+	return db.TrackSimplification{
+		Tolerance: tolerance,
+		Precision: precision,
+	}, nil
+}
+
+// GetTrackFormatFromRequest returns the track format from the format query
+// parameter, either geometry or feature.
+func GetTrackFormatFromRequest(r *http.Request) (string, error) {
+	formatParam := NewStringQueryParamWithDefault(formatName, formatGeometry)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{formatParam},
+	)
+	if err != nil {
+		return "", err
+	}
+	format, err := GetParamValue[string](queryParams[formatName])
+	if err != nil {
+		return "", err
+	}
+	if format != formatGeometry && format != formatFeature {
+		return "", fmt.Errorf(
+			"format must be %s or %s", formatGeometry, formatFeature,
+		)
+	}
+	return format, nil
+}
+
+// GetRaceIDFromRequest returns the race ID from the URL.
+func GetRaceIDFromRequest(r *http.Request) (int, error) {
+	value := r.PathValue(RaceID)
+	if value == "" {
+		return 0, errors.New("race ID is required")
+	}
+	return strconv.Atoi(value)
+}
+
+func GetRiderIDFromRequest(r *http.Request) (int, error) {
+	value := r.PathValue(RiderID)
+	if value == "" {
+		return 0, errors.New("rider ID is required")
+	}
+	return strconv.Atoi(value)
+}
+
+func GetOtherRiderIDFromRequest(r *http.Request) (int, error) {
+	value := r.PathValue(OtherRiderID)
+	if value == "" {
+		return 0, errors.New("other rider ID is required")
+	}
+	return strconv.Atoi(value)
+}
+
+func GetTeamIDFromRequest(r *http.Request) (int, error) {
+	value := r.PathValue(TeamID)
+	if value == "" {
+		return 0, errors.New("team ID is required")
+	}
+	return strconv.Atoi(value)
+}
+
+// GetClimbsFromRequest returns whether climbs were requested with the climbs
+// query parameter.
+func GetClimbsFromRequest(r *http.Request) (bool, error) {
+	climbsParam := NewBoolQueryParamWithDefault(climbsName, climbsDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{climbsParam},
+	)
+	if err != nil {
+		return false, err
+	}
+	return GetParamValue[bool](queryParams[climbsName])
+}
+
+// GetTileFromRequest returns the tile coordinates from the z, x and y segments
+// of the URL, and the stage filters from the grand_tour, year and stage_type
+// query parameters. The y segment must have a .mvt extension.
+func GetTileFromRequest(r *http.Request) (db.TileQueryParams, error) {
+	z, err := strconv.Atoi(r.PathValue(TileZ))
+	if err != nil {
+		return db.TileQueryParams{}, errors.New("invalid tile zoom")
+	}
+	if z < 0 || z > zoomMax {
+		return db.TileQueryParams{}, fmt.Errorf(
+			"tile zoom must be between 0 and %d", zoomMax,
+		)
+	}
+
+	x, err := strconv.Atoi(r.PathValue(TileX))
+	if err != nil {
+		return db.TileQueryParams{}, errors.New("invalid tile x")
+	}
+
+	yValue, ok := strings.CutSuffix(r.PathValue(TileY), tileExtension)
+	if !ok {
+		return db.TileQueryParams{}, fmt.Errorf(
+			"tile must have a %s extension", tileExtension,
+		)
+	}
+	y, err := strconv.Atoi(yValue)
+	if err != nil {
+		return db.TileQueryParams{}, errors.New("invalid tile y")
+	}
+
+	maxIndex := int(math.Pow(2, float64(z)))
+	if x < 0 || x >= maxIndex || y < 0 || y >= maxIndex {
+		return db.TileQueryParams{}, fmt.Errorf(
+			"tile x and y must be between 0 and %d at zoom %d", maxIndex-1, z,
+		)
+	}
+
+	grandTourParam := NewOptionalQueryParam(grandTourName, db.ParseGrandTour)
+	yearParam := NewOptionalQueryParam(yearName, coerceInt)
+	stageTypeParam := NewOptionalQueryParam(stageTypeName, db.ParseStageType)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{grandTourParam, yearParam, stageTypeParam},
+	)
+	if err != nil {
+		return db.TileQueryParams{}, err
+	}
+
+	grandTour, err := GetParamValue[*db.GrandTour](queryParams[grandTourName])
+	if err != nil {
+		return db.TileQueryParams{}, err
+	}
+	year, err := GetParamValue[*int](queryParams[yearName])
+	if err != nil {
+		return db.TileQueryParams{}, err
+	}
+	stageType, err := GetParamValue[*db.StageType](queryParams[stageTypeName])
+	if err != nil {
+		return db.TileQueryParams{}, err
+	}
+
+	return db.TileQueryParams{
+		Z:         z,
+		X:         x,
+		Y:         y,
+		GrandTour: grandTour,
+		Year:      year,
+		StageType: stageType,
+	}, nil
+}
+
+// GetStageNumberFromRequest returns the stage number from the URL.
+func GetStageNumberFromRequest(r *http.Request) (int, error) {
+	value := r.PathValue(StageNumber)
+	if value == "" {
+		return 0, errors.New("stage number is required")
+	}
+	return strconv.Atoi(value)
+}
+
+// GetRacesQueryParamsFromRequest returns the race filters from the grand_tour
+// and year query parameters.
+func GetRacesQueryParamsFromRequest(
+	r *http.Request,
+) (db.RacesQueryParams, error) {
+	grandTourParam := NewOptionalQueryParam(grandTourName, db.ParseGrandTour)
+	yearParam := NewOptionalQueryParam(yearName, coerceInt)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{grandTourParam, yearParam},
+	)
+	if err != nil {
+		return db.RacesQueryParams{}, err
+	}
+
+	grandTour, err := GetParamValue[*db.GrandTour](queryParams[grandTourName])
+	if err != nil {
+		return db.RacesQueryParams{}, err
+	}
+	year, err := GetParamValue[*int](queryParams[yearName])
+	if err != nil {
+		return db.RacesQueryParams{}, err
+	}
+
+	return db.RacesQueryParams{GrandTour: grandTour, Year: year}, nil
+}
+
+// GetStagePageQueryParamsFromRequest returns the pagination, filter and sort
+// parameters for a page of stages from the query parameters.
+func GetStagePageQueryParamsFromRequest(
+	r *http.Request,
+) (db.StagePageQueryParams, error) {
+	limitParam := NewIntQueryParamWithDefault(limitName, limitDefault)
+	cursorParam := NewOptionalQueryParam(cursorName, db.DecodeStageCursor)
+	sortParam := NewStringQueryParamWithDefault(sortName, sortDefault)
+	orderParam := NewStringQueryParamWithDefault(orderName, orderDefault)
+	grandTourParam := NewOptionalQueryParam(grandTourName, db.ParseGrandTour)
+	minYearParam := NewOptionalQueryParam(minYearName, coerceInt)
+	maxYearParam := NewOptionalQueryParam(maxYearName, coerceInt)
+	stageTypeParam := NewOptionalQueryParam(stageTypeName, db.ParseStageType)
+	minLengthParam := NewOptionalQueryParam(minLengthName, coerceFloat64)
+	maxLengthParam := NewOptionalQueryParam(maxLengthName, coerceFloat64)
+	townParam := NewOptionalQueryParam(townName, coerceString)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{
+			limitParam,
+			cursorParam,
+			sortParam,
+			orderParam,
+			grandTourParam,
+			minYearParam,
+			maxYearParam,
+			stageTypeParam,
+			minLengthParam,
+			maxLengthParam,
+			townParam,
+		},
+	)
+	if err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+
+	limit, err := GetParamValue[int](queryParams[limitName])
+	if err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if limit < 1 || limit > limitMax {
+		return db.StagePageQueryParams{}, fmt.Errorf(
+			"limit must be between 1 and %d", limitMax,
+		)
+	}
+
+	sortValue, err := GetParamValue[string](queryParams[sortName])
+	if err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	sort := db.StageSort(sortValue)
+	if !sort.IsValid() {
+		return db.StagePageQueryParams{}, errors.New("invalid sort")
+	}
+
+	order, err := GetParamValue[string](queryParams[orderName])
+	if err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if order != orderAsc && order != orderDesc {
+		return db.StagePageQueryParams{}, fmt.Errorf(
+			"order must be %s or %s", orderAsc, orderDesc,
+		)
+	}
+
+	params := db.StagePageQueryParams{
+		Limit: limit,
+		Sort:  sort,
+		Desc:  order == orderDesc,
+	}
+	if params.Cursor, err = GetParamValue[*db.StageCursor](
+		queryParams[cursorName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.Cursor != nil &&
+		(params.Cursor.Sort != params.Sort || params.Cursor.Desc != params.Desc) {
+		return db.StagePageQueryParams{}, errors.New(
+			"cursor does not match the sort order",
+		)
+	}
+	if params.GrandTour, err = GetParamValue[*db.GrandTour](
+		queryParams[grandTourName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.MinYear, err = GetParamValue[*int](
+		queryParams[minYearName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.MaxYear, err = GetParamValue[*int](
+		queryParams[maxYearName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.StageType, err = GetParamValue[*db.StageType](
+		queryParams[stageTypeName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.MinLength, err = GetParamValue[*float64](
+		queryParams[minLengthName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.MaxLength, err = GetParamValue[*float64](
+		queryParams[maxLengthName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+	if params.Town, err = GetParamValue[*string](
+		queryParams[townName],
+	); err != nil {
+		return db.StagePageQueryParams{}, err
+	}
+
+	return params, nil
+}
+
+// GetTimeFormatFromRequest returns the format for times and gaps in results
+// from the time_format query parameter, either duration or cycling.
+func GetTimeFormatFromRequest(r *http.Request) (TimeFormat, error) {
+	formatParam := NewStringQueryParamWithDefault(timeFormatName, timeFormatDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{formatParam},
+	)
+	if err != nil {
+		return "", err
+	}
+	value, err := GetParamValue[string](queryParams[timeFormatName])
+	if err != nil {
+		return "", err
+	}
+	format := TimeFormat(value)
+	if !format.IsValid() {
+		return "", fmt.Errorf(
+			"time_format must be %s or %s",
+			TimeFormatDuration, TimeFormatCycling,
+		)
+	}
+	return format, nil
+}
+
+// GetIncludeStatusFromRequest returns whether riders and teams without a valid
+// rank should be included in results, from the include_status query parameter.
+func GetIncludeStatusFromRequest(r *http.Request) (bool, error) {
+	includeStatusParam := NewBoolQueryParamWithDefault(
+		includeStatusName, includeStatusDefault,
+	)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{includeStatusParam},
+	)
+	if err != nil {
+		return false, err
+	}
+	return GetParamValue[bool](queryParams[includeStatusName])
+}
+
+// GetOptionalClassificationFromRequest returns the classification from the
+// classification query parameter, or nil if it is not given.
+func GetOptionalClassificationFromRequest(
+	r *http.Request,
+) (*db.Classification, error) {
+	value := r.URL.Query().Get(classificationName)
+	if value == "" {
+		return nil, nil
+	}
+	classification := db.Classification(value)
+	if !classification.IsValid() {
+		return nil, errors.New("invalid result classification")
+	}
+	return &classification, nil
+}
+
+// GetRiderSearchQueryParamsFromRequest returns the rider name search from the
+// q query parameter and the maximum number of riders from the limit query
+// parameter.
+func GetRiderSearchQueryParamsFromRequest(
+	r *http.Request,
+) (db.RiderSearchQueryParams, error) {
+	searchParam := NewStringQueryParamWithDefault(searchQueryName, "")
+	limitParam := NewIntQueryParamWithDefault(limitName, limitDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		nil,
+		[]QueryParamInterface{searchParam, limitParam},
+	)
+	if err != nil {
+		return db.RiderSearchQueryParams{}, err
+	}
+
+	search, err := GetParamValue[string](queryParams[searchQueryName])
+	if err != nil {
+		return db.RiderSearchQueryParams{}, err
+	}
+	limit, err := GetParamValue[int](queryParams[limitName])
+	if err != nil {
+		return db.RiderSearchQueryParams{}, err
+	}
+	if limit < 1 || limit > limitMax {
+		return db.RiderSearchQueryParams{}, fmt.Errorf(
+			"limit must be between 1 and %d", limitMax,
+		)
+	}
+
+	return db.RiderSearchQueryParams{
+		Query: strings.TrimSpace(search),
+		Limit: limit,
+	}, nil
+}
+
+// GetSearchQueryParamsFromRequest returns the search from the required q query
+// parameter, and the optional type, stage and limit query parameters.
+func GetSearchQueryParamsFromRequest(
+	r *http.Request,
+) (SearchQueryParams, error) {
+	searchParam := NewStringQueryParam(searchQueryName)
+	typeParam := NewOptionalQueryParam(searchTypeName, db.ParseSearchEntity)
+	stageParam := NewOptionalQueryParam(stageName, coerceInt)
+	limitParam := NewIntQueryParamWithDefault(limitName, searchLimitDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		[]QueryParamInterface{searchParam},
+		[]QueryParamInterface{typeParam, stageParam, limitParam},
+	)
+	if err != nil {
+		return SearchQueryParams{}, err
+	}
+
+	var params SearchQueryParams
+	if params.Query, err = GetParamValue[string](
+		queryParams[searchQueryName],
+	); err != nil {
+		return SearchQueryParams{}, err
+	}
+	if params.Type, err = GetParamValue[*db.SearchEntity](
+		queryParams[searchTypeName],
+	); err != nil {
+		return SearchQueryParams{}, err
+	}
+	if params.StageID, err = GetParamValue[*int](
+		queryParams[stageName],
+	); err != nil {
+		return SearchQueryParams{}, err
+	}
+	if params.Limit, err = GetParamValue[int](
+		queryParams[limitName],
+	); err != nil {
+		return SearchQueryParams{}, err
+	}
+	if params.Limit < 1 || params.Limit > limitMax {
+		return SearchQueryParams{}, fmt.Errorf(
+			"limit must be between 1 and %d", limitMax,
+		)
+	}
+	return params, nil
+}
+
+// GetAutocompleteQueryParamsFromRequest returns the partial guess from the
+// required q query parameter, and the optional limit query parameter.
+func GetAutocompleteQueryParamsFromRequest(
+	r *http.Request,
+) (AutocompleteQueryParams, error) {
+	searchParam := NewStringQueryParam(searchQueryName)
+	limitParam := NewIntQueryParamWithDefault(limitName, searchLimitDefault)
+	queryParams, _, _, err := GetQueryParams(
+		r,
+		[]QueryParamInterface{searchParam},
+		[]QueryParamInterface{limitParam},
+	)
+	if err != nil {
+		return AutocompleteQueryParams{}, err
+	}
+
+	var params AutocompleteQueryParams
+	if params.Query, err = GetParamValue[string](
+		queryParams[searchQueryName],
+	); err != nil {
+		return AutocompleteQueryParams{}, err
+	}
+	if utf8.RuneCountInString(
+		strings.TrimSpace(params.Query),
+	) < autocompleteQueryMinLength {
+		return AutocompleteQueryParams{}, fmt.Errorf(
+			"q must be at least %d characters", autocompleteQueryMinLength,
+		)
+	}
+	if params.Limit, err = GetParamValue[int](
+		queryParams[limitName],
+	); err != nil {
+		return AutocompleteQueryParams{}, err
+	}
+	if params.Limit < 1 || params.Limit > autocompleteLimitMax {
+		return AutocompleteQueryParams{}, fmt.Errorf(
+			"limit must be between 1 and %d", autocompleteLimitMax,
+		)
+	}
+	return params, nil
+}
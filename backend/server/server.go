@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/michaelbennett99/stagehunter/backend/db"
 )
 
@@ -23,37 +22,60 @@ func DefaultServerConfig() ServerConfig {
 func addRoute(
 	mux *http.ServeMux,
 	path string,
-	pool *pgxpool.Pool,
-	handler func(http.ResponseWriter, *http.Request, *db.Queries),
+	store db.Store,
+	handler func(http.ResponseWriter, *http.Request, db.Store),
+	middleware ...func(http.HandlerFunc) http.HandlerFunc,
 ) {
 	mux.HandleFunc(
 		path,
 		HandlerMiddleware(
-			MakeHandler(pool, handler),
-			AddRequestLogger,
-			SetCORSHeaders,
+			MakeHandler(store, handler),
+			append(middleware, AddRequestLogger, SetCORSHeaders)...,
 		),
 	)
 }
 
 type Route struct {
+	method    string
 	baseRoute string
 	path      string
-	handler   func(http.ResponseWriter, *http.Request, *db.Queries)
+	handler   func(http.ResponseWriter, *http.Request, db.Store)
+	admin     bool
 }
 
+// FullPath returns the pattern of the route, prefixed with its method if it
+// only matches one.
 func (r *Route) FullPath() string {
+	if r.method != "" {
+		return fmt.Sprintf("%s %s%s", r.method, r.baseRoute, r.path)
+	}
 	return fmt.Sprintf("%s%s", r.baseRoute, r.path)
 }
 
 func NewRoute(
 	path string,
-	handler func(http.ResponseWriter, *http.Request, *db.Queries),
+	handler func(http.ResponseWriter, *http.Request, db.Store),
 ) Route {
-	return Route{baseRoute, path, handler}
+	return Route{baseRoute: baseRoute, path: path, handler: handler}
 }
 
-func NewServer(pool *pgxpool.Pool, config ServerConfig) *http.Server {
+// NewAdminRoute creates a route of the admin API, which matches only the
+// given method and requires the admin token.
+func NewAdminRoute(
+	method string,
+	path string,
+	handler func(http.ResponseWriter, *http.Request, db.Store),
+) Route {
+	return Route{
+		method:    method,
+		baseRoute: baseRoute,
+		path:      path,
+		handler:   handler,
+		admin:     true,
+	}
+}
+
+func NewServer(store db.Store, config ServerConfig) *http.Server {
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.Port),
 		Handler: http.NewServeMux(),
@@ -77,6 +99,18 @@ func NewServer(pool *pgxpool.Pool, config ServerConfig) *http.Server {
 			fmt.Sprintf("/stages/{%s}/track", StageID),
 			GetStageTrackHandler,
 		),
+		NewRoute(
+			fmt.Sprintf("/stages/{%s}/track.gpx", StageID),
+			GetStageTrackGPXHandler,
+		),
+		NewRoute(
+			fmt.Sprintf("/stages/{%s}/track.kml", StageID),
+			GetStageTrackKMLHandler,
+		),
+		NewRoute(
+			fmt.Sprintf("/stages/{%s}/geometry/summary", StageID),
+			GetStageGeometrySummaryHandler,
+		),
 		NewRoute(
 			fmt.Sprintf("/stages/{%s}/elevation", StageID),
 			GetStageElevationHandler,
@@ -89,6 +123,10 @@ func NewServer(pool *pgxpool.Pool, config ServerConfig) *http.Server {
 			fmt.Sprintf("/stages/{%s}/results", StageID),
 			GetResultsHandler,
 		),
+		NewRoute(
+			fmt.Sprintf("/stages/{%s}/nonfinishers", StageID),
+			GetNonFinishersHandler,
+		),
 		NewRoute(
 			fmt.Sprintf("/stages/{%s}/riders", StageID),
 			GetRidersHandler,
@@ -121,6 +159,13 @@ func NewServer(pool *pgxpool.Pool, config ServerConfig) *http.Server {
 			),
 			GetResultNameForRankAndClassificationHandler,
 		),
+		NewRoute(
+			fmt.Sprintf(
+				"/stages/{%s}/autocomplete/{%s}",
+				StageID, ResultClassification,
+			),
+			GetAutocompleteHandler,
+		),
 		NewRoute(
 			fmt.Sprintf("/stages/{%s}/teams", StageID),
 			GetTeamsHandler,
@@ -143,10 +188,51 @@ func NewServer(pool *pgxpool.Pool, config ServerConfig) *http.Server {
 			fmt.Sprintf("/stages/{%s}/results/count", StageID),
 			GetValidResultsCountHandler,
 		),
+		NewRoute("/search", SearchHandler),
+		NewRoute("/riders", SearchRidersHandler),
+		NewRoute(fmt.Sprintf("/riders/{%s}", RiderID), GetRiderHandler),
+		NewRoute(
+			fmt.Sprintf("/riders/{%s}/vs/{%s}", RiderID, OtherRiderID),
+			GetHeadToHeadHandler,
+		),
+		NewRoute(fmt.Sprintf("/teams/{%s}", TeamID), GetTeamHandler),
+		NewRoute("/races", GetRacesHandler),
+		NewRoute(fmt.Sprintf("/races/{%s}", RaceID), GetRaceHandler),
+		NewRoute(
+			fmt.Sprintf("/races/{%s}/stages/{%s}", RaceID, StageNumber),
+			GetRaceStageHandler,
+		),
+		NewRoute(
+			fmt.Sprintf(
+				"/races/{%s}/standings/{%s}", RaceID, ResultClassification,
+			),
+			GetStandingsHandler,
+		),
+		NewRoute(
+			fmt.Sprintf("/races/{%s}/tracks", RaceID),
+			GetRaceTracksHandler,
+		),
+		NewRoute(
+			fmt.Sprintf("/races/{%s}/teams/{%s}/roster", RaceID, TeamID),
+			GetRaceTeamRosterHandler,
+		),
+		NewRoute(
+			fmt.Sprintf("/tiles/{%s}/{%s}/{%s}", TileZ, TileX, TileY),
+			GetTileHandler,
+		),
 	}
 
+	routes = append(routes, adminRoutes()...)
+
 	for _, route := range routes {
-		addRoute(mux, route.FullPath(), pool, route.handler)
+		if route.admin {
+			addRoute(
+				mux, route.FullPath(), store, route.handler,
+				RequireAdminToken, ClearCachesOnChange,
+			)
+			continue
+		}
+		addRoute(mux, route.FullPath(), store, route.handler)
 	}
 
 	return server
@@ -0,0 +1,449 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/michaelbennett99/stagehunter/backend/archive"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/memstore"
+	"github.com/michaelbennett99/stagehunter/backend/server"
+)
+
+const adminToken = "test-token"
+
+// newTestServer returns the handler of a server on a store seeded with the
+// default fixtures, with stage 1 as the daily stage.
+func newTestServer(t *testing.T) (*memstore.Store, http.Handler) {
+	t.Helper()
+	store := memstore.Default()
+	if err := store.ScheduleDailyStage(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	return store, server.NewServer(store, server.DefaultServerConfig()).Handler
+}
+
+func do(
+	t *testing.T, handler http.Handler, method, path string, body io.Reader,
+	admin bool,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if admin {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestPublicRoutes(t *testing.T) {
+	_, handler := newTestServer(t)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		// Text the body must contain
+		want string
+	}{
+		{"/v1/daily", http.StatusOK, `"stage_id":1`},
+		{"/v1/random", http.StatusOK, ""},
+		{"/v1/stages", http.StatusOK, `"next_cursor":null`},
+		{"/v1/stages?sort=stage_length&order=desc&limit=1", http.StatusOK, `"Piacenza"`},
+		{"/v1/stages?sort=height", http.StatusBadRequest, ""},
+		{"/v1/stages/1/info", http.StatusOK, `"stage_start":"Florence"`},
+		{"/v1/stages/abc/info", http.StatusBadRequest, ""},
+		{"/v1/stages/1/info/stage_end", http.StatusOK, `"Rimini"`},
+		{"/v1/stages/1/track", http.StatusOK, `"LineString"`},
+		{"/v1/stages/1/track?format=feature", http.StatusOK, `"Feature"`},
+		{"/v1/stages/1/track.gpx", http.StatusOK, "<gpx"},
+		{"/v1/stages/1/track.kml?climbs=true", http.StatusOK, "<kml"},
+		{"/v1/stages/1/geometry/summary", http.StatusOK, `"bbox"`},
+		{"/v1/stages/1/elevation", http.StatusOK, `"elevation"`},
+		{"/v1/stages/1/gradient", http.StatusOK, `"gradient"`},
+		{"/v1/stages/1/results", http.StatusOK, `"classification":"gc"`},
+		{"/v1/stages/3/results?include_status=true", http.StatusOK, `"status":"DNF"`},
+		{"/v1/stages/3/nonfinishers", http.StatusOK, `"Primož Roglič"`},
+		{"/v1/stages/1/riders", http.StatusOK, `"Tadej Pogačar"`},
+		{"/v1/stages/1/teams", http.StatusOK, `"UAE Team Emirates"`},
+		{"/v1/stages/1/results/stage", http.StatusOK, `"rider":"Biniam Girmay"`},
+		{"/v1/stages/1/results/gc", http.StatusBadRequest, ""},
+		{"/v1/stages/1/results/stage/1", http.StatusOK, `"Biniam Girmay"`},
+		{"/v1/stages/1/results/stage/1/team", http.StatusOK, `"Intermarché - Wanty"`},
+		{"/v1/stages/1/results/teams/1/name", http.StatusOK, `"UAE Team Emirates"`},
+		{"/v1/stages/1/results/count", http.StatusOK, `"stage":5`},
+		{"/v1/stages/1/autocomplete/general?q=poga", http.StatusOK, "Pogačar"},
+		// Guesses match riders of every race, so that the matches do not
+		// list the riders of the stage
+		{"/v1/stages/1/autocomplete/mountains?q=evenep", http.StatusOK, "Evenepoel"},
+		{"/v1/stages/1/autocomplete/general?q=a", http.StatusBadRequest, ""},
+		{"/v1/stages/1/autocomplete/general?q=poga&limit=500", http.StatusBadRequest, ""},
+		{"/v1/stages/1/verify/info/stage_end?v=rimini", http.StatusOK, "true"},
+		{"/v1/stages/1/verify/results/stage/1?v=biniam%20girmay", http.StatusOK, "true"},
+		{"/v1/stages/1/verify/results/stage/2?v=girmay", http.StatusOK, "false"},
+		{"/v1/search?q=pogacar", http.StatusOK, "Pogačar"},
+		{"/v1/search", http.StatusBadRequest, ""},
+		{"/v1/riders?q=vinge", http.StatusOK, `"Vingegaard"`},
+		{"/v1/riders/1", http.StatusOK, `"Pogačar"`},
+		{"/v1/riders/1/vs/2", http.StatusOK, `"wins_a":2,"wins_b":1`},
+		{"/v1/teams/1", http.StatusOK, `"UAE Team Emirates"`},
+		{"/v1/teams/4", http.StatusOK, `"year":2023,"name":"BORA - hansgrohe"`},
+		{"/v1/races", http.StatusOK, `"num_stages":3`},
+		{"/v1/races?grand_tour=GIRO", http.StatusOK, `"num_stages":2`},
+		{"/v1/races/1", http.StatusOK, `"Cesenatico"`},
+		{"/v1/races/1/stages/3", http.StatusOK, `"Turin"`},
+		{"/v1/races/1/standings/general", http.StatusOK, "Vingegaard"},
+		{"/v1/races/2/tracks", http.StatusOK, `"FeatureCollection"`},
+		{"/v1/races/2/teams/3/roster", http.StatusOK, "Evenepoel"},
+		{"/v1/tiles/0/0/0.mvt", http.StatusOK, ""},
+		{"/v1/tiles/0/0/0.png", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := do(t, handler, http.MethodGet, tt.path, nil, false)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body does not contain %s: %s", tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	_, handler := newTestServer(t)
+
+	t.Setenv("ADMIN_TOKEN", "")
+	w := do(t, handler, http.MethodGet, "/v1/admin/export", nil, true)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d with the admin API disabled, want 404", w.Code)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "other-token")
+	w = do(t, handler, http.MethodGet, "/v1/admin/export", nil, true)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d with a wrong token, want 401", w.Code)
+	}
+}
+
+func TestAdminCRUDRoutes(t *testing.T) {
+	store, handler := newTestServer(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"create race", http.MethodPost, "/v1/admin/races",
+			`{"grand_tour": "VUELTA", "year": 2024}`, http.StatusCreated},
+		{"update race", http.MethodPut, "/v1/admin/races/3",
+			`{"grand_tour": "VUELTA", "year": 2023}`, http.StatusOK},
+		{"create stage", http.MethodPost, "/v1/admin/stages",
+			`{"race_id": 3, "stage_no": 1, "stage_type": "TTT",
+			"stage_length": 10, "stage_start": "Lisbon",
+			"stage_end": "Lisbon", "gpx_id": 1, "gpx_accuracy": "Exact"}`,
+			http.StatusConflict},
+		{"create rider", http.MethodPost, "/v1/admin/riders",
+			`{"first_name": "Juan", "last_name": "Ayuso"}`, http.StatusCreated},
+		{"update rider", http.MethodPut, "/v1/admin/riders/6",
+			`{"first_name": "Juan", "last_name": "Ayuso Pesquera"}`,
+			http.StatusOK},
+		{"create team", http.MethodPost, "/v1/admin/teams",
+			`{"name": "Movistar Team"}`, http.StatusCreated},
+		{"update team", http.MethodPut, "/v1/admin/teams/6",
+			`{"name": "Movistar"}`, http.StatusOK},
+		{"create result", http.MethodPost, "/v1/admin/results",
+			`{"stage_id": 5, "rank": 4, "classification": "stage",
+			"team_id": 6, "rider_id": 6, "time": "4h30m40s"}`,
+			http.StatusCreated},
+		{"create result of unknown stage", http.MethodPost, "/v1/admin/results",
+			`{"stage_id": 99, "rank": 1, "classification": "stage",
+			"team_id": 6, "rider_id": 6, "time": "4h30m"}`,
+			http.StatusConflict},
+		{"create invalid result", http.MethodPost, "/v1/admin/results",
+			`{"stage_id": 5, "rank": 1, "classification": "points",
+			"team_id": 6, "rider_id": 6, "time": "4h30m"}`,
+			http.StatusBadRequest},
+		{"update result", http.MethodPut, "/v1/admin/results/106",
+			`{"stage_id": 5, "rank": 4, "classification": "stage",
+			"team_id": 6, "rider_id": 6, "time": "4h30m45s"}`,
+			http.StatusOK},
+		{"delete team with results", http.MethodDelete, "/v1/admin/teams/6",
+			"", http.StatusConflict},
+		{"delete result", http.MethodDelete, "/v1/admin/results/106",
+			"", http.StatusNoContent},
+		{"delete rider", http.MethodDelete, "/v1/admin/riders/6",
+			"", http.StatusNoContent},
+		{"delete team", http.MethodDelete, "/v1/admin/teams/6",
+			"", http.StatusNoContent},
+		{"delete missing team", http.MethodDelete, "/v1/admin/teams/6",
+			"", http.StatusNotFound},
+		{"delete stage with results", http.MethodDelete, "/v1/admin/stages/5",
+			"", http.StatusConflict},
+		{"delete race", http.MethodDelete, "/v1/admin/races/3",
+			"", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(
+				t, handler, tt.method, tt.path, strings.NewReader(tt.body), true,
+			)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	// Every successful change is recorded, and no failed one
+	var successes int
+	for _, tt := range tests {
+		if tt.wantStatus < 300 {
+			successes++
+		}
+	}
+	if entries := store.AuditLog(); len(entries) != successes {
+		t.Errorf("got %d audit entries, want %d", len(entries), successes)
+	}
+}
+
+func TestAdminChangesClearCaches(t *testing.T) {
+	_, handler := newTestServer(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+
+	// Caches the search candidates of every stage
+	w := do(t, handler, http.MethodGet, "/v1/search?q=pogacar", nil, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	w = do(
+		t, handler, http.MethodPut, "/v1/admin/riders/1",
+		strings.NewReader(`{"first_name": "Tadej", "last_name": "Zabriskie"}`),
+		true,
+	)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	w = do(t, handler, http.MethodGet, "/v1/search?q=zabriskie", nil, false)
+	if !strings.Contains(w.Body.String(), "Zabriskie") {
+		t.Errorf("renamed rider not found after the change: %s", w.Body)
+	}
+}
+
+func TestAdminStageRoutes(t *testing.T) {
+	store, handler := newTestServer(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+
+	gpx := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Florence - Rimini</name>
+    <trkseg>
+      <trkpt lat="43.7696" lon="11.2558"><ele>50</ele></trkpt>
+      <trkpt lat="44.0678" lon="12.5683"><ele>5</ele></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+	w := do(
+		t, handler, http.MethodPost, "/v1/admin/stages/1/track?accuracy=Exact",
+		strings.NewReader(gpx), true,
+	)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d importing a track: %s", w.Code, w.Body)
+	}
+	var response server.AdminResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := store.GetTrackMetadata(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ID != 6 || metadata.Name.String != "Florence - Rimini" {
+		t.Errorf("got track %d named %q", response.ID, metadata.Name.String)
+	}
+
+	// A new race, with a new stage on a track imported for it
+	w = do(
+		t, handler, http.MethodPost, "/v1/admin/races",
+		strings.NewReader(`{"grand_tour": "VUELTA", "year": 2025}`), true,
+	)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d creating a race: %s", w.Code, w.Body)
+	}
+	var race server.AdminResponse
+	if err := json.NewDecoder(w.Body).Decode(&race); err != nil {
+		t.Fatal(err)
+	}
+	w = do(
+		t, handler, http.MethodPost, "/v1/admin/tracks",
+		strings.NewReader(gpx), true,
+	)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d importing a track: %s", w.Code, w.Body)
+	}
+	var track server.AdminResponse
+	if err := json.NewDecoder(w.Body).Decode(&track); err != nil {
+		t.Fatal(err)
+	}
+	stage := fmt.Sprintf(`{"race_id": %d, "stage_no": 1, "stage_type": "ROAD",
+		"stage_length": 110.3, "stage_start": "Florence",
+		"stage_end": "Rimini", "gpx_id": %d, "gpx_accuracy": "Exact"}`,
+		race.ID, track.ID,
+	)
+	w = do(
+		t, handler, http.MethodPost, "/v1/admin/stages",
+		strings.NewReader(stage), true,
+	)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d creating a stage: %s", w.Code, w.Body)
+	}
+	stages, err := store.GetRaceStages(context.Background(), race.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 1 || stages[0].StageID != 6 {
+		t.Fatalf("got stages %+v of the new race, want stage 6", stages)
+	}
+	w = do(
+		t, handler, http.MethodPut, "/v1/admin/stages/6",
+		strings.NewReader(strings.Replace(stage, "ROAD", "ITT", 1)), true,
+	)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d updating a stage: %s", w.Code, w.Body)
+	}
+
+	// The new stage has no results, so fails the checks
+	w = do(
+		t, handler, http.MethodPost, "/v1/admin/validation?dry_run=true",
+		nil, true,
+	)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"num_failed":1`) {
+		t.Errorf("got status %d validating: %s", w.Code, w.Body)
+	}
+
+	w = do(t, handler, http.MethodDelete, "/v1/admin/stages/6", nil, true)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d deleting a stage: %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminResultsRoutes(t *testing.T) {
+	store, handler := newTestServer(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+	ctx := context.Background()
+
+	// A batch with a failing change makes no change
+	batch := `{"delete": [1], "create": [{"stage_id": 99, "rank": 1,
+		"classification": "stage", "team_id": 1, "rider_id": 1,
+		"time": "4h"}]}`
+	w := do(
+		t, handler, http.MethodPost, "/v1/admin/results/batch",
+		strings.NewReader(batch), true,
+	)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d for a failing batch: %s", w.Code, w.Body)
+	}
+	results, err := store.ExportResults(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].ResultID != 1 {
+		t.Errorf("result 1 deleted by a failing batch")
+	}
+
+	batch = `{"delete": [1], "update": [{"result_id": 2, "stage_id": 1,
+		"rank": 1, "classification": "stage", "team_id": 1, "rider_id": 1,
+		"time": "5h15m"}]}`
+	w = do(
+		t, handler, http.MethodPost, "/v1/admin/results/batch",
+		strings.NewReader(batch), true,
+	)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d for a batch: %s", w.Code, w.Body)
+	}
+	winner, err := store.GetResultForRankAndClassification(
+		ctx, db.GetResultForRankAndClassificationParams{
+			StageID: 1, Rank: 1, Classification: "stage",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if winner.Rider.String != "Tadej Pogačar" {
+		t.Errorf("got stage winner %s after the batch", winner.Rider.String)
+	}
+
+	csv := "stage,classification,rank,rider,team,time\n" +
+		"2,stage,1,Tadej Pogačar,UAE Team Emirates,4h30m\n" +
+		"2,stage,2,Enric Mas,Movistar Team,4h31m\n"
+	w = do(
+		t, handler, http.MethodPost,
+		"/v1/admin/races/2/results/import?dry_run=true",
+		strings.NewReader(csv), true,
+	)
+	if w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(), "already has 4 results") {
+		t.Errorf("got status %d importing existing results: %s", w.Code, w.Body)
+	}
+	w = do(
+		t, handler, http.MethodPost,
+		"/v1/admin/races/2/results/import?replace=true",
+		strings.NewReader(csv), true,
+	)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d replacing results: %s", w.Code, w.Body)
+	}
+	count, err := store.GetValidResultsCount(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Stage != 2 {
+		t.Errorf("got %d stage results after replacing them, want 2", count.Stage)
+	}
+	names, err := store.GetAllTeamNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := names[len(names)-1]; last.Year != 2024 ||
+		last.Name != "Movistar Team" {
+		t.Errorf("got name %+v of the new team, want Movistar Team in 2024", last)
+	}
+}
+
+func TestAdminExport(t *testing.T) {
+	_, handler := newTestServer(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+
+	w := do(t, handler, http.MethodGet, "/v1/admin/export", nil, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d exporting: %s", w.Code, w.Body)
+	}
+	body := w.Body.Bytes()
+	reader, err := archive.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := reader.Dataset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Races) != 2 || len(data.Stages) != 5 {
+		t.Errorf(
+			"got %d races and %d stages in the archive",
+			len(data.Races), len(data.Stages),
+		)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/gpx"
+	"github.com/michaelbennett99/stagehunter/backend/kml"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+// StageTrack holds everything needed to export a stage route to a file.
+type StageTrack struct {
+	Info     db.StageInfo
+	Metadata db.TrackMetadata
+	Points   []db.TrackPoint
+	Climbs   []db.Climb
+}
+
+// GetStageTrack loads the info, track metadata and track points of a stage,
+// and detects the climbs on the route if withClimbs is set.
+func GetStageTrack(
+	conn db.Store, stageID int, withClimbs bool,
+) (StageTrack, error) {
+	info, err := conn.GetStageInfo(context.Background(), stageID)
+	if err != nil {
+		return StageTrack{}, err
+	}
+	metadata, err := conn.GetTrackMetadata(context.Background(), stageID)
+	if err != nil {
+		return StageTrack{}, err
+	}
+	points, err := conn.GetTrackPoints(context.Background(), stageID)
+	if err != nil {
+		return StageTrack{}, err
+	}
+
+	track := StageTrack{Info: info, Metadata: metadata, Points: points}
+	if withClimbs {
+		elevationPoints := make([]db.ElevationPoint, len(points))
+		for i, point := range points {
+			elevationPoints[i] = point.ElevationPoint
+		}
+		track.Climbs = db.DetectClimbs(
+			elevationPoints, db.DefaultClimbParams(),
+		)
+	}
+	return track, nil
+}
+
+// FileName returns the name of the file the track is exported to, with the
+// given extension.
+func (t StageTrack) FileName(extension string) (string, error) {
+	slug, err := lib.Slugify(t.Info.Name())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", slug, extension), nil
+}
+
+func climbName(i int, climb db.Climb) string {
+	return fmt.Sprintf(
+		"Climb %d: %.1f km at %.1f%%",
+		i+1, climb.Length/1000, climb.AverageGradient,
+	)
+}
+
+func climbDescription(climb db.Climb) string {
+	return fmt.Sprintf(
+		"%.0f m gain from %.1f km to %.1f km",
+		climb.ElevationGain, climb.Start.Distance/1000, climb.Top.Distance/1000,
+	)
+}
+
+// NewStageGPX builds a GPX document for the stage, with the route as a track
+// and the top of each climb as a waypoint.
+func NewStageGPX(t StageTrack) *gpx.GPX {
+	name := t.Info.Name()
+
+	doc := gpx.New()
+	doc.Metadata = &gpx.Metadata{Name: name}
+
+	var link *gpx.Link
+	if t.Metadata.LinkHref.Valid {
+		link = &gpx.Link{
+			Href: t.Metadata.LinkHref.String,
+			Text: t.Metadata.LinkText.String,
+		}
+		doc.Metadata.Link = link
+	}
+
+	for i, climb := range t.Climbs {
+		top := t.Points[climb.TopIndex]
+		doc.Waypoints = append(doc.Waypoints, gpx.Waypoint{
+			Latitude:    top.Latitude,
+			Longitude:   top.Longitude,
+			Elevation:   &top.Elevation,
+			Name:        climbName(i, climb),
+			Description: climbDescription(climb),
+			Type:        "Summit",
+		})
+	}
+
+	points := make([]gpx.Waypoint, len(t.Points))
+	for i := range t.Points {
+		points[i] = gpx.Waypoint{
+			Latitude:  t.Points[i].Latitude,
+			Longitude: t.Points[i].Longitude,
+			Elevation: &t.Points[i].Elevation,
+		}
+	}
+	doc.Tracks = []gpx.Track{{
+		Name:     name,
+		Source:   t.Metadata.Source.String,
+		Link:     link,
+		Segments: []gpx.Segment{{Points: points}},
+	}}
+
+	return doc
+}
+
+// NewStageKML builds a KML document for the stage, with the route as a line
+// and the top of each climb as a point.
+func NewStageKML(t StageTrack) *kml.KML {
+	name := t.Info.Name()
+
+	doc := kml.New(name)
+	if t.Metadata.Source.Valid {
+		doc.Document.Description = fmt.Sprintf(
+			"Source: %s", t.Metadata.Source.String,
+		)
+	}
+
+	coordinates := make(kml.Coordinates, len(t.Points))
+	for i, point := range t.Points {
+		coordinates[i] = kml.Coordinate{
+			Longitude: point.Longitude,
+			Latitude:  point.Latitude,
+			Altitude:  point.Elevation,
+		}
+	}
+	doc.Document.Placemarks = append(doc.Document.Placemarks, kml.Placemark{
+		Name: name,
+		LineString: &kml.LineString{
+			Tessellate:   1,
+			AltitudeMode: "clampToGround",
+			Coordinates:  coordinates,
+		},
+	})
+
+	for i, climb := range t.Climbs {
+		top := t.Points[climb.TopIndex]
+		doc.Document.Placemarks = append(
+			doc.Document.Placemarks,
+			kml.Placemark{
+				Name:        climbName(i, climb),
+				Description: climbDescription(climb),
+				Point: &kml.Point{
+					AltitudeMode: "clampToGround",
+					Coordinates: kml.Coordinates{{
+						Longitude: top.Longitude,
+						Latitude:  top.Latitude,
+						Altitude:  top.Elevation,
+					}},
+				},
+			},
+		)
+	}
+
+	return doc
+}
+
+// SetAttachmentHeaders sets the headers for a file download.
+func SetAttachmentHeaders(
+	w http.ResponseWriter, contentType string, fileName string,
+) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", fileName),
+	)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+}
@@ -2,25 +2,69 @@ package server
 
 import (
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
 )
 
+// TimeFormat enum, how times and gaps in results are formatted
+type TimeFormat string
+
+const (
+	// Go duration strings, e.g. 4h32m10s and 1m23s
+	TimeFormatDuration TimeFormat = "duration"
+	// Cycling style times and gaps, e.g. 4:32:10, +1:23 and s.t.
+	TimeFormatCycling TimeFormat = "cycling"
+)
+
+func (f TimeFormat) IsValid() bool {
+	return f == TimeFormatDuration || f == TimeFormatCycling
+}
+
+func (f TimeFormat) FormatTime(d time.Duration) string {
+	if f == TimeFormatCycling {
+		return lib.FormatClock(d)
+	}
+	return d.String()
+}
+
+func (f TimeFormat) FormatGap(d time.Duration, sameTime bool) string {
+	if f == TimeFormatCycling {
+		if sameTime {
+			return lib.SameTime
+		}
+		return lib.FormatGap(d)
+	}
+	return d.String()
+}
+
 type Result struct {
-	Rank           int               `json:"rank"`
+	Rank           int               `json:"rank,omitempty"`
+	RiderID        *int64            `json:"rider_id,omitempty"`
 	Rider          *string           `json:"rider,omitempty"`
+	TeamID         int               `json:"team_id"`
 	Team           *string           `json:"team,omitempty"`
 	Time           *string           `json:"time,omitempty"`
+	Gap            *string           `json:"gap,omitempty"`
 	Points         *int64            `json:"points,omitempty"`
 	Classification db.Classification `json:"classification"`
+	// Only set for riders and teams without a valid rank, e.g. DNF
+	Status db.RankStatus `json:"status,omitempty"`
 }
 
-func NewResult(dbResult db.Result) Result {
+// NewResult converts a database result, formatting the time and gap with the
+// given format. The leader has no gap.
+func NewResult(dbResult db.Result, format TimeFormat) Result {
 	result := Result{
 		Rank:           dbResult.Rank,
+		TeamID:         dbResult.TeamID,
 		Classification: dbResult.Classification,
 	}
+	if dbResult.RiderID.Valid {
+		result.RiderID = &dbResult.RiderID.Int64
+	}
 	if dbResult.Rider.Valid {
 		result.Rider = &dbResult.Rider.String
 	}
@@ -28,23 +72,236 @@ func NewResult(dbResult db.Result) Result {
 		result.Team = &dbResult.Team.String
 	}
 	if dbResult.Time.Valid {
-		timeStr := dbResult.Time.Duration.String()
+		timeStr := format.FormatTime(dbResult.Time.Duration)
 		result.Time = &timeStr
 	}
+	if dbResult.Gap.Valid && dbResult.Rank > 1 {
+		gapStr := format.FormatGap(dbResult.Gap.Duration, dbResult.SameTime)
+		result.Gap = &gapStr
+	}
 	if dbResult.Points.Valid {
 		result.Points = &dbResult.Points.Int64
 	}
 	return result
 }
 
-func NewResults(dbResults []db.Result) []Result {
+func NewResults(dbResults []db.Result, format TimeFormat) []Result {
 	results := make([]Result, len(dbResults))
 	for i, dbResult := range dbResults {
-		results[i] = NewResult(dbResult)
+		results[i] = NewResult(dbResult, format)
 	}
 	return results
 }
 
+// NewNonFinisherResult converts a rider or team without a valid rank to an
+// unranked result with its status.
+func NewNonFinisherResult(nonFinisher db.NonFinisher) Result {
+	result := Result{
+		TeamID:         nonFinisher.TeamID,
+		Classification: nonFinisher.Classification,
+		Status:         nonFinisher.Status,
+	}
+	if nonFinisher.RiderID.Valid {
+		result.RiderID = &nonFinisher.RiderID.Int64
+	}
+	if nonFinisher.Rider.Valid {
+		result.Rider = &nonFinisher.Rider.String
+	}
+	if nonFinisher.Team.Valid {
+		result.Team = &nonFinisher.Team.String
+	}
+	return result
+}
+
+func NewNonFinisherResults(nonFinishers []db.NonFinisher) []Result {
+	results := make([]Result, len(nonFinishers))
+	for i, nonFinisher := range nonFinishers {
+		results[i] = NewNonFinisherResult(nonFinisher)
+	}
+	return results
+}
+
+// StageStandings are the standings in a classification after a stage.
+type StageStandings struct {
+	StageID     int      `json:"stage_id"`
+	StageNumber int      `json:"stage_no"`
+	Standings   []Result `json:"standings"`
+}
+
+// NewStageStandings groups standings ordered by stage into the standings after
+// each stage.
+func NewStageStandings(
+	dbStandings []db.Standing, format TimeFormat,
+) []StageStandings {
+	stageStandings := []StageStandings{}
+	for _, dbStanding := range dbStandings {
+		n := len(stageStandings)
+		if n == 0 || stageStandings[n-1].StageID != dbStanding.StageID {
+			stageStandings = append(stageStandings, StageStandings{
+				StageID:     dbStanding.StageID,
+				StageNumber: dbStanding.StageNumber,
+			})
+			n++
+		}
+		stageStandings[n-1].Standings = append(
+			stageStandings[n-1].Standings,
+			NewResult(dbStanding.Result, format),
+		)
+	}
+	return stageStandings
+}
+
+// RaceDetail is a race with its ordered list of stages.
+type RaceDetail struct {
+	db.Race
+	Stages []db.RaceStage `json:"stages"`
+}
+
+// RiderProfile is a rider with their career, aggregated from all results.
+type RiderProfile struct {
+	db.Rider
+	StageWins      []db.RiderStageWin      `json:"stage_wins"`
+	Placings       []db.RiderPlacing       `json:"placings"`
+	Participations []db.RiderParticipation `json:"participations"`
+	Teams          []db.RiderTeam          `json:"teams"`
+}
+
+// TeamRoster is the riders who rode for a team in a race.
+type TeamRoster struct {
+	RaceID    int          `json:"race_id"`
+	GrandTour db.GrandTour `json:"grand_tour"`
+	Year      int          `json:"year"`
+	Riders    []db.Rider   `json:"riders"`
+}
+
+// NewTeamRosters groups roster riders ordered by race into a roster per race.
+func NewTeamRosters(dbRiders []db.TeamRosterRider) []TeamRoster {
+	rosters := []TeamRoster{}
+	for _, dbRider := range dbRiders {
+		n := len(rosters)
+		if n == 0 || rosters[n-1].RaceID != dbRider.RaceID {
+			rosters = append(rosters, TeamRoster{
+				RaceID:    dbRider.RaceID,
+				GrandTour: dbRider.GrandTour,
+				Year:      dbRider.Year,
+			})
+			n++
+		}
+		rosters[n-1].Riders = append(rosters[n-1].Riders, dbRider.Rider)
+	}
+	return rosters
+}
+
+// TeamProfile is a team with its history, aggregated from all results.
+type TeamProfile struct {
+	db.Team
+	Names     []db.TeamName     `json:"names"`
+	Rosters   []TeamRoster      `json:"rosters"`
+	StageWins []db.TeamStageWin `json:"stage_wins"`
+	Placings  []db.TeamPlacing  `json:"placings"`
+}
+
+// HeadToHeadStage is a stage both riders of a head to head finished.
+type HeadToHeadStage struct {
+	RaceID int `json:"race_id"`
+	db.RaceStage
+	RankA int `json:"rank_a"`
+	RankB int `json:"rank_b"`
+	// Time of rider A relative to rider B
+	TimeDelta *string `json:"time_delta,omitempty"`
+	GCRankA   *int64  `json:"gc_rank_a,omitempty"`
+	GCRankB   *int64  `json:"gc_rank_b,omitempty"`
+}
+
+// HeadToHeadSummary is the aggregate statistics of a head to head.
+type HeadToHeadSummary struct {
+	Stages     int                 `json:"stages"`
+	WinsA      int                 `json:"wins_a"`
+	WinsB      int                 `json:"wins_b"`
+	AverageGap string              `json:"average_gap"`
+	GCWinsA    int                 `json:"gc_wins_a"`
+	GCWinsB    int                 `json:"gc_wins_b"`
+	Races      []db.HeadToHeadRace `json:"races"`
+}
+
+// HeadToHead compares two riders over every stage they both finished.
+type HeadToHead struct {
+	RiderA  db.Rider          `json:"rider_a"`
+	RiderB  db.Rider          `json:"rider_b"`
+	Summary HeadToHeadSummary `json:"summary"`
+	Stages  []HeadToHeadStage `json:"stages"`
+}
+
+// NewHeadToHead converts the stages both riders finished and their summary,
+// formatting time deltas with the given format.
+func NewHeadToHead(
+	riderA, riderB db.Rider,
+	h2h db.HeadToHead,
+	format TimeFormat,
+) HeadToHead {
+	stages := make([]HeadToHeadStage, len(h2h.Stages))
+	for i, dbStage := range h2h.Stages {
+		stage := HeadToHeadStage{
+			RaceID:    dbStage.RaceID,
+			RaceStage: dbStage.RaceStage,
+			RankA:     dbStage.RankA,
+			RankB:     dbStage.RankB,
+		}
+		if dbStage.TimeDelta.Valid {
+			delta := format.FormatGap(dbStage.TimeDelta.Duration, false)
+			stage.TimeDelta = &delta
+		}
+		if dbStage.GCRankA.Valid {
+			stage.GCRankA = &dbStage.GCRankA.Int64
+		}
+		if dbStage.GCRankB.Valid {
+			stage.GCRankB = &dbStage.GCRankB.Int64
+		}
+		stages[i] = stage
+	}
+
+	dbSummary := h2h.Summary
+	return HeadToHead{
+		RiderA: riderA,
+		RiderB: riderB,
+		Summary: HeadToHeadSummary{
+			Stages:     dbSummary.Stages,
+			WinsA:      dbSummary.WinsA,
+			WinsB:      dbSummary.WinsB,
+			AverageGap: format.FormatGap(dbSummary.AverageGap, false),
+			GCWinsA:    dbSummary.GCWinsA,
+			GCWinsB:    dbSummary.GCWinsB,
+			Races:      dbSummary.Races,
+		},
+		Stages: stages,
+	}
+}
+
+// SearchQueryParams are the parameters of a search.
+type SearchQueryParams struct {
+	Query string
+	// Optional, all entity types if nil
+	Type *db.SearchEntity
+	// Optional, the riders, teams and towns of all stages if nil
+	StageID *int
+	Limit   int
+}
+
+// AutocompleteQueryParams are the parameters of an autocomplete of a guess.
+type AutocompleteQueryParams struct {
+	Query string
+	Limit int
+}
+
+// SearchHit is a rider, team or stage town matching a search, with how well
+// it matches from 0 to 1.
+type SearchHit struct {
+	Type  db.SearchEntity `json:"type"`
+	ID    *int64          `json:"id,omitempty"`
+	Name  string          `json:"name"`
+	Score float64         `json:"score"`
+}
+
 type RiderOrTeam struct {
 	isRider bool
 	value   string
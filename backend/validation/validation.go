@@ -0,0 +1,310 @@
+// Package validation checks the race data of every stage for the problems
+// that spoil a daily stage: a missing track or elevation profile, a track
+// that does not match the stage length, and missing or inconsistent results.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/lib"
+)
+
+// Checks made on every stage
+type Check string
+
+const (
+	CheckTrack           Check = "track"
+	CheckElevation       Check = "elevation"
+	CheckTrackLength     Check = "track_length"
+	CheckClassifications Check = "classifications"
+	CheckRanks           Check = "ranks"
+	CheckTimes           Check = "times"
+)
+
+// DefaultTrackLengthTolerance is how far, as a fraction of the stage length,
+// the track length may be from the stage length by default.
+const DefaultTrackLengthTolerance = 0.1
+
+// Config struct, the settings of the checks
+type Config struct {
+	// How far, as a fraction of the stage length, the track length may be
+	// from the stage length
+	TrackLengthTolerance float64 `json:"track_length_tolerance"`
+}
+
+func DefaultConfig() Config {
+	return Config{TrackLengthTolerance: DefaultTrackLengthTolerance}
+}
+
+func (c Config) Validate() error {
+	if c.TrackLengthTolerance < 0 {
+		return errors.New("track length tolerance must not be negative")
+	}
+	return nil
+}
+
+// Problem struct, a failed check
+type Problem struct {
+	Check   Check  `json:"check"`
+	Message string `json:"message"`
+}
+
+// StageReport struct, the outcome of the checks of a stage
+type StageReport struct {
+	StageID     int          `json:"stage_id"`
+	RaceID      int          `json:"race_id"`
+	GrandTour   db.GrandTour `json:"grand_tour"`
+	Year        int          `json:"year"`
+	StageNumber int          `json:"stage_no"`
+	Passed      bool         `json:"passed"`
+	Problems    []Problem    `json:"problems"`
+}
+
+// Report struct, the outcome of the checks of every stage
+type Report struct {
+	CheckedAt time.Time     `json:"checked_at"`
+	Config    Config        `json:"config"`
+	NumStages int           `json:"num_stages"`
+	NumFailed int           `json:"num_failed"`
+	Stages    []StageReport `json:"stages"`
+}
+
+// Classifications ranked by points rather than time, whose results have no
+// time to check
+var pointsClassifications = map[db.Classification]bool{
+	db.ClassificationPoints:    true,
+	db.ClassificationMountains: true,
+}
+
+// Classifications every stage has results for
+var alwaysExpected = []db.Classification{
+	db.ClassificationStage,
+	db.ClassificationGC,
+}
+
+// classificationName returns the database label of a classification, the
+// name it is known by in the API.
+func classificationName(c db.Classification) string {
+	if key, err := db.EnumKey(c, db.ClassificationMapping); err == nil {
+		return key
+	}
+	return string(c)
+}
+
+// ExpectedClassifications returns the classifications every stage of a race
+// should have results for: the stage and general classifications, and any
+// other classification the race has results for in some stage.
+func ExpectedClassifications(
+	results []db.CheckedResult,
+) []db.Classification {
+	expected := append([]db.Classification{}, alwaysExpected...)
+	seen := make(map[db.Classification]bool)
+	for _, c := range alwaysExpected {
+		seen[c] = true
+	}
+	for _, result := range results {
+		if !seen[result.Classification] {
+			seen[result.Classification] = true
+			expected = append(expected, result.Classification)
+		}
+	}
+	return expected
+}
+
+// checkRanks returns a problem if the ranks of a classification, in order, do
+// not count up from 1. Tied riders share a rank, and the rank after a tie
+// skips the tied places, e.g. 1, 2, 2, 4.
+func checkRanks(c db.Classification, results []db.CheckedResult) *Problem {
+	for i, result := range results {
+		if result.Rank == i+1 || (i > 0 && result.Rank == results[i-1].Rank) {
+			continue
+		}
+		message := fmt.Sprintf(
+			"%s ranks start at %d", classificationName(c), result.Rank,
+		)
+		if i > 0 {
+			message = fmt.Sprintf(
+				"%s ranks jump from %d to %d",
+				classificationName(c), results[i-1].Rank, result.Rank,
+			)
+		}
+		return &Problem{Check: CheckRanks, Message: message}
+	}
+	return nil
+}
+
+// checkTimes returns a problem if a result of a classification, in order of
+// rank, has a shorter time than the result ranked before it.
+func checkTimes(c db.Classification, results []db.CheckedResult) *Problem {
+	for i := 1; i < len(results); i++ {
+		previous, result := results[i-1].Time, results[i].Time
+		if !previous.Valid || !result.Valid {
+			continue
+		}
+		if result.Duration < previous.Duration {
+			return &Problem{
+				Check: CheckTimes,
+				Message: fmt.Sprintf(
+					"%s rank %d (%s) is faster than rank %d (%s)",
+					classificationName(c),
+					results[i].Rank, lib.FormatClock(result.Duration),
+					results[i-1].Rank, lib.FormatClock(previous.Duration),
+				),
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateStage checks a stage. The results are the valid results of the
+// stage by classification, ordered by rank.
+func ValidateStage(
+	stage db.StageCheckData,
+	results map[db.Classification][]db.CheckedResult,
+	expected []db.Classification,
+	cfg Config,
+) StageReport {
+	report := StageReport{
+		StageID:     stage.StageID,
+		RaceID:      stage.RaceID,
+		GrandTour:   stage.GrandTour,
+		Year:        stage.Year,
+		StageNumber: stage.StageNumber,
+		Problems:    []Problem{},
+	}
+	add := func(check Check, format string, args ...any) {
+		report.Problems = append(report.Problems, Problem{
+			Check: check, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if !stage.TrackLength.Valid {
+		add(CheckTrack, "stage has no track")
+	} else if stage.StageLength > 0 {
+		trackLength := stage.TrackLength.Float64
+		off := math.Abs(trackLength-stage.StageLength) / stage.StageLength
+		if off > cfg.TrackLengthTolerance {
+			add(
+				CheckTrackLength,
+				"track is %.1f km long, %.0f%% off the stage length of %.1f km",
+				trackLength, off*100, stage.StageLength,
+			)
+		}
+	}
+	if stage.TrackLength.Valid && stage.ElevationPoints == 0 {
+		add(CheckElevation, "track has no elevation profile")
+	}
+
+	for _, c := range expected {
+		if len(results[c]) == 0 {
+			add(
+				CheckClassifications,
+				"no valid %s results", classificationName(c),
+			)
+		}
+	}
+	// Checked in the order of the expected classifications to keep the
+	// problems in a stable order
+	for _, c := range expected {
+		if problem := checkRanks(c, results[c]); problem != nil {
+			report.Problems = append(report.Problems, *problem)
+		}
+		if pointsClassifications[c] {
+			continue
+		}
+		if problem := checkTimes(c, results[c]); problem != nil {
+			report.Problems = append(report.Problems, *problem)
+		}
+	}
+
+	report.Passed = len(report.Problems) == 0
+	return report
+}
+
+// Run checks every stage and, unless dryRun is set, records the outcomes in
+// the database, where the daily stage selector skips the stages that failed.
+func Run(
+	ctx context.Context, conn db.Store, cfg Config, dryRun bool,
+) (Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return Report{}, db.NewValidationError(err)
+	}
+	stages, err := conn.GetStageCheckData(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		CheckedAt: time.Now().UTC(),
+		Config:    cfg,
+		NumStages: len(stages),
+		Stages:    make([]StageReport, 0, len(stages)),
+	}
+	// Stages are ordered by race, so each race's results are loaded once
+	raceID := 0
+	var expected []db.Classification
+	var stageResults map[int]map[db.Classification][]db.CheckedResult
+	for _, stage := range stages {
+		if stage.RaceID != raceID {
+			raceID = stage.RaceID
+			results, err := conn.GetRaceCheckedResults(ctx, raceID)
+			if err != nil {
+				return Report{}, err
+			}
+			expected = ExpectedClassifications(results)
+			stageResults = groupResults(results)
+		}
+
+		stageReport := ValidateStage(
+			stage, stageResults[stage.StageID], expected, cfg,
+		)
+		if !stageReport.Passed {
+			report.NumFailed++
+		}
+		report.Stages = append(report.Stages, stageReport)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	validations := make([]db.StageValidation, 0, len(report.Stages))
+	for _, stageReport := range report.Stages {
+		validations = append(validations, db.StageValidation{
+			StageID:   stageReport.StageID,
+			Passed:    stageReport.Passed,
+			Problems:  stageReport.Problems,
+			CheckedAt: report.CheckedAt,
+		})
+	}
+	err = conn.WithAdminTx(ctx, func(tx db.Store) error {
+		return tx.SaveStageValidations(ctx, validations)
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// groupResults groups results by stage and classification, keeping their
+// order.
+func groupResults(
+	results []db.CheckedResult,
+) map[int]map[db.Classification][]db.CheckedResult {
+	grouped := make(map[int]map[db.Classification][]db.CheckedResult)
+	for _, result := range results {
+		if grouped[result.StageID] == nil {
+			grouped[result.StageID] = make(
+				map[db.Classification][]db.CheckedResult,
+			)
+		}
+		grouped[result.StageID][result.Classification] = append(
+			grouped[result.StageID][result.Classification], result,
+		)
+	}
+	return grouped
+}
@@ -0,0 +1,147 @@
+package validation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/michaelbennett99/stagehunter/backend/db"
+	"github.com/michaelbennett99/stagehunter/backend/validation"
+)
+
+func result(
+	c db.Classification, rank int, minutes int,
+) db.CheckedResult {
+	r := db.CheckedResult{StageID: 1, Classification: c, Rank: rank}
+	if minutes > 0 {
+		r.Time = db.Duration{
+			Duration: time.Duration(minutes) * time.Minute, Valid: true,
+		}
+	}
+	return r
+}
+
+func testStage(trackLength float64) db.StageCheckData {
+	return db.StageCheckData{
+		StageID:         1,
+		RaceID:          1,
+		StageLength:     200,
+		TrackLength:     pgtype.Float8{Float64: trackLength, Valid: true},
+		ElevationPoints: 100,
+	}
+}
+
+func TestExpectedClassifications(t *testing.T) {
+	expected := validation.ExpectedClassifications([]db.CheckedResult{
+		result(db.ClassificationStage, 1, 0),
+		result(db.ClassificationPoints, 1, 0),
+		result(db.ClassificationPoints, 2, 0),
+	})
+	want := []db.Classification{
+		db.ClassificationStage, db.ClassificationGC, db.ClassificationPoints,
+	}
+	if len(expected) != len(want) {
+		t.Fatalf("expected %v, got %v", want, expected)
+	}
+	for i := range want {
+		if expected[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, expected)
+		}
+	}
+}
+
+func TestValidateStagePasses(t *testing.T) {
+	results := map[db.Classification][]db.CheckedResult{
+		db.ClassificationStage: {
+			result(db.ClassificationStage, 1, 300),
+			result(db.ClassificationStage, 2, 300),
+			result(db.ClassificationStage, 2, 300),
+			result(db.ClassificationStage, 4, 301),
+		},
+		db.ClassificationGC: {
+			result(db.ClassificationGC, 1, 300),
+			result(db.ClassificationGC, 2, 302),
+		},
+		// Points are ranked by points, not time
+		db.ClassificationPoints: {
+			result(db.ClassificationPoints, 1, 0),
+			result(db.ClassificationPoints, 2, 0),
+		},
+	}
+	expected := []db.Classification{
+		db.ClassificationStage, db.ClassificationGC, db.ClassificationPoints,
+	}
+
+	report := validation.ValidateStage(
+		testStage(215), results, expected, validation.DefaultConfig(),
+	)
+	if !report.Passed || len(report.Problems) != 0 {
+		t.Errorf("expected the stage to pass, got %+v", report.Problems)
+	}
+}
+
+func TestValidateStageFails(t *testing.T) {
+	results := map[db.Classification][]db.CheckedResult{
+		db.ClassificationStage: {
+			result(db.ClassificationStage, 1, 300),
+			result(db.ClassificationStage, 3, 299),
+		},
+	}
+	stage := testStage(250)
+	stage.ElevationPoints = 0
+	expected := []db.Classification{
+		db.ClassificationStage, db.ClassificationGC,
+	}
+
+	report := validation.ValidateStage(
+		stage, results, expected, validation.DefaultConfig(),
+	)
+	want := []validation.Problem{
+		{
+			Check: validation.CheckTrackLength,
+			Message: "track is 250.0 km long, 25% off the stage length of " +
+				"200.0 km",
+		},
+		{
+			Check:   validation.CheckElevation,
+			Message: "track has no elevation profile",
+		},
+		{
+			Check:   validation.CheckClassifications,
+			Message: "no valid general results",
+		},
+		{
+			Check:   validation.CheckRanks,
+			Message: "stage ranks jump from 1 to 3",
+		},
+		{
+			Check:   validation.CheckTimes,
+			Message: "stage rank 3 (4:59:00) is faster than rank 1 (5:00:00)",
+		},
+	}
+	if report.Passed {
+		t.Errorf("expected the stage to fail")
+	}
+	if len(report.Problems) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, report.Problems)
+	}
+	for i := range want {
+		if report.Problems[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], report.Problems[i])
+		}
+	}
+}
+
+func TestValidateStageWithoutTrack(t *testing.T) {
+	stage := testStage(0)
+	stage.TrackLength = pgtype.Float8{}
+	stage.ElevationPoints = 0
+
+	report := validation.ValidateStage(
+		stage, nil, nil, validation.DefaultConfig(),
+	)
+	if len(report.Problems) != 1 ||
+		report.Problems[0].Check != validation.CheckTrack {
+		t.Errorf("expected only a missing track, got %+v", report.Problems)
+	}
+}
@@ -115,6 +115,18 @@ CREATE TYPE racedata.stagetype AS ENUM (
 );
 
 
+--
+-- Name: refresh_elevation(); Type: FUNCTION; Schema: geog; Owner: -
+--
+
+CREATE FUNCTION geog.refresh_elevation() RETURNS void
+    LANGUAGE sql SECURITY DEFINER
+    SET search_path TO 'geog', 'pg_temp'
+    AS $$
+    REFRESH MATERIALIZED VIEW CONCURRENTLY geog.elevation;
+$$;
+
+
 --
 -- Name: get_children(text, text); Type: FUNCTION; Schema: public; Owner: -
 --
@@ -194,6 +206,25 @@ CREATE FUNCTION racedata.get_random_stage_id() RETURNS bigint
 $$;
 
 
+--
+-- Name: get_random_valid_stage_id(); Type: FUNCTION; Schema: racedata; Owner: -
+--
+
+CREATE FUNCTION racedata.get_random_valid_stage_id() RETURNS bigint
+    LANGUAGE sql
+    AS $$
+    SELECT s.stage_id
+    FROM racedata.stages s
+    WHERE NOT EXISTS (
+        SELECT 1
+        FROM racedata.stage_validation v
+        WHERE v.stage_id = s.stage_id AND NOT v.passed
+    )
+    ORDER BY random()
+    LIMIT 1;
+$$;
+
+
 SET default_tablespace = '';
 
 SET default_table_access_method = heap;
@@ -268,6 +299,26 @@ CREATE TABLE geog.tracks (
 );
 
 
+--
+-- Name: tracks_track_id_seq; Type: SEQUENCE; Schema: geog; Owner: -
+--
+
+CREATE SEQUENCE geog.tracks_track_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: tracks_track_id_seq; Type: SEQUENCE OWNED BY; Schema: geog; Owner: -
+--
+
+ALTER SEQUENCE geog.tracks_track_id_seq OWNED BY geog.tracks.track_id;
+
+
 --
 -- Name: schema_migrations; Type: TABLE; Schema: migrations; Owner: -
 --
@@ -277,6 +328,41 @@ CREATE TABLE migrations.schema_migrations (
 );
 
 
+--
+-- Name: audit_log; Type: TABLE; Schema: racedata; Owner: -
+--
+
+CREATE TABLE racedata.audit_log (
+    audit_id integer NOT NULL,
+    changed_at timestamp with time zone DEFAULT now() NOT NULL,
+    actor text NOT NULL,
+    action text NOT NULL,
+    entity text NOT NULL,
+    entity_id integer NOT NULL,
+    payload jsonb
+);
+
+
+--
+-- Name: audit_log_audit_id_seq; Type: SEQUENCE; Schema: racedata; Owner: -
+--
+
+CREATE SEQUENCE racedata.audit_log_audit_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: audit_log_audit_id_seq; Type: SEQUENCE OWNED BY; Schema: racedata; Owner: -
+--
+
+ALTER SEQUENCE racedata.audit_log_audit_id_seq OWNED BY racedata.audit_log.audit_id;
+
+
 --
 -- Name: daily; Type: TABLE; Schema: racedata; Owner: -
 --
@@ -319,6 +405,38 @@ CREATE TABLE racedata.races (
 );
 
 
+--
+-- Name: races_race_id_seq; Type: SEQUENCE; Schema: racedata; Owner: -
+--
+
+CREATE SEQUENCE racedata.races_race_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: races_race_id_seq; Type: SEQUENCE OWNED BY; Schema: racedata; Owner: -
+--
+
+ALTER SEQUENCE racedata.races_race_id_seq OWNED BY racedata.races.race_id;
+
+
+--
+-- Name: stage_validation; Type: TABLE; Schema: racedata; Owner: -
+--
+
+CREATE TABLE racedata.stage_validation (
+    stage_id integer NOT NULL,
+    passed boolean NOT NULL,
+    problems jsonb DEFAULT '[]'::jsonb NOT NULL,
+    checked_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: stages; Type: TABLE; Schema: racedata; Owner: -
 --
@@ -336,6 +454,26 @@ CREATE TABLE racedata.stages (
 );
 
 
+--
+-- Name: stages_stage_id_seq; Type: SEQUENCE; Schema: racedata; Owner: -
+--
+
+CREATE SEQUENCE racedata.stages_stage_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: stages_stage_id_seq; Type: SEQUENCE OWNED BY; Schema: racedata; Owner: -
+--
+
+ALTER SEQUENCE racedata.stages_stage_id_seq OWNED BY racedata.stages.stage_id;
+
+
 --
 -- Name: races_stages; Type: VIEW; Schema: racedata; Owner: -
 --
@@ -442,6 +580,37 @@ CREATE TABLE racedata.riders (
 );
 
 
+--
+-- Name: riders_rider_id_seq; Type: SEQUENCE; Schema: racedata; Owner: -
+--
+
+CREATE SEQUENCE racedata.riders_rider_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: riders_rider_id_seq; Type: SEQUENCE OWNED BY; Schema: racedata; Owner: -
+--
+
+ALTER SEQUENCE racedata.riders_rider_id_seq OWNED BY racedata.riders.rider_id;
+
+
+--
+-- Name: team_names; Type: TABLE; Schema: racedata; Owner: -
+--
+
+CREATE TABLE racedata.team_names (
+    team_id integer NOT NULL,
+    year integer NOT NULL,
+    name text NOT NULL
+);
+
+
 --
 -- Name: teams; Type: TABLE; Schema: racedata; Owner: -
 --
@@ -452,6 +621,26 @@ CREATE TABLE racedata.teams (
 );
 
 
+--
+-- Name: teams_team_id_seq; Type: SEQUENCE; Schema: racedata; Owner: -
+--
+
+CREATE SEQUENCE racedata.teams_team_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: teams_team_id_seq; Type: SEQUENCE OWNED BY; Schema: racedata; Owner: -
+--
+
+ALTER SEQUENCE racedata.teams_team_id_seq OWNED BY racedata.teams.team_id;
+
+
 --
 -- Name: riders_teams_results; Type: VIEW; Schema: racedata; Owner: -
 --
@@ -466,7 +655,9 @@ CREATE VIEW racedata.riders_teams_results AS
     t.name AS team,
     rv."time",
     rv.points,
-    rv.classification
+    rv.classification,
+    rv.rider_id,
+    rv.team_id
    FROM ((racedata.results_valid rv
      LEFT JOIN racedata.riders r ON ((rv.rider_id = r.rider_id)))
      LEFT JOIN racedata.teams t ON ((rv.team_id = t.team_id)));
@@ -491,6 +682,20 @@ CREATE VIEW racedata.stages_elevation AS
 ALTER TABLE ONLY geog.track_points ALTER COLUMN ogc_fid SET DEFAULT nextval('geog.track_points_ogc_fid_seq'::regclass);
 
 
+--
+-- Name: tracks track_id; Type: DEFAULT; Schema: geog; Owner: -
+--
+
+ALTER TABLE ONLY geog.tracks ALTER COLUMN track_id SET DEFAULT nextval('geog.tracks_track_id_seq'::regclass);
+
+
+--
+-- Name: audit_log audit_id; Type: DEFAULT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.audit_log ALTER COLUMN audit_id SET DEFAULT nextval('racedata.audit_log_audit_id_seq'::regclass);
+
+
 --
 -- Name: daily daily_id; Type: DEFAULT; Schema: racedata; Owner: -
 --
@@ -498,6 +703,13 @@ ALTER TABLE ONLY geog.track_points ALTER COLUMN ogc_fid SET DEFAULT nextval('geo
 ALTER TABLE ONLY racedata.daily ALTER COLUMN daily_id SET DEFAULT nextval('racedata.daily_daily_id_seq'::regclass);
 
 
+--
+-- Name: races race_id; Type: DEFAULT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.races ALTER COLUMN race_id SET DEFAULT nextval('racedata.races_race_id_seq'::regclass);
+
+
 --
 -- Name: results result_id; Type: DEFAULT; Schema: racedata; Owner: -
 --
@@ -505,6 +717,27 @@ ALTER TABLE ONLY racedata.daily ALTER COLUMN daily_id SET DEFAULT nextval('raced
 ALTER TABLE ONLY racedata.results ALTER COLUMN result_id SET DEFAULT nextval('racedata.results_result_id_seq'::regclass);
 
 
+--
+-- Name: riders rider_id; Type: DEFAULT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.riders ALTER COLUMN rider_id SET DEFAULT nextval('racedata.riders_rider_id_seq'::regclass);
+
+
+--
+-- Name: stages stage_id; Type: DEFAULT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.stages ALTER COLUMN stage_id SET DEFAULT nextval('racedata.stages_stage_id_seq'::regclass);
+
+
+--
+-- Name: teams team_id; Type: DEFAULT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.teams ALTER COLUMN team_id SET DEFAULT nextval('racedata.teams_team_id_seq'::regclass);
+
+
 --
 -- Name: track_points track_points_pkey; Type: CONSTRAINT; Schema: geog; Owner: -
 --
@@ -529,6 +762,22 @@ ALTER TABLE ONLY migrations.schema_migrations
     ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
 
 
+--
+-- Name: audit_log audit_log_pkey; Type: CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.audit_log
+    ADD CONSTRAINT audit_log_pkey PRIMARY KEY (audit_id);
+
+
+--
+-- Name: daily daily_date_key; Type: CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.daily
+    ADD CONSTRAINT daily_date_key UNIQUE (date);
+
+
 --
 -- Name: daily daily_pkey; Type: CONSTRAINT; Schema: racedata; Owner: -
 --
@@ -561,6 +810,14 @@ ALTER TABLE ONLY racedata.riders
     ADD CONSTRAINT riders_pkey PRIMARY KEY (rider_id);
 
 
+--
+-- Name: stage_validation stage_validation_pkey; Type: CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.stage_validation
+    ADD CONSTRAINT stage_validation_pkey PRIMARY KEY (stage_id);
+
+
 --
 -- Name: stages stages_gpx_id_key; Type: CONSTRAINT; Schema: racedata; Owner: -
 --
@@ -577,6 +834,14 @@ ALTER TABLE ONLY racedata.stages
     ADD CONSTRAINT stages_pkey PRIMARY KEY (stage_id);
 
 
+--
+-- Name: team_names team_names_pkey; Type: CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.team_names
+    ADD CONSTRAINT team_names_pkey PRIMARY KEY (team_id, year);
+
+
 --
 -- Name: teams teams_pkey; Type: CONSTRAINT; Schema: racedata; Owner: -
 --
@@ -614,10 +879,10 @@ CREATE INDEX tracks_the_geog_geom_idx ON geog.tracks USING gist (the_geom);
 
 
 --
--- Name: daily_date_idx; Type: INDEX; Schema: racedata; Owner: -
+-- Name: audit_log_entity_idx; Type: INDEX; Schema: racedata; Owner: -
 --
 
-CREATE INDEX daily_date_idx ON racedata.daily USING btree (date);
+CREATE INDEX audit_log_entity_idx ON racedata.audit_log USING btree (entity, entity_id);
 
 
 --
@@ -674,6 +939,14 @@ ALTER TABLE ONLY racedata.results
     ADD CONSTRAINT results_team_id_fkey FOREIGN KEY (team_id) REFERENCES racedata.teams(team_id);
 
 
+--
+-- Name: stage_validation stage_validation_stage_id_fkey; Type: FK CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.stage_validation
+    ADD CONSTRAINT stage_validation_stage_id_fkey FOREIGN KEY (stage_id) REFERENCES racedata.stages(stage_id) ON DELETE CASCADE;
+
+
 --
 -- Name: stages stages_gpx_id_fkey; Type: FK CONSTRAINT; Schema: racedata; Owner: -
 --
@@ -690,6 +963,14 @@ ALTER TABLE ONLY racedata.stages
     ADD CONSTRAINT stages_race_id_fkey FOREIGN KEY (race_id) REFERENCES racedata.races(race_id);
 
 
+--
+-- Name: team_names team_names_team_id_fkey; Type: FK CONSTRAINT; Schema: racedata; Owner: -
+--
+
+ALTER TABLE ONLY racedata.team_names
+    ADD CONSTRAINT team_names_team_id_fkey FOREIGN KEY (team_id) REFERENCES racedata.teams(team_id) ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -729,4 +1010,13 @@ INSERT INTO migrations.schema_migrations (version) VALUES
     ('20241030213402'),
     ('20241030215240'),
     ('20241031205705'),
-    ('20241111112453');
+    ('20241111112453'),
+    ('20241115093000'),
+    ('20241118201500'),
+    ('20241122104500'),
+    ('20241126090000'),
+    ('20241129100000'),
+    ('20241203090000'),
+    ('20241204090000'),
+    ('20241205090000'),
+    ('20241206090000');
@@ -7,7 +7,8 @@ import {
   NewInfoData,
   Info,
   InfoData,
-  DailyStage
+  DailyStage,
+  StagePage
 } from './types';
 
 export class APIClient {
@@ -16,6 +17,7 @@ export class APIClient {
   private version: string;
 
   private static StagesSegment = '/stages';
+  private static StagesPageLimit = 500;
 
   constructor(host: string, baseURL: string, version: string) {
     this.host = host;
@@ -59,8 +61,25 @@ export class APIClient {
     return this.getDailyStage().then(dailyStage => dailyStage.stage_id);
   }
 
+  async getStagePage(cursor: string | null = null): Promise<StagePage> {
+    const params = new URLSearchParams({
+      limit: APIClient.StagesPageLimit.toString(),
+    });
+    if (cursor !== null) {
+      params.set('cursor', cursor);
+    }
+    return this.fetchJSON(`${APIClient.StagesSegment}?${params.toString()}`);
+  }
+
   async getAllStageIDs(): Promise<number[]> {
-    return this.fetchJSON(APIClient.StagesSegment);
+    const stageIDs: number[] = [];
+    let cursor: string | null = null;
+    do {
+      const page: StagePage = await this.getStagePage(cursor);
+      stageIDs.push(...page.stages.map((stage) => stage.stage_id));
+      cursor = page.next_cursor;
+    } while (cursor !== null);
+    return stageIDs;
   }
 
   async getStageLength(
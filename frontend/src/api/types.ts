@@ -37,6 +37,16 @@ export interface Info {
   stage_length: number;
 }
 
+export interface Stage extends Info {
+  stage_id: number;
+  stage_type: string;
+}
+
+export interface StagePage {
+  stages: Stage[];
+  next_cursor: string | null;
+}
+
 export type InfoType = Exclude<keyof Info, 'stage_length'>;
 
 export type ClassificationEnum = (